@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"syscall"
 	"time"
 
+	"kv_db/internal/database"
 	"kv_db/internal/network"
 )
 
@@ -22,10 +24,20 @@ func main() {
 func run() error {
 	address := flag.String("address", "localhost:3223", "Address of the kv_db")
 	idleTimeout := flag.Duration("idle_timeout", time.Minute, "Idle timeout for connection")
+	slotRouting := flag.Bool("slot_routing", false, "Send keys to the nodes of their slots")
 	flag.Parse()
 
+	var options []network.TCPClientOption
+	if *slotRouting {
+		options = append(options, network.WithSlotRouting(network.SlotRouting{
+			Slot:       database.QuerySlot,
+			SlotsQuery: database.SlotsCommand,
+			ParseSlots: database.ParseSlots,
+		}))
+	}
+
 	reader := bufio.NewReader(os.Stdin)
-	client, err := network.NewTCPClient(*address, *idleTimeout)
+	client, err := network.NewTCPClient(*address, *idleTimeout, options...)
 	if err != nil {
 		return err
 	}
@@ -41,10 +53,38 @@ func run() error {
 		}
 
 		response, err := client.Send([]byte(request))
+		if errors.Is(err, database.ErrSessionRouting) {
+			fmt.Printf("[error] %s\n", err.Error()) // nolint:forbidigo
+			continue
+		}
 		if err != nil {
 			return err
 		}
 
 		fmt.Println(string(response)) // nolint:forbidigo
+
+		// A subscribed connection only gets messages until the client is
+		// stopped.
+		if isSubscription(request) && strings.HasPrefix(string(response), "[ok]") {
+			return receive(client)
+		}
+	}
+}
+
+func isSubscription(request string) bool {
+	fields := strings.Fields(request)
+	return len(fields) != 0 &&
+		(fields[0] == database.SubscribeCommand || fields[0] == database.PSubscribeCommand ||
+			fields[0] == database.WatchCommand)
+}
+
+func receive(client *network.TCPClient) error {
+	for {
+		message, err := client.Receive()
+		if err != nil {
+			return fmt.Errorf("connection was closed: %w", err)
+		}
+
+		fmt.Println(string(message)) // nolint:forbidigo
 	}
 }
@@ -39,6 +39,7 @@ func main() {
 		logger.With(slog.String("layer", "database")),
 	)
 
+	session := db.NewSession()
 	for {
 		fmt.Println("input command:")
 		scanner := bufio.NewScanner(os.Stdin)
@@ -47,7 +48,7 @@ func main() {
 			fmt.Println(err)
 		}
 
-		res := db.HandleQuery(context.Background(), scanner.Text())
+		res := session.HandleQuery(context.Background(), scanner.Text())
 		fmt.Printf("result: %s\n", res)
 	}
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"kv_db/internal/network"
+	"kv_db/internal/proxy"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	address := flag.String("address", "localhost:3224", "Address of the proxy")
+	backends := flag.String("backends", "localhost:3223", "Comma-separated addresses of the kv_db backends")
+	maxConnections := flag.Int("max_connections", 100, "Max number of client connections")
+	idleTimeout := flag.Duration("idle_timeout", 5*time.Minute, "Idle timeout for connections")
+	poolSize := flag.Int("pool_size", 10, "Number of idle connections to every backend")
+	backendIdleTimeout := flag.Duration("backend_idle_timeout", 5*time.Minute, "Idle timeout of the backends")
+	flag.Parse()
+
+	if *backends == "" {
+		return errors.New("backends are not set")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	shardingProxy, err := proxy.NewProxy(
+		strings.Split(*backends, ","), *idleTimeout, logger.With(slog.String("layer", "proxy")),
+		proxy.WithPoolSize(*poolSize),
+		proxy.WithBackendIdleTimeout(*backendIdleTimeout),
+	)
+	if err != nil {
+		return err
+	}
+	defer shardingProxy.Close()
+
+	server, err := network.NewTCPServer(
+		*address, *maxConnections, *idleTimeout, logger.With(slog.String("layer", "server")),
+	)
+	if err != nil {
+		return err
+	}
+
+	return server.HandleQueries(ctx, shardingProxy.HandleQuery)
+}
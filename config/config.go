@@ -3,18 +3,81 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Engine  EngineConfig  `yaml:"engine"`
-	Network NetworkConfig `yaml:"network"`
-	Logging LoggingConfig `yaml:"logging"`
+	Engine      EngineConfig       `yaml:"engine"`
+	WAL         *WALConfig         `yaml:"wal"`
+	Snapshot    *SnapshotConfig    `yaml:"snapshot"`
+	Replication *ReplicationConfig `yaml:"replication"`
+	Cluster     *ClusterConfig     `yaml:"cluster"`
+	Sharding    *ShardingConfig    `yaml:"sharding"`
+	PubSub      PubSubConfig       `yaml:"pubsub"`
+	Network     NetworkConfig      `yaml:"network"`
+	Logging     LoggingConfig      `yaml:"logging"`
 }
 
 type EngineConfig struct {
-	Type string `yaml:"type"`
+	Type                string        `yaml:"type"`
+	Databases           int           `yaml:"databases"`
+	Shards              int           `yaml:"shards"`
+	DataDirectory       string        `yaml:"data_directory"`
+	MemtableSize        string        `yaml:"memtable_size"`
+	BlockSize           string        `yaml:"block_size"`
+	CompactionThreshold int           `yaml:"compaction_threshold"`
+	SweepInterval       time.Duration `yaml:"sweep_interval"`
+	MaxMemory           string        `yaml:"max_memory"`
+	EvictionPolicy      string        `yaml:"eviction_policy"`
+}
+
+type WALConfig struct {
+	FlushingBatchSize    int           `yaml:"flushing_batch_size"`
+	FlushingBatchTimeout time.Duration `yaml:"flushing_batch_timeout"`
+	MaxSegmentSize       string        `yaml:"max_segment_size"`
+	DataDirectory        string        `yaml:"data_directory"`
+	Fsync                *bool         `yaml:"fsync"`
+}
+
+type SnapshotConfig struct {
+	Interval      time.Duration `yaml:"interval"`
+	DataDirectory string        `yaml:"data_directory"`
+}
+
+type ReplicationConfig struct {
+	MasterAddress string `yaml:"master_address"`
+	BacklogSize   int    `yaml:"backlog_size"`
+}
+
+type ClusterConfig struct {
+	NodeID            string              `yaml:"node_id"`
+	Nodes             []ClusterNodeConfig `yaml:"nodes"`
+	ElectionTimeout   time.Duration       `yaml:"election_timeout"`
+	HeartbeatInterval time.Duration       `yaml:"heartbeat_interval"`
+	DataDirectory     string              `yaml:"data_directory"`
+	SnapshotThreshold uint64              `yaml:"snapshot_threshold"`
+}
+
+type ClusterNodeConfig struct {
+	ID      string `yaml:"id"`
+	Address string `yaml:"address"`
+}
+
+type ShardingConfig struct {
+	Address string               `yaml:"address"`
+	Nodes   []ShardingNodeConfig `yaml:"nodes"`
+}
+
+type ShardingNodeConfig struct {
+	Address string `yaml:"address"`
+	Slots   string `yaml:"slots"`
+}
+
+type PubSubConfig struct {
+	BufferSize     int  `yaml:"buffer_size"`
+	KeyspaceEvents bool `yaml:"keyspace_events"`
 }
 
 type NetworkConfig struct {
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -56,6 +57,36 @@ func TestLoad(t *testing.T) {
 		require.NoError(t, err)
 
 		require.Equal(t, "in_memory", cfg.Engine.Type)
+		require.Equal(t, 16, cfg.Engine.Databases)
+		require.Equal(t, 16, cfg.Engine.Shards)
+		require.Equal(t, "/data/kv_db/lsm", cfg.Engine.DataDirectory)
+		require.Equal(t, "4MB", cfg.Engine.MemtableSize)
+		require.Equal(t, "4KB", cfg.Engine.BlockSize)
+		require.Equal(t, 4, cfg.Engine.CompactionThreshold)
+		require.Equal(t, 100*time.Millisecond, cfg.Engine.SweepInterval)
+		require.Equal(t, "1GB", cfg.Engine.MaxMemory)
+		require.Equal(t, "noeviction", cfg.Engine.EvictionPolicy)
+
+		require.NotNil(t, cfg.WAL)
+		require.Equal(t, 100, cfg.WAL.FlushingBatchSize)
+		require.Equal(t, 10*time.Millisecond, cfg.WAL.FlushingBatchTimeout)
+		require.Equal(t, "10MB", cfg.WAL.MaxSegmentSize)
+		require.Equal(t, "/data/kv_db/wal", cfg.WAL.DataDirectory)
+		require.Equal(t, true, *cfg.WAL.Fsync)
+
+		require.NotNil(t, cfg.Snapshot)
+		require.Equal(t, 5*time.Minute, cfg.Snapshot.Interval)
+		require.Equal(t, "/data/kv_db/snapshots", cfg.Snapshot.DataDirectory)
+
+		require.NotNil(t, cfg.Replication)
+		require.Empty(t, cfg.Replication.MasterAddress)
+		require.Equal(t, 10000, cfg.Replication.BacklogSize)
+
+		require.Nil(t, cfg.Cluster)
+		require.Nil(t, cfg.Sharding)
+
+		require.Equal(t, 1000, cfg.PubSub.BufferSize)
+		require.True(t, cfg.PubSub.KeyspaceEvents)
 
 		require.Equal(t, "127.0.0.1:3223", cfg.Network.Address)
 		require.Equal(t, 100, cfg.Network.MaxConnections)
@@ -64,4 +95,64 @@ func TestLoad(t *testing.T) {
 		require.Equal(t, "info", cfg.Logging.Level)
 		require.Equal(t, "/log/output.log", cfg.Logging.Output)
 	})
+	t.Run("cluster", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "cluster_test.yaml")
+		data := `
+cluster:
+  node_id: "node1"
+  nodes:
+    - id: "node1"
+      address: "127.0.0.1:3323"
+    - id: "node2"
+      address: "127.0.0.2:3323"
+  election_timeout: "500ms"
+  heartbeat_interval: "100ms"
+  data_directory: "/data/kv_db/cluster"
+  snapshot_threshold: 10000
+`
+		err := os.WriteFile(src, []byte(data), 0o666)
+		require.NoError(t, err)
+
+		cfg, err := Load(src)
+
+		require.NoError(t, err)
+		require.Equal(t, &ClusterConfig{
+			NodeID: "node1",
+			Nodes: []ClusterNodeConfig{
+				{ID: "node1", Address: "127.0.0.1:3323"},
+				{ID: "node2", Address: "127.0.0.2:3323"},
+			},
+			ElectionTimeout:   500 * time.Millisecond,
+			HeartbeatInterval: 100 * time.Millisecond,
+			DataDirectory:     "/data/kv_db/cluster",
+			SnapshotThreshold: 10000,
+		}, cfg.Cluster)
+	})
+	t.Run("sharding", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "sharding_test.yaml")
+		data := `
+sharding:
+  address: "127.0.0.1:3223"
+  nodes:
+    - address: "127.0.0.1:3223"
+      slots: "0-8191"
+    - address: "127.0.0.2:3223"
+      slots: "8192-16383"
+`
+		err := os.WriteFile(src, []byte(data), 0o666)
+		require.NoError(t, err)
+
+		cfg, err := Load(src)
+
+		require.NoError(t, err)
+		require.Equal(t, &ShardingConfig{
+			Address: "127.0.0.1:3223",
+			Nodes: []ShardingNodeConfig{
+				{Address: "127.0.0.1:3223", Slots: "0-8191"},
+				{Address: "127.0.0.2:3223", Slots: "8192-16383"},
+			},
+		}, cfg.Sharding)
+	})
 }
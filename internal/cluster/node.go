@@ -0,0 +1,1014 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"kv_db/internal/database/storage"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dlog"
+)
+
+const (
+	defaultElectionTimeout   = 500 * time.Millisecond
+	defaultHeartbeatInterval = 100 * time.Millisecond
+	defaultProposeTimeout    = 2 * time.Second
+	defaultSnapshotThreshold = 10000
+
+	// maxAppendEntries is the number of entries that a single AppendEntries
+	// carries, so a lagging follower catches up in requests of a limited
+	// size.
+	maxAppendEntries = 100
+	// maxSnapshotLogs is the number of logs that a single InstallSnapshot
+	// carries.
+	maxSnapshotLogs = 1000
+)
+
+var (
+	ErrNoLeader = errors.New("cluster has no leader")
+	// ErrProposalLost is returned when a leader loses its leadership before
+	// the proposal is committed and another entry takes its place.
+	ErrProposalLost = errors.New("proposal is lost by a leader change")
+	// ErrProposalUnknown is returned when the entry of a proposal is
+	// compacted into a snapshot before its commit is checked, and the
+	// snapshot doesn't tell whether it has the entry.
+	ErrProposalUnknown = errors.New("proposal outcome is unknown")
+
+	errNotLeader = errors.New("node isn't the leader")
+)
+
+// StateMachine applies the committed logs in the order of the Raft log.
+type StateMachine interface {
+	ApplyChanges(context.Context, storage.Changes) error
+	// SnapshotLogs returns logs that recreate the current state.
+	SnapshotLogs(context.Context) ([]wal.Log, error)
+}
+
+// Transport sends Raft requests to other nodes by their addresses.
+type Transport interface {
+	RequestVote(ctx context.Context, address string, request VoteRequest) (VoteResponse, error)
+	AppendEntries(ctx context.Context, address string, request AppendRequest) (AppendResponse, error)
+	InstallSnapshot(ctx context.Context, address string, request SnapshotRequest) (SnapshotResponse, error)
+	// Propose proposes the log to the leader and returns its index.
+	Propose(ctx context.Context, address string, log wal.Log) (uint64, error)
+}
+
+type VoteRequest struct {
+	Term         uint64
+	CandidateID  string
+	LastLogIndex uint64
+	LastLogTerm  uint64
+}
+
+type VoteResponse struct {
+	Term    uint64
+	Granted bool
+}
+
+type AppendRequest struct {
+	Term         uint64
+	LeaderID     string
+	PrevLogIndex uint64
+	PrevLogTerm  uint64
+	LeaderCommit uint64
+	Entries      []Entry
+}
+
+// AppendResponse has the last index of the entries that match the leader on
+// success and the index the leader should continue from otherwise.
+type AppendResponse struct {
+	Term    uint64
+	Success bool
+	Index   uint64
+}
+
+// SnapshotRequest carries a chunk of the logs of a snapshot, which starts at
+// the offset among the logs. The last chunk is done.
+type SnapshotRequest struct {
+	Term         uint64
+	LeaderID     string
+	Index        uint64
+	SnapshotTerm uint64
+	Offset       uint64
+	Done         bool
+	Logs         []wal.Log
+}
+
+type SnapshotResponse struct {
+	Term    uint64
+	Success bool
+}
+
+// Entry is an entry of the Raft log. Leaders append an entry without a
+// command at the start of their term, so the entries of previous terms get
+// committed without waiting for a new proposal.
+type Entry struct {
+	Term    uint64
+	Command *wal.Log
+}
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+func (r role) String() string {
+	return [...]string{"follower", "candidate", "leader"}[r]
+}
+
+type NodeOption func(*Node)
+
+func WithElectionTimeout(timeout time.Duration) NodeOption {
+	return func(node *Node) {
+		node.electionTimeout = timeout
+	}
+}
+
+func WithHeartbeatInterval(interval time.Duration) NodeOption {
+	return func(node *Node) {
+		node.heartbeatInterval = interval
+	}
+}
+
+// WithProposeTimeout sets the longest time a proposal waits for the commit.
+func WithProposeTimeout(timeout time.Duration) NodeOption {
+	return func(node *Node) {
+		node.proposeTimeout = timeout
+	}
+}
+
+// WithStore persists the state of the node in the store, which is loaded by
+// NewNode. Without a store, a restarted node rejoins with an empty log and
+// gets the whole state from the leader.
+func WithStore(store Store) NodeOption {
+	return func(node *Node) {
+		node.store = store
+	}
+}
+
+// WithSnapshotThreshold sets the number of applied entries after which the
+// state machine is snapshotted and the log is compacted.
+func WithSnapshotThreshold(threshold uint64) NodeOption {
+	return func(node *Node) {
+		node.snapshotThreshold = threshold
+	}
+}
+
+// Node is a member of a Raft cluster. It elects a leader together with the
+// other members, and the leader replicates proposed logs to them. A log is
+// applied to the state machines of the nodes after a majority has it.
+//
+// The term and the vote are persisted before the node answers with them, and
+// entries are persisted before they are acknowledged. Persistence happens
+// under the mutex of the node, so a slow store slows down the whole node.
+// The applied entries are compacted into a snapshot of the state machine
+// from time to time, and the leader sends the snapshot to a follower that
+// needs compacted entries.
+type Node struct {
+	id                string
+	peers             map[string]string
+	transport         Transport
+	store             Store
+	electionTimeout   time.Duration
+	heartbeatInterval time.Duration
+	proposeTimeout    time.Duration
+	snapshotThreshold uint64
+	logger            *slog.Logger
+
+	// snapshotMutex serializes snapshots, so an older snapshot never replaces
+	// a newer one. It's locked before the mutex.
+	snapshotMutex sync.Mutex
+
+	mutex    sync.Mutex
+	role     role
+	term     uint64
+	votedFor string
+	leaderID string
+	// entries start with the entry at the offset, which is the last entry of
+	// the snapshot or the sentinel of an empty log, so the indexes of the log
+	// start at 1.
+	entries       []Entry
+	offset        uint64
+	snapshotIndex uint64
+	// restore is the snapshot that the applier applies before the entries
+	// that follow it.
+	restore *Snapshot
+	// installing collects the chunks of a snapshot of the leader.
+	installing   *Snapshot
+	commitIndex  uint64
+	lastApplied  uint64
+	nextIndex    map[string]uint64
+	matchIndex   map[string]uint64
+	lastContact  time.Time
+	timeout      time.Duration
+	changed      chan struct{}
+	replicateNow chan struct{}
+}
+
+// NewNode creates the member with the ID of a cluster, whose members are
+// given by their IDs and Raft addresses, and loads its persisted state.
+func NewNode(
+	id string, members map[string]string, transport Transport, logger *slog.Logger, options ...NodeOption,
+) (*Node, error) {
+	if _, ok := members[id]; !ok || id == "" {
+		return nil, errors.New("cluster node id is invalid")
+	}
+
+	if transport == nil {
+		return nil, errors.New("cluster transport is invalid")
+	}
+
+	if logger == nil {
+		return nil, errors.New("cluster logger is invalid")
+	}
+
+	node := &Node{
+		id:                id,
+		peers:             make(map[string]string, len(members)-1),
+		transport:         transport,
+		electionTimeout:   defaultElectionTimeout,
+		heartbeatInterval: defaultHeartbeatInterval,
+		proposeTimeout:    defaultProposeTimeout,
+		snapshotThreshold: defaultSnapshotThreshold,
+		logger:            logger,
+		nextIndex:         make(map[string]uint64),
+		matchIndex:        make(map[string]uint64),
+		changed:           make(chan struct{}),
+		replicateNow:      make(chan struct{}),
+	}
+	for memberID, address := range members {
+		if address == "" {
+			return nil, fmt.Errorf("cluster address of node %s is invalid", memberID)
+		}
+		if memberID != id {
+			node.peers[memberID] = address
+		}
+	}
+	for _, option := range options {
+		option(node)
+	}
+
+	if node.electionTimeout <= 0 {
+		return nil, errors.New("cluster election timeout is invalid")
+	}
+
+	if node.heartbeatInterval <= 0 || node.heartbeatInterval >= node.electionTimeout {
+		return nil, errors.New("cluster heartbeat interval is invalid")
+	}
+
+	if node.proposeTimeout <= 0 {
+		return nil, errors.New("cluster propose timeout is invalid")
+	}
+
+	if node.snapshotThreshold == 0 {
+		return nil, errors.New("cluster snapshot threshold is invalid")
+	}
+
+	if node.store == nil {
+		node.store = &memoryStore{}
+	}
+	if err := node.load(); err != nil {
+		return nil, err
+	}
+
+	node.resetElectionTimer()
+	return node, nil
+}
+
+// load restores the persisted state. The snapshot is applied by the applier
+// first, and the entries that follow it are applied after the leader tells
+// that they are committed.
+func (n *Node) load() error {
+	state, err := n.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load cluster state: %w", err)
+	}
+
+	n.term, n.votedFor = state.Term, state.VotedFor
+	n.entries = append([]Entry{{Term: state.Snapshot.Term}}, state.Entries...)
+	n.offset, n.snapshotIndex = state.Snapshot.Index, state.Snapshot.Index
+	n.commitIndex, n.lastApplied = state.Snapshot.Index, state.Snapshot.Index
+	if state.Snapshot.Index != 0 {
+		n.restore = &state.Snapshot
+	}
+	return nil
+}
+
+// Start takes part in elections, replicates the log while the node is the
+// leader and applies committed logs to the state machine until the context
+// is done.
+func (n *Node) Start(ctx context.Context, machine StateMachine) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		n.runElections(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		n.runApplier(ctx, machine)
+	}()
+
+	for peerID := range n.peers {
+		peerID := peerID
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.runReplication(ctx, peerID)
+		}()
+	}
+}
+
+// Propose returns after the log is committed and applied to the state
+// machine of this node. A follower forwards the log to the leader.
+func (n *Node) Propose(ctx context.Context, log wal.Log) error {
+	ctx, cancel := context.WithTimeout(ctx, n.proposeTimeout)
+	defer cancel()
+
+	index, term, err := n.appendLog(log)
+	if errors.Is(err, errNotLeader) {
+		index, err = n.forward(ctx, log)
+		term = 0
+	}
+	if err != nil {
+		return err
+	}
+
+	return n.waitApplied(ctx, index, term)
+}
+
+// appendLog appends the log if the node is the leader.
+func (n *Node) appendLog(log wal.Log) (uint64, uint64, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.role != leader {
+		return 0, 0, errNotLeader
+	}
+
+	if err := n.appendEntries(n.lastIndex()+1, []Entry{{Term: n.term, Command: &log}}); err != nil {
+		return 0, 0, err
+	}
+	n.notify()
+	if len(n.peers) == 0 {
+		n.advanceCommit()
+	}
+	return n.lastIndex(), n.term, nil
+}
+
+func (n *Node) forward(ctx context.Context, log wal.Log) (uint64, error) {
+	n.mutex.Lock()
+	address, ok := n.peers[n.leaderID]
+	n.mutex.Unlock()
+	if !ok {
+		return 0, ErrNoLeader
+	}
+
+	return n.transport.Propose(ctx, address, log)
+}
+
+// waitApplied waits until the entry with the index is applied. A non-zero
+// term is checked against the term of the applied entry.
+func (n *Node) waitApplied(ctx context.Context, index, term uint64) error {
+	for {
+		n.mutex.Lock()
+		applied, changed := n.lastApplied >= index, n.changed
+		var err error
+		if applied && term != 0 {
+			err = n.checkTerm(index, term)
+		}
+		n.mutex.Unlock()
+
+		if applied {
+			return err
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("proposal isn't committed: %w", ctx.Err())
+		}
+	}
+}
+
+// checkTerm returns an error unless the applied entry with the index has the
+// term. An entry compacted into the snapshot is checked against the last
+// entry of the snapshot: terms grow along the log, and the entries of a term
+// are appended by its leader one after another, so the snapshot has the
+// entry if its last entry has the same term and doesn't have it if the term
+// is older.
+func (n *Node) checkTerm(index, term uint64) error {
+	if index >= n.offset {
+		if n.termAt(index) != term {
+			return ErrProposalLost
+		}
+		return nil
+	}
+
+	switch snapshotTerm := n.termAt(n.offset); {
+	case snapshotTerm == term:
+		return nil
+	case snapshotTerm < term:
+		return ErrProposalLost
+	default:
+		return ErrProposalUnknown
+	}
+}
+
+// HandlePropose appends a log forwarded by a follower and returns its index
+// after it is committed.
+func (n *Node) HandlePropose(ctx context.Context, log wal.Log) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, n.proposeTimeout)
+	defer cancel()
+
+	index, term, err := n.appendLog(log)
+	if errors.Is(err, errNotLeader) {
+		return 0, ErrNoLeader
+	}
+	if err != nil {
+		return 0, err
+	}
+	return index, n.waitApplied(ctx, index, term)
+}
+
+// HandleVote grants the vote to a candidate whose log is at least as up to
+// date as the log of the node, once per term.
+func (n *Node) HandleVote(request VoteRequest) VoteResponse {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if request.Term > n.term {
+		if err := n.becomeFollower(request.Term, ""); err != nil {
+			return VoteResponse{Term: n.term}
+		}
+	}
+	if request.Term < n.term {
+		return VoteResponse{Term: n.term}
+	}
+
+	lastTerm := n.termAt(n.lastIndex())
+	upToDate := request.LastLogTerm > lastTerm ||
+		(request.LastLogTerm == lastTerm && request.LastLogIndex >= n.lastIndex())
+	if (n.votedFor != "" && n.votedFor != request.CandidateID) || !upToDate {
+		return VoteResponse{Term: n.term}
+	}
+
+	if err := n.saveVote(n.term, request.CandidateID); err != nil {
+		return VoteResponse{Term: n.term}
+	}
+	n.resetElectionTimer()
+	return VoteResponse{Term: n.term, Granted: true}
+}
+
+// HandleAppend appends the entries of the leader after the previous entry if
+// the log of the node has it, replacing conflicting entries.
+func (n *Node) HandleAppend(request AppendRequest) AppendResponse {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if request.Term < n.term {
+		return AppendResponse{Term: n.term}
+	}
+	if request.Term > n.term || n.role != follower || n.leaderID != request.LeaderID {
+		if err := n.becomeFollower(request.Term, request.LeaderID); err != nil {
+			return AppendResponse{Term: n.term}
+		}
+	}
+	n.resetElectionTimer()
+
+	match := request.PrevLogIndex + uint64(len(request.Entries))
+	// The entries up to the offset are committed, so they match the leader.
+	if request.PrevLogIndex < n.offset {
+		skip := min(n.offset-request.PrevLogIndex, uint64(len(request.Entries)))
+		request.PrevLogIndex += skip
+		request.Entries = request.Entries[skip:]
+		if request.PrevLogIndex < n.offset {
+			return AppendResponse{Term: n.term, Success: true, Index: match}
+		}
+		request.PrevLogTerm = n.termAt(n.offset)
+	}
+
+	if request.PrevLogIndex > n.lastIndex() {
+		return AppendResponse{Term: n.term, Index: n.lastIndex() + 1}
+	}
+	if n.termAt(request.PrevLogIndex) != request.PrevLogTerm {
+		// The whole conflicting term is skipped at once.
+		index := request.PrevLogIndex
+		for index > n.commitIndex+1 && n.termAt(index-1) == n.termAt(request.PrevLogIndex) {
+			index--
+		}
+		return AppendResponse{Term: n.term, Index: index}
+	}
+
+	// Only the entries from the first one that the log doesn't have are
+	// persisted.
+	for idx, entry := range request.Entries {
+		index := request.PrevLogIndex + 1 + uint64(idx)
+		if index <= n.lastIndex() && n.termAt(index) == entry.Term {
+			continue
+		}
+		if err := n.appendEntries(index, request.Entries[idx:]); err != nil {
+			return AppendResponse{Term: n.term, Index: request.PrevLogIndex + 1}
+		}
+		break
+	}
+
+	if commit := min(request.LeaderCommit, match); commit > n.commitIndex {
+		n.commitIndex = commit
+		n.notify()
+	}
+	return AppendResponse{Term: n.term, Success: true, Index: match}
+}
+
+// Info reports the role of the node, the term, the leader and the indexes of
+// the log.
+func (n *Node) Info(context.Context) map[string]string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return map[string]string{
+		"node_id":        n.id,
+		"role":           n.role.String(),
+		"term":           strconv.FormatUint(n.term, 10),
+		"leader_id":      n.leaderID,
+		"last_index":     strconv.FormatUint(n.lastIndex(), 10),
+		"commit_index":   strconv.FormatUint(n.commitIndex, 10),
+		"last_applied":   strconv.FormatUint(n.lastApplied, 10),
+		"snapshot_index": strconv.FormatUint(n.snapshotIndex, 10),
+	}
+}
+
+func (n *Node) runElections(ctx context.Context) {
+	ticker := time.NewTicker(n.electionTimeout / 10)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n.mutex.Lock()
+		expired := n.role != leader && time.Since(n.lastContact) > n.timeout
+		n.mutex.Unlock()
+		if expired {
+			n.elect(ctx)
+		}
+	}
+}
+
+// elect starts a new term and becomes the leader if a majority votes for it.
+func (n *Node) elect(ctx context.Context) {
+	n.mutex.Lock()
+	n.resetElectionTimer()
+	if err := n.saveVote(n.term+1, n.id); err != nil {
+		n.mutex.Unlock()
+		return
+	}
+	n.role = candidate
+	n.leaderID = ""
+	request := VoteRequest{
+		Term:         n.term,
+		CandidateID:  n.id,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.termAt(n.lastIndex()),
+	}
+	n.notify()
+	n.mutex.Unlock()
+	n.logger.Debug("election is started", slog.Uint64("term", request.Term))
+
+	votes := 1
+	n.mutex.Lock()
+	n.winIfMajority(request.Term, votes)
+	n.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, n.electionTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, address := range n.peers {
+		address := address
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := n.transport.RequestVote(ctx, address, request)
+			if err != nil {
+				return
+			}
+
+			n.mutex.Lock()
+			defer n.mutex.Unlock()
+			if response.Term > n.term {
+				_ = n.becomeFollower(response.Term, "")
+				return
+			}
+			if response.Granted {
+				votes++
+				n.winIfMajority(request.Term, votes)
+			}
+		}()
+	}
+}
+
+// winIfMajority becomes the leader of the term with a majority of votes.
+func (n *Node) winIfMajority(term uint64, votes int) {
+	if n.role != candidate || n.term != term || votes < n.quorum() {
+		return
+	}
+
+	// The node stays a candidate if the entry of its term isn't persisted.
+	if err := n.appendEntries(n.lastIndex()+1, []Entry{{Term: n.term}}); err != nil {
+		return
+	}
+	n.role = leader
+	n.leaderID = n.id
+	for peerID := range n.peers {
+		n.nextIndex[peerID] = n.lastIndex()
+		n.matchIndex[peerID] = 0
+	}
+	if len(n.peers) == 0 {
+		n.advanceCommit()
+	}
+	n.notify()
+	n.logger.Info("node is elected as leader", slog.Uint64("term", term))
+}
+
+func (n *Node) runReplication(ctx context.Context, peerID string) {
+	ticker := time.NewTicker(n.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		n.mutex.Lock()
+		replicateNow := n.replicateNow
+		n.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-replicateNow:
+		}
+
+		n.replicate(ctx, peerID)
+	}
+}
+
+// replicate sends the entries that the peer doesn't have yet, or a heartbeat
+// if it has all of them. A peer that needs compacted entries gets the
+// snapshot instead.
+func (n *Node) replicate(ctx context.Context, peerID string) {
+	n.mutex.Lock()
+	if n.role != leader {
+		n.mutex.Unlock()
+		return
+	}
+
+	next := n.nextIndex[peerID]
+	if next <= n.offset {
+		term := n.term
+		n.mutex.Unlock()
+		n.sendSnapshot(ctx, peerID, term)
+		return
+	}
+
+	end := min(n.lastIndex()+1, next+maxAppendEntries)
+	request := AppendRequest{
+		Term:         n.term,
+		LeaderID:     n.id,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  n.termAt(next - 1),
+		LeaderCommit: n.commitIndex,
+		Entries:      append([]Entry(nil), n.entries[next-n.offset:end-n.offset]...),
+	}
+	n.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, n.electionTimeout)
+	defer cancel()
+	response, err := n.transport.AppendEntries(ctx, n.peers[peerID], request)
+	if err != nil {
+		return
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if response.Term > n.term {
+		_ = n.becomeFollower(response.Term, "")
+		return
+	}
+	if n.role != leader || n.term != request.Term {
+		return
+	}
+
+	if !response.Success {
+		n.nextIndex[peerID] = max(1, min(response.Index, next-1))
+		n.notify()
+		return
+	}
+	if response.Index > n.matchIndex[peerID] {
+		n.matchIndex[peerID] = response.Index
+		n.nextIndex[peerID] = response.Index + 1
+		n.advanceCommit()
+	}
+	if n.nextIndex[peerID] <= n.lastIndex() {
+		n.notify()
+	}
+}
+
+// sendSnapshot sends the snapshot to the peer in chunks of a limited size.
+func (n *Node) sendSnapshot(ctx context.Context, peerID string, term uint64) {
+	snapshot, err := n.store.LoadSnapshot()
+	if err != nil {
+		n.logger.Error("failed to load snapshot", dlog.ErrAttr(err))
+		return
+	}
+
+	for offset := 0; ; {
+		end := min(len(snapshot.Logs), offset+maxSnapshotLogs)
+		request := SnapshotRequest{
+			Term:         term,
+			LeaderID:     n.id,
+			Index:        snapshot.Index,
+			SnapshotTerm: snapshot.Term,
+			Offset:       uint64(offset),
+			Done:         end == len(snapshot.Logs),
+			Logs:         snapshot.Logs[offset:end],
+		}
+
+		requestCtx, cancel := context.WithTimeout(ctx, n.electionTimeout)
+		response, err := n.transport.InstallSnapshot(requestCtx, n.peers[peerID], request)
+		cancel()
+		if err != nil {
+			return
+		}
+
+		n.mutex.Lock()
+		if response.Term > n.term {
+			_ = n.becomeFollower(response.Term, "")
+		}
+		if n.role != leader || n.term != term || !response.Success {
+			n.mutex.Unlock()
+			return
+		}
+		if request.Done {
+			n.matchIndex[peerID] = max(n.matchIndex[peerID], snapshot.Index)
+			n.nextIndex[peerID] = n.matchIndex[peerID] + 1
+			n.advanceCommit()
+			n.notify()
+		}
+		n.mutex.Unlock()
+
+		if request.Done {
+			n.logger.Info("snapshot is sent", slog.String("peer", peerID), slog.Uint64("index", snapshot.Index))
+			return
+		}
+		offset = end
+	}
+}
+
+// HandleSnapshot collects the chunks of a snapshot of the leader and installs
+// it after the last one. The entries that follow the snapshot are kept if the
+// log has the last entry of the snapshot.
+func (n *Node) HandleSnapshot(request SnapshotRequest) SnapshotResponse {
+	n.snapshotMutex.Lock()
+	defer n.snapshotMutex.Unlock()
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if request.Term < n.term {
+		return SnapshotResponse{Term: n.term}
+	}
+	if request.Term > n.term || n.role != follower || n.leaderID != request.LeaderID {
+		if err := n.becomeFollower(request.Term, request.LeaderID); err != nil {
+			return SnapshotResponse{Term: n.term}
+		}
+	}
+	n.resetElectionTimer()
+
+	// The node has the committed entries of the snapshot already.
+	if request.Index <= n.commitIndex {
+		n.installing = nil
+		return SnapshotResponse{Term: n.term, Success: true}
+	}
+
+	if request.Offset == 0 {
+		n.installing = &Snapshot{Index: request.Index, Term: request.SnapshotTerm}
+	}
+	snapshot := n.installing
+	if snapshot == nil || snapshot.Index != request.Index || snapshot.Term != request.SnapshotTerm ||
+		uint64(len(snapshot.Logs)) != request.Offset {
+		return SnapshotResponse{Term: n.term}
+	}
+	snapshot.Logs = append(snapshot.Logs, request.Logs...)
+	if !request.Done {
+		return SnapshotResponse{Term: n.term, Success: true}
+	}
+
+	n.installing = nil
+	var entries []Entry
+	if snapshot.Index <= n.lastIndex() && n.termAt(snapshot.Index) == snapshot.Term {
+		entries = n.entries[snapshot.Index-n.offset+1:]
+	}
+	if err := n.store.SaveSnapshot(*snapshot); err != nil {
+		n.logger.Error("failed to save snapshot", dlog.ErrAttr(err))
+		return SnapshotResponse{Term: n.term}
+	}
+	n.compact(snapshot.Index, snapshot.Term, entries)
+
+	n.commitIndex = snapshot.Index
+	n.restore = snapshot
+	n.notify()
+	n.logger.Info("snapshot is installed", slog.Uint64("index", snapshot.Index))
+	return SnapshotResponse{Term: n.term, Success: true}
+}
+
+// advanceCommit commits the greatest index of the current term that a
+// majority of the nodes has.
+func (n *Node) advanceCommit() {
+	matches := []uint64{n.lastIndex()}
+	for peerID := range n.peers {
+		matches = append(matches, n.matchIndex[peerID])
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i] > matches[j] })
+
+	index := matches[n.quorum()-1]
+	if index > n.commitIndex && n.termAt(index) == n.term {
+		n.commitIndex = index
+		n.notify()
+	}
+}
+
+// runApplier applies the committed entries, or a snapshot that replaces them,
+// and takes snapshots between applies.
+func (n *Node) runApplier(ctx context.Context, machine StateMachine) {
+	for {
+		n.mutex.Lock()
+		restore, changed := n.restore, n.changed
+		n.restore = nil
+		from, to := n.lastApplied+1, n.commitIndex
+		var entries []Entry
+		if restore == nil && from <= to {
+			entries = append(entries, n.entries[from-n.offset:to-n.offset+1]...)
+		}
+		n.mutex.Unlock()
+
+		if restore != nil {
+			changes := storage.Changes{Snapshot: true, Logs: restore.Logs}
+			if err := machine.ApplyChanges(ctx, changes); err != nil {
+				n.logger.Error("failed to apply snapshot", dlog.ErrAttr(err))
+			}
+
+			n.mutex.Lock()
+			n.lastApplied = restore.Index
+			n.notify()
+			n.mutex.Unlock()
+			continue
+		}
+
+		if len(entries) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+				continue
+			}
+		}
+
+		for _, entry := range entries {
+			if entry.Command == nil {
+				continue
+			}
+			changes := storage.Changes{Logs: []wal.Log{*entry.Command}}
+			if err := machine.ApplyChanges(ctx, changes); err != nil {
+				n.logger.Error("failed to apply committed log", dlog.ErrAttr(err))
+			}
+		}
+
+		n.mutex.Lock()
+		n.lastApplied = to
+		n.notify()
+		n.mutex.Unlock()
+
+		n.takeSnapshot(ctx, machine)
+	}
+}
+
+// takeSnapshot persists a snapshot of the state machine and compacts the log
+// once enough entries are applied after the last snapshot. It's called by the
+// applier between applies, so the snapshot has exactly the applied entries.
+func (n *Node) takeSnapshot(ctx context.Context, machine StateMachine) {
+	n.snapshotMutex.Lock()
+	defer n.snapshotMutex.Unlock()
+
+	n.mutex.Lock()
+	index := n.lastApplied
+	if n.restore != nil || index < n.offset || index-n.snapshotIndex < n.snapshotThreshold {
+		n.mutex.Unlock()
+		return
+	}
+	term := n.termAt(index)
+	n.mutex.Unlock()
+
+	logs, err := machine.SnapshotLogs(ctx)
+	if err != nil {
+		n.logger.Error("failed to take snapshot", dlog.ErrAttr(err))
+		return
+	}
+	if err := n.store.SaveSnapshot(Snapshot{Index: index, Term: term, Logs: logs}); err != nil {
+		n.logger.Error("failed to save snapshot", dlog.ErrAttr(err))
+		return
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.compact(index, term, n.entries[index-n.offset+1:])
+	n.logger.Info("snapshot is taken", slog.Uint64("index", index), slog.Int("logs", len(logs)))
+}
+
+// compact replaces the log with the entries that follow the saved snapshot.
+// A failed compaction of the store leaves the compacted entries in it, which
+// are skipped on load after the snapshot.
+func (n *Node) compact(index, term uint64, entries []Entry) {
+	entries = append([]Entry{{Term: term}}, entries...)
+	if err := n.store.Compact(index, entries[1:]); err != nil {
+		n.logger.Error("failed to compact log", dlog.ErrAttr(err))
+	}
+	n.entries, n.offset, n.snapshotIndex = entries, index, index
+}
+
+// becomeFollower persists a newer term before the node follows it.
+func (n *Node) becomeFollower(term uint64, leaderID string) error {
+	if term > n.term {
+		if err := n.saveVote(term, ""); err != nil {
+			return err
+		}
+	}
+	n.role = follower
+	n.leaderID = leaderID
+	n.notify()
+	return nil
+}
+
+// saveVote persists the term and the vote before they are set, so a restarted
+// node never votes twice in a term.
+func (n *Node) saveVote(term uint64, votedFor string) error {
+	if err := n.store.SaveVote(term, votedFor); err != nil {
+		n.logger.Error("failed to save vote", dlog.ErrAttr(err))
+		return err
+	}
+	n.term, n.votedFor = term, votedFor
+	return nil
+}
+
+// appendEntries persists the entries that start at the index and replaces the
+// entries of the log from the index on with them.
+func (n *Node) appendEntries(index uint64, entries []Entry) error {
+	if err := n.store.Append(index, entries); err != nil {
+		n.logger.Error("failed to append log", dlog.ErrAttr(err))
+		return err
+	}
+	n.entries = append(n.entries[:index-n.offset], entries...)
+	return nil
+}
+
+// resetElectionTimer randomizes the election timeout, so nodes rarely start
+// elections at the same time.
+func (n *Node) resetElectionTimer() {
+	n.lastContact = time.Now()
+	n.timeout = n.electionTimeout + time.Duration(rand.Int63n(int64(n.electionTimeout))) // nolint:gosec
+}
+
+// notify wakes up everyone who waits for a change of the node.
+func (n *Node) notify() {
+	close(n.changed)
+	n.changed = make(chan struct{})
+	close(n.replicateNow)
+	n.replicateNow = make(chan struct{})
+}
+
+func (n *Node) lastIndex() uint64 {
+	return n.offset + uint64(len(n.entries)-1)
+}
+
+// termAt returns the term of the entry with the index, which isn't compacted.
+func (n *Node) termAt(index uint64) uint64 {
+	return n.entries[index-n.offset].Term
+}
+
+func (n *Node) quorum() int {
+	return (len(n.peers)+1)/2 + 1
+}
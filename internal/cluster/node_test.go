@@ -0,0 +1,506 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/internal/network"
+	"kv_db/pkg/dlog"
+)
+
+func TestNewNode(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewTCPTransport(time.Second)
+	require.NoError(t, err)
+	members := map[string]string{"n1": "localhost:1", "n2": "localhost:2"}
+
+	tests := map[string]struct {
+		id        string
+		members   map[string]string
+		transport Transport
+		options   []NodeOption
+		expErr    bool
+	}{
+		"unknown id":    {id: "n3", members: members, transport: transport, expErr: true},
+		"empty address": {id: "n1", members: map[string]string{"n1": ""}, transport: transport, expErr: true},
+		"no transport":  {id: "n1", members: members, expErr: true},
+		"invalid election timeout": {
+			id: "n1", members: members, transport: transport,
+			options: []NodeOption{WithElectionTimeout(0)}, expErr: true,
+		},
+		"heartbeat interval longer than election timeout": {
+			id: "n1", members: members, transport: transport,
+			options: []NodeOption{WithHeartbeatInterval(time.Second)}, expErr: true,
+		},
+		"invalid propose timeout": {
+			id: "n1", members: members, transport: transport,
+			options: []NodeOption{WithProposeTimeout(0)}, expErr: true,
+		},
+		"invalid snapshot threshold": {
+			id: "n1", members: members, transport: transport,
+			options: []NodeOption{WithSnapshotThreshold(0)}, expErr: true,
+		},
+		"success": {id: "n1", members: members, transport: transport},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			node, err := NewNode(test.id, test.members, test.transport, dlog.NewNonSlog(), test.options...)
+			if test.expErr {
+				require.Error(t, err)
+				require.Nil(t, node)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"n2": "localhost:2"}, node.peers)
+		})
+	}
+
+	_, err = NewTCPTransport(0)
+	require.Error(t, err)
+}
+
+func TestSingleNodeCluster(t *testing.T) {
+	t.Parallel()
+
+	cluster := startCluster(t, 20030, 1)
+	leaderID := cluster.waitLeader(t, cluster.ids()...)
+
+	require.NoError(t, cluster.nodes[leaderID].Propose(context.Background(), setLog("key", "value")))
+	require.Equal(t, map[string]string{"key": "value"}, cluster.machines[leaderID].data())
+}
+
+func TestClusterReplicatesLogs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cluster := startCluster(t, 20031, 3)
+	leaderID := cluster.waitLeader(t, cluster.ids()...)
+
+	// A follower forwards its proposals to the leader and returns after it
+	// has applied them itself.
+	require.NoError(t, cluster.nodes[leaderID].Propose(ctx, setLog("key1", "value1")))
+	for _, id := range cluster.ids() {
+		if id != leaderID {
+			require.NoError(t, cluster.nodes[id].Propose(ctx, setLog("key2", id)))
+			require.Equal(t, id, cluster.machines[id].data()["key2"])
+			require.NoError(t, cluster.nodes[id].Propose(ctx, wal.NewLog(0, wal.DelOp, "key1")))
+			break
+		}
+	}
+
+	cluster.waitConverged(t, cluster.ids()...)
+	require.Len(t, cluster.machines[leaderID].data(), 1)
+	require.Equal(t, "leader", cluster.nodes[leaderID].Info(ctx)["role"])
+}
+
+func TestClusterPartitions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cluster := startCluster(t, 20034, 5)
+	oldLeaderID := cluster.waitLeader(t, cluster.ids()...)
+	require.NoError(t, cluster.nodes[oldLeaderID].Propose(ctx, setLog("key", "before")))
+	cluster.waitConverged(t, cluster.ids()...)
+
+	// The old leader stays in the minority with one follower.
+	minority := []string{oldLeaderID}
+	var majority []string
+	for _, id := range cluster.ids() {
+		switch {
+		case id == oldLeaderID:
+		case len(minority) < 2:
+			minority = append(minority, id)
+		default:
+			majority = append(majority, id)
+		}
+	}
+	cluster.partition(minority, majority)
+
+	// The minority can't commit.
+	err := cluster.nodes[oldLeaderID].Propose(ctx, setLog("key", "minority"))
+	require.Error(t, err)
+
+	newLeaderID := cluster.waitLeader(t, majority...)
+	require.NoError(t, cluster.nodes[newLeaderID].Propose(ctx, setLog("key", "majority")))
+	require.NoError(t, cluster.nodes[majority[0]].Propose(ctx, setLog("other", "value")))
+	for _, id := range minority {
+		require.Equal(t, "before", cluster.machines[id].data()["key"])
+	}
+
+	// After the partition heals, the old leader follows the new one and its
+	// uncommitted entry is replaced.
+	cluster.heal()
+	cluster.waitConverged(t, cluster.ids()...)
+	require.Equal(t, map[string]string{"key": "majority", "other": "value"}, cluster.machines[oldLeaderID].data())
+	require.Eventually(t, func() bool {
+		return cluster.nodes[oldLeaderID].Info(ctx)["leader_id"] == newLeaderID
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestClusterSnapshots(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cluster := startCluster(t, 20057, 3, WithSnapshotThreshold(5))
+	leaderID := cluster.waitLeader(t, cluster.ids()...)
+
+	// The lagging follower needs entries that the leader has compacted, so it
+	// gets the snapshot.
+	var laggingID string
+	for _, id := range cluster.ids() {
+		if id != leaderID {
+			laggingID = id
+		}
+	}
+	cluster.partition([]string{laggingID}, cluster.ids())
+	for idx := 0; idx < 20; idx++ {
+		require.NoError(t, cluster.nodes[leaderID].Propose(ctx, setLog(fmt.Sprintf("key%d", idx%7), fmt.Sprint(idx))))
+	}
+	require.NotEqual(t, "0", cluster.nodes[leaderID].Info(ctx)["snapshot_index"])
+
+	cluster.heal()
+	cluster.waitConverged(t, cluster.ids()...)
+	require.Len(t, cluster.machines[laggingID].data(), 7)
+	require.Eventually(t, func() bool {
+		return cluster.nodes[laggingID].Info(ctx)["snapshot_index"] != "0"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNodeRestart(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	directory := t.TempDir()
+	start := func() (*Node, *testMachine, func()) {
+		store, err := NewFileStore(directory)
+		require.NoError(t, err)
+		transport, err := NewTCPTransport(time.Second)
+		require.NoError(t, err)
+		node, err := NewNode("n1", map[string]string{"n1": "localhost:20060"}, transport, dlog.NewNonSlog(),
+			WithStore(store),
+			WithElectionTimeout(150*time.Millisecond),
+			WithHeartbeatInterval(30*time.Millisecond),
+			WithSnapshotThreshold(3),
+		)
+		require.NoError(t, err)
+
+		machine := &testMachine{values: make(map[string]string)}
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			node.Start(ctx, machine)
+		}()
+		return node, machine, func() {
+			cancel()
+			<-done
+			require.NoError(t, store.Close())
+		}
+	}
+
+	node, _, stop := start()
+	require.Eventually(t, func() bool {
+		return node.Info(ctx)["role"] == "leader"
+	}, 5*time.Second, 10*time.Millisecond)
+	for idx := 0; idx < 5; idx++ {
+		require.NoError(t, node.Propose(ctx, setLog(fmt.Sprintf("key%d", idx), "value")))
+	}
+	info := node.Info(ctx)
+	stop()
+
+	// The restarted node keeps its term and restores the snapshot together
+	// with the entries that follow it.
+	node, machine, stop := start()
+	defer stop()
+	require.Equal(t, info["term"], node.Info(ctx)["term"])
+	require.Equal(t, info["snapshot_index"], node.Info(ctx)["snapshot_index"])
+	require.Eventually(t, func() bool {
+		return len(machine.data()) == 5
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNode_HandleRequest(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewTCPTransport(time.Second)
+	require.NoError(t, err)
+	node, err := NewNode("n1", map[string]string{"n1": "localhost:1", "n2": "localhost:2"}, transport, dlog.NewNonSlog())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	text, err := setLog("key", "value").MarshalText()
+	require.NoError(t, err)
+	for _, test := range []struct {
+		request     string
+		expResponse string
+	}{
+		{request: "", expResponse: "[error] invalid request"},
+		{request: "UNKNOWN", expResponse: "[error] invalid request"},
+		{request: "VOTE 1 n2 0", expResponse: "[error] invalid request"},
+		{
+			request:     "VOTE x n2 0 0",
+			expResponse: "[error] invalid number: strconv.ParseUint: parsing \"x\": invalid syntax",
+		},
+		{request: "VOTE 1 n2 0 0", expResponse: "[ok] 1 1"},
+		{request: "VOTE 1 n3 0 0", expResponse: "[ok] 1 0"},
+		{request: "APPEND 1 n2 0 0 0 1:" + string(text), expResponse: "[ok] 1 1 1"},
+		{request: "APPEND 1 n2 5 1 0", expResponse: "[ok] 1 0 2"},
+		{request: "APPEND 1 n2 0 0 0 1", expResponse: "[error] invalid entry"},
+		{request: "APPEND 1 n2 0 0 0 1:invalid", expResponse: "[error] corrupted log: illegal base64 data at input byte 4"},
+		{request: "SNAPSHOT 1 n2 5 1 0", expResponse: "[error] invalid request"},
+		{request: "SNAPSHOT 1 n2 5 1 1 0 " + string(text), expResponse: "[ok] 1 0"},
+		{request: "SNAPSHOT 1 n2 5 1 0 0 " + string(text), expResponse: "[ok] 1 1"},
+		{request: "SNAPSHOT 1 n2 5 1 1 1 " + string(text), expResponse: "[ok] 1 1"},
+		{request: "APPEND 1 n2 5 1 0", expResponse: "[ok] 1 1 5"},
+		{
+			request:     "SNAPSHOT 1 n2 6 1 0 1 invalid",
+			expResponse: "[error] corrupted log: illegal base64 data at input byte 4",
+		},
+		{request: "PROPOSE " + string(text), expResponse: "[error] cluster has no leader"},
+	} {
+		require.Equal(t, test.expResponse, string(node.HandleRequest(ctx, []byte(test.request))), test.request)
+	}
+}
+
+func setLog(key, value string) wal.Log {
+	return wal.NewLog(0, wal.SetOp, key, value)
+}
+
+// testCluster runs nodes on loopback ports. Partitions are simulated by
+// transports that fail requests between disconnected nodes.
+type testCluster struct {
+	addresses map[string]string
+	nodes     map[string]*Node
+	machines  map[string]*testMachine
+
+	mutex        sync.Mutex
+	disconnected map[[2]string]bool
+}
+
+func startCluster(t *testing.T, basePort, size int, options ...NodeOption) *testCluster {
+	t.Helper()
+
+	cluster := &testCluster{
+		addresses:    make(map[string]string),
+		nodes:        make(map[string]*Node),
+		machines:     make(map[string]*testMachine),
+		disconnected: make(map[[2]string]bool),
+	}
+	for idx := 0; idx < size; idx++ {
+		cluster.addresses[fmt.Sprintf("n%d", idx+1)] = fmt.Sprintf("localhost:%d", basePort+idx)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	for id, address := range cluster.addresses {
+		transport, err := NewTCPTransport(time.Second)
+		require.NoError(t, err)
+
+		node, err := NewNode(
+			id, cluster.addresses, &partitionedTransport{Transport: transport, from: address, cluster: cluster},
+			dlog.NewNonSlog(),
+			append([]NodeOption{
+				WithElectionTimeout(150 * time.Millisecond),
+				WithHeartbeatInterval(30 * time.Millisecond),
+				WithProposeTimeout(time.Second),
+			}, options...)...,
+		)
+		require.NoError(t, err)
+		server, err := network.NewTCPServer(
+			address, 100, time.Minute, dlog.NewNonSlog(), network.WithMaxQuerySize(MaxRequestSize),
+		)
+		require.NoError(t, err)
+		cluster.nodes[id], cluster.machines[id] = node, &testMachine{values: make(map[string]string)}
+
+		machine := cluster.machines[id]
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = server.HandleQueries(ctx, node.HandleRequest)
+		}()
+		go func() {
+			defer wg.Done()
+			node.Start(ctx, machine)
+			transport.Close()
+		}()
+	}
+	return cluster
+}
+
+func (c *testCluster) ids() []string {
+	ids := make([]string, 0, len(c.addresses))
+	for idx := 1; idx <= len(c.addresses); idx++ {
+		ids = append(ids, fmt.Sprintf("n%d", idx))
+	}
+	return ids
+}
+
+// waitLeader waits until one of the nodes is the leader of the others.
+func (c *testCluster) waitLeader(t *testing.T, ids ...string) string {
+	t.Helper()
+
+	var leaderID string
+	require.Eventually(t, func() bool {
+		leaderID = ""
+		leaders := make(map[string]bool)
+		for _, id := range ids {
+			info := c.nodes[id].Info(context.Background())
+			leaders[info["leader_id"]] = true
+			if info["role"] == "leader" {
+				leaderID = id
+			}
+		}
+		return leaderID != "" && len(leaders) == 1 && leaders[leaderID]
+	}, 5*time.Second, 10*time.Millisecond)
+	return leaderID
+}
+
+// waitConverged waits until the nodes have applied the same data.
+func (c *testCluster) waitConverged(t *testing.T, ids ...string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		expected := c.machines[ids[0]].data()
+		for _, id := range ids[1:] {
+			if fmt.Sprint(c.machines[id].data()) != fmt.Sprint(expected) {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (c *testCluster) partition(left, right []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, from := range left {
+		for _, to := range right {
+			c.disconnected[[2]string{c.addresses[from], c.addresses[to]}] = true
+			c.disconnected[[2]string{c.addresses[to], c.addresses[from]}] = true
+		}
+	}
+}
+
+func (c *testCluster) heal() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.disconnected = make(map[[2]string]bool)
+}
+
+func (c *testCluster) connected(from, to string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.disconnected[[2]string{from, to}] {
+		return errors.New("nodes are partitioned")
+	}
+	return nil
+}
+
+type partitionedTransport struct {
+	Transport
+	from    string
+	cluster *testCluster
+}
+
+func (t *partitionedTransport) RequestVote(
+	ctx context.Context, address string, request VoteRequest,
+) (VoteResponse, error) {
+	if err := t.cluster.connected(t.from, address); err != nil {
+		return VoteResponse{}, err
+	}
+	return t.Transport.RequestVote(ctx, address, request)
+}
+
+func (t *partitionedTransport) AppendEntries(
+	ctx context.Context, address string, request AppendRequest,
+) (AppendResponse, error) {
+	if err := t.cluster.connected(t.from, address); err != nil {
+		return AppendResponse{}, err
+	}
+	return t.Transport.AppendEntries(ctx, address, request)
+}
+
+func (t *partitionedTransport) InstallSnapshot(
+	ctx context.Context, address string, request SnapshotRequest,
+) (SnapshotResponse, error) {
+	if err := t.cluster.connected(t.from, address); err != nil {
+		return SnapshotResponse{}, err
+	}
+	return t.Transport.InstallSnapshot(ctx, address, request)
+}
+
+func (t *partitionedTransport) Propose(ctx context.Context, address string, log wal.Log) (uint64, error) {
+	if err := t.cluster.connected(t.from, address); err != nil {
+		return 0, err
+	}
+	return t.Transport.Propose(ctx, address, log)
+}
+
+// testMachine applies SET and DEL logs to a map.
+type testMachine struct {
+	mutex  sync.Mutex
+	values map[string]string
+}
+
+func (m *testMachine) ApplyChanges(_ context.Context, changes storage.Changes) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if changes.Snapshot {
+		m.values = make(map[string]string)
+	}
+	for _, log := range changes.Logs {
+		switch log.Op {
+		case wal.SetOp:
+			m.values[log.Args[0]] = log.Args[1]
+		case wal.DelOp:
+			delete(m.values, log.Args[0])
+		default:
+			return fmt.Errorf("unexpected operation %d", log.Op)
+		}
+	}
+	return nil
+}
+
+func (m *testMachine) SnapshotLogs(context.Context) ([]wal.Log, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	logs := make([]wal.Log, 0, len(m.values))
+	for key, value := range m.values {
+		logs = append(logs, setLog(key, value))
+	}
+	return logs, nil
+}
+
+func (m *testMachine) data() map[string]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	values := make(map[string]string, len(m.values))
+	for key, value := range m.values {
+		values[key] = value
+	}
+	return values
+}
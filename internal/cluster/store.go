@@ -0,0 +1,394 @@
+package cluster
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"kv_db/internal/database/storage/wal"
+)
+
+const (
+	stateFile    = "state"
+	logFile      = "log"
+	snapshotFile = "snapshot"
+	tmpSuffix    = ".tmp"
+)
+
+var ErrCorruptedStore = errors.New("corrupted cluster store")
+
+// Store persists the state of a node, so a restarted node keeps its votes and
+// the entries it has acknowledged. Every write is durable when it returns.
+type Store interface {
+	// Load returns the persisted state, which is empty for a new node.
+	Load() (State, error)
+	// SaveVote persists the current term and the vote in it.
+	SaveVote(term uint64, votedFor string) error
+	// Append persists the entries that start at the index. They replace the
+	// persisted entries from the index on.
+	Append(index uint64, entries []Entry) error
+	// SaveSnapshot persists the snapshot. The entries that it contains stay
+	// persisted until Compact.
+	SaveSnapshot(snapshot Snapshot) error
+	// LoadSnapshot returns the persisted snapshot.
+	LoadSnapshot() (Snapshot, error)
+	// Compact replaces the persisted entries with the entries that follow
+	// the index.
+	Compact(index uint64, entries []Entry) error
+}
+
+// State is the persisted state of a node.
+type State struct {
+	Term     uint64
+	VotedFor string
+	Snapshot Snapshot
+	// Entries follow the snapshot.
+	Entries []Entry
+}
+
+// Snapshot recreates the state machine after the entry with the index is
+// applied. The zero index means that there is no snapshot.
+type Snapshot struct {
+	Index uint64
+	Term  uint64
+	Logs  []wal.Log
+}
+
+// FileStore keeps the state of a node in a directory. The term and the vote
+// are in the state file, and the last snapshot is in the snapshot file, both
+// of which are written to a temporary name and renamed when complete. The log
+// file is appended with a line per entry, which replaces the entries from its
+// index on, and it is rewritten by compaction only.
+type FileStore struct {
+	directory string
+	log       *os.File
+}
+
+func NewFileStore(directory string) (*FileStore, error) {
+	if directory == "" {
+		return nil, errors.New("cluster store directory is invalid")
+	}
+
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cluster store directory: %w", err)
+	}
+
+	return &FileStore{directory: directory}, nil
+}
+
+// Load reads the state and opens the log file for appends. An incomplete last
+// line of the log file, which is left by a crash during an append, is
+// truncated.
+func (s *FileStore) Load() (State, error) {
+	var state State
+	if err := s.readState(&state); err != nil {
+		return State{}, err
+	}
+
+	snapshot, err := s.LoadSnapshot()
+	if err != nil {
+		return State{}, err
+	}
+	state.Snapshot = snapshot
+
+	path := filepath.Join(s.directory, logFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return State{}, fmt.Errorf("failed to open cluster log: %w", err)
+	}
+
+	size, err := readEntries(file, &state)
+	if err == nil {
+		err = file.Truncate(size)
+	}
+	if err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+	if err == nil {
+		err = syncDirectory(s.directory)
+	}
+	if err != nil {
+		_ = file.Close()
+		return State{}, fmt.Errorf("failed to load cluster log: %w", err)
+	}
+
+	if s.log != nil {
+		_ = s.log.Close()
+	}
+	s.log = file
+	return state, nil
+}
+
+func (s *FileStore) readState(state *State) error {
+	data, err := os.ReadFile(filepath.Join(s.directory, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cluster state: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("%w: invalid state", ErrCorruptedStore)
+	}
+	if state.Term, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return fmt.Errorf("%w: invalid term", ErrCorruptedStore)
+	}
+	if len(fields) == 2 {
+		state.VotedFor = fields[1]
+	}
+	return nil
+}
+
+// readEntries reads the entries that follow the snapshot of the state and
+// returns the size of the complete lines.
+func readEntries(file *os.File, state *State) (int64, error) {
+	reader := bufio.NewReader(file)
+	var size int64
+	for {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		indexText, entryText, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		if !ok {
+			return 0, fmt.Errorf("%w: invalid entry", ErrCorruptedStore)
+		}
+		index, err := strconv.ParseUint(indexText, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid index", ErrCorruptedStore)
+		}
+		entry, err := parseEntry(entryText)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrCorruptedStore, err)
+		}
+		size += int64(len(line))
+
+		// Entries of the snapshot are left by a crash before compaction.
+		if index <= state.Snapshot.Index {
+			continue
+		}
+		position := index - state.Snapshot.Index - 1
+		if position > uint64(len(state.Entries)) {
+			return 0, fmt.Errorf("%w: missing entries before %d", ErrCorruptedStore, index)
+		}
+		state.Entries = append(state.Entries[:position], entry)
+	}
+}
+
+func (s *FileStore) SaveVote(term uint64, votedFor string) error {
+	data := strconv.FormatUint(term, 10)
+	if votedFor != "" {
+		data += " " + votedFor
+	}
+
+	if err := s.writeFile(stateFile, []byte(data+"\n")); err != nil {
+		return fmt.Errorf("failed to save cluster state: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Append(index uint64, entries []Entry) error {
+	if s.log == nil {
+		return errors.New("cluster log isn't loaded")
+	}
+
+	data, err := appendEntries(nil, index, entries)
+	if err != nil {
+		return err
+	}
+	if _, err := s.log.Write(data); err != nil {
+		return fmt.Errorf("failed to append cluster log: %w", err)
+	}
+	if err := s.log.Sync(); err != nil {
+		return fmt.Errorf("failed to sync cluster log: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) SaveSnapshot(snapshot Snapshot) error {
+	data := fmt.Appendf(nil, "%d %d\n", snapshot.Index, snapshot.Term)
+	for _, log := range snapshot.Logs {
+		text, err := log.MarshalText()
+		if err != nil {
+			return err
+		}
+		data = append(append(data, text...), '\n')
+	}
+
+	if err := s.writeFile(snapshotFile, data); err != nil {
+		return fmt.Errorf("failed to save cluster snapshot: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) LoadSnapshot() (Snapshot, error) {
+	file, err := os.Open(filepath.Join(s.directory, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, nil
+	}
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to open cluster snapshot: %w", err)
+	}
+	defer file.Close()
+
+	var snapshot Snapshot
+	reader := bufio.NewReader(file)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read cluster snapshot: %w", err)
+	}
+	if _, err := fmt.Sscanf(header, "%d %d\n", &snapshot.Index, &snapshot.Term); err != nil {
+		return Snapshot{}, fmt.Errorf("%w: invalid snapshot header", ErrCorruptedStore)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) && line == "" {
+			return snapshot, nil
+		}
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("failed to read cluster snapshot: %w", err)
+		}
+
+		var log wal.Log
+		if err := log.UnmarshalText([]byte(strings.TrimSuffix(line, "\n"))); err != nil {
+			return Snapshot{}, fmt.Errorf("%w: %w", ErrCorruptedStore, err)
+		}
+		snapshot.Logs = append(snapshot.Logs, log)
+	}
+}
+
+// Compact writes the entries to a new log file, which replaces the current
+// one.
+func (s *FileStore) Compact(index uint64, entries []Entry) error {
+	if s.log == nil {
+		return errors.New("cluster log isn't loaded")
+	}
+
+	data, err := appendEntries(nil, index+1, entries)
+	if err != nil {
+		return err
+	}
+	writeErr := s.writeFile(logFile, data)
+
+	// The log file is reopened even if the write fails, since it could fail
+	// after the rename.
+	file, err := os.OpenFile(filepath.Join(s.directory, logFile), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open cluster log: %w", err)
+	}
+	_ = s.log.Close()
+	s.log = file
+
+	if writeErr != nil {
+		return fmt.Errorf("failed to compact cluster log: %w", writeErr)
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (s *FileStore) Close() error {
+	if s.log == nil {
+		return nil
+	}
+	return s.log.Close()
+}
+
+// writeFile replaces the file with the data atomically.
+func (s *FileStore) writeFile(name string, data []byte) error {
+	path := filepath.Join(s.directory, name)
+	file, err := os.OpenFile(path+tmpSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path+tmpSuffix, path)
+	}
+	if err != nil {
+		_ = os.Remove(path + tmpSuffix)
+		return err
+	}
+	return syncDirectory(s.directory)
+}
+
+// memoryStore keeps the last snapshot only, so a node without a store forgets
+// its state on restart but still compacts its log.
+type memoryStore struct {
+	mutex    sync.Mutex
+	snapshot Snapshot
+}
+
+func (s *memoryStore) Load() (State, error) {
+	return State{}, nil
+}
+
+func (s *memoryStore) SaveVote(uint64, string) error {
+	return nil
+}
+
+func (s *memoryStore) Append(uint64, []Entry) error {
+	return nil
+}
+
+func (s *memoryStore) SaveSnapshot(snapshot Snapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.snapshot = snapshot
+	return nil
+}
+
+func (s *memoryStore) LoadSnapshot() (Snapshot, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.snapshot, nil
+}
+
+func (s *memoryStore) Compact(uint64, []Entry) error {
+	return nil
+}
+
+func appendEntries(data []byte, index uint64, entries []Entry) ([]byte, error) {
+	for idx, entry := range entries {
+		text, err := formatEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		data = fmt.Appendf(data, "%d %s\n", index+uint64(idx), text)
+	}
+	return data, nil
+}
+
+func syncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+
+	if err := dir.Sync(); err != nil {
+		_ = dir.Close()
+		return err
+	}
+	return dir.Close()
+}
@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage/wal"
+)
+
+func TestNewFileStore(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewFileStore("")
+	require.Error(t, err)
+}
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+
+	directory := t.TempDir()
+	store, err := NewFileStore(directory)
+	require.NoError(t, err)
+	state, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, State{}, state)
+
+	log := setLog("key", "value")
+	require.NoError(t, store.SaveVote(2, "n2"))
+	require.NoError(t, store.Append(1, []Entry{{Term: 1}, {Term: 1, Command: &log}, {Term: 1}}))
+	// The entries from the index on are replaced.
+	require.NoError(t, store.Append(3, []Entry{{Term: 2}, {Term: 2, Command: &log}}))
+	require.NoError(t, store.Close())
+
+	// An incomplete line is left by a crash during an append.
+	file, err := os.OpenFile(filepath.Join(directory, logFile), os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = file.WriteString("5 2:")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	state, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, State{
+		Term:     2,
+		VotedFor: "n2",
+		Entries:  []Entry{{Term: 1}, {Term: 1, Command: &log}, {Term: 2}, {Term: 2, Command: &log}},
+	}, state)
+
+	require.NoError(t, store.Append(5, []Entry{{Term: 2}}))
+	snapshot := Snapshot{Index: 3, Term: 2, Logs: []wal.Log{log}}
+	require.NoError(t, store.SaveSnapshot(snapshot))
+	loaded, err := store.LoadSnapshot()
+	require.NoError(t, err)
+	require.Equal(t, snapshot, loaded)
+
+	// The entries of the snapshot are skipped before the log is compacted.
+	state, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, []Entry{{Term: 2, Command: &log}, {Term: 2}}, state.Entries)
+
+	require.NoError(t, store.Compact(3, []Entry{{Term: 2, Command: &log}}))
+	require.NoError(t, store.Append(5, []Entry{{Term: 3}}))
+	require.NoError(t, store.SaveVote(3, ""))
+	require.NoError(t, store.Close())
+
+	state, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, State{
+		Term:     3,
+		Snapshot: snapshot,
+		Entries:  []Entry{{Term: 2, Command: &log}, {Term: 3}},
+	}, state)
+	require.NoError(t, store.Close())
+}
+
+func TestFileStore_Corrupted(t *testing.T) {
+	t.Parallel()
+
+	for name, files := range map[string]map[string]string{
+		"invalid state":    {stateFile: "x"},
+		"invalid entry":    {logFile: "1 x\n"},
+		"missing entries":  {logFile: "1 1:\n3 1:\n"},
+		"invalid snapshot": {snapshotFile: "1\n"},
+	} {
+		files := files
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			directory := t.TempDir()
+			for name, data := range files {
+				require.NoError(t, os.WriteFile(filepath.Join(directory, name), []byte(data), 0o644))
+			}
+
+			store, err := NewFileStore(directory)
+			require.NoError(t, err)
+			_, err = store.Load()
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,385 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/internal/network"
+)
+
+const (
+	// maxIdleConnections is the number of connections to a node that are
+	// kept open between requests.
+	maxIdleConnections = 4
+
+	// MaxRequestSize is the longest request, which keeps a batch of logs. The
+	// server of the protocol accepts queries of this size.
+	MaxRequestSize = 64 << 20
+)
+
+// Requests of the Raft protocol are single lines, like queries, and their
+// entries are logs encoded by wal.Log.MarshalText:
+//
+//	VOTE term candidate last_index last_term -> [ok] term granted
+//	APPEND term leader prev_index prev_term commit term:log... -> [ok] term success index
+//	SNAPSHOT term leader index snapshot_term offset done log... -> [ok] term success
+//	PROPOSE log -> [ok] index
+const (
+	voteRequest     = "VOTE"
+	appendRequest   = "APPEND"
+	snapshotRequest = "SNAPSHOT"
+	proposeRequest  = "PROPOSE"
+)
+
+// TCPTransport sends requests over pooled connections. A request that takes
+// longer than the idle timeout fails.
+type TCPTransport struct {
+	idleTimeout time.Duration
+
+	mutex sync.Mutex
+	idle  map[string][]*network.TCPClient
+}
+
+func NewTCPTransport(idleTimeout time.Duration) (*TCPTransport, error) {
+	if idleTimeout <= 0 {
+		return nil, errors.New("cluster transport idle timeout is invalid")
+	}
+
+	return &TCPTransport{
+		idleTimeout: idleTimeout,
+		idle:        make(map[string][]*network.TCPClient),
+	}, nil
+}
+
+func (t *TCPTransport) RequestVote(ctx context.Context, address string, request VoteRequest) (VoteResponse, error) {
+	fields, err := t.send(ctx, address, fmt.Sprintf("%s %d %s %d %d",
+		voteRequest, request.Term, request.CandidateID, request.LastLogIndex, request.LastLogTerm), 2)
+	if err != nil {
+		return VoteResponse{}, err
+	}
+
+	term, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return VoteResponse{}, err
+	}
+	return VoteResponse{Term: term, Granted: fields[1] == "1"}, nil
+}
+
+func (t *TCPTransport) AppendEntries(
+	ctx context.Context, address string, request AppendRequest,
+) (AppendResponse, error) {
+	var query strings.Builder
+	fmt.Fprintf(&query, "%s %d %s %d %d %d", appendRequest,
+		request.Term, request.LeaderID, request.PrevLogIndex, request.PrevLogTerm, request.LeaderCommit)
+	for _, entry := range request.Entries {
+		text, err := formatEntry(entry)
+		if err != nil {
+			return AppendResponse{}, err
+		}
+		query.WriteString(" " + text)
+	}
+
+	fields, err := t.send(ctx, address, query.String(), 3)
+	if err != nil {
+		return AppendResponse{}, err
+	}
+
+	numbers, err := parseNumbers(fields[0], fields[2])
+	if err != nil {
+		return AppendResponse{}, err
+	}
+	return AppendResponse{Term: numbers[0], Success: fields[1] == "1", Index: numbers[1]}, nil
+}
+
+func (t *TCPTransport) InstallSnapshot(
+	ctx context.Context, address string, request SnapshotRequest,
+) (SnapshotResponse, error) {
+	var query strings.Builder
+	fmt.Fprintf(&query, "%s %d %s %d %d %d %s", snapshotRequest, request.Term, request.LeaderID,
+		request.Index, request.SnapshotTerm, request.Offset, formatBool(request.Done))
+	for _, log := range request.Logs {
+		text, err := log.MarshalText()
+		if err != nil {
+			return SnapshotResponse{}, err
+		}
+		query.WriteString(" " + string(text))
+	}
+
+	fields, err := t.send(ctx, address, query.String(), 2)
+	if err != nil {
+		return SnapshotResponse{}, err
+	}
+
+	term, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return SnapshotResponse{}, err
+	}
+	return SnapshotResponse{Term: term, Success: fields[1] == "1"}, nil
+}
+
+func (t *TCPTransport) Propose(ctx context.Context, address string, log wal.Log) (uint64, error) {
+	text, err := log.MarshalText()
+	if err != nil {
+		return 0, err
+	}
+
+	fields, err := t.send(ctx, address, proposeRequest+" "+string(text), 1)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(fields[0], 10, 64)
+}
+
+// send returns the fields of an [ok] response after the status.
+func (t *TCPTransport) send(ctx context.Context, address, request string, fieldsCount int) ([]string, error) {
+	client, err := t.take(address)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = client.Close()
+	})
+	response, err := client.Send([]byte(request + "\n"))
+	if !stop() || err != nil {
+		_ = client.Close()
+		if err == nil {
+			err = ctx.Err()
+		}
+		return nil, err
+	}
+	t.put(address, client)
+
+	if message, ok := strings.CutPrefix(string(response), "[error] "); ok {
+		if message == ErrNoLeader.Error() {
+			return nil, ErrNoLeader
+		}
+		return nil, errors.New(message)
+	}
+
+	fields := strings.Fields(string(response))
+	if len(fields) != fieldsCount+1 || fields[0] != "[ok]" {
+		return nil, fmt.Errorf("unexpected response: %s", response)
+	}
+	return fields[1:], nil
+}
+
+func (t *TCPTransport) take(address string) (*network.TCPClient, error) {
+	t.mutex.Lock()
+	if clients := t.idle[address]; len(clients) != 0 {
+		client := clients[len(clients)-1]
+		t.idle[address] = clients[:len(clients)-1]
+		t.mutex.Unlock()
+		return client, nil
+	}
+	t.mutex.Unlock()
+
+	return network.NewTCPClient(address, t.idleTimeout)
+}
+
+func (t *TCPTransport) put(address string, client *network.TCPClient) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.idle[address]) >= maxIdleConnections {
+		_ = client.Close()
+		return
+	}
+	t.idle[address] = append(t.idle[address], client)
+}
+
+// Close closes the idle connections.
+func (t *TCPTransport) Close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for address, clients := range t.idle {
+		for _, client := range clients {
+			_ = client.Close()
+		}
+		delete(t.idle, address)
+	}
+}
+
+// HandleRequest handles a request of another node, which is sent by
+// TCPTransport.
+func (n *Node) HandleRequest(ctx context.Context, request []byte) []byte {
+	fields := strings.Fields(string(request))
+	if len(fields) == 0 {
+		return []byte("[error] invalid request")
+	}
+
+	var response string
+	var err error
+	switch fields[0] {
+	case voteRequest:
+		response, err = n.handleVoteRequest(fields[1:])
+	case appendRequest:
+		response, err = n.handleAppendRequest(fields[1:])
+	case snapshotRequest:
+		response, err = n.handleSnapshotRequest(fields[1:])
+	case proposeRequest:
+		response, err = n.handleProposeRequest(ctx, fields[1:])
+	default:
+		err = errors.New("invalid request")
+	}
+	if err != nil {
+		return []byte(fmt.Sprintf("[error] %s", err.Error()))
+	}
+	return []byte(response)
+}
+
+func (n *Node) handleVoteRequest(fields []string) (string, error) {
+	if len(fields) != 4 {
+		return "", errors.New("invalid request")
+	}
+
+	numbers, err := parseNumbers(fields[0], fields[2], fields[3])
+	if err != nil {
+		return "", err
+	}
+
+	response := n.HandleVote(VoteRequest{
+		Term:         numbers[0],
+		CandidateID:  fields[1],
+		LastLogIndex: numbers[1],
+		LastLogTerm:  numbers[2],
+	})
+	return fmt.Sprintf("[ok] %d %s", response.Term, formatBool(response.Granted)), nil
+}
+
+func (n *Node) handleAppendRequest(fields []string) (string, error) {
+	if len(fields) < 5 {
+		return "", errors.New("invalid request")
+	}
+
+	numbers, err := parseNumbers(fields[0], fields[2], fields[3], fields[4])
+	if err != nil {
+		return "", err
+	}
+
+	request := AppendRequest{
+		Term:         numbers[0],
+		LeaderID:     fields[1],
+		PrevLogIndex: numbers[1],
+		PrevLogTerm:  numbers[2],
+		LeaderCommit: numbers[3],
+		Entries:      make([]Entry, 0, len(fields)-5),
+	}
+	for _, field := range fields[5:] {
+		entry, err := parseEntry(field)
+		if err != nil {
+			return "", err
+		}
+		request.Entries = append(request.Entries, entry)
+	}
+
+	response := n.HandleAppend(request)
+	return fmt.Sprintf("[ok] %d %s %d", response.Term, formatBool(response.Success), response.Index), nil
+}
+
+func (n *Node) handleSnapshotRequest(fields []string) (string, error) {
+	if len(fields) < 6 {
+		return "", errors.New("invalid request")
+	}
+
+	numbers, err := parseNumbers(fields[0], fields[2], fields[3], fields[4])
+	if err != nil {
+		return "", err
+	}
+
+	request := SnapshotRequest{
+		Term:         numbers[0],
+		LeaderID:     fields[1],
+		Index:        numbers[1],
+		SnapshotTerm: numbers[2],
+		Offset:       numbers[3],
+		Done:         fields[5] == "1",
+		Logs:         make([]wal.Log, len(fields)-6),
+	}
+	for idx, field := range fields[6:] {
+		if err := request.Logs[idx].UnmarshalText([]byte(field)); err != nil {
+			return "", err
+		}
+	}
+
+	response := n.HandleSnapshot(request)
+	return fmt.Sprintf("[ok] %d %s", response.Term, formatBool(response.Success)), nil
+}
+
+func (n *Node) handleProposeRequest(ctx context.Context, fields []string) (string, error) {
+	if len(fields) != 1 {
+		return "", errors.New("invalid request")
+	}
+
+	var log wal.Log
+	if err := log.UnmarshalText([]byte(fields[0])); err != nil {
+		return "", err
+	}
+
+	index, err := n.HandlePropose(ctx, log)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("[ok] %d", index), nil
+}
+
+// formatEntry encodes the entry as term:log, where the log is empty for an
+// entry without a command.
+func formatEntry(entry Entry) (string, error) {
+	term := strconv.FormatUint(entry.Term, 10)
+	if entry.Command == nil {
+		return term + ":", nil
+	}
+
+	text, err := entry.Command.MarshalText()
+	if err != nil {
+		return "", err
+	}
+	return term + ":" + string(text), nil
+}
+
+func parseEntry(field string) (Entry, error) {
+	termText, text, ok := strings.Cut(field, ":")
+	if !ok {
+		return Entry{}, errors.New("invalid entry")
+	}
+
+	var entry Entry
+	var err error
+	if entry.Term, err = strconv.ParseUint(termText, 10, 64); err != nil {
+		return Entry{}, err
+	}
+	if text != "" {
+		entry.Command = &wal.Log{}
+		if err := entry.Command.UnmarshalText([]byte(text)); err != nil {
+			return Entry{}, err
+		}
+	}
+	return entry, nil
+}
+
+func parseNumbers(fields ...string) ([]uint64, error) {
+	numbers := make([]uint64, 0, len(fields))
+	for _, field := range fields {
+		number, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %w", err)
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+func formatBool(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
@@ -7,20 +7,214 @@ const (
 	SetCommandID
 	GetCommandID
 	DelCommandID
+	TTLCommandID
+	ExpireCommandID
+	PersistCommandID
+	InfoCommandID
+	BeginCommandID
+	CommitCommandID
+	RollbackCommandID
+	RangeCommandID
+	ScanCommandID
+	KeysCommandID
+	CASCommandID
+	IncrCommandID
+	DecrCommandID
+	IncrByCommandID
+	DecrByCommandID
+	MGetCommandID
+	MSetCommandID
+	MDelCommandID
+	LPushCommandID
+	RPushCommandID
+	LPopCommandID
+	RPopCommandID
+	LRangeCommandID
+	LLenCommandID
+	BLPopCommandID
+	HSetCommandID
+	HGetCommandID
+	HDelCommandID
+	HGetAllCommandID
+	HKeysCommandID
+	HLenCommandID
+	SAddCommandID
+	SRemCommandID
+	SIsMemberCommandID
+	SMembersCommandID
+	SInterCommandID
+	SUnionCommandID
+	ZAddCommandID
+	ZRangeCommandID
+	ZRangeByScoreCommandID
+	ZRankCommandID
+	ZRemCommandID
+	GetVCommandID
+	SetVCommandID
+	SelectCommandID
+	FlushDBCommandID
+	ReplSyncCommandID
+	ReplInfoCommandID
+	SlotsCommandID
+	SubscribeCommandID
+	PSubscribeCommandID
+	UnsubscribeCommandID
+	PUnsubscribeCommandID
+	PublishCommandID
+	WatchCommandID
+	UnwatchCommandID
 )
 
 var (
-	UnknownCommand = "UNKNOWN"
-	SetCommand     = "SET"
-	GetCommand     = "GET"
-	DelCommand     = "DEL"
+	UnknownCommand       = "UNKNOWN"
+	SetCommand           = "SET"
+	GetCommand           = "GET"
+	DelCommand           = "DEL"
+	TTLCommand           = "TTL"
+	ExpireCommand        = "EXPIRE"
+	PersistCommand       = "PERSIST"
+	InfoCommand          = "INFO"
+	BeginCommand         = "BEGIN"
+	CommitCommand        = "COMMIT"
+	RollbackCommand      = "ROLLBACK"
+	RangeCommand         = "RANGE"
+	ScanCommand          = "SCAN"
+	KeysCommand          = "KEYS"
+	CASCommand           = "CAS"
+	IncrCommand          = "INCR"
+	DecrCommand          = "DECR"
+	IncrByCommand        = "INCRBY"
+	DecrByCommand        = "DECRBY"
+	MGetCommand          = "MGET"
+	MSetCommand          = "MSET"
+	MDelCommand          = "MDEL"
+	LPushCommand         = "LPUSH"
+	RPushCommand         = "RPUSH"
+	LPopCommand          = "LPOP"
+	RPopCommand          = "RPOP"
+	LRangeCommand        = "LRANGE"
+	LLenCommand          = "LLEN"
+	BLPopCommand         = "BLPOP"
+	HSetCommand          = "HSET"
+	HGetCommand          = "HGET"
+	HDelCommand          = "HDEL"
+	HGetAllCommand       = "HGETALL"
+	HKeysCommand         = "HKEYS"
+	HLenCommand          = "HLEN"
+	SAddCommand          = "SADD"
+	SRemCommand          = "SREM"
+	SIsMemberCommand     = "SISMEMBER"
+	SMembersCommand      = "SMEMBERS"
+	SInterCommand        = "SINTER"
+	SUnionCommand        = "SUNION"
+	ZAddCommand          = "ZADD"
+	ZRangeCommand        = "ZRANGE"
+	ZRangeByScoreCommand = "ZRANGEBYSCORE"
+	ZRankCommand         = "ZRANK"
+	ZRemCommand          = "ZREM"
+	GetVCommand          = "GETV"
+	SetVCommand          = "SETV"
+	SelectCommand        = "SELECT"
+	FlushDBCommand       = "FLUSHDB"
+	ReplSyncCommand      = "REPLSYNC"
+	ReplInfoCommand      = "REPLINFO"
+	SlotsCommand         = "SLOTS"
+	SubscribeCommand     = "SUBSCRIBE"
+	PSubscribeCommand    = "PSUBSCRIBE"
+	UnsubscribeCommand   = "UNSUBSCRIBE"
+	PUnsubscribeCommand  = "PUNSUBSCRIBE"
+	PublishCommand       = "PUBLISH"
+	WatchCommand         = "WATCH"
+	UnwatchCommand       = "UNWATCH"
 )
 
+// ExpirationOption is the optional argument of SET that is followed by the
+// TTL in seconds.
+var ExpirationOption = "EX"
+
+// NotExistsOption and ExistsOption are the optional arguments of SET that
+// make it write only a key that doesn't exist or exists.
+var (
+	NotExistsOption = "NX"
+	ExistsOption    = "XX"
+)
+
+// LimitOption is the optional argument of RANGE that is followed by the
+// maximum number of keys.
+var LimitOption = "LIMIT"
+
+// MatchOption and CountOption are the optional arguments of SCAN that are
+// followed by a glob pattern and the number of keys to read.
+var (
+	MatchOption = "MATCH"
+	CountOption = "COUNT"
+)
+
+// WithScoresOption is the optional argument of ZRANGE and ZRANGEBYSCORE that
+// adds scores to members.
+var WithScoresOption = "WITHSCORES"
+
 var commandNameToID = map[string]CmdID{
-	UnknownCommand: UnknownCommandID,
-	SetCommand:     SetCommandID,
-	GetCommand:     GetCommandID,
-	DelCommand:     DelCommandID,
+	UnknownCommand:       UnknownCommandID,
+	SetCommand:           SetCommandID,
+	GetCommand:           GetCommandID,
+	DelCommand:           DelCommandID,
+	TTLCommand:           TTLCommandID,
+	ExpireCommand:        ExpireCommandID,
+	PersistCommand:       PersistCommandID,
+	InfoCommand:          InfoCommandID,
+	BeginCommand:         BeginCommandID,
+	CommitCommand:        CommitCommandID,
+	RollbackCommand:      RollbackCommandID,
+	RangeCommand:         RangeCommandID,
+	ScanCommand:          ScanCommandID,
+	KeysCommand:          KeysCommandID,
+	CASCommand:           CASCommandID,
+	IncrCommand:          IncrCommandID,
+	DecrCommand:          DecrCommandID,
+	IncrByCommand:        IncrByCommandID,
+	DecrByCommand:        DecrByCommandID,
+	MGetCommand:          MGetCommandID,
+	MSetCommand:          MSetCommandID,
+	MDelCommand:          MDelCommandID,
+	LPushCommand:         LPushCommandID,
+	RPushCommand:         RPushCommandID,
+	LPopCommand:          LPopCommandID,
+	RPopCommand:          RPopCommandID,
+	LRangeCommand:        LRangeCommandID,
+	LLenCommand:          LLenCommandID,
+	BLPopCommand:         BLPopCommandID,
+	HSetCommand:          HSetCommandID,
+	HGetCommand:          HGetCommandID,
+	HDelCommand:          HDelCommandID,
+	HGetAllCommand:       HGetAllCommandID,
+	HKeysCommand:         HKeysCommandID,
+	HLenCommand:          HLenCommandID,
+	SAddCommand:          SAddCommandID,
+	SRemCommand:          SRemCommandID,
+	SIsMemberCommand:     SIsMemberCommandID,
+	SMembersCommand:      SMembersCommandID,
+	SInterCommand:        SInterCommandID,
+	SUnionCommand:        SUnionCommandID,
+	ZAddCommand:          ZAddCommandID,
+	ZRangeCommand:        ZRangeCommandID,
+	ZRangeByScoreCommand: ZRangeByScoreCommandID,
+	ZRankCommand:         ZRankCommandID,
+	ZRemCommand:          ZRemCommandID,
+	GetVCommand:          GetVCommandID,
+	SetVCommand:          SetVCommandID,
+	SelectCommand:        SelectCommandID,
+	FlushDBCommand:       FlushDBCommandID,
+	ReplSyncCommand:      ReplSyncCommandID,
+	ReplInfoCommand:      ReplInfoCommandID,
+	SlotsCommand:         SlotsCommandID,
+	SubscribeCommand:     SubscribeCommandID,
+	PSubscribeCommand:    PSubscribeCommandID,
+	UnsubscribeCommand:   UnsubscribeCommandID,
+	PUnsubscribeCommand:  PUnsubscribeCommandID,
+	PublishCommand:       PublishCommandID,
+	WatchCommand:         WatchCommandID,
+	UnwatchCommand:       UnwatchCommandID,
 }
 
 func GetCommandIDByName(command string) CmdID {
@@ -13,4 +13,54 @@ func TestGetCommandIDByName(t *testing.T) {
 	require.Equal(t, SetCommandID, GetCommandIDByName("SET"))
 	require.Equal(t, GetCommandID, GetCommandIDByName("GET"))
 	require.Equal(t, DelCommandID, GetCommandIDByName("DEL"))
+	require.Equal(t, TTLCommandID, GetCommandIDByName("TTL"))
+	require.Equal(t, ExpireCommandID, GetCommandIDByName("EXPIRE"))
+	require.Equal(t, PersistCommandID, GetCommandIDByName("PERSIST"))
+	require.Equal(t, InfoCommandID, GetCommandIDByName("INFO"))
+	require.Equal(t, BeginCommandID, GetCommandIDByName("BEGIN"))
+	require.Equal(t, CommitCommandID, GetCommandIDByName("COMMIT"))
+	require.Equal(t, RollbackCommandID, GetCommandIDByName("ROLLBACK"))
+	require.Equal(t, RangeCommandID, GetCommandIDByName("RANGE"))
+	require.Equal(t, ScanCommandID, GetCommandIDByName("SCAN"))
+	require.Equal(t, KeysCommandID, GetCommandIDByName("KEYS"))
+	require.Equal(t, CASCommandID, GetCommandIDByName("CAS"))
+	require.Equal(t, IncrCommandID, GetCommandIDByName("INCR"))
+	require.Equal(t, DecrCommandID, GetCommandIDByName("DECR"))
+	require.Equal(t, IncrByCommandID, GetCommandIDByName("INCRBY"))
+	require.Equal(t, DecrByCommandID, GetCommandIDByName("DECRBY"))
+	require.Equal(t, MGetCommandID, GetCommandIDByName("MGET"))
+	require.Equal(t, MSetCommandID, GetCommandIDByName("MSET"))
+	require.Equal(t, MDelCommandID, GetCommandIDByName("MDEL"))
+	require.Equal(t, LPushCommandID, GetCommandIDByName("LPUSH"))
+	require.Equal(t, RPushCommandID, GetCommandIDByName("RPUSH"))
+	require.Equal(t, LPopCommandID, GetCommandIDByName("LPOP"))
+	require.Equal(t, RPopCommandID, GetCommandIDByName("RPOP"))
+	require.Equal(t, LRangeCommandID, GetCommandIDByName("LRANGE"))
+	require.Equal(t, LLenCommandID, GetCommandIDByName("LLEN"))
+	require.Equal(t, BLPopCommandID, GetCommandIDByName("BLPOP"))
+	require.Equal(t, HSetCommandID, GetCommandIDByName("HSET"))
+	require.Equal(t, HGetCommandID, GetCommandIDByName("HGET"))
+	require.Equal(t, HDelCommandID, GetCommandIDByName("HDEL"))
+	require.Equal(t, HGetAllCommandID, GetCommandIDByName("HGETALL"))
+	require.Equal(t, HKeysCommandID, GetCommandIDByName("HKEYS"))
+	require.Equal(t, HLenCommandID, GetCommandIDByName("HLEN"))
+	require.Equal(t, SAddCommandID, GetCommandIDByName("SADD"))
+	require.Equal(t, SRemCommandID, GetCommandIDByName("SREM"))
+	require.Equal(t, SIsMemberCommandID, GetCommandIDByName("SISMEMBER"))
+	require.Equal(t, SMembersCommandID, GetCommandIDByName("SMEMBERS"))
+	require.Equal(t, SInterCommandID, GetCommandIDByName("SINTER"))
+	require.Equal(t, SUnionCommandID, GetCommandIDByName("SUNION"))
+	require.Equal(t, ZAddCommandID, GetCommandIDByName("ZADD"))
+	require.Equal(t, ZRangeCommandID, GetCommandIDByName("ZRANGE"))
+	require.Equal(t, ZRangeByScoreCommandID, GetCommandIDByName("ZRANGEBYSCORE"))
+	require.Equal(t, ZRankCommandID, GetCommandIDByName("ZRANK"))
+	require.Equal(t, ZRemCommandID, GetCommandIDByName("ZREM"))
+	require.Equal(t, SlotsCommandID, GetCommandIDByName("SLOTS"))
+	require.Equal(t, SubscribeCommandID, GetCommandIDByName("SUBSCRIBE"))
+	require.Equal(t, PSubscribeCommandID, GetCommandIDByName("PSUBSCRIBE"))
+	require.Equal(t, UnsubscribeCommandID, GetCommandIDByName("UNSUBSCRIBE"))
+	require.Equal(t, PUnsubscribeCommandID, GetCommandIDByName("PUNSUBSCRIBE"))
+	require.Equal(t, PublishCommandID, GetCommandIDByName("PUBLISH"))
+	require.Equal(t, WatchCommandID, GetCommandIDByName("WATCH"))
+	require.Equal(t, UnwatchCommandID, GetCommandIDByName("UNWATCH"))
 }
@@ -4,11 +4,18 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"math"
+	"path"
+	"strconv"
+	"time"
 
 	"kv_db/internal/database"
 	"kv_db/internal/database/compute"
 )
 
+// maxSeconds keeps a TTL representable as time.Duration.
+const maxSeconds = math.MaxInt64 / int64(time.Second)
+
 type QueryAnalyzer struct {
 	validators []func(database.Query) error
 	logger     *slog.Logger
@@ -24,9 +31,65 @@ func NewAnalyzer(logger *slog.Logger) (*QueryAnalyzer, error) {
 	}
 
 	analyser.validators = []func(database.Query) error{
-		database.SetCommandID: validateArgsCount(2),
-		database.GetCommandID: validateArgsCount(1),
-		database.DelCommandID: validateArgsCount(1),
+		database.SetCommandID:           validateSetArgs,
+		database.GetCommandID:           validateArgsCount(1),
+		database.DelCommandID:           validateArgsCount(1),
+		database.TTLCommandID:           validateArgsCount(1),
+		database.ExpireCommandID:        validateExpireArgs,
+		database.PersistCommandID:       validateArgsCount(1),
+		database.InfoCommandID:          validateArgsCount(0),
+		database.BeginCommandID:         validateArgsCount(0),
+		database.CommitCommandID:        validateArgsCount(0),
+		database.RollbackCommandID:      validateArgsCount(0),
+		database.RangeCommandID:         validateRangeArgs,
+		database.ScanCommandID:          validateScanArgs,
+		database.KeysCommandID:          validateKeysArgs,
+		database.CASCommandID:           validateArgsCount(3),
+		database.IncrCommandID:          validateArgsCount(1),
+		database.DecrCommandID:          validateArgsCount(1),
+		database.IncrByCommandID:        validateIncrementArgs,
+		database.DecrByCommandID:        validateIncrementArgs,
+		database.MGetCommandID:          validateMinArgsCount(1),
+		database.MSetCommandID:          validatePairs,
+		database.MDelCommandID:          validateMinArgsCount(1),
+		database.LPushCommandID:         validateMinArgsCount(2),
+		database.RPushCommandID:         validateMinArgsCount(2),
+		database.LPopCommandID:          validateArgsCount(1),
+		database.RPopCommandID:          validateArgsCount(1),
+		database.LRangeCommandID:        validateListRangeArgs,
+		database.LLenCommandID:          validateArgsCount(1),
+		database.BLPopCommandID:         validateBlockingPopArgs,
+		database.HSetCommandID:          validateHashSetArgs,
+		database.HGetCommandID:          validateArgsCount(2),
+		database.HDelCommandID:          validateMinArgsCount(2),
+		database.HGetAllCommandID:       validateArgsCount(1),
+		database.HKeysCommandID:         validateArgsCount(1),
+		database.HLenCommandID:          validateArgsCount(1),
+		database.SAddCommandID:          validateMinArgsCount(2),
+		database.SRemCommandID:          validateMinArgsCount(2),
+		database.SIsMemberCommandID:     validateArgsCount(2),
+		database.SMembersCommandID:      validateArgsCount(1),
+		database.SInterCommandID:        validateMinArgsCount(1),
+		database.SUnionCommandID:        validateMinArgsCount(1),
+		database.ZAddCommandID:          validateSortedSetAddArgs,
+		database.ZRangeCommandID:        validateSortedSetRangeArgs,
+		database.ZRangeByScoreCommandID: validateSortedSetRangeArgs,
+		database.ZRankCommandID:         validateArgsCount(2),
+		database.ZRemCommandID:          validateMinArgsCount(2),
+		database.GetVCommandID:          validateArgsCount(1),
+		database.SetVCommandID:          validateSetVersionArgs,
+		database.SelectCommandID:        validateSelectArgs,
+		database.FlushDBCommandID:       validateArgsCount(0),
+		database.ReplSyncCommandID:      validateReplSyncArgs,
+		database.ReplInfoCommandID:      validateArgsCount(0),
+		database.SlotsCommandID:         validateArgsCount(0),
+		database.SubscribeCommandID:     validateMinArgsCount(1),
+		database.PSubscribeCommandID:    validatePatterns,
+		database.UnsubscribeCommandID:   validateMinArgsCount(0),
+		database.PUnsubscribeCommandID:  validateMinArgsCount(0),
+		database.PublishCommandID:       validateArgsCount(2),
+		database.WatchCommandID:         validateMinArgsCount(1),
+		database.UnwatchCommandID:       validateMinArgsCount(0),
 	}
 
 	return analyser, nil
@@ -70,3 +133,283 @@ func validateArgsCount(expected int) func(database.Query) error {
 		return nil
 	}
 }
+
+func validateMinArgsCount(minimum int) func(database.Query) error {
+	return func(query database.Query) error {
+		if len(query.Arguments()) < minimum {
+			return compute.ErrInvalidArguments
+		}
+		return nil
+	}
+}
+
+// validatePairs accepts one or more key value pairs.
+func validatePairs(query database.Query) error {
+	count := len(query.Arguments())
+	if count == 0 || count%2 != 0 {
+		return compute.ErrInvalidArguments
+	}
+	return nil
+}
+
+// validateHashSetArgs accepts a key followed by one or more field value pairs.
+func validateHashSetArgs(query database.Query) error {
+	count := len(query.Arguments())
+	if count < 3 || count%2 == 0 {
+		return compute.ErrInvalidArguments
+	}
+	return nil
+}
+
+// validateSortedSetAddArgs accepts a key followed by one or more score member
+// pairs, where scores are floating point numbers.
+func validateSortedSetAddArgs(query database.Query) error {
+	if err := validateHashSetArgs(query); err != nil {
+		return err
+	}
+	arguments := query.Arguments()
+	for i := 1; i < len(arguments); i += 2 {
+		if err := validateScore(arguments[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSortedSetRangeArgs accepts "ZRANGE key start stop" with integer
+// ranks and "ZRANGEBYSCORE key min max" with scores, both followed by an
+// optional "WITHSCORES".
+func validateSortedSetRangeArgs(query database.Query) error {
+	arguments := query.Arguments()
+	if len(arguments) == 4 && arguments[3] == database.WithScoresOption {
+		arguments = arguments[:3]
+	}
+	if len(arguments) != 3 {
+		return compute.ErrInvalidArguments
+	}
+
+	for _, argument := range arguments[1:] {
+		var err error
+		if query.CommandID() == database.ZRangeCommandID {
+			_, err = strconv.Atoi(argument)
+		} else {
+			err = validateScore(argument)
+		}
+		if err != nil {
+			return compute.ErrInvalidArguments
+		}
+	}
+	return nil
+}
+
+// validateSetVersionArgs accepts "SETV key value version" with an unsigned
+// integer version.
+func validateSetVersionArgs(query database.Query) error {
+	if err := validateArgsCount(3)(query); err != nil {
+		return err
+	}
+	if _, err := strconv.ParseUint(query.Arguments()[2], 10, 64); err != nil {
+		return compute.ErrInvalidArguments
+	}
+	return nil
+}
+
+// validateSelectArgs accepts a non-negative database index.
+func validateSelectArgs(query database.Query) error {
+	if err := validateArgsCount(1)(query); err != nil {
+		return err
+	}
+	if index, err := strconv.Atoi(query.Arguments()[0]); err != nil || index < 0 {
+		return compute.ErrInvalidArguments
+	}
+	return nil
+}
+
+// validateReplSyncArgs accepts "REPLSYNC id offset" with an unsigned integer
+// offset.
+func validateReplSyncArgs(query database.Query) error {
+	if err := validateArgsCount(2)(query); err != nil {
+		return err
+	}
+	if _, err := strconv.ParseUint(query.Arguments()[1], 10, 64); err != nil {
+		return compute.ErrInvalidArguments
+	}
+	return nil
+}
+
+// validateScore accepts floating point numbers including infinities.
+func validateScore(argument string) error {
+	score, err := strconv.ParseFloat(argument, 64)
+	if err != nil || math.IsNaN(score) {
+		return compute.ErrInvalidArguments
+	}
+	return nil
+}
+
+// validateSetArgs accepts "SET key value" followed by optional "EX seconds"
+// and either "NX" or "XX" in any order.
+func validateSetArgs(query database.Query) error {
+	arguments := query.Arguments()
+	if len(arguments) < 2 {
+		return compute.ErrInvalidArguments
+	}
+
+	expiration, condition := false, false
+	for i := 2; i < len(arguments); i++ {
+		switch arguments[i] {
+		case database.ExpirationOption:
+			if expiration || i+1 == len(arguments) {
+				return compute.ErrInvalidArguments
+			}
+			expiration = true
+			i++
+			if err := validateSeconds(arguments[i]); err != nil {
+				return err
+			}
+		case database.NotExistsOption, database.ExistsOption:
+			if condition {
+				return compute.ErrInvalidArguments
+			}
+			condition = true
+		default:
+			return compute.ErrInvalidArguments
+		}
+	}
+	return nil
+}
+
+// validateRangeArgs accepts "RANGE start end" and "RANGE start end LIMIT n".
+func validateRangeArgs(query database.Query) error {
+	arguments := query.Arguments()
+	switch len(arguments) {
+	case 2:
+		return nil
+	case 4:
+		if arguments[2] != database.LimitOption {
+			return compute.ErrInvalidArguments
+		}
+		limit, err := strconv.Atoi(arguments[3])
+		if err != nil || limit <= 0 {
+			return compute.ErrInvalidArguments
+		}
+		return nil
+	}
+	return compute.ErrInvalidArguments
+}
+
+// validateScanArgs accepts "SCAN cursor" followed by optional "MATCH pattern"
+// and "COUNT n" in any order.
+func validateScanArgs(query database.Query) error {
+	arguments := query.Arguments()
+	if len(arguments) == 0 || len(arguments)%2 == 0 {
+		return compute.ErrInvalidArguments
+	}
+	if _, err := strconv.ParseUint(arguments[0], 10, 64); err != nil {
+		return compute.ErrInvalidArguments
+	}
+
+	seen := make(map[string]bool)
+	for i := 1; i < len(arguments); i += 2 {
+		option, value := arguments[i], arguments[i+1]
+		if seen[option] {
+			return compute.ErrInvalidArguments
+		}
+		seen[option] = true
+
+		var err error
+		switch option {
+		case database.MatchOption:
+			err = validatePattern(value)
+		case database.CountOption:
+			if count, parseErr := strconv.Atoi(value); parseErr != nil || count <= 0 {
+				err = compute.ErrInvalidArguments
+			}
+		default:
+			err = compute.ErrInvalidArguments
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateKeysArgs(query database.Query) error {
+	if err := validateArgsCount(1)(query); err != nil {
+		return err
+	}
+	return validatePattern(query.Arguments()[0])
+}
+
+// validatePatterns accepts one or more glob patterns.
+func validatePatterns(query database.Query) error {
+	if err := validateMinArgsCount(1)(query); err != nil {
+		return err
+	}
+	for _, pattern := range query.Arguments() {
+		if err := validatePattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return compute.ErrInvalidArguments
+	}
+	return nil
+}
+
+// validateIncrementArgs accepts "INCRBY key delta" and "DECRBY key delta"
+// with a 64-bit integer delta.
+func validateIncrementArgs(query database.Query) error {
+	if err := validateArgsCount(2)(query); err != nil {
+		return err
+	}
+	if _, err := strconv.ParseInt(query.Arguments()[1], 10, 64); err != nil {
+		return compute.ErrInvalidArguments
+	}
+	return nil
+}
+
+// validateListRangeArgs accepts "LRANGE key start stop" with integer indexes,
+// which can be negative.
+func validateListRangeArgs(query database.Query) error {
+	if err := validateArgsCount(3)(query); err != nil {
+		return err
+	}
+	for _, argument := range query.Arguments()[1:] {
+		if _, err := strconv.Atoi(argument); err != nil {
+			return compute.ErrInvalidArguments
+		}
+	}
+	return nil
+}
+
+// validateBlockingPopArgs accepts "BLPOP key timeout" with the timeout in
+// seconds, which is 0 to wait without a limit.
+func validateBlockingPopArgs(query database.Query) error {
+	if err := validateArgsCount(2)(query); err != nil {
+		return err
+	}
+	if timeout := query.Arguments()[1]; timeout != "0" {
+		return validateSeconds(timeout)
+	}
+	return nil
+}
+
+func validateExpireArgs(query database.Query) error {
+	if err := validateArgsCount(2)(query); err != nil {
+		return err
+	}
+	return validateSeconds(query.Arguments()[1])
+}
+
+func validateSeconds(argument string) error {
+	seconds, err := strconv.ParseInt(argument, 10, 64)
+	if err != nil || seconds <= 0 || seconds > maxSeconds {
+		return compute.ErrInvalidArguments
+	}
+	return nil
+}
@@ -65,6 +65,282 @@ func TestAnalyzeQuery(t *testing.T) {
 			tokens: []string{"DEL", "key", "value"},
 			expErr: compute.ErrInvalidArguments,
 		},
+		"invalid set option": {
+			tokens: []string{"SET", "key", "value", "PX", "10"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid set expiration": {
+			tokens: []string{"SET", "key", "value", "EX", "ten"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"zero set expiration": {
+			tokens: []string{"SET", "key", "value", "EX", "0"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"too big set expiration": {
+			tokens: []string{"SET", "key", "value", "EX", "9223372036854775807"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"missing set expiration": {
+			tokens: []string{"SET", "key", "value", "EX"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"both set conditions": {
+			tokens: []string{"SET", "key", "value", "NX", "XX"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"repeated set expiration": {
+			tokens: []string{"SET", "key", "value", "EX", "10", "EX", "20"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for cas query": {
+			tokens: []string{"CAS", "key", "value"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for setv query": {
+			tokens: []string{"SETV", "key", "value"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid setv version": {
+			tokens: []string{"SETV", "key", "value", "-1"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid select index": {
+			tokens: []string{"SELECT", "-1"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for flushdb query": {
+			tokens: []string{"FLUSHDB", "0"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for replsync query": {
+			tokens: []string{"REPLSYNC", "id"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid replsync offset": {
+			tokens: []string{"REPLSYNC", "id", "-1"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for replinfo query": {
+			tokens: []string{"REPLINFO", "0"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for slots query": {
+			tokens: []string{"SLOTS", "0"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for subscribe query": {
+			tokens: []string{"SUBSCRIBE"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid psubscribe pattern": {
+			tokens: []string{"PSUBSCRIBE", "news*", "news_[a-"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for publish query": {
+			tokens: []string{"PUBLISH", "news"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for watch query": {
+			tokens: []string{"WATCH"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for incr query": {
+			tokens: []string{"INCR", "key", "1"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for incrby query": {
+			tokens: []string{"INCRBY", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid delta for decrby query": {
+			tokens: []string{"DECRBY", "key", "9223372036854775808"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for mget query": {
+			tokens: []string{"MGET"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for mset query": {
+			tokens: []string{"MSET", "key1", "value1", "key2"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"empty mset query": {
+			tokens: []string{"MSET"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for mdel query": {
+			tokens: []string{"MDEL"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for lpush query": {
+			tokens: []string{"LPUSH", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for rpop query": {
+			tokens: []string{"RPOP", "key", "value"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for lrange query": {
+			tokens: []string{"LRANGE", "key", "0"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid index for lrange query": {
+			tokens: []string{"LRANGE", "key", "0", "last"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for llen query": {
+			tokens: []string{"LLEN"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for blpop query": {
+			tokens: []string{"BLPOP", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"negative timeout for blpop query": {
+			tokens: []string{"BLPOP", "key", "-1"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for hset query": {
+			tokens: []string{"HSET", "key", "field"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"missing value for hset query": {
+			tokens: []string{"HSET", "key", "field1", "value1", "field2"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for hget query": {
+			tokens: []string{"HGET", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for hdel query": {
+			tokens: []string{"HDEL", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for hgetall query": {
+			tokens: []string{"HGETALL", "key", "field"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for hkeys query": {
+			tokens: []string{"HKEYS"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for hlen query": {
+			tokens: []string{"HLEN"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for sadd query": {
+			tokens: []string{"SADD", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for sismember query": {
+			tokens: []string{"SISMEMBER", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for smembers query": {
+			tokens: []string{"SMEMBERS"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for sinter query": {
+			tokens: []string{"SINTER"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for zadd query": {
+			tokens: []string{"ZADD", "key", "1"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid score for zadd query": {
+			tokens: []string{"ZADD", "key", "1", "a", "score", "b"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"nan score for zadd query": {
+			tokens: []string{"ZADD", "key", "NaN", "a"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid rank for zrange query": {
+			tokens: []string{"ZRANGE", "key", "0", "1.5"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid option for zrange query": {
+			tokens: []string{"ZRANGE", "key", "0", "-1", "LIMIT"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid score for zrangebyscore query": {
+			tokens: []string{"ZRANGEBYSCORE", "key", "-inf", "max"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for zrank query": {
+			tokens: []string{"ZRANK", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for zrem query": {
+			tokens: []string{"ZREM", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for ttl query": {
+			tokens: []string{"TTL"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for expire query": {
+			tokens: []string{"EXPIRE", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid expire seconds": {
+			tokens: []string{"EXPIRE", "key", "value"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for persist query": {
+			tokens: []string{"PERSIST", "key", "value"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for info query": {
+			tokens: []string{"INFO", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for begin query": {
+			tokens: []string{"BEGIN", "key"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for range query": {
+			tokens: []string{"RANGE", "a"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid option for range query": {
+			tokens: []string{"RANGE", "a", "z", "COUNT", "10"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid limit for range query": {
+			tokens: []string{"RANGE", "a", "z", "LIMIT", "0"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid cursor for scan query": {
+			tokens: []string{"SCAN", "cursor"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid option for scan query": {
+			tokens: []string{"SCAN", "0", "LIMIT", "10"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"repeated option for scan query": {
+			tokens: []string{"SCAN", "0", "COUNT", "10", "COUNT", "20"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid count for scan query": {
+			tokens: []string{"SCAN", "0", "COUNT", "0"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid pattern for scan query": {
+			tokens: []string{"SCAN", "0", "MATCH", "[a"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid number arguments for keys query": {
+			tokens: []string{"KEYS"},
+			expErr: compute.ErrInvalidArguments,
+		},
+		"invalid pattern for keys query": {
+			tokens: []string{"KEYS", "user_[a-"},
+			expErr: compute.ErrInvalidArguments,
+		},
 		"valid set query": {
 			tokens:   []string{"SET", "key", "value"},
 			expQuery: database.NewQuery(database.SetCommandID, []string{"key", "value"}),
@@ -77,6 +353,258 @@ func TestAnalyzeQuery(t *testing.T) {
 			tokens:   []string{"DEL", "key"},
 			expQuery: database.NewQuery(database.DelCommandID, []string{"key"}),
 		},
+		"valid set query with expiration": {
+			tokens:   []string{"SET", "key", "value", "EX", "30"},
+			expQuery: database.NewQuery(database.SetCommandID, []string{"key", "value", "EX", "30"}),
+		},
+		"valid set query with condition": {
+			tokens:   []string{"SET", "key", "value", "NX"},
+			expQuery: database.NewQuery(database.SetCommandID, []string{"key", "value", "NX"}),
+		},
+		"valid set query with condition and expiration": {
+			tokens:   []string{"SET", "key", "value", "XX", "EX", "30"},
+			expQuery: database.NewQuery(database.SetCommandID, []string{"key", "value", "XX", "EX", "30"}),
+		},
+		"valid cas query": {
+			tokens:   []string{"CAS", "key", "old", "new"},
+			expQuery: database.NewQuery(database.CASCommandID, []string{"key", "old", "new"}),
+		},
+		"valid getv query": {
+			tokens:   []string{"GETV", "key"},
+			expQuery: database.NewQuery(database.GetVCommandID, []string{"key"}),
+		},
+		"valid setv query": {
+			tokens:   []string{"SETV", "key", "value", "42"},
+			expQuery: database.NewQuery(database.SetVCommandID, []string{"key", "value", "42"}),
+		},
+		"valid select query": {
+			tokens:   []string{"SELECT", "3"},
+			expQuery: database.NewQuery(database.SelectCommandID, []string{"3"}),
+		},
+		"valid flushdb query": {
+			tokens:   []string{"FLUSHDB"},
+			expQuery: database.NewQuery(database.FlushDBCommandID, []string{}),
+		},
+		"valid replsync query": {
+			tokens:   []string{"REPLSYNC", "?", "0"},
+			expQuery: database.NewQuery(database.ReplSyncCommandID, []string{"?", "0"}),
+		},
+		"valid replinfo query": {
+			tokens:   []string{"REPLINFO"},
+			expQuery: database.NewQuery(database.ReplInfoCommandID, []string{}),
+		},
+		"valid slots query": {
+			tokens:   []string{"SLOTS"},
+			expQuery: database.NewQuery(database.SlotsCommandID, []string{}),
+		},
+		"valid subscribe query": {
+			tokens:   []string{"SUBSCRIBE", "news", "sport"},
+			expQuery: database.NewQuery(database.SubscribeCommandID, []string{"news", "sport"}),
+		},
+		"valid psubscribe query": {
+			tokens:   []string{"PSUBSCRIBE", "news*"},
+			expQuery: database.NewQuery(database.PSubscribeCommandID, []string{"news*"}),
+		},
+		"valid unsubscribe query": {
+			tokens:   []string{"UNSUBSCRIBE"},
+			expQuery: database.NewQuery(database.UnsubscribeCommandID, []string{}),
+		},
+		"valid punsubscribe query": {
+			tokens:   []string{"PUNSUBSCRIBE", "news*"},
+			expQuery: database.NewQuery(database.PUnsubscribeCommandID, []string{"news*"}),
+		},
+		"valid publish query": {
+			tokens:   []string{"PUBLISH", "news", "hello"},
+			expQuery: database.NewQuery(database.PublishCommandID, []string{"news", "hello"}),
+		},
+		"valid watch query": {
+			tokens:   []string{"WATCH", "user.", "order."},
+			expQuery: database.NewQuery(database.WatchCommandID, []string{"user.", "order."}),
+		},
+		"valid unwatch query": {
+			tokens:   []string{"UNWATCH", "user."},
+			expQuery: database.NewQuery(database.UnwatchCommandID, []string{"user."}),
+		},
+		"valid incr query": {
+			tokens:   []string{"INCR", "key"},
+			expQuery: database.NewQuery(database.IncrCommandID, []string{"key"}),
+		},
+		"valid decr query": {
+			tokens:   []string{"DECR", "key"},
+			expQuery: database.NewQuery(database.DecrCommandID, []string{"key"}),
+		},
+		"valid incrby query": {
+			tokens:   []string{"INCRBY", "key", "-5"},
+			expQuery: database.NewQuery(database.IncrByCommandID, []string{"key", "-5"}),
+		},
+		"valid decrby query": {
+			tokens:   []string{"DECRBY", "key", "5"},
+			expQuery: database.NewQuery(database.DecrByCommandID, []string{"key", "5"}),
+		},
+		"valid mget query": {
+			tokens:   []string{"MGET", "key1", "key2"},
+			expQuery: database.NewQuery(database.MGetCommandID, []string{"key1", "key2"}),
+		},
+		"valid mset query": {
+			tokens:   []string{"MSET", "key1", "value1", "key2", "value2"},
+			expQuery: database.NewQuery(database.MSetCommandID, []string{"key1", "value1", "key2", "value2"}),
+		},
+		"valid mdel query": {
+			tokens:   []string{"MDEL", "key1"},
+			expQuery: database.NewQuery(database.MDelCommandID, []string{"key1"}),
+		},
+		"valid lpush query": {
+			tokens:   []string{"LPUSH", "key", "a", "b"},
+			expQuery: database.NewQuery(database.LPushCommandID, []string{"key", "a", "b"}),
+		},
+		"valid rpush query": {
+			tokens:   []string{"RPUSH", "key", "a"},
+			expQuery: database.NewQuery(database.RPushCommandID, []string{"key", "a"}),
+		},
+		"valid lpop query": {
+			tokens:   []string{"LPOP", "key"},
+			expQuery: database.NewQuery(database.LPopCommandID, []string{"key"}),
+		},
+		"valid rpop query": {
+			tokens:   []string{"RPOP", "key"},
+			expQuery: database.NewQuery(database.RPopCommandID, []string{"key"}),
+		},
+		"valid lrange query": {
+			tokens:   []string{"LRANGE", "key", "0", "-1"},
+			expQuery: database.NewQuery(database.LRangeCommandID, []string{"key", "0", "-1"}),
+		},
+		"valid llen query": {
+			tokens:   []string{"LLEN", "key"},
+			expQuery: database.NewQuery(database.LLenCommandID, []string{"key"}),
+		},
+		"valid blpop query": {
+			tokens:   []string{"BLPOP", "key", "5"},
+			expQuery: database.NewQuery(database.BLPopCommandID, []string{"key", "5"}),
+		},
+		"valid blpop query without timeout": {
+			tokens:   []string{"BLPOP", "key", "0"},
+			expQuery: database.NewQuery(database.BLPopCommandID, []string{"key", "0"}),
+		},
+		"valid hset query": {
+			tokens:   []string{"HSET", "key", "field1", "value1", "field2", "value2"},
+			expQuery: database.NewQuery(database.HSetCommandID, []string{"key", "field1", "value1", "field2", "value2"}),
+		},
+		"valid hget query": {
+			tokens:   []string{"HGET", "key", "field"},
+			expQuery: database.NewQuery(database.HGetCommandID, []string{"key", "field"}),
+		},
+		"valid hdel query": {
+			tokens:   []string{"HDEL", "key", "field1", "field2"},
+			expQuery: database.NewQuery(database.HDelCommandID, []string{"key", "field1", "field2"}),
+		},
+		"valid hgetall query": {
+			tokens:   []string{"HGETALL", "key"},
+			expQuery: database.NewQuery(database.HGetAllCommandID, []string{"key"}),
+		},
+		"valid hkeys query": {
+			tokens:   []string{"HKEYS", "key"},
+			expQuery: database.NewQuery(database.HKeysCommandID, []string{"key"}),
+		},
+		"valid hlen query": {
+			tokens:   []string{"HLEN", "key"},
+			expQuery: database.NewQuery(database.HLenCommandID, []string{"key"}),
+		},
+		"valid sadd query": {
+			tokens:   []string{"SADD", "key", "a", "b"},
+			expQuery: database.NewQuery(database.SAddCommandID, []string{"key", "a", "b"}),
+		},
+		"valid srem query": {
+			tokens:   []string{"SREM", "key", "a"},
+			expQuery: database.NewQuery(database.SRemCommandID, []string{"key", "a"}),
+		},
+		"valid sismember query": {
+			tokens:   []string{"SISMEMBER", "key", "a"},
+			expQuery: database.NewQuery(database.SIsMemberCommandID, []string{"key", "a"}),
+		},
+		"valid smembers query": {
+			tokens:   []string{"SMEMBERS", "key"},
+			expQuery: database.NewQuery(database.SMembersCommandID, []string{"key"}),
+		},
+		"valid sinter query": {
+			tokens:   []string{"SINTER", "key1", "key2"},
+			expQuery: database.NewQuery(database.SInterCommandID, []string{"key1", "key2"}),
+		},
+		"valid sunion query": {
+			tokens:   []string{"SUNION", "key1"},
+			expQuery: database.NewQuery(database.SUnionCommandID, []string{"key1"}),
+		},
+		"valid zadd query": {
+			tokens:   []string{"ZADD", "key", "1.5", "a", "-2e+3", "b"},
+			expQuery: database.NewQuery(database.ZAddCommandID, []string{"key", "1.5", "a", "-2e+3", "b"}),
+		},
+		"valid zrange query": {
+			tokens:   []string{"ZRANGE", "key", "0", "-1"},
+			expQuery: database.NewQuery(database.ZRangeCommandID, []string{"key", "0", "-1"}),
+		},
+		"valid zrange query with scores": {
+			tokens:   []string{"ZRANGE", "key", "0", "-1", "WITHSCORES"},
+			expQuery: database.NewQuery(database.ZRangeCommandID, []string{"key", "0", "-1", "WITHSCORES"}),
+		},
+		"valid zrangebyscore query": {
+			tokens:   []string{"ZRANGEBYSCORE", "key", "-inf", "+inf", "WITHSCORES"},
+			expQuery: database.NewQuery(database.ZRangeByScoreCommandID, []string{"key", "-inf", "+inf", "WITHSCORES"}),
+		},
+		"valid zrank query": {
+			tokens:   []string{"ZRANK", "key", "a"},
+			expQuery: database.NewQuery(database.ZRankCommandID, []string{"key", "a"}),
+		},
+		"valid zrem query": {
+			tokens:   []string{"ZREM", "key", "a", "b"},
+			expQuery: database.NewQuery(database.ZRemCommandID, []string{"key", "a", "b"}),
+		},
+		"valid ttl query": {
+			tokens:   []string{"TTL", "key"},
+			expQuery: database.NewQuery(database.TTLCommandID, []string{"key"}),
+		},
+		"valid expire query": {
+			tokens:   []string{"EXPIRE", "key", "30"},
+			expQuery: database.NewQuery(database.ExpireCommandID, []string{"key", "30"}),
+		},
+		"valid persist query": {
+			tokens:   []string{"PERSIST", "key"},
+			expQuery: database.NewQuery(database.PersistCommandID, []string{"key"}),
+		},
+		"valid info query": {
+			tokens:   []string{"INFO"},
+			expQuery: database.NewQuery(database.InfoCommandID, []string{}),
+		},
+		"valid begin query": {
+			tokens:   []string{"BEGIN"},
+			expQuery: database.NewQuery(database.BeginCommandID, []string{}),
+		},
+		"valid commit query": {
+			tokens:   []string{"COMMIT"},
+			expQuery: database.NewQuery(database.CommitCommandID, []string{}),
+		},
+		"valid rollback query": {
+			tokens:   []string{"ROLLBACK"},
+			expQuery: database.NewQuery(database.RollbackCommandID, []string{}),
+		},
+		"valid scan query": {
+			tokens:   []string{"SCAN", "0"},
+			expQuery: database.NewQuery(database.ScanCommandID, []string{"0"}),
+		},
+		"valid scan query with options": {
+			tokens:   []string{"SCAN", "42", "COUNT", "5", "MATCH", "user_*"},
+			expQuery: database.NewQuery(database.ScanCommandID, []string{"42", "COUNT", "5", "MATCH", "user_*"}),
+		},
+		"valid keys query": {
+			tokens:   []string{"KEYS", "user_?"},
+			expQuery: database.NewQuery(database.KeysCommandID, []string{"user_?"}),
+		},
+		"valid range query": {
+			tokens:   []string{"RANGE", "a", "z"},
+			expQuery: database.NewQuery(database.RangeCommandID, []string{"a", "z"}),
+		},
+		"valid range query with limit": {
+			tokens:   []string{"RANGE", "a", "z", "LIMIT", "10"},
+			expQuery: database.NewQuery(database.RangeCommandID, []string{"a", "z", "LIMIT", "10"}),
+		},
 	}
 
 	for name, tc := range testcases {
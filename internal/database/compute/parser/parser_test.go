@@ -74,6 +74,14 @@ func TestParse(t *testing.T) {
 			query:  ".set#",
 			expErr: compute.ErrInvalidSymbol,
 		},
+		"query with glob pattern": {
+			query:     "keys user_[a-c]?*",
+			expTokens: []string{"keys", "user_[a-c]?*"},
+		},
+		"query with float numbers": {
+			query:     "zadd board 1.5 alice -2e+3 bob",
+			expTokens: []string{"zadd", "board", "1.5", "alice", "-2e+3", "bob"},
+		},
 		"query with two tokens with additional spaces": {
 			query:     " get   key  ",
 			expTokens: []string{"get", "key"},
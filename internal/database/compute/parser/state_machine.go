@@ -36,7 +36,7 @@ func (sm *StateMachine) Parse(query string) ([]string, error) {
 		switch {
 		case isWhiteSpace(symbol):
 			sm.currentState.skipLetter()
-		case isLetter(symbol):
+		case isLetter(symbol), isPatternSymbol(symbol), isNumberSymbol(symbol):
 			sm.currentState.appendLetter(symbol)
 		default:
 			return nil, compute.ErrInvalidSymbol
@@ -110,6 +110,18 @@ func isWhiteSpace(symbol byte) bool {
 	return symbol == '\t' || symbol == '\n' || symbol == ' '
 }
 
+// isPatternSymbol reports whether the symbol is a special symbol of glob
+// patterns.
+func isPatternSymbol(symbol byte) bool {
+	return symbol == '*' || symbol == '?' || symbol == '[' || symbol == ']' || symbol == '^' || symbol == '-'
+}
+
+// isNumberSymbol reports whether the symbol is a special symbol of floating
+// point numbers besides the minus, which is a pattern symbol.
+func isNumberSymbol(symbol byte) bool {
+	return symbol == '.' || symbol == '+'
+}
+
 func isLetter(symbol byte) bool {
 	return (symbol >= 'a' && symbol <= 'z') ||
 		(symbol >= 'A' && symbol <= 'Z') ||
@@ -5,6 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kv_db/internal/database/storage"
+	"kv_db/internal/pubsub"
+	"kv_db/internal/sharding"
 )
 
 type ComputeLayer interface {
@@ -13,17 +22,133 @@ type ComputeLayer interface {
 
 type StorageLayer interface {
 	Set(ctx context.Context, key, value string) error
+	SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error
 	Get(ctx context.Context, key string) (string, bool, error)
+	GetWithVersion(ctx context.Context, key string) (string, uint64, bool, error)
+	SetIfVersion(ctx context.Context, key, value string, expected uint64) (uint64, error)
 	Delete(ctx context.Context, key string) error
+	Expire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	Persist(ctx context.Context, key string) (bool, error)
+	TTL(ctx context.Context, key string) (time.Duration, bool, error)
+	Info(ctx context.Context) (map[string]string, error)
+	SetIf(ctx context.Context, key, value string, ttl time.Duration, condition storage.SetCondition) (bool, error)
+	CompareAndSwap(ctx context.Context, key, expected, value string) (bool, error)
+	Increment(ctx context.Context, key string, delta int64) (int64, error)
+	Commit(ctx context.Context, tx *storage.Transaction) error
+	Range(ctx context.Context, start, end string, limit int) ([]storage.KeyValue, error)
+	Scan(ctx context.Context, cursor uint64, pattern string, count int) ([]string, uint64, error)
+	Keys(ctx context.Context, pattern string) ([]string, error)
+	Push(ctx context.Context, key string, left bool, values ...string) (int, error)
+	Pop(ctx context.Context, key string, left bool) (string, bool, error)
+	BlockingPop(ctx context.Context, key string, left bool, timeout time.Duration) (string, bool, error)
+	ListRange(ctx context.Context, key string, start, stop int) ([]string, error)
+	ListLen(ctx context.Context, key string) (int, error)
+	HashSet(ctx context.Context, key string, pairs ...string) (int, error)
+	HashGet(ctx context.Context, key, field string) (string, bool, error)
+	HashDelete(ctx context.Context, key string, fields ...string) (int, error)
+	HashGetAll(ctx context.Context, key string) (map[string]string, error)
+	HashLen(ctx context.Context, key string) (int, error)
+	SetAdd(ctx context.Context, key string, members ...string) (int, error)
+	SetRemove(ctx context.Context, key string, members ...string) (int, error)
+	SetIsMember(ctx context.Context, key, member string) (bool, error)
+	SetMembers(ctx context.Context, key string) ([]string, error)
+	SetIntersect(ctx context.Context, keys ...string) ([]string, error)
+	SetUnion(ctx context.Context, keys ...string) ([]string, error)
+	SortedSetAdd(ctx context.Context, key string, members ...storage.ScoredMember) (int, error)
+	SortedSetRemove(ctx context.Context, key string, members ...string) (int, error)
+	SortedSetRange(ctx context.Context, key string, start, stop int) ([]storage.ScoredMember, error)
+	SortedSetRangeByScore(ctx context.Context, key string, minScore, maxScore float64) ([]storage.ScoredMember, error)
+	SortedSetRank(ctx context.Context, key, member string) (int, bool, error)
+	Flush(ctx context.Context) error
+	Changes(ctx context.Context, id string, offset uint64) (storage.Changes, error)
+}
+
+// ReplicationLayer reports the role of the server and the state of the
+// replication.
+type ReplicationLayer interface {
+	Info(ctx context.Context) map[string]string
+}
+
+// ShardingLayer maps keys to the nodes of a sharded cluster by their slots.
+type ShardingLayer interface {
+	// Owner returns the slot of the key and the address of the node that
+	// owns it, which is empty if this node owns it.
+	Owner(key string) (int, string)
+	Ranges() []sharding.Range
+}
+
+// PubSubLayer delivers messages published to channels to the sessions that
+// are subscribed to them.
+type PubSubLayer interface {
+	Publish(channel, message string) int
+	NewSubscriber() *pubsub.Subscriber
+}
+
+// REPLSYNC responses start with one of the kinds of changes.
+const (
+	ReplSyncSnapshot = "snapshot"
+	ReplSyncLogs     = "logs"
+)
+
+// replSyncTimeout is the longest time REPLSYNC waits for changes, so an idle
+// replica still hears from the primary regularly.
+const replSyncTimeout = time.Second
+
+type DatabaseOption func(*Database)
+
+// WithReplication makes REPLINFO report the state of the replication.
+func WithReplication(replicationLayer ReplicationLayer) DatabaseOption {
+	return func(database *Database) {
+		database.replicationLayer = replicationLayer
+	}
+}
+
+// WithSharding makes the database serve only the keys of its slots. A query
+// with keys of another node is answered with "[moved] slot address".
+func WithSharding(shardingLayer ShardingLayer) DatabaseOption {
+	return func(database *Database) {
+		database.shardingLayer = shardingLayer
+	}
+}
+
+// WithPubSub enables PUBLISH and the subscriptions of sessions. Databases
+// that share the layer share their channels.
+func WithPubSub(pubSubLayer PubSubLayer) DatabaseOption {
+	return func(database *Database) {
+		database.pubSubLayer = pubSubLayer
+	}
 }
 
+// WithKeyspaceEvents enables WATCH, which streams the changes of keys to
+// sessions. The storage layers must publish their events to the pubsub layer
+// with the indexes of their databases.
+func WithKeyspaceEvents() DatabaseOption {
+	return func(database *Database) {
+		database.keyspaceEvents = true
+	}
+}
+
+// defaultScanCount is the number of keys that SCAN reads without COUNT.
+const defaultScanCount = 10
+
 type Database struct {
-	computeLayer ComputeLayer
-	storageLayer StorageLayer
-	logger       *slog.Logger
+	computeLayer     ComputeLayer
+	storageLayer     StorageLayer
+	replicationLayer ReplicationLayer
+	shardingLayer    ShardingLayer
+	pubSubLayer      PubSubLayer
+	keyspaceEvents   bool
+	logger           *slog.Logger
+	// index is the index of the keyspace, which WATCH subscribes to.
+	index int
+	// keyspaces are the databases that sessions switch between with SELECT,
+	// including this one.
+	keyspaces []*Database
 }
 
-func NewDatabase(computeLayer ComputeLayer, storageLayer StorageLayer, logger *slog.Logger) (*Database, error) {
+func NewDatabase(
+	computeLayer ComputeLayer, storageLayer StorageLayer, logger *slog.Logger, options ...DatabaseOption,
+) (*Database, error) {
 	if computeLayer == nil {
 		return nil, errors.New("database compute is invalid")
 	}
@@ -36,11 +161,46 @@ func NewDatabase(computeLayer ComputeLayer, storageLayer StorageLayer, logger *s
 		return nil, errors.New("database logger is invalid")
 	}
 
-	return &Database{
+	database := &Database{
 		computeLayer: computeLayer,
 		storageLayer: storageLayer,
 		logger:       logger,
-	}, nil
+	}
+	for _, option := range options {
+		option(database)
+	}
+	database.keyspaces = []*Database{database}
+	return database, nil
+}
+
+// NewDatabases creates a database for every storage layer. They are isolated
+// keyspaces with the indexes of their storage layers, and a session switches
+// between them with SELECT.
+func NewDatabases(
+	computeLayer ComputeLayer, storageLayers []StorageLayer, logger *slog.Logger, options ...DatabaseOption,
+) ([]*Database, error) {
+	if len(storageLayers) == 0 {
+		return nil, errors.New("database storages are invalid")
+	}
+
+	if logger == nil {
+		return nil, errors.New("database logger is invalid")
+	}
+
+	databases := make([]*Database, 0, len(storageLayers))
+	for idx, storageLayer := range storageLayers {
+		database, err := NewDatabase(computeLayer, storageLayer, logger.With(slog.Int("db", idx)), options...)
+		if err != nil {
+			return nil, err
+		}
+		database.index = idx
+		databases = append(databases, database)
+	}
+
+	for _, database := range databases {
+		database.keyspaces = databases
+	}
+	return databases, nil
 }
 
 func MustDatabase(computeLayer ComputeLayer, storageLayer StorageLayer, logger *slog.Logger) *Database {
@@ -51,19 +211,138 @@ func MustDatabase(computeLayer ComputeLayer, storageLayer StorageLayer, logger *
 	return database
 }
 
+// HandleQuery handles a query that doesn't depend on previous ones. Queries
+// of a client connection are handled by a Session.
 func (d *Database) HandleQuery(ctx context.Context, queryStr string) string {
 	query, err := d.computeLayer.HandleQuery(ctx, queryStr)
 	if err != nil {
 		return fmt.Sprintf("[error] %s", err.Error())
 	}
 
+	if response, moved := d.redirect(query); moved {
+		return response
+	}
+	return d.handleQuery(ctx, query)
+}
+
+// redirect returns the response to a query whose keys this node doesn't own.
+// Keys of a query must be owned by a single node.
+func (d *Database) redirect(query Query) (string, bool) {
+	if d.shardingLayer == nil {
+		return "", false
+	}
+
+	keys := query.Keys()
+	if len(keys) == 0 {
+		return "", false
+	}
+
+	slot, owner := d.shardingLayer.Owner(keys[0])
+	for _, key := range keys[1:] {
+		if _, keyOwner := d.shardingLayer.Owner(key); keyOwner != owner {
+			return "[error] keys of the query belong to different nodes", true
+		}
+	}
+	if owner == "" {
+		return "", false
+	}
+	return fmt.Sprintf("[moved] %d %s", slot, owner), true
+}
+
+func (d *Database) handleQuery(ctx context.Context, query Query) string {
 	switch query.CommandID() {
 	case SetCommandID:
 		return d.handleSetQuery(ctx, query)
-	case GetCommandID:
+	case GetCommandID, GetVCommandID:
 		return d.handleGetQuery(ctx, query)
+	case SetVCommandID:
+		return d.handleSetVersionQuery(ctx, query)
 	case DelCommandID:
 		return d.handleDelQuery(ctx, query)
+	case TTLCommandID:
+		return d.handleTTLQuery(ctx, query)
+	case ExpireCommandID:
+		return d.handleExpireQuery(ctx, query)
+	case PersistCommandID:
+		return d.handlePersistQuery(ctx, query)
+	case InfoCommandID:
+		return d.handleInfoQuery(ctx)
+	case RangeCommandID:
+		return d.handleRangeQuery(ctx, query)
+	case ScanCommandID:
+		return d.handleScanQuery(ctx, query)
+	case KeysCommandID:
+		return d.handleKeysQuery(ctx, query)
+	case CASCommandID:
+		return d.handleCASQuery(ctx, query)
+	case IncrCommandID, DecrCommandID, IncrByCommandID, DecrByCommandID:
+		return d.handleIncrementQuery(ctx, query)
+	case MGetCommandID:
+		return d.handleMGetQuery(ctx, query, nil)
+	case MSetCommandID, MDelCommandID:
+		tx := storage.NewTransaction()
+		writeMultiQuery(tx, query)
+		if err := d.storageLayer.Commit(ctx, tx); err != nil {
+			return fmt.Sprintf("[error] %s", err.Error())
+		}
+		return "[ok]"
+	case LPushCommandID, RPushCommandID:
+		return d.handlePushQuery(ctx, query)
+	case LPopCommandID, RPopCommandID:
+		return d.handlePopQuery(ctx, query)
+	case BLPopCommandID:
+		return d.handleBlockingPopQuery(ctx, query)
+	case LRangeCommandID:
+		return d.handleListRangeQuery(ctx, query)
+	case LLenCommandID:
+		return d.handleListLenQuery(ctx, query)
+	case HSetCommandID:
+		return d.handleHashSetQuery(ctx, query)
+	case HGetCommandID:
+		return d.handleHashGetQuery(ctx, query)
+	case HDelCommandID:
+		return d.handleHashDelQuery(ctx, query)
+	case HGetAllCommandID, HKeysCommandID:
+		return d.handleHashGetAllQuery(ctx, query)
+	case HLenCommandID:
+		return d.handleHashLenQuery(ctx, query)
+	case SAddCommandID, SRemCommandID, ZAddCommandID, ZRemCommandID:
+		return d.handleMembersWriteQuery(ctx, query)
+	case SIsMemberCommandID:
+		return d.handleSetIsMemberQuery(ctx, query)
+	case SMembersCommandID, SInterCommandID, SUnionCommandID:
+		return d.handleSetReadQuery(ctx, query)
+	case ZRangeCommandID, ZRangeByScoreCommandID:
+		return d.handleSortedSetRangeQuery(ctx, query)
+	case ZRankCommandID:
+		return d.handleSortedSetRankQuery(ctx, query)
+	case FlushDBCommandID:
+		if err := d.storageLayer.Flush(ctx); err != nil {
+			return fmt.Sprintf("[error] %s", err.Error())
+		}
+		return "[ok]"
+	case ReplSyncCommandID:
+		return d.handleReplSyncQuery(ctx, query)
+	case ReplInfoCommandID:
+		if d.replicationLayer == nil {
+			return "[error] replication is disabled"
+		}
+		return formatFields(d.replicationLayer.Info(ctx))
+	case SlotsCommandID:
+		return d.handleSlotsQuery()
+	case PublishCommandID:
+		if d.pubSubLayer == nil {
+			return "[error] pubsub is disabled"
+		}
+		arguments := query.Arguments()
+		return fmt.Sprintf("[ok] %d", d.pubSubLayer.Publish(arguments[0], arguments[1]))
+	case SubscribeCommandID, PSubscribeCommandID, UnsubscribeCommandID, PUnsubscribeCommandID,
+		WatchCommandID, UnwatchCommandID:
+		return "[error] subscriptions require a session"
+	case BeginCommandID, CommitCommandID, RollbackCommandID:
+		return "[error] transactions require a session"
+	case SelectCommandID:
+		return "[error] databases are selected by a session"
 	case UnknownCommandID:
 		d.logger.Error("compute layer is incorrect")
 	}
@@ -71,17 +350,128 @@ func (d *Database) HandleQuery(ctx context.Context, queryStr string) string {
 	return "[error] internal configuration error"
 }
 
+// handleSetQuery returns [nil] if a conditional write hasn't happened.
 func (d *Database) handleSetQuery(ctx context.Context, query Query) string {
 	arguments := query.Arguments()
-	if err := d.storageLayer.Set(ctx, arguments[0], arguments[1]); err != nil {
+	options := parseSetOptions(arguments[2:])
+
+	if options.conditional {
+		ok, err := d.storageLayer.SetIf(ctx, arguments[0], arguments[1], options.ttl, options.condition)
+		if err != nil {
+			return fmt.Sprintf("[error] %s", err.Error())
+		}
+		if !ok {
+			return "[nil]"
+		}
+		return "[ok]"
+	}
+
+	var err error
+	if options.ttl != 0 {
+		err = d.storageLayer.SetWithTTL(ctx, arguments[0], arguments[1], options.ttl)
+	} else {
+		err = d.storageLayer.Set(ctx, arguments[0], arguments[1])
+	}
+	if err != nil {
 		return fmt.Sprintf("[error] %s", err.Error())
 	}
 
 	return "[ok]"
 }
 
+// setOptions are the optional arguments of SET, which are validated by the
+// analyzer.
+type setOptions struct {
+	ttl         time.Duration
+	conditional bool
+	condition   storage.SetCondition
+}
+
+func parseSetOptions(arguments []string) setOptions {
+	var options setOptions
+	for i := 0; i < len(arguments); i++ {
+		switch arguments[i] {
+		case ExpirationOption:
+			i++
+			options.ttl = parseSeconds(arguments[i])
+		case NotExistsOption:
+			options.conditional, options.condition = true, storage.IfNotExists
+		case ExistsOption:
+			options.conditional, options.condition = true, storage.IfExists
+		}
+	}
+	return options
+}
+
+// handleSlotsQuery returns the ranges of slots with the addresses of their
+// nodes as "start-end address" values.
+func (d *Database) handleSlotsQuery() string {
+	if d.shardingLayer == nil {
+		return "[error] sharding is disabled"
+	}
+
+	ranges := d.shardingLayer.Ranges()
+	values := make([]string, 0, len(ranges))
+	for _, slotRange := range ranges {
+		values = append(values, slotRange.String())
+	}
+	return formatValues(values)
+}
+
+// handleCASQuery returns [nil] if the current value differs from the expected
+// one.
+func (d *Database) handleCASQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	ok, err := d.storageLayer.CompareAndSwap(ctx, arguments[0], arguments[1], arguments[2])
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	if !ok {
+		return "[nil]"
+	}
+
+	return "[ok]"
+}
+
+// handleIncrementQuery handles INCR, DECR, INCRBY and DECRBY and returns the
+// new value.
+func (d *Database) handleIncrementQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	delta := int64(1)
+	if len(arguments) == 2 {
+		delta, _ = strconv.ParseInt(arguments[1], 10, 64)
+	}
+
+	if commandID := query.CommandID(); commandID == DecrCommandID || commandID == DecrByCommandID {
+		if delta == math.MinInt64 {
+			return fmt.Sprintf("[error] %s", storage.ErrOverflow.Error())
+		}
+		delta = -delta
+	}
+
+	value, err := d.storageLayer.Increment(ctx, arguments[0], delta)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	return fmt.Sprintf("[ok] %d", value)
+}
+
+// handleGetQuery handles GET and GETV. GETV returns the version after the
+// value as "[ok] value version".
 func (d *Database) handleGetQuery(ctx context.Context, query Query) string {
 	arguments := query.Arguments()
+	if query.CommandID() == GetVCommandID {
+		value, version, ok, err := d.storageLayer.GetWithVersion(ctx, arguments[0])
+		if err != nil {
+			return fmt.Sprintf("[error] %s", err.Error())
+		}
+		if !ok {
+			return "[nil]"
+		}
+		return fmt.Sprintf("[ok] %s %d", value, version)
+	}
+
 	value, ok, err := d.storageLayer.Get(ctx, arguments[0])
 	if err != nil {
 		return fmt.Sprintf("[error] %s", err.Error())
@@ -93,6 +483,63 @@ func (d *Database) handleGetQuery(ctx context.Context, query Query) string {
 	return fmt.Sprintf("[ok] %s", value)
 }
 
+// handleSetVersionQuery returns the new version of the key. The expected
+// version of a missing key is 0.
+func (d *Database) handleSetVersionQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	expected, _ := strconv.ParseUint(arguments[2], 10, 64)
+	version, err := d.storageLayer.SetIfVersion(ctx, arguments[0], arguments[1], expected)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	return fmt.Sprintf("[ok] %d", version)
+}
+
+// handleMGetQuery returns the values of the keys as a multi-value response
+// with [nil] for missing keys. Writes of the transaction, if it isn't nil,
+// are read before the storage.
+func (d *Database) handleMGetQuery(ctx context.Context, query Query, tx *storage.Transaction) string {
+	keys := query.Arguments()
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		var value string
+		found, written := false, false
+		if tx != nil {
+			value, found, written = tx.Get(key)
+		}
+
+		if !written {
+			var err error
+			if value, found, err = d.storageLayer.Get(ctx, key); err != nil {
+				return fmt.Sprintf("[error] %s", err.Error())
+			}
+		}
+
+		if !found {
+			value = "[nil]"
+		}
+		values = append(values, value)
+	}
+	return formatValues(values)
+}
+
+// writeMultiQuery adds the writes of MSET or MDEL to the transaction, so
+// they are applied atomically.
+func writeMultiQuery(tx *storage.Transaction, query Query) {
+	arguments := query.Arguments()
+	if query.CommandID() == MDelCommandID {
+		for _, key := range arguments {
+			tx.Delete(key)
+		}
+		return
+	}
+
+	for i := 0; i < len(arguments); i += 2 {
+		tx.Set(arguments[i], arguments[i+1])
+	}
+}
+
 func (d *Database) handleDelQuery(ctx context.Context, query Query) string {
 	arguments := query.Arguments()
 	if err := d.storageLayer.Delete(ctx, arguments[0]); err != nil {
@@ -101,3 +548,414 @@ func (d *Database) handleDelQuery(ctx context.Context, query Query) string {
 
 	return "[ok]"
 }
+
+// handleTTLQuery returns the remaining TTL in seconds rounded up, or -1 if
+// the key doesn't expire.
+func (d *Database) handleTTLQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	ttl, ok, err := d.storageLayer.TTL(ctx, arguments[0])
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	if !ok {
+		return "[nil]"
+	}
+	if ttl < 0 {
+		return "[ok] -1"
+	}
+
+	return fmt.Sprintf("[ok] %d", (ttl+time.Second-1)/time.Second)
+}
+
+func (d *Database) handleExpireQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	ok, err := d.storageLayer.Expire(ctx, arguments[0], parseSeconds(arguments[1]))
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	if !ok {
+		return "[nil]"
+	}
+
+	return "[ok]"
+}
+
+func (d *Database) handlePersistQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	ok, err := d.storageLayer.Persist(ctx, arguments[0])
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	if !ok {
+		return "[nil]"
+	}
+
+	return "[ok]"
+}
+
+// handleInfoQuery returns the storage statistics as fields.
+func (d *Database) handleInfoQuery(ctx context.Context) string {
+	info, err := d.storageLayer.Info(ctx)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	return formatFields(info)
+}
+
+// formatFields returns space separated name:value fields sorted by name.
+func formatFields(info map[string]string) string {
+	names := make([]string, 0, len(info))
+	for name := range info {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]string, 0, len(info))
+	for _, name := range names {
+		fields = append(fields, name+":"+info[name])
+	}
+	return fmt.Sprintf("[ok] %s", strings.Join(fields, " "))
+}
+
+// handleReplSyncQuery returns the changes that follow the offset of the
+// storage start with the ID as "[ok] kind id offset head" and a line per log.
+// It waits for changes at most replSyncTimeout.
+func (d *Database) handleReplSyncQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	offset, _ := strconv.ParseUint(arguments[1], 10, 64)
+
+	ctx, cancel := context.WithTimeout(ctx, replSyncTimeout)
+	defer cancel()
+	changes, err := d.storageLayer.Changes(ctx, arguments[0], offset)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	kind := ReplSyncLogs
+	if changes.Snapshot {
+		kind = ReplSyncSnapshot
+	}
+
+	var response strings.Builder
+	fmt.Fprintf(&response, "[ok] %s %s %d %d", kind, changes.ID, changes.Offset, changes.Head)
+	for _, log := range changes.Logs {
+		text, err := log.MarshalText()
+		if err != nil {
+			return fmt.Sprintf("[error] %s", err.Error())
+		}
+		response.WriteByte('\n')
+		response.Write(text)
+	}
+	return response.String()
+}
+
+// handleRangeQuery returns the keys between the bounds inclusively with
+// their values as a multi-value response.
+func (d *Database) handleRangeQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	limit := 0
+	if len(arguments) == 4 {
+		limit, _ = strconv.Atoi(arguments[3])
+	}
+
+	pairs, err := d.storageLayer.Range(ctx, arguments[0], arguments[1], limit)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	values := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		values = append(values, pair.Key+" "+pair.Value)
+	}
+	return formatValues(values)
+}
+
+// handleScanQuery returns the cursor of the next call followed by the keys
+// as a multi-value response. The iteration is over when the cursor is 0.
+func (d *Database) handleScanQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	cursor, _ := strconv.ParseUint(arguments[0], 10, 64)
+	pattern, count := "*", defaultScanCount
+	for i := 1; i < len(arguments); i += 2 {
+		if arguments[i] == MatchOption {
+			pattern = arguments[i+1]
+		} else {
+			count, _ = strconv.Atoi(arguments[i+1])
+		}
+	}
+
+	keys, next, err := d.storageLayer.Scan(ctx, cursor, pattern, count)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	return formatValues(append([]string{strconv.FormatUint(next, 10)}, keys...))
+}
+
+func (d *Database) handleKeysQuery(ctx context.Context, query Query) string {
+	keys, err := d.storageLayer.Keys(ctx, query.Arguments()[0])
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	return formatValues(keys)
+}
+
+// handlePushQuery handles LPUSH and RPUSH and returns the length of the list.
+func (d *Database) handlePushQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	left := query.CommandID() == LPushCommandID
+	length, err := d.storageLayer.Push(ctx, arguments[0], left, arguments[1:]...)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	return fmt.Sprintf("[ok] %d", length)
+}
+
+func (d *Database) handlePopQuery(ctx context.Context, query Query) string {
+	left := query.CommandID() == LPopCommandID
+	value, ok, err := d.storageLayer.Pop(ctx, query.Arguments()[0], left)
+	return formatPopResult(value, ok, err)
+}
+
+// handleBlockingPopQuery parks the client until a value is pushed or the
+// timeout is over, and returns [nil] in the latter case.
+func (d *Database) handleBlockingPopQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	value, ok, err := d.storageLayer.BlockingPop(ctx, arguments[0], true, parseSeconds(arguments[1]))
+	return formatPopResult(value, ok, err)
+}
+
+func formatPopResult(value string, ok bool, err error) string {
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	if !ok {
+		return "[nil]"
+	}
+
+	return fmt.Sprintf("[ok] %s", value)
+}
+
+// handleListRangeQuery returns the values of the list between the indexes
+// inclusively as a multi-value response.
+func (d *Database) handleListRangeQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	start, _ := strconv.Atoi(arguments[1])
+	stop, _ := strconv.Atoi(arguments[2])
+
+	values, err := d.storageLayer.ListRange(ctx, arguments[0], start, stop)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	return formatValues(values)
+}
+
+func (d *Database) handleListLenQuery(ctx context.Context, query Query) string {
+	length, err := d.storageLayer.ListLen(ctx, query.Arguments()[0])
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	return fmt.Sprintf("[ok] %d", length)
+}
+
+// handleHashSetQuery returns the number of new fields of the hash.
+func (d *Database) handleHashSetQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	added, err := d.storageLayer.HashSet(ctx, arguments[0], arguments[1:]...)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	return fmt.Sprintf("[ok] %d", added)
+}
+
+func (d *Database) handleHashGetQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	value, ok, err := d.storageLayer.HashGet(ctx, arguments[0], arguments[1])
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	if !ok {
+		return "[nil]"
+	}
+
+	return fmt.Sprintf("[ok] %s", value)
+}
+
+// handleHashDelQuery returns the number of deleted fields of the hash.
+func (d *Database) handleHashDelQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	deleted, err := d.storageLayer.HashDelete(ctx, arguments[0], arguments[1:]...)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	return fmt.Sprintf("[ok] %d", deleted)
+}
+
+// handleHashGetAllQuery handles HGETALL and HKEYS and returns the fields of
+// the hash sorted by name as a multi-value response. HGETALL follows every
+// field with its value.
+func (d *Database) handleHashGetAllQuery(ctx context.Context, query Query) string {
+	fields, err := d.storageLayer.HashGetAll(ctx, query.Arguments()[0])
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if query.CommandID() == HGetAllCommandID {
+		for i, name := range names {
+			names[i] = name + " " + fields[name]
+		}
+	}
+	return formatValues(names)
+}
+
+func (d *Database) handleHashLenQuery(ctx context.Context, query Query) string {
+	length, err := d.storageLayer.HashLen(ctx, query.Arguments()[0])
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	return fmt.Sprintf("[ok] %d", length)
+}
+
+// handleMembersWriteQuery handles SADD, SREM, ZADD and ZREM and returns the
+// number of added or removed members.
+func (d *Database) handleMembersWriteQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	key, members := arguments[0], arguments[1:]
+
+	var count int
+	var err error
+	switch commandID := query.CommandID(); {
+	case commandID == SAddCommandID:
+		count, err = d.storageLayer.SetAdd(ctx, key, members...)
+	case commandID == SRemCommandID:
+		count, err = d.storageLayer.SetRemove(ctx, key, members...)
+	case commandID == ZAddCommandID:
+		scored := make([]storage.ScoredMember, 0, len(members)/2)
+		for i := 0; i < len(members); i += 2 {
+			score, _ := strconv.ParseFloat(members[i], 64)
+			scored = append(scored, storage.ScoredMember{Member: members[i+1], Score: score})
+		}
+		count, err = d.storageLayer.SortedSetAdd(ctx, key, scored...)
+	default:
+		count, err = d.storageLayer.SortedSetRemove(ctx, key, members...)
+	}
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	return fmt.Sprintf("[ok] %d", count)
+}
+
+// handleSetIsMemberQuery returns 1 if the member belongs to the set and 0
+// otherwise.
+func (d *Database) handleSetIsMemberQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	ok, err := d.storageLayer.SetIsMember(ctx, arguments[0], arguments[1])
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	if !ok {
+		return "[ok] 0"
+	}
+
+	return "[ok] 1"
+}
+
+// handleSetReadQuery handles SMEMBERS, SINTER and SUNION and returns the
+// sorted members as a multi-value response.
+func (d *Database) handleSetReadQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+
+	var members []string
+	var err error
+	switch commandID := query.CommandID(); {
+	case commandID == SMembersCommandID:
+		members, err = d.storageLayer.SetMembers(ctx, arguments[0])
+	case commandID == SInterCommandID:
+		members, err = d.storageLayer.SetIntersect(ctx, arguments...)
+	default:
+		members, err = d.storageLayer.SetUnion(ctx, arguments...)
+	}
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	sort.Strings(members)
+	return formatValues(members)
+}
+
+// handleSortedSetRangeQuery handles ZRANGE and ZRANGEBYSCORE and returns the
+// members in the order of scores as a multi-value response. WITHSCORES
+// follows every member with its score.
+func (d *Database) handleSortedSetRangeQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+
+	var members []storage.ScoredMember
+	var err error
+	if query.CommandID() == ZRangeCommandID {
+		start, _ := strconv.Atoi(arguments[1])
+		stop, _ := strconv.Atoi(arguments[2])
+		members, err = d.storageLayer.SortedSetRange(ctx, arguments[0], start, stop)
+	} else {
+		minScore, _ := strconv.ParseFloat(arguments[1], 64)
+		maxScore, _ := strconv.ParseFloat(arguments[2], 64)
+		members, err = d.storageLayer.SortedSetRangeByScore(ctx, arguments[0], minScore, maxScore)
+	}
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	withScores := len(arguments) == 4
+	values := make([]string, 0, len(members))
+	for _, member := range members {
+		if withScores {
+			values = append(values, member.Member+" "+strconv.FormatFloat(member.Score, 'g', -1, 64))
+		} else {
+			values = append(values, member.Member)
+		}
+	}
+	return formatValues(values)
+}
+
+// handleSortedSetRankQuery returns the zero-based rank of the member in the
+// order of scores.
+func (d *Database) handleSortedSetRankQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+	rank, ok, err := d.storageLayer.SortedSetRank(ctx, arguments[0], arguments[1])
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	if !ok {
+		return "[nil]"
+	}
+
+	return fmt.Sprintf("[ok] %d", rank)
+}
+
+// formatValues returns a multi-value response: the number of values followed
+// by one numbered value per line. The numbers keep values from being taken
+// for the end delimiter of the network protocol.
+func formatValues(values []string) string {
+	var builder strings.Builder
+	builder.WriteString("[ok] " + strconv.Itoa(len(values)))
+	for i, value := range values {
+		builder.WriteString(fmt.Sprintf("\n%d) %s", i+1, value))
+	}
+	return builder.String()
+}
+
+// parseSeconds parses a number of seconds that is validated by the analyzer.
+func parseSeconds(argument string) time.Duration {
+	seconds, _ := strconv.ParseInt(argument, 10, 64)
+	return time.Duration(seconds) * time.Second
+}
@@ -11,7 +11,11 @@ package database
 
 import (
 	context "context"
+	storage "kv_db/internal/database/storage"
+	pubsub "kv_db/internal/pubsub"
+	sharding "kv_db/internal/sharding"
 	reflect "reflect"
+	time "time"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -77,6 +81,66 @@ func (m *MockStorageLayer) EXPECT() *MockStorageLayerMockRecorder {
 	return m.recorder
 }
 
+// BlockingPop mocks base method.
+func (m *MockStorageLayer) BlockingPop(ctx context.Context, key string, left bool, timeout time.Duration) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BlockingPop", ctx, key, left, timeout)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// BlockingPop indicates an expected call of BlockingPop.
+func (mr *MockStorageLayerMockRecorder) BlockingPop(ctx, key, left, timeout any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BlockingPop", reflect.TypeOf((*MockStorageLayer)(nil).BlockingPop), ctx, key, left, timeout)
+}
+
+// Changes mocks base method.
+func (m *MockStorageLayer) Changes(ctx context.Context, id string, offset uint64) (storage.Changes, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Changes", ctx, id, offset)
+	ret0, _ := ret[0].(storage.Changes)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Changes indicates an expected call of Changes.
+func (mr *MockStorageLayerMockRecorder) Changes(ctx, id, offset any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Changes", reflect.TypeOf((*MockStorageLayer)(nil).Changes), ctx, id, offset)
+}
+
+// Commit mocks base method.
+func (m *MockStorageLayer) Commit(ctx context.Context, tx *storage.Transaction) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Commit", ctx, tx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Commit indicates an expected call of Commit.
+func (mr *MockStorageLayerMockRecorder) Commit(ctx, tx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockStorageLayer)(nil).Commit), ctx, tx)
+}
+
+// CompareAndSwap mocks base method.
+func (m *MockStorageLayer) CompareAndSwap(ctx context.Context, key, expected, value string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareAndSwap", ctx, key, expected, value)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareAndSwap indicates an expected call of CompareAndSwap.
+func (mr *MockStorageLayerMockRecorder) CompareAndSwap(ctx, key, expected, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAndSwap", reflect.TypeOf((*MockStorageLayer)(nil).CompareAndSwap), ctx, key, expected, value)
+}
+
 // Delete mocks base method.
 func (m *MockStorageLayer) Delete(ctx context.Context, key string) error {
 	m.ctrl.T.Helper()
@@ -91,6 +155,35 @@ func (mr *MockStorageLayerMockRecorder) Delete(ctx, key any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockStorageLayer)(nil).Delete), ctx, key)
 }
 
+// Expire mocks base method.
+func (m *MockStorageLayer) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Expire", ctx, key, ttl)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Expire indicates an expected call of Expire.
+func (mr *MockStorageLayerMockRecorder) Expire(ctx, key, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expire", reflect.TypeOf((*MockStorageLayer)(nil).Expire), ctx, key, ttl)
+}
+
+// Flush mocks base method.
+func (m *MockStorageLayer) Flush(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush.
+func (mr *MockStorageLayerMockRecorder) Flush(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockStorageLayer)(nil).Flush), ctx)
+}
+
 // Get mocks base method.
 func (m *MockStorageLayer) Get(ctx context.Context, key string) (string, bool, error) {
 	m.ctrl.T.Helper()
@@ -107,6 +200,266 @@ func (mr *MockStorageLayerMockRecorder) Get(ctx, key any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStorageLayer)(nil).Get), ctx, key)
 }
 
+// GetWithVersion mocks base method.
+func (m *MockStorageLayer) GetWithVersion(ctx context.Context, key string) (string, uint64, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWithVersion", ctx, key)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(uint64)
+	ret2, _ := ret[2].(bool)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// GetWithVersion indicates an expected call of GetWithVersion.
+func (mr *MockStorageLayerMockRecorder) GetWithVersion(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithVersion", reflect.TypeOf((*MockStorageLayer)(nil).GetWithVersion), ctx, key)
+}
+
+// HashDelete mocks base method.
+func (m *MockStorageLayer) HashDelete(ctx context.Context, key string, fields ...string) (int, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, key}
+	for _, a := range fields {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "HashDelete", varargs...)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HashDelete indicates an expected call of HashDelete.
+func (mr *MockStorageLayerMockRecorder) HashDelete(ctx, key any, fields ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, key}, fields...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashDelete", reflect.TypeOf((*MockStorageLayer)(nil).HashDelete), varargs...)
+}
+
+// HashGet mocks base method.
+func (m *MockStorageLayer) HashGet(ctx context.Context, key, field string) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashGet", ctx, key, field)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// HashGet indicates an expected call of HashGet.
+func (mr *MockStorageLayerMockRecorder) HashGet(ctx, key, field any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashGet", reflect.TypeOf((*MockStorageLayer)(nil).HashGet), ctx, key, field)
+}
+
+// HashGetAll mocks base method.
+func (m *MockStorageLayer) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashGetAll", ctx, key)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HashGetAll indicates an expected call of HashGetAll.
+func (mr *MockStorageLayerMockRecorder) HashGetAll(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashGetAll", reflect.TypeOf((*MockStorageLayer)(nil).HashGetAll), ctx, key)
+}
+
+// HashLen mocks base method.
+func (m *MockStorageLayer) HashLen(ctx context.Context, key string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashLen", ctx, key)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HashLen indicates an expected call of HashLen.
+func (mr *MockStorageLayerMockRecorder) HashLen(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashLen", reflect.TypeOf((*MockStorageLayer)(nil).HashLen), ctx, key)
+}
+
+// HashSet mocks base method.
+func (m *MockStorageLayer) HashSet(ctx context.Context, key string, pairs ...string) (int, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, key}
+	for _, a := range pairs {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "HashSet", varargs...)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HashSet indicates an expected call of HashSet.
+func (mr *MockStorageLayerMockRecorder) HashSet(ctx, key any, pairs ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, key}, pairs...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashSet", reflect.TypeOf((*MockStorageLayer)(nil).HashSet), varargs...)
+}
+
+// Increment mocks base method.
+func (m *MockStorageLayer) Increment(ctx context.Context, key string, delta int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Increment", ctx, key, delta)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Increment indicates an expected call of Increment.
+func (mr *MockStorageLayerMockRecorder) Increment(ctx, key, delta any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Increment", reflect.TypeOf((*MockStorageLayer)(nil).Increment), ctx, key, delta)
+}
+
+// Info mocks base method.
+func (m *MockStorageLayer) Info(ctx context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Info", ctx)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Info indicates an expected call of Info.
+func (mr *MockStorageLayerMockRecorder) Info(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Info", reflect.TypeOf((*MockStorageLayer)(nil).Info), ctx)
+}
+
+// Keys mocks base method.
+func (m *MockStorageLayer) Keys(ctx context.Context, pattern string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Keys", ctx, pattern)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Keys indicates an expected call of Keys.
+func (mr *MockStorageLayerMockRecorder) Keys(ctx, pattern any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Keys", reflect.TypeOf((*MockStorageLayer)(nil).Keys), ctx, pattern)
+}
+
+// ListLen mocks base method.
+func (m *MockStorageLayer) ListLen(ctx context.Context, key string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLen", ctx, key)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLen indicates an expected call of ListLen.
+func (mr *MockStorageLayerMockRecorder) ListLen(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLen", reflect.TypeOf((*MockStorageLayer)(nil).ListLen), ctx, key)
+}
+
+// ListRange mocks base method.
+func (m *MockStorageLayer) ListRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListRange", ctx, key, start, stop)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListRange indicates an expected call of ListRange.
+func (mr *MockStorageLayerMockRecorder) ListRange(ctx, key, start, stop any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRange", reflect.TypeOf((*MockStorageLayer)(nil).ListRange), ctx, key, start, stop)
+}
+
+// Persist mocks base method.
+func (m *MockStorageLayer) Persist(ctx context.Context, key string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Persist", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Persist indicates an expected call of Persist.
+func (mr *MockStorageLayerMockRecorder) Persist(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Persist", reflect.TypeOf((*MockStorageLayer)(nil).Persist), ctx, key)
+}
+
+// Pop mocks base method.
+func (m *MockStorageLayer) Pop(ctx context.Context, key string, left bool) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pop", ctx, key, left)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Pop indicates an expected call of Pop.
+func (mr *MockStorageLayerMockRecorder) Pop(ctx, key, left any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pop", reflect.TypeOf((*MockStorageLayer)(nil).Pop), ctx, key, left)
+}
+
+// Push mocks base method.
+func (m *MockStorageLayer) Push(ctx context.Context, key string, left bool, values ...string) (int, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, key, left}
+	for _, a := range values {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Push", varargs...)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Push indicates an expected call of Push.
+func (mr *MockStorageLayerMockRecorder) Push(ctx, key, left any, values ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, key, left}, values...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Push", reflect.TypeOf((*MockStorageLayer)(nil).Push), varargs...)
+}
+
+// Range mocks base method.
+func (m *MockStorageLayer) Range(ctx context.Context, start, end string, limit int) ([]storage.KeyValue, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Range", ctx, start, end, limit)
+	ret0, _ := ret[0].([]storage.KeyValue)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Range indicates an expected call of Range.
+func (mr *MockStorageLayerMockRecorder) Range(ctx, start, end, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Range", reflect.TypeOf((*MockStorageLayer)(nil).Range), ctx, start, end, limit)
+}
+
+// Scan mocks base method.
+func (m *MockStorageLayer) Scan(ctx context.Context, cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Scan", ctx, cursor, pattern, count)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(uint64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Scan indicates an expected call of Scan.
+func (mr *MockStorageLayerMockRecorder) Scan(ctx, cursor, pattern, count any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scan", reflect.TypeOf((*MockStorageLayer)(nil).Scan), ctx, cursor, pattern, count)
+}
+
 // Set mocks base method.
 func (m *MockStorageLayer) Set(ctx context.Context, key, value string) error {
 	m.ctrl.T.Helper()
@@ -120,3 +473,399 @@ func (mr *MockStorageLayerMockRecorder) Set(ctx, key, value any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockStorageLayer)(nil).Set), ctx, key, value)
 }
+
+// SetAdd mocks base method.
+func (m *MockStorageLayer) SetAdd(ctx context.Context, key string, members ...string) (int, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, key}
+	for _, a := range members {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SetAdd", varargs...)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetAdd indicates an expected call of SetAdd.
+func (mr *MockStorageLayerMockRecorder) SetAdd(ctx, key any, members ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, key}, members...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAdd", reflect.TypeOf((*MockStorageLayer)(nil).SetAdd), varargs...)
+}
+
+// SetIf mocks base method.
+func (m *MockStorageLayer) SetIf(ctx context.Context, key, value string, ttl time.Duration, condition storage.SetCondition) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetIf", ctx, key, value, ttl, condition)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetIf indicates an expected call of SetIf.
+func (mr *MockStorageLayerMockRecorder) SetIf(ctx, key, value, ttl, condition any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetIf", reflect.TypeOf((*MockStorageLayer)(nil).SetIf), ctx, key, value, ttl, condition)
+}
+
+// SetIfVersion mocks base method.
+func (m *MockStorageLayer) SetIfVersion(ctx context.Context, key, value string, expected uint64) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetIfVersion", ctx, key, value, expected)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetIfVersion indicates an expected call of SetIfVersion.
+func (mr *MockStorageLayerMockRecorder) SetIfVersion(ctx, key, value, expected any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetIfVersion", reflect.TypeOf((*MockStorageLayer)(nil).SetIfVersion), ctx, key, value, expected)
+}
+
+// SetIntersect mocks base method.
+func (m *MockStorageLayer) SetIntersect(ctx context.Context, keys ...string) ([]string, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx}
+	for _, a := range keys {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SetIntersect", varargs...)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetIntersect indicates an expected call of SetIntersect.
+func (mr *MockStorageLayerMockRecorder) SetIntersect(ctx any, keys ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx}, keys...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetIntersect", reflect.TypeOf((*MockStorageLayer)(nil).SetIntersect), varargs...)
+}
+
+// SetIsMember mocks base method.
+func (m *MockStorageLayer) SetIsMember(ctx context.Context, key, member string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetIsMember", ctx, key, member)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetIsMember indicates an expected call of SetIsMember.
+func (mr *MockStorageLayerMockRecorder) SetIsMember(ctx, key, member any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetIsMember", reflect.TypeOf((*MockStorageLayer)(nil).SetIsMember), ctx, key, member)
+}
+
+// SetMembers mocks base method.
+func (m *MockStorageLayer) SetMembers(ctx context.Context, key string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMembers", ctx, key)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetMembers indicates an expected call of SetMembers.
+func (mr *MockStorageLayerMockRecorder) SetMembers(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMembers", reflect.TypeOf((*MockStorageLayer)(nil).SetMembers), ctx, key)
+}
+
+// SetRemove mocks base method.
+func (m *MockStorageLayer) SetRemove(ctx context.Context, key string, members ...string) (int, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, key}
+	for _, a := range members {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SetRemove", varargs...)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetRemove indicates an expected call of SetRemove.
+func (mr *MockStorageLayerMockRecorder) SetRemove(ctx, key any, members ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, key}, members...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRemove", reflect.TypeOf((*MockStorageLayer)(nil).SetRemove), varargs...)
+}
+
+// SetUnion mocks base method.
+func (m *MockStorageLayer) SetUnion(ctx context.Context, keys ...string) ([]string, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx}
+	for _, a := range keys {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SetUnion", varargs...)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetUnion indicates an expected call of SetUnion.
+func (mr *MockStorageLayerMockRecorder) SetUnion(ctx any, keys ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx}, keys...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUnion", reflect.TypeOf((*MockStorageLayer)(nil).SetUnion), varargs...)
+}
+
+// SetWithTTL mocks base method.
+func (m *MockStorageLayer) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetWithTTL", ctx, key, value, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetWithTTL indicates an expected call of SetWithTTL.
+func (mr *MockStorageLayerMockRecorder) SetWithTTL(ctx, key, value, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWithTTL", reflect.TypeOf((*MockStorageLayer)(nil).SetWithTTL), ctx, key, value, ttl)
+}
+
+// SortedSetAdd mocks base method.
+func (m *MockStorageLayer) SortedSetAdd(ctx context.Context, key string, members ...storage.ScoredMember) (int, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, key}
+	for _, a := range members {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SortedSetAdd", varargs...)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SortedSetAdd indicates an expected call of SortedSetAdd.
+func (mr *MockStorageLayerMockRecorder) SortedSetAdd(ctx, key any, members ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, key}, members...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SortedSetAdd", reflect.TypeOf((*MockStorageLayer)(nil).SortedSetAdd), varargs...)
+}
+
+// SortedSetRange mocks base method.
+func (m *MockStorageLayer) SortedSetRange(ctx context.Context, key string, start, stop int) ([]storage.ScoredMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SortedSetRange", ctx, key, start, stop)
+	ret0, _ := ret[0].([]storage.ScoredMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SortedSetRange indicates an expected call of SortedSetRange.
+func (mr *MockStorageLayerMockRecorder) SortedSetRange(ctx, key, start, stop any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SortedSetRange", reflect.TypeOf((*MockStorageLayer)(nil).SortedSetRange), ctx, key, start, stop)
+}
+
+// SortedSetRangeByScore mocks base method.
+func (m *MockStorageLayer) SortedSetRangeByScore(ctx context.Context, key string, minScore, maxScore float64) ([]storage.ScoredMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SortedSetRangeByScore", ctx, key, minScore, maxScore)
+	ret0, _ := ret[0].([]storage.ScoredMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SortedSetRangeByScore indicates an expected call of SortedSetRangeByScore.
+func (mr *MockStorageLayerMockRecorder) SortedSetRangeByScore(ctx, key, minScore, maxScore any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SortedSetRangeByScore", reflect.TypeOf((*MockStorageLayer)(nil).SortedSetRangeByScore), ctx, key, minScore, maxScore)
+}
+
+// SortedSetRank mocks base method.
+func (m *MockStorageLayer) SortedSetRank(ctx context.Context, key, member string) (int, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SortedSetRank", ctx, key, member)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SortedSetRank indicates an expected call of SortedSetRank.
+func (mr *MockStorageLayerMockRecorder) SortedSetRank(ctx, key, member any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SortedSetRank", reflect.TypeOf((*MockStorageLayer)(nil).SortedSetRank), ctx, key, member)
+}
+
+// SortedSetRemove mocks base method.
+func (m *MockStorageLayer) SortedSetRemove(ctx context.Context, key string, members ...string) (int, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, key}
+	for _, a := range members {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SortedSetRemove", varargs...)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SortedSetRemove indicates an expected call of SortedSetRemove.
+func (mr *MockStorageLayerMockRecorder) SortedSetRemove(ctx, key any, members ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, key}, members...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SortedSetRemove", reflect.TypeOf((*MockStorageLayer)(nil).SortedSetRemove), varargs...)
+}
+
+// TTL mocks base method.
+func (m *MockStorageLayer) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TTL", ctx, key)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// TTL indicates an expected call of TTL.
+func (mr *MockStorageLayerMockRecorder) TTL(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TTL", reflect.TypeOf((*MockStorageLayer)(nil).TTL), ctx, key)
+}
+
+// MockReplicationLayer is a mock of ReplicationLayer interface.
+type MockReplicationLayer struct {
+	ctrl     *gomock.Controller
+	recorder *MockReplicationLayerMockRecorder
+}
+
+// MockReplicationLayerMockRecorder is the mock recorder for MockReplicationLayer.
+type MockReplicationLayerMockRecorder struct {
+	mock *MockReplicationLayer
+}
+
+// NewMockReplicationLayer creates a new mock instance.
+func NewMockReplicationLayer(ctrl *gomock.Controller) *MockReplicationLayer {
+	mock := &MockReplicationLayer{ctrl: ctrl}
+	mock.recorder = &MockReplicationLayerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReplicationLayer) EXPECT() *MockReplicationLayerMockRecorder {
+	return m.recorder
+}
+
+// Info mocks base method.
+func (m *MockReplicationLayer) Info(ctx context.Context) map[string]string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Info", ctx)
+	ret0, _ := ret[0].(map[string]string)
+	return ret0
+}
+
+// Info indicates an expected call of Info.
+func (mr *MockReplicationLayerMockRecorder) Info(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Info", reflect.TypeOf((*MockReplicationLayer)(nil).Info), ctx)
+}
+
+// MockShardingLayer is a mock of ShardingLayer interface.
+type MockShardingLayer struct {
+	ctrl     *gomock.Controller
+	recorder *MockShardingLayerMockRecorder
+}
+
+// MockShardingLayerMockRecorder is the mock recorder for MockShardingLayer.
+type MockShardingLayerMockRecorder struct {
+	mock *MockShardingLayer
+}
+
+// NewMockShardingLayer creates a new mock instance.
+func NewMockShardingLayer(ctrl *gomock.Controller) *MockShardingLayer {
+	mock := &MockShardingLayer{ctrl: ctrl}
+	mock.recorder = &MockShardingLayerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockShardingLayer) EXPECT() *MockShardingLayerMockRecorder {
+	return m.recorder
+}
+
+// Owner mocks base method.
+func (m *MockShardingLayer) Owner(key string) (int, string) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Owner", key)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(string)
+	return ret0, ret1
+}
+
+// Owner indicates an expected call of Owner.
+func (mr *MockShardingLayerMockRecorder) Owner(key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Owner", reflect.TypeOf((*MockShardingLayer)(nil).Owner), key)
+}
+
+// Ranges mocks base method.
+func (m *MockShardingLayer) Ranges() []sharding.Range {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ranges")
+	ret0, _ := ret[0].([]sharding.Range)
+	return ret0
+}
+
+// Ranges indicates an expected call of Ranges.
+func (mr *MockShardingLayerMockRecorder) Ranges() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ranges", reflect.TypeOf((*MockShardingLayer)(nil).Ranges))
+}
+
+// MockPubSubLayer is a mock of PubSubLayer interface.
+type MockPubSubLayer struct {
+	ctrl     *gomock.Controller
+	recorder *MockPubSubLayerMockRecorder
+}
+
+// MockPubSubLayerMockRecorder is the mock recorder for MockPubSubLayer.
+type MockPubSubLayerMockRecorder struct {
+	mock *MockPubSubLayer
+}
+
+// NewMockPubSubLayer creates a new mock instance.
+func NewMockPubSubLayer(ctrl *gomock.Controller) *MockPubSubLayer {
+	mock := &MockPubSubLayer{ctrl: ctrl}
+	mock.recorder = &MockPubSubLayerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPubSubLayer) EXPECT() *MockPubSubLayerMockRecorder {
+	return m.recorder
+}
+
+// NewSubscriber mocks base method.
+func (m *MockPubSubLayer) NewSubscriber() *pubsub.Subscriber {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewSubscriber")
+	ret0, _ := ret[0].(*pubsub.Subscriber)
+	return ret0
+}
+
+// NewSubscriber indicates an expected call of NewSubscriber.
+func (mr *MockPubSubLayerMockRecorder) NewSubscriber() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewSubscriber", reflect.TypeOf((*MockPubSubLayer)(nil).NewSubscriber))
+}
+
+// Publish mocks base method.
+func (m *MockPubSubLayer) Publish(channel, message string) int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Publish", channel, message)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Publish indicates an expected call of Publish.
+func (mr *MockPubSubLayerMockRecorder) Publish(channel, message any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Publish", reflect.TypeOf((*MockPubSubLayer)(nil).Publish), channel, message)
+}
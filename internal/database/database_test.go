@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 
+	"kv_db/internal/database/storage"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/internal/sharding"
 	"kv_db/pkg/dlog"
 )
 
@@ -35,6 +40,29 @@ func TestNewDatabase(t *testing.T) {
 	require.NotNil(t, database)
 }
 
+func TestNewDatabases(t *testing.T) {
+	t.Parallel()
+
+	compute, storage := getMockComputeAndStorage(t)
+
+	databases, err := NewDatabases(compute, nil, dlog.NewNonSlog())
+	require.Error(t, err)
+	require.Nil(t, databases)
+
+	databases, err = NewDatabases(compute, []StorageLayer{storage, nil}, dlog.NewNonSlog())
+	require.Error(t, err)
+	require.Nil(t, databases)
+
+	databases, err = NewDatabases(compute, []StorageLayer{storage}, nil)
+	require.Error(t, err)
+	require.Nil(t, databases)
+
+	databases, err = NewDatabases(compute, []StorageLayer{storage, storage}, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.Len(t, databases, 2)
+	require.Equal(t, databases, databases[1].keyspaces)
+}
+
 func TestMustDatabase(t *testing.T) {
 	t.Parallel()
 
@@ -89,6 +117,679 @@ func TestDatabase_SetCommand(t *testing.T) {
 	})
 }
 
+func TestDatabase_ConditionalSetCommand(t *testing.T) {
+	t.Parallel()
+
+	testcases := map[string]struct {
+		arguments []string
+		ttl       time.Duration
+		condition storage.SetCondition
+		ok        bool
+		err       error
+		expRes    string
+	}{
+		"set if not exists": {
+			arguments: []string{"key", "value", "NX"},
+			condition: storage.IfNotExists,
+			ok:        true,
+			expRes:    "[ok]",
+		},
+		"set if exists with expiration": {
+			arguments: []string{"key", "value", "EX", "10", "XX"},
+			ttl:       10 * time.Second,
+			condition: storage.IfExists,
+			ok:        true,
+			expRes:    "[ok]",
+		},
+		"condition doesn't hold": {
+			arguments: []string{"key", "value", "NX"},
+			condition: storage.IfNotExists,
+			expRes:    "[nil]",
+		},
+		"conditional set error": {
+			arguments: []string{"key", "value", "XX"},
+			condition: storage.IfExists,
+			err:       errors.New("test error"),
+			expRes:    "[error] test error",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			compute, storageLayer := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+			require.NoError(t, err)
+			inputQuery := "SET " + strings.Join(tc.arguments, " ")
+			compute.EXPECT().HandleQuery(ctx, inputQuery).Return(NewQuery(SetCommandID, tc.arguments), nil)
+			storageLayer.EXPECT().SetIf(ctx, "key", "value", tc.ttl, tc.condition).Return(tc.ok, tc.err)
+
+			require.Equal(t, tc.expRes, database.HandleQuery(ctx, inputQuery))
+		})
+	}
+}
+
+func TestDatabase_CASCommand(t *testing.T) {
+	t.Parallel()
+
+	testcases := map[string]struct {
+		ok     bool
+		err    error
+		expRes string
+	}{
+		"swapped":        {ok: true, expRes: "[ok]"},
+		"not swapped":    {expRes: "[nil]"},
+		"swapping error": {err: errors.New("test error"), expRes: "[error] test error"},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			compute, storageLayer := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+			require.NoError(t, err)
+			inputQuery := "CAS key old new"
+			query := NewQuery(CASCommandID, []string{"key", "old", "new"})
+			compute.EXPECT().HandleQuery(ctx, inputQuery).Return(query, nil)
+			storageLayer.EXPECT().CompareAndSwap(ctx, "key", "old", "new").Return(tc.ok, tc.err)
+
+			require.Equal(t, tc.expRes, database.HandleQuery(ctx, inputQuery))
+		})
+	}
+}
+
+func TestDatabase_VersionCommands(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storageLayer := getMockComputeAndStorage(t)
+	database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	handle := func(queryStr string, query Query) string {
+		compute.EXPECT().HandleQuery(ctx, queryStr).Return(query, nil)
+		return database.HandleQuery(ctx, queryStr)
+	}
+
+	storageLayer.EXPECT().GetWithVersion(ctx, "key").Return("value", uint64(42), true, nil)
+	require.Equal(t, "[ok] value 42", handle("GETV key", NewQuery(GetVCommandID, []string{"key"})))
+	storageLayer.EXPECT().GetWithVersion(ctx, "key").Return("", uint64(0), false, nil)
+	require.Equal(t, "[nil]", handle("GETV key", NewQuery(GetVCommandID, []string{"key"})))
+
+	setQuery := NewQuery(SetVCommandID, []string{"key", "new", "42"})
+	storageLayer.EXPECT().SetIfVersion(ctx, "key", "new", uint64(42)).Return(uint64(43), nil)
+	require.Equal(t, "[ok] 43", handle("SETV key new 42", setQuery))
+	storageLayer.EXPECT().SetIfVersion(ctx, "key", "new", uint64(42)).Return(uint64(0), storage.ErrVersionConflict)
+	require.Equal(t, "[error] version of the key has changed", handle("SETV key new 42", setQuery))
+}
+
+func TestDatabase_FlushDBCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storageLayer := getMockComputeAndStorage(t)
+	database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+	require.NoError(t, err)
+	compute.EXPECT().HandleQuery(ctx, "FLUSHDB").Return(NewQuery(FlushDBCommandID, nil), nil).Times(2)
+
+	storageLayer.EXPECT().Flush(ctx).Return(nil)
+	require.Equal(t, "[ok]", database.HandleQuery(ctx, "FLUSHDB"))
+	storageLayer.EXPECT().Flush(ctx).Return(errors.New("test error"))
+	require.Equal(t, "[error] test error", database.HandleQuery(ctx, "FLUSHDB"))
+}
+
+func TestDatabase_ReplSyncCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storageLayer := getMockComputeAndStorage(t)
+	database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+	require.NoError(t, err)
+	query := NewQuery(ReplSyncCommandID, []string{"id", "5"})
+	compute.EXPECT().HandleQuery(ctx, "REPLSYNC id 5").Return(query, nil).Times(3)
+
+	log := wal.NewLog(0, wal.SetOp, "key", "value")
+	text, err := log.MarshalText()
+	require.NoError(t, err)
+
+	storageLayer.EXPECT().Changes(gomock.Any(), "id", uint64(5)).Return(storage.Changes{
+		ID: "id", Offset: 6, Head: 7, Logs: []wal.Log{log},
+	}, nil)
+	require.Equal(t, "[ok] logs id 6 7\n"+string(text), database.HandleQuery(ctx, "REPLSYNC id 5"))
+
+	storageLayer.EXPECT().Changes(gomock.Any(), "id", uint64(5)).Return(storage.Changes{
+		ID: "other", Offset: 7, Head: 7, Snapshot: true,
+	}, nil)
+	require.Equal(t, "[ok] snapshot other 7 7", database.HandleQuery(ctx, "REPLSYNC id 5"))
+
+	storageLayer.EXPECT().Changes(gomock.Any(), "id", uint64(5)).Return(storage.Changes{}, errors.New("test error"))
+	require.Equal(t, "[error] test error", database.HandleQuery(ctx, "REPLSYNC id 5"))
+}
+
+func TestDatabase_ReplInfoCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	compute, storageLayer := getMockComputeAndStorage(t)
+	compute.EXPECT().HandleQuery(ctx, "REPLINFO").Return(NewQuery(ReplInfoCommandID, nil), nil).Times(2)
+
+	database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.Equal(t, "[error] replication is disabled", database.HandleQuery(ctx, "REPLINFO"))
+
+	replicationLayer := NewMockReplicationLayer(ctrl)
+	replicationLayer.EXPECT().Info(ctx).Return(map[string]string{"role": "replica", "lag": "0"})
+	database, err = NewDatabase(compute, storageLayer, dlog.NewNonSlog(), WithReplication(replicationLayer))
+	require.NoError(t, err)
+	require.Equal(t, "[ok] lag:0 role:replica", database.HandleQuery(ctx, "REPLINFO"))
+}
+
+func TestDatabase_Sharding(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	compute, storageLayer := getMockComputeAndStorage(t)
+	compute.EXPECT().HandleQuery(ctx, "SLOTS").Return(NewQuery(SlotsCommandID, nil), nil).Times(2)
+
+	database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.Equal(t, "[error] sharding is disabled", database.HandleQuery(ctx, "SLOTS"))
+
+	shardingLayer := NewMockShardingLayer(ctrl)
+	shardingLayer.EXPECT().Owner("local").Return(1, "").AnyTimes()
+	shardingLayer.EXPECT().Owner("remote").Return(2, "localhost:3224").AnyTimes()
+	shardingLayer.EXPECT().Owner("other").Return(3, "localhost:3225").AnyTimes()
+	shardingLayer.EXPECT().Ranges().Return([]sharding.Range{
+		{Start: 0, End: 1, Address: "localhost:3223"},
+		{Start: 2, End: 16383, Address: "localhost:3224"},
+	})
+	database, err = NewDatabase(compute, storageLayer, dlog.NewNonSlog(), WithSharding(shardingLayer))
+	require.NoError(t, err)
+	require.Equal(t,
+		"[ok] 2\n1) 0-1 localhost:3223\n2) 2-16383 localhost:3224", database.HandleQuery(ctx, "SLOTS"),
+	)
+
+	storageLayer.EXPECT().Get(ctx, "local").Return("value", true, nil).Times(2)
+	for request, test := range map[string]struct {
+		query       Query
+		expResponse string
+	}{
+		"GET local": {query: NewQuery(GetCommandID, []string{"local"}), expResponse: "[ok] value"},
+		"GET remote": {
+			query:       NewQuery(GetCommandID, []string{"remote"}),
+			expResponse: "[moved] 2 localhost:3224",
+		},
+		"MDEL remote remote": {
+			query:       NewQuery(MDelCommandID, []string{"remote", "remote"}),
+			expResponse: "[moved] 2 localhost:3224",
+		},
+		"MGET local remote": {
+			query:       NewQuery(MGetCommandID, []string{"local", "remote"}),
+			expResponse: "[error] keys of the query belong to different nodes",
+		},
+		"MGET remote other": {
+			query:       NewQuery(MGetCommandID, []string{"remote", "other"}),
+			expResponse: "[error] keys of the query belong to different nodes",
+		},
+	} {
+		compute.EXPECT().HandleQuery(ctx, request).Return(test.query, nil).Times(2)
+		require.Equal(t, test.expResponse, database.HandleQuery(ctx, request), request)
+		require.Equal(t, test.expResponse, database.NewSession().HandleQuery(ctx, request), request)
+	}
+}
+
+func TestDatabase_IncrementCommands(t *testing.T) {
+	t.Parallel()
+
+	testcases := map[string]struct {
+		query  Query
+		delta  int64
+		result int64
+		err    error
+		expRes string
+	}{
+		"incr": {
+			query:  NewQuery(IncrCommandID, []string{"key"}),
+			delta:  1,
+			result: 11,
+			expRes: "[ok] 11",
+		},
+		"decr": {
+			query:  NewQuery(DecrCommandID, []string{"key"}),
+			delta:  -1,
+			result: -1,
+			expRes: "[ok] -1",
+		},
+		"incrby": {
+			query:  NewQuery(IncrByCommandID, []string{"key", "-5"}),
+			delta:  -5,
+			result: 5,
+			expRes: "[ok] 5",
+		},
+		"decrby": {
+			query:  NewQuery(DecrByCommandID, []string{"key", "5"}),
+			delta:  -5,
+			result: 5,
+			expRes: "[ok] 5",
+		},
+		"not integer": {
+			query:  NewQuery(IncrCommandID, []string{"key"}),
+			delta:  1,
+			err:    storage.ErrNotInteger,
+			expRes: "[error] value is not an integer",
+		},
+	}
+
+	for name, tc := range testcases {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			compute, storageLayer := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+			require.NoError(t, err)
+			compute.EXPECT().HandleQuery(ctx, name).Return(tc.query, nil)
+			storageLayer.EXPECT().Increment(ctx, "key", tc.delta).Return(tc.result, tc.err)
+
+			require.Equal(t, tc.expRes, database.HandleQuery(ctx, name))
+		})
+	}
+
+	t.Run("decrby overflow", func(t *testing.T) {
+		ctx := context.Background()
+		compute, storageLayer := getMockComputeAndStorage(t)
+		database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+		require.NoError(t, err)
+		query := NewQuery(DecrByCommandID, []string{"key", "-9223372036854775808"})
+		compute.EXPECT().HandleQuery(ctx, "decrby").Return(query, nil)
+
+		require.Equal(t, "[error] increment or decrement would overflow", database.HandleQuery(ctx, "decrby"))
+	})
+}
+
+func TestDatabase_MultiKeyCommands(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("mget command", func(t *testing.T) {
+		compute, storageLayer := getMockComputeAndStorage(t)
+		database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+		require.NoError(t, err)
+		query := NewQuery(MGetCommandID, []string{"key1", "key2", "key3"})
+		compute.EXPECT().HandleQuery(ctx, "MGET").Return(query, nil).Times(2)
+		storageLayer.EXPECT().Get(ctx, "key1").Return("value1", true, nil)
+		storageLayer.EXPECT().Get(ctx, "key2").Return("", false, nil)
+		storageLayer.EXPECT().Get(ctx, "key3").Return("value3", true, nil)
+
+		require.Equal(t, "[ok] 3\n1) value1\n2) [nil]\n3) value3", database.HandleQuery(ctx, "MGET"))
+
+		storageLayer.EXPECT().Get(ctx, "key1").Return("", false, errors.New("test error"))
+		require.Equal(t, "[error] test error", database.HandleQuery(ctx, "MGET"))
+	})
+
+	t.Run("mset command", func(t *testing.T) {
+		compute, storageLayer := getMockComputeAndStorage(t)
+		database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+		require.NoError(t, err)
+		query := NewQuery(MSetCommandID, []string{"key1", "value1", "key2", "value2", "key1", "value3"})
+		compute.EXPECT().HandleQuery(ctx, "MSET").Return(query, nil).Times(2)
+
+		expTx := storage.NewTransaction()
+		expTx.Set("key1", "value1")
+		expTx.Set("key2", "value2")
+		expTx.Set("key1", "value3")
+		storageLayer.EXPECT().Commit(ctx, expTx).Return(nil)
+		require.Equal(t, "[ok]", database.HandleQuery(ctx, "MSET"))
+
+		storageLayer.EXPECT().Commit(ctx, expTx).Return(errors.New("test error"))
+		require.Equal(t, "[error] test error", database.HandleQuery(ctx, "MSET"))
+	})
+
+	t.Run("mdel command", func(t *testing.T) {
+		compute, storageLayer := getMockComputeAndStorage(t)
+		database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+		require.NoError(t, err)
+		query := NewQuery(MDelCommandID, []string{"key1", "key2"})
+		compute.EXPECT().HandleQuery(ctx, "MDEL").Return(query, nil)
+
+		expTx := storage.NewTransaction()
+		expTx.Delete("key1")
+		expTx.Delete("key2")
+		storageLayer.EXPECT().Commit(ctx, expTx).Return(nil)
+		require.Equal(t, "[ok]", database.HandleQuery(ctx, "MDEL"))
+	})
+}
+
+func TestDatabase_ListCommands(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	testErr := errors.New("test error")
+
+	testcases := map[string]struct {
+		query   Query
+		prepare func(storageLayer *MockStorageLayer)
+		expRes  string
+	}{
+		"lpush": {
+			query: NewQuery(LPushCommandID, []string{"key", "a", "b"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().Push(ctx, "key", true, "a", "b").Return(3, nil)
+			},
+			expRes: "[ok] 3",
+		},
+		"rpush wrong type": {
+			query: NewQuery(RPushCommandID, []string{"key", "a"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().Push(ctx, "key", false, "a").Return(0, storage.ErrWrongType)
+			},
+			expRes: "[error] WRONGTYPE operation against a key holding the wrong kind of value",
+		},
+		"lpop": {
+			query: NewQuery(LPopCommandID, []string{"key"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().Pop(ctx, "key", true).Return("a", true, nil)
+			},
+			expRes: "[ok] a",
+		},
+		"rpop empty list": {
+			query: NewQuery(RPopCommandID, []string{"key"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().Pop(ctx, "key", false).Return("", false, nil)
+			},
+			expRes: "[nil]",
+		},
+		"blpop": {
+			query: NewQuery(BLPopCommandID, []string{"key", "5"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().BlockingPop(ctx, "key", true, 5*time.Second).Return("a", true, nil)
+			},
+			expRes: "[ok] a",
+		},
+		"blpop timeout": {
+			query: NewQuery(BLPopCommandID, []string{"key", "0"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().BlockingPop(ctx, "key", true, time.Duration(0)).Return("", false, nil)
+			},
+			expRes: "[nil]",
+		},
+		"lrange": {
+			query: NewQuery(LRangeCommandID, []string{"key", "0", "-1"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().ListRange(ctx, "key", 0, -1).Return([]string{"a", "b"}, nil)
+			},
+			expRes: "[ok] 2\n1) a\n2) b",
+		},
+		"lrange error": {
+			query: NewQuery(LRangeCommandID, []string{"key", "0", "-1"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().ListRange(ctx, "key", 0, -1).Return(nil, testErr)
+			},
+			expRes: "[error] test error",
+		},
+		"llen": {
+			query: NewQuery(LLenCommandID, []string{"key"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().ListLen(ctx, "key").Return(2, nil)
+			},
+			expRes: "[ok] 2",
+		},
+	}
+
+	for name, tc := range testcases {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			compute, storageLayer := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+			require.NoError(t, err)
+			compute.EXPECT().HandleQuery(ctx, name).Return(tc.query, nil)
+			tc.prepare(storageLayer)
+
+			require.Equal(t, tc.expRes, database.HandleQuery(ctx, name))
+		})
+	}
+}
+
+func TestDatabase_HashCommands(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	testErr := errors.New("test error")
+	fields := map[string]string{"name": "alice", "email": "a@b"}
+
+	testcases := map[string]struct {
+		query   Query
+		prepare func(storageLayer *MockStorageLayer)
+		expRes  string
+	}{
+		"hset": {
+			query: NewQuery(HSetCommandID, []string{"key", "name", "alice", "email", "a@b"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().HashSet(ctx, "key", "name", "alice", "email", "a@b").Return(2, nil)
+			},
+			expRes: "[ok] 2",
+		},
+		"hset wrong type": {
+			query: NewQuery(HSetCommandID, []string{"key", "name", "alice"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().HashSet(ctx, "key", "name", "alice").Return(0, storage.ErrWrongType)
+			},
+			expRes: "[error] WRONGTYPE operation against a key holding the wrong kind of value",
+		},
+		"hget": {
+			query: NewQuery(HGetCommandID, []string{"key", "name"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().HashGet(ctx, "key", "name").Return("alice", true, nil)
+			},
+			expRes: "[ok] alice",
+		},
+		"hget missing field": {
+			query: NewQuery(HGetCommandID, []string{"key", "phone"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().HashGet(ctx, "key", "phone").Return("", false, nil)
+			},
+			expRes: "[nil]",
+		},
+		"hdel": {
+			query: NewQuery(HDelCommandID, []string{"key", "name", "phone"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().HashDelete(ctx, "key", "name", "phone").Return(1, nil)
+			},
+			expRes: "[ok] 1",
+		},
+		"hgetall": {
+			query: NewQuery(HGetAllCommandID, []string{"key"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().HashGetAll(ctx, "key").Return(fields, nil)
+			},
+			expRes: "[ok] 2\n1) email a@b\n2) name alice",
+		},
+		"hgetall error": {
+			query: NewQuery(HGetAllCommandID, []string{"key"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().HashGetAll(ctx, "key").Return(nil, testErr)
+			},
+			expRes: "[error] test error",
+		},
+		"hkeys": {
+			query: NewQuery(HKeysCommandID, []string{"key"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().HashGetAll(ctx, "key").Return(fields, nil)
+			},
+			expRes: "[ok] 2\n1) email\n2) name",
+		},
+		"hkeys missing key": {
+			query: NewQuery(HKeysCommandID, []string{"key"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().HashGetAll(ctx, "key").Return(nil, nil)
+			},
+			expRes: "[ok] 0",
+		},
+		"hlen": {
+			query: NewQuery(HLenCommandID, []string{"key"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().HashLen(ctx, "key").Return(2, nil)
+			},
+			expRes: "[ok] 2",
+		},
+	}
+
+	for name, tc := range testcases {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			compute, storageLayer := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+			require.NoError(t, err)
+			compute.EXPECT().HandleQuery(ctx, name).Return(tc.query, nil)
+			tc.prepare(storageLayer)
+
+			require.Equal(t, tc.expRes, database.HandleQuery(ctx, name))
+		})
+	}
+}
+
+func TestDatabase_SetCommands(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	testErr := errors.New("test error")
+	board := []storage.ScoredMember{{Member: "bob", Score: -1.5}, {Member: "alice", Score: 20}}
+
+	testcases := map[string]struct {
+		query   Query
+		prepare func(storageLayer *MockStorageLayer)
+		expRes  string
+	}{
+		"sadd": {
+			query: NewQuery(SAddCommandID, []string{"key", "a", "b"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SetAdd(ctx, "key", "a", "b").Return(2, nil)
+			},
+			expRes: "[ok] 2",
+		},
+		"srem wrong type": {
+			query: NewQuery(SRemCommandID, []string{"key", "a"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SetRemove(ctx, "key", "a").Return(0, storage.ErrWrongType)
+			},
+			expRes: "[error] WRONGTYPE operation against a key holding the wrong kind of value",
+		},
+		"sismember": {
+			query: NewQuery(SIsMemberCommandID, []string{"key", "a"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SetIsMember(ctx, "key", "a").Return(true, nil)
+			},
+			expRes: "[ok] 1",
+		},
+		"sismember missing member": {
+			query: NewQuery(SIsMemberCommandID, []string{"key", "c"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SetIsMember(ctx, "key", "c").Return(false, nil)
+			},
+			expRes: "[ok] 0",
+		},
+		"smembers": {
+			query: NewQuery(SMembersCommandID, []string{"key"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SetMembers(ctx, "key").Return([]string{"b", "a"}, nil)
+			},
+			expRes: "[ok] 2\n1) a\n2) b",
+		},
+		"sinter": {
+			query: NewQuery(SInterCommandID, []string{"key1", "key2"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SetIntersect(ctx, "key1", "key2").Return([]string{"b"}, nil)
+			},
+			expRes: "[ok] 1\n1) b",
+		},
+		"sunion error": {
+			query: NewQuery(SUnionCommandID, []string{"key1", "key2"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SetUnion(ctx, "key1", "key2").Return(nil, testErr)
+			},
+			expRes: "[error] test error",
+		},
+		"zadd": {
+			query: NewQuery(ZAddCommandID, []string{"key", "-1.5", "bob", "20", "alice"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SortedSetAdd(ctx, "key", board[0], board[1]).Return(2, nil)
+			},
+			expRes: "[ok] 2",
+		},
+		"zrem": {
+			query: NewQuery(ZRemCommandID, []string{"key", "bob"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SortedSetRemove(ctx, "key", "bob").Return(1, nil)
+			},
+			expRes: "[ok] 1",
+		},
+		"zrange": {
+			query: NewQuery(ZRangeCommandID, []string{"key", "0", "-1"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SortedSetRange(ctx, "key", 0, -1).Return(board, nil)
+			},
+			expRes: "[ok] 2\n1) bob\n2) alice",
+		},
+		"zrange with scores": {
+			query: NewQuery(ZRangeCommandID, []string{"key", "0", "-1", "WITHSCORES"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SortedSetRange(ctx, "key", 0, -1).Return(board, nil)
+			},
+			expRes: "[ok] 2\n1) bob -1.5\n2) alice 20",
+		},
+		"zrangebyscore": {
+			query: NewQuery(ZRangeByScoreCommandID, []string{"key", "-inf", "10", "WITHSCORES"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SortedSetRangeByScore(ctx, "key", math.Inf(-1), float64(10)).Return(board[:1], nil)
+			},
+			expRes: "[ok] 1\n1) bob -1.5",
+		},
+		"zrank": {
+			query: NewQuery(ZRankCommandID, []string{"key", "alice"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SortedSetRank(ctx, "key", "alice").Return(1, true, nil)
+			},
+			expRes: "[ok] 1",
+		},
+		"zrank missing member": {
+			query: NewQuery(ZRankCommandID, []string{"key", "carol"}),
+			prepare: func(storageLayer *MockStorageLayer) {
+				storageLayer.EXPECT().SortedSetRank(ctx, "key", "carol").Return(0, false, nil)
+			},
+			expRes: "[nil]",
+		},
+	}
+
+	for name, tc := range testcases {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			compute, storageLayer := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+			require.NoError(t, err)
+			compute.EXPECT().HandleQuery(ctx, name).Return(tc.query, nil)
+			tc.prepare(storageLayer)
+
+			require.Equal(t, tc.expRes, database.HandleQuery(ctx, name))
+		})
+	}
+}
+
 func TestDatabase_GetCommand(t *testing.T) {
 	t.Parallel()
 
@@ -178,6 +879,324 @@ func TestDatabase_DelCommand(t *testing.T) {
 	})
 }
 
+func TestDatabase_SetWithTTLCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storage := getMockComputeAndStorage(t)
+	database, err := NewDatabase(compute, storage, dlog.NewNonSlog())
+	require.NoError(t, err)
+	inputQuery := "SET key value EX 30"
+	query := Query{
+		commandID: SetCommandID,
+		arguments: []string{"key", "value", ExpirationOption, "30"},
+	}
+	compute.EXPECT().HandleQuery(ctx, gomock.Eq(inputQuery)).Return(query, nil)
+	storage.EXPECT().SetWithTTL(ctx, "key", "value", 30*time.Second).Return(nil)
+
+	res := database.HandleQuery(ctx, inputQuery)
+
+	require.Equal(t, "[ok]", res)
+}
+
+func TestDatabase_TTLCommand(t *testing.T) {
+	t.Parallel()
+
+	inputQuery := "TTL key"
+	query := Query{
+		commandID: TTLCommandID,
+		arguments: []string{"key"},
+	}
+
+	testcases := map[string]struct {
+		ttl    time.Duration
+		found  bool
+		err    error
+		expRes string
+	}{
+		"missing key":        {expRes: "[nil]"},
+		"key without ttl":    {ttl: -1, found: true, expRes: "[ok] -1"},
+		"key with ttl":       {ttl: 1500 * time.Millisecond, found: true, expRes: "[ok] 2"},
+		"key with whole ttl": {ttl: 10 * time.Second, found: true, expRes: "[ok] 10"},
+		"storage error":      {err: errors.New("test error"), expRes: "[error] test error"},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			compute, storage := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storage, dlog.NewNonSlog())
+			require.NoError(t, err)
+			compute.EXPECT().HandleQuery(ctx, gomock.Eq(inputQuery)).Return(query, nil)
+			storage.EXPECT().TTL(ctx, "key").Return(tc.ttl, tc.found, tc.err)
+
+			res := database.HandleQuery(ctx, inputQuery)
+
+			require.Equal(t, tc.expRes, res)
+		})
+	}
+}
+
+func TestDatabase_ExpireCommand(t *testing.T) {
+	t.Parallel()
+
+	inputQuery := "EXPIRE key 5"
+	query := Query{
+		commandID: ExpireCommandID,
+		arguments: []string{"key", "5"},
+	}
+
+	testcases := map[string]struct {
+		ok     bool
+		err    error
+		expRes string
+	}{
+		"existing key":  {ok: true, expRes: "[ok]"},
+		"missing key":   {expRes: "[nil]"},
+		"storage error": {err: errors.New("test error"), expRes: "[error] test error"},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			compute, storage := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storage, dlog.NewNonSlog())
+			require.NoError(t, err)
+			compute.EXPECT().HandleQuery(ctx, gomock.Eq(inputQuery)).Return(query, nil)
+			storage.EXPECT().Expire(ctx, "key", 5*time.Second).Return(tc.ok, tc.err)
+
+			res := database.HandleQuery(ctx, inputQuery)
+
+			require.Equal(t, tc.expRes, res)
+		})
+	}
+}
+
+func TestDatabase_PersistCommand(t *testing.T) {
+	t.Parallel()
+
+	inputQuery := "PERSIST key"
+	query := Query{
+		commandID: PersistCommandID,
+		arguments: []string{"key"},
+	}
+
+	testcases := map[string]struct {
+		ok     bool
+		err    error
+		expRes string
+	}{
+		"key with ttl":  {ok: true, expRes: "[ok]"},
+		"key no ttl":    {expRes: "[nil]"},
+		"storage error": {err: errors.New("test error"), expRes: "[error] test error"},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			compute, storage := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storage, dlog.NewNonSlog())
+			require.NoError(t, err)
+			compute.EXPECT().HandleQuery(ctx, gomock.Eq(inputQuery)).Return(query, nil)
+			storage.EXPECT().Persist(ctx, "key").Return(tc.ok, tc.err)
+
+			res := database.HandleQuery(ctx, inputQuery)
+
+			require.Equal(t, tc.expRes, res)
+		})
+	}
+}
+
+func TestDatabase_InfoCommand(t *testing.T) {
+	t.Parallel()
+
+	inputQuery := "INFO"
+	query := Query{
+		commandID: InfoCommandID,
+		arguments: nil,
+	}
+
+	t.Run("success info command", func(t *testing.T) {
+		ctx := context.Background()
+		compute, storage := getMockComputeAndStorage(t)
+		database, err := NewDatabase(compute, storage, dlog.NewNonSlog())
+		require.NoError(t, err)
+		compute.EXPECT().HandleQuery(ctx, gomock.Eq(inputQuery)).Return(query, nil)
+		storage.EXPECT().Info(ctx).Return(map[string]string{"keys": "2", "evicted_keys": "1"}, nil)
+
+		res := database.HandleQuery(ctx, inputQuery)
+
+		require.Equal(t, "[ok] evicted_keys:1 keys:2", res)
+	})
+
+	t.Run("error info command", func(t *testing.T) {
+		ctx := context.Background()
+		compute, storage := getMockComputeAndStorage(t)
+		database, err := NewDatabase(compute, storage, dlog.NewNonSlog())
+		require.NoError(t, err)
+		compute.EXPECT().HandleQuery(ctx, gomock.Eq(inputQuery)).Return(query, nil)
+		storage.EXPECT().Info(ctx).Return(nil, errors.New("test error"))
+
+		res := database.HandleQuery(ctx, inputQuery)
+
+		require.Equal(t, "[error] test error", res)
+	})
+}
+
+func TestDatabase_RangeCommand(t *testing.T) {
+	t.Parallel()
+
+	testcases := map[string]struct {
+		arguments []string
+		limit     int
+		pairs     []storage.KeyValue
+		err       error
+		expRes    string
+	}{
+		"range with values": {
+			arguments: []string{"a", "z"},
+			pairs:     []storage.KeyValue{{Key: "a", Value: "1"}, {Key: "end", Value: "2"}},
+			expRes:    "[ok] 2\n1) a 1\n2) end 2",
+		},
+		"range with limit": {
+			arguments: []string{"a", "z", "LIMIT", "1"},
+			limit:     1,
+			pairs:     []storage.KeyValue{{Key: "a", Value: "1"}},
+			expRes:    "[ok] 1\n1) a 1",
+		},
+		"empty range": {
+			arguments: []string{"a", "z"},
+			expRes:    "[ok] 0",
+		},
+		"range error": {
+			arguments: []string{"a", "z"},
+			err:       errors.New("test error"),
+			expRes:    "[error] test error",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			compute, storageLayer := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+			require.NoError(t, err)
+			inputQuery := "RANGE " + strings.Join(tc.arguments, " ")
+			query := NewQuery(RangeCommandID, tc.arguments)
+			compute.EXPECT().HandleQuery(ctx, gomock.Eq(inputQuery)).Return(query, nil)
+			storageLayer.EXPECT().Range(ctx, "a", "z", tc.limit).Return(tc.pairs, tc.err)
+
+			res := database.HandleQuery(ctx, inputQuery)
+
+			require.Equal(t, tc.expRes, res)
+		})
+	}
+}
+
+func TestDatabase_ScanCommand(t *testing.T) {
+	t.Parallel()
+
+	testcases := map[string]struct {
+		arguments []string
+		cursor    uint64
+		pattern   string
+		count     int
+		keys      []string
+		next      uint64
+		err       error
+		expRes    string
+	}{
+		"scan with defaults": {
+			arguments: []string{"0"},
+			pattern:   "*",
+			count:     defaultScanCount,
+			keys:      []string{"a", "b"},
+			next:      42,
+			expRes:    "[ok] 3\n1) 42\n2) a\n3) b",
+		},
+		"scan with options": {
+			arguments: []string{"42", "MATCH", "user_*", "COUNT", "5"},
+			cursor:    42,
+			pattern:   "user_*",
+			count:     5,
+			keys:      []string{"user_1"},
+			expRes:    "[ok] 2\n1) 0\n2) user_1",
+		},
+		"scan error": {
+			arguments: []string{"0"},
+			pattern:   "*",
+			count:     defaultScanCount,
+			err:       errors.New("test error"),
+			expRes:    "[error] test error",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			compute, storageLayer := getMockComputeAndStorage(t)
+			database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+			require.NoError(t, err)
+			inputQuery := "SCAN " + strings.Join(tc.arguments, " ")
+			query := NewQuery(ScanCommandID, tc.arguments)
+			compute.EXPECT().HandleQuery(ctx, gomock.Eq(inputQuery)).Return(query, nil)
+			storageLayer.EXPECT().Scan(ctx, tc.cursor, tc.pattern, tc.count).Return(tc.keys, tc.next, tc.err)
+
+			res := database.HandleQuery(ctx, inputQuery)
+
+			require.Equal(t, tc.expRes, res)
+		})
+	}
+}
+
+func TestDatabase_KeysCommand(t *testing.T) {
+	t.Parallel()
+
+	inputQuery := "KEYS k*"
+	query := NewQuery(KeysCommandID, []string{"k*"})
+
+	t.Run("success keys command", func(t *testing.T) {
+		ctx := context.Background()
+		compute, storageLayer := getMockComputeAndStorage(t)
+		database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+		require.NoError(t, err)
+		compute.EXPECT().HandleQuery(ctx, gomock.Eq(inputQuery)).Return(query, nil)
+		storageLayer.EXPECT().Keys(ctx, "k*").Return([]string{"k1", "k2"}, nil)
+
+		res := database.HandleQuery(ctx, inputQuery)
+
+		require.Equal(t, "[ok] 2\n1) k1\n2) k2", res)
+	})
+
+	t.Run("error keys command", func(t *testing.T) {
+		ctx := context.Background()
+		compute, storageLayer := getMockComputeAndStorage(t)
+		database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+		require.NoError(t, err)
+		compute.EXPECT().HandleQuery(ctx, gomock.Eq(inputQuery)).Return(query, nil)
+		storageLayer.EXPECT().Keys(ctx, "k*").Return(nil, errors.New("test error"))
+
+		res := database.HandleQuery(ctx, inputQuery)
+
+		require.Equal(t, "[error] test error", res)
+	})
+}
+
 func TestDatabase_UnknownCommand(t *testing.T) {
 	t.Parallel()
 
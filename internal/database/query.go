@@ -19,3 +19,46 @@ func (c *Query) CommandID() CmdID {
 func (c *Query) Arguments() []string {
 	return c.arguments
 }
+
+// Keys returns the keys of the query, which decide the node that serves it
+// when keys are sharded. Queries without keys are served by any node.
+func (c *Query) Keys() []string {
+	if len(c.arguments) == 0 {
+		return nil
+	}
+
+	switch c.commandID {
+	case SetCommandID, GetCommandID, DelCommandID, TTLCommandID, ExpireCommandID, PersistCommandID,
+		CASCommandID, IncrCommandID, DecrCommandID, IncrByCommandID, DecrByCommandID,
+		LPushCommandID, RPushCommandID, LPopCommandID, RPopCommandID, LRangeCommandID, LLenCommandID,
+		BLPopCommandID, HSetCommandID, HGetCommandID, HDelCommandID, HGetAllCommandID, HKeysCommandID,
+		HLenCommandID, SAddCommandID, SRemCommandID, SIsMemberCommandID, SMembersCommandID,
+		ZAddCommandID, ZRangeCommandID, ZRangeByScoreCommandID, ZRankCommandID, ZRemCommandID,
+		GetVCommandID, SetVCommandID:
+		return c.arguments[:1]
+	case MGetCommandID, MDelCommandID, SInterCommandID, SUnionCommandID:
+		return c.arguments
+	case MSetCommandID:
+		keys := make([]string, 0, (len(c.arguments)+1)/2)
+		for idx := 0; idx < len(c.arguments); idx += 2 {
+			keys = append(keys, c.arguments[idx])
+		}
+		return keys
+	case UnknownCommandID, InfoCommandID, BeginCommandID, CommitCommandID, RollbackCommandID,
+		RangeCommandID, ScanCommandID, KeysCommandID, SelectCommandID, FlushDBCommandID,
+		ReplSyncCommandID, ReplInfoCommandID, SlotsCommandID, SubscribeCommandID, PSubscribeCommandID,
+		UnsubscribeCommandID, PUnsubscribeCommandID, PublishCommandID, WatchCommandID, UnwatchCommandID:
+	}
+	return nil
+}
+
+// QueryKeys returns the keys of a query that is split into the command and
+// its arguments but isn't validated.
+func QueryKeys(tokens []string) []string {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	query := NewQuery(GetCommandIDByName(tokens[0]), tokens[1:])
+	return query.Keys()
+}
@@ -12,3 +12,29 @@ func TestNewQuery(t *testing.T) {
 	require.Equal(t, GetCommandID, query.CommandID())
 	require.Equal(t, args, query.Arguments())
 }
+
+func TestQuery_Keys(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		tokens  []string
+		expKeys []string
+	}{
+		"empty":         {},
+		"without keys":  {tokens: []string{"SCAN", "0"}},
+		"no arguments":  {tokens: []string{"GET"}},
+		"unknown":       {tokens: []string{"UNKNOWN", "key"}},
+		"single key":    {tokens: []string{"SET", "key", "value", "EX", "10"}, expKeys: []string{"key"}},
+		"all arguments": {tokens: []string{"MGET", "key1", "key2"}, expKeys: []string{"key1", "key2"}},
+		"pairs":         {tokens: []string{"MSET", "key1", "value1", "key2"}, expKeys: []string{"key1", "key2"}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, test.expKeys, QueryKeys(test.tokens))
+		})
+	}
+}
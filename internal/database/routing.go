@@ -0,0 +1,53 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"kv_db/internal/sharding"
+)
+
+// ErrSessionRouting rejects a query that changes the state of the session,
+// like a transaction or the selected database, of a client that routes
+// queries by slots, because the following queries could go to other nodes.
+var ErrSessionRouting = errors.New("transactions and databases aren't supported with slot routing")
+
+// QuerySlot returns the slot of the first key of a query that is split into
+// the command and its arguments, and false for a query without keys.
+func QuerySlot(tokens []string) (int, bool, error) {
+	if len(tokens) != 0 {
+		switch GetCommandIDByName(tokens[0]) {
+		case BeginCommandID, CommitCommandID, RollbackCommandID, SelectCommandID:
+			return 0, false, ErrSessionRouting
+		}
+	}
+
+	keys := QueryKeys(tokens)
+	if len(keys) == 0 {
+		return 0, false, nil
+	}
+	return sharding.Slot(keys[0]), true, nil
+}
+
+// ParseSlots returns the owners of slots by a SLOTS response. A node without
+// sharding responds with an error, which has no owners.
+func ParseSlots(response []byte) map[int]string {
+	lines := strings.Split(string(response), "\n")
+	if !strings.HasPrefix(lines[0], "[ok] ") {
+		return nil
+	}
+
+	owners := make(map[int]string)
+	for _, line := range lines[1:] {
+		_, value, _ := strings.Cut(line, ") ")
+		text, address, _ := strings.Cut(value, " ")
+		slotRange, err := sharding.ParseRange(text, address)
+		if err != nil || slotRange.Start < 0 || slotRange.End >= sharding.SlotsCount || address == "" {
+			continue
+		}
+		for slot := slotRange.Start; slot <= slotRange.End; slot++ {
+			owners[slot] = address
+		}
+	}
+	return owners
+}
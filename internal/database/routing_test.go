@@ -0,0 +1,36 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/sharding"
+)
+
+func TestQuerySlot(t *testing.T) {
+	t.Parallel()
+
+	slot, ok, err := QuerySlot([]string{"MGET", "key1", "key2"})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, sharding.Slot("key1"), slot)
+
+	_, ok, err = QuerySlot([]string{"INFO"})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	for _, command := range []string{BeginCommand, CommitCommand, RollbackCommand, SelectCommand} {
+		_, _, err = QuerySlot([]string{command})
+		require.ErrorIs(t, err, ErrSessionRouting)
+	}
+}
+
+func TestParseSlots(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, ParseSlots([]byte("[error] sharding is disabled")))
+
+	owners := ParseSlots([]byte("[ok] 3\n1) 0-1 localhost:1\n2) 2 localhost:2\n3) 5-20000 localhost:3"))
+	require.Equal(t, map[int]string{0: "localhost:1", 1: "localhost:1", 2: "localhost:2"}, owners)
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"kv_db/internal/database/storage"
+	"kv_db/internal/pubsub"
+)
+
+// Session handles queries of a single client and keeps its state between
+// them. Queries of a session must be handled sequentially.
+//
+// BEGIN starts a transaction, which buffers SET, DEL, MSET and MDEL until
+// COMMIT applies them atomically or ROLLBACK discards them. GET and MGET
+// within a transaction read its own writes and the latest committed values
+// otherwise, so concurrent transactions are isolated from each other only
+// until they are committed.
+//
+// SELECT switches the keyspace of the session. A new session starts with the
+// keyspace of the database that creates it.
+//
+// SUBSCRIBE, PSUBSCRIBE and WATCH switch the session into push mode, in which
+// it gets the messages of its subscriptions from Messages and handles only
+// subscription commands. UNSUBSCRIBE, PUNSUBSCRIBE and UNWATCH remove the
+// subscriptions to channels, patterns and watched prefixes, and the session
+// returns to the normal mode when all subscriptions are removed. WATCH
+// subscribes to the changes of the keys with the prefixes in the selected
+// keyspace.
+type Session struct {
+	database   *Database
+	tx         *storage.Transaction
+	subscriber *pubsub.Subscriber
+}
+
+func (d *Database) NewSession() *Session {
+	return &Session{database: d}
+}
+
+func (s *Session) HandleQuery(ctx context.Context, queryStr string) string {
+	query, err := s.database.computeLayer.HandleQuery(ctx, queryStr)
+	if err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+	if response, moved := s.database.redirect(query); moved {
+		return response
+	}
+
+	switch commandID := query.CommandID(); {
+	case commandID == SubscribeCommandID, commandID == PSubscribeCommandID,
+		commandID == UnsubscribeCommandID, commandID == PUnsubscribeCommandID,
+		commandID == WatchCommandID, commandID == UnwatchCommandID:
+		return s.handleSubscriptionQuery(query)
+	case s.subscriber != nil:
+		return "[error] only subscription commands are allowed in push mode"
+	case commandID == BeginCommandID:
+		if s.tx != nil {
+			return "[error] transaction is already started"
+		}
+		s.tx = storage.NewTransaction()
+		return "[ok]"
+	case commandID == CommitCommandID:
+		return s.commit(ctx)
+	case commandID == RollbackCommandID:
+		if s.tx == nil {
+			return "[error] transaction is not started"
+		}
+		s.tx = nil
+		return "[ok]"
+	case commandID == SelectCommandID:
+		return s.selectKeyspace(query)
+	}
+
+	if s.tx != nil {
+		return s.handleTransactionQuery(ctx, query)
+	}
+	return s.database.handleQuery(ctx, query)
+}
+
+// Messages returns the messages of the subscriptions, or nil if the session
+// isn't in push mode. The channel is closed if the session can't keep up
+// with the messages.
+func (s *Session) Messages() <-chan []byte {
+	if s.subscriber == nil {
+		return nil
+	}
+	return s.subscriber.Messages()
+}
+
+// Close discards the transaction that isn't committed and removes the
+// subscriptions.
+func (s *Session) Close() {
+	s.tx = nil
+	if s.subscriber != nil {
+		s.subscriber.Close()
+		s.subscriber = nil
+	}
+}
+
+// handleSubscriptionQuery returns the number of subscriptions of the session.
+func (s *Session) handleSubscriptionQuery(query Query) string {
+	if s.database.pubSubLayer == nil {
+		return "[error] pubsub is disabled"
+	}
+	if query.CommandID() == WatchCommandID && !s.database.keyspaceEvents {
+		return "[error] keyspace events are disabled"
+	}
+	if s.tx != nil {
+		return "[error] command is not supported in a transaction"
+	}
+	if s.subscriber == nil {
+		s.subscriber = s.database.pubSubLayer.NewSubscriber()
+	}
+
+	var subscriptions int
+	switch commandID := query.CommandID(); {
+	case commandID == SubscribeCommandID:
+		subscriptions = s.subscriber.Subscribe(query.Arguments()...)
+	case commandID == PSubscribeCommandID:
+		subscriptions = s.subscriber.PSubscribe(query.Arguments()...)
+	case commandID == WatchCommandID:
+		subscriptions = s.subscriber.Watch(s.database.index, query.Arguments()...)
+	case commandID == UnsubscribeCommandID:
+		subscriptions = s.subscriber.Unsubscribe(query.Arguments()...)
+	case commandID == PUnsubscribeCommandID:
+		subscriptions = s.subscriber.PUnsubscribe(query.Arguments()...)
+	default:
+		subscriptions = s.subscriber.Unwatch(s.database.index, query.Arguments()...)
+	}
+
+	// Messages that are left after the last subscription is removed are
+	// dropped with the subscriber.
+	if subscriptions == 0 {
+		s.subscriber.Close()
+		s.subscriber = nil
+	}
+	return fmt.Sprintf("[ok] %d", subscriptions)
+}
+
+// selectKeyspace isn't allowed in a transaction, because its writes would be
+// committed to another keyspace than the one they are read from.
+func (s *Session) selectKeyspace(query Query) string {
+	if s.tx != nil {
+		return "[error] database can't be selected in a transaction"
+	}
+
+	index, _ := strconv.Atoi(query.Arguments()[0])
+	keyspaces := s.database.keyspaces
+	if index >= len(keyspaces) {
+		return fmt.Sprintf("[error] database index is out of range, there are %d databases", len(keyspaces))
+	}
+
+	s.database = keyspaces[index]
+	return "[ok]"
+}
+
+// commit discards the transaction even if it fails.
+func (s *Session) commit(ctx context.Context) string {
+	if s.tx == nil {
+		return "[error] transaction is not started"
+	}
+
+	tx := s.tx
+	s.tx = nil
+	if err := s.database.storageLayer.Commit(ctx, tx); err != nil {
+		return fmt.Sprintf("[error] %s", err.Error())
+	}
+
+	return "[ok]"
+}
+
+func (s *Session) handleTransactionQuery(ctx context.Context, query Query) string {
+	arguments := query.Arguments()
+
+	switch commandID := query.CommandID(); {
+	case commandID == SetCommandID:
+		options := parseSetOptions(arguments[2:])
+		switch {
+		case options.conditional:
+			return "[error] conditional writes are not supported in a transaction"
+		case options.ttl != 0:
+			s.tx.SetWithTTL(arguments[0], arguments[1], options.ttl)
+		default:
+			s.tx.Set(arguments[0], arguments[1])
+		}
+		return "[ok]"
+	case commandID == DelCommandID:
+		s.tx.Delete(arguments[0])
+		return "[ok]"
+	case commandID == GetCommandID:
+		value, found, ok := s.tx.Get(arguments[0])
+		if !ok {
+			return s.database.handleGetQuery(ctx, query)
+		}
+		if !found {
+			return "[nil]"
+		}
+		return fmt.Sprintf("[ok] %s", value)
+	case commandID == MSetCommandID, commandID == MDelCommandID:
+		writeMultiQuery(s.tx, query)
+		return "[ok]"
+	case commandID == MGetCommandID:
+		return s.database.handleMGetQuery(ctx, query, s.tx)
+	case commandID == InfoCommandID:
+		return s.database.handleQuery(ctx, query)
+	}
+
+	return "[error] command is not supported in a transaction"
+}
@@ -0,0 +1,328 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage"
+	"kv_db/internal/pubsub"
+	"kv_db/pkg/dlog"
+)
+
+func TestSession_Transaction(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storageLayer := getMockComputeAndStorage(t)
+	database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+	require.NoError(t, err)
+	session := database.NewSession()
+
+	queries := map[string]Query{
+		"BEGIN":               NewQuery(BeginCommandID, nil),
+		"SET key1 value1":     NewQuery(SetCommandID, []string{"key1", "value1"}),
+		"SET key2 v EX 10":    NewQuery(SetCommandID, []string{"key2", "v", ExpirationOption, "10"}),
+		"DEL key3":            NewQuery(DelCommandID, []string{"key3"}),
+		"GET key1":            NewQuery(GetCommandID, []string{"key1"}),
+		"GET key3":            NewQuery(GetCommandID, []string{"key3"}),
+		"GET key4":            NewQuery(GetCommandID, []string{"key4"}),
+		"TTL key1":            NewQuery(TTLCommandID, []string{"key1"}),
+		"SET key1 v NX":       NewQuery(SetCommandID, []string{"key1", "v", NotExistsOption}),
+		"MSET key5 v key6 v":  NewQuery(MSetCommandID, []string{"key5", "v", "key6", "v"}),
+		"MDEL key6":           NewQuery(MDelCommandID, []string{"key6"}),
+		"MGET key5 key6 key4": NewQuery(MGetCommandID, []string{"key5", "key6", "key4"}),
+		"COMMIT":              NewQuery(CommitCommandID, nil),
+	}
+	for queryStr, query := range queries {
+		compute.EXPECT().HandleQuery(ctx, queryStr).Return(query, nil).AnyTimes()
+	}
+
+	expTx := storage.NewTransaction()
+	expTx.Set("key1", "value1")
+	expTx.SetWithTTL("key2", "v", 10*time.Second)
+	expTx.Delete("key3")
+	expTx.Set("key5", "v")
+	expTx.Set("key6", "v")
+	expTx.Delete("key6")
+	storageLayer.EXPECT().Get(ctx, "key4").Return("value4", true, nil).Times(2)
+	storageLayer.EXPECT().Commit(ctx, expTx).Return(nil)
+
+	for _, exchange := range [][2]string{
+		{"BEGIN", "[ok]"},
+		{"BEGIN", "[error] transaction is already started"},
+		{"SET key1 value1", "[ok]"},
+		{"SET key2 v EX 10", "[ok]"},
+		{"DEL key3", "[ok]"},
+		{"GET key1", "[ok] value1"},
+		{"GET key3", "[nil]"},
+		{"GET key4", "[ok] value4"},
+		{"TTL key1", "[error] command is not supported in a transaction"},
+		{"SET key1 v NX", "[error] conditional writes are not supported in a transaction"},
+		{"MSET key5 v key6 v", "[ok]"},
+		{"MDEL key6", "[ok]"},
+		{"MGET key5 key6 key4", "[ok] 3\n1) v\n2) [nil]\n3) value4"},
+		{"COMMIT", "[ok]"},
+		{"COMMIT", "[error] transaction is not started"},
+	} {
+		require.Equal(t, exchange[1], session.HandleQuery(ctx, exchange[0]), exchange[0])
+	}
+}
+
+func TestSession_Rollback(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storageLayer := getMockComputeAndStorage(t)
+	database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+	require.NoError(t, err)
+	session := database.NewSession()
+
+	compute.EXPECT().HandleQuery(ctx, "BEGIN").Return(NewQuery(BeginCommandID, nil), nil).AnyTimes()
+	compute.EXPECT().HandleQuery(ctx, "ROLLBACK").Return(NewQuery(RollbackCommandID, nil), nil).AnyTimes()
+	compute.EXPECT().HandleQuery(ctx, "SET key value").
+		Return(NewQuery(SetCommandID, []string{"key", "value"}), nil).AnyTimes()
+
+	require.Equal(t, "[error] transaction is not started", session.HandleQuery(ctx, "ROLLBACK"))
+	require.Equal(t, "[ok]", session.HandleQuery(ctx, "BEGIN"))
+	require.Equal(t, "[ok]", session.HandleQuery(ctx, "SET key value"))
+	require.Equal(t, "[ok]", session.HandleQuery(ctx, "ROLLBACK"))
+
+	// Outside of a transaction writes go to the storage right away.
+	storageLayer.EXPECT().Set(ctx, "key", "value").Return(nil)
+	require.Equal(t, "[ok]", session.HandleQuery(ctx, "SET key value"))
+
+	require.Equal(t, "[ok]", session.HandleQuery(ctx, "BEGIN"))
+	session.Close()
+	require.Equal(t, "[ok]", session.HandleQuery(ctx, "BEGIN"))
+}
+
+func TestSession_CommitError(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storageLayer := getMockComputeAndStorage(t)
+	database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+	require.NoError(t, err)
+	session := database.NewSession()
+
+	compute.EXPECT().HandleQuery(ctx, "BEGIN").Return(NewQuery(BeginCommandID, nil), nil)
+	compute.EXPECT().HandleQuery(ctx, "COMMIT").Return(NewQuery(CommitCommandID, nil), nil).Times(2)
+	storageLayer.EXPECT().Commit(ctx, storage.NewTransaction()).Return(errors.New("test error"))
+
+	require.Equal(t, "[ok]", session.HandleQuery(ctx, "BEGIN"))
+	require.Equal(t, "[error] test error", session.HandleQuery(ctx, "COMMIT"))
+	require.Equal(t, "[error] transaction is not started", session.HandleQuery(ctx, "COMMIT"))
+}
+
+func TestSession_Select(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storage0 := getMockComputeAndStorage(t)
+	_, storage1 := getMockComputeAndStorage(t)
+	databases, err := NewDatabases(compute, []StorageLayer{storage0, storage1}, dlog.NewNonSlog())
+	require.NoError(t, err)
+	session := databases[0].NewSession()
+	other := databases[0].NewSession()
+
+	queries := map[string]Query{
+		"SELECT 0": NewQuery(SelectCommandID, []string{"0"}),
+		"SELECT 1": NewQuery(SelectCommandID, []string{"1"}),
+		"SELECT 2": NewQuery(SelectCommandID, []string{"2"}),
+		"GET key":  NewQuery(GetCommandID, []string{"key"}),
+		"FLUSHDB":  NewQuery(FlushDBCommandID, nil),
+		"BEGIN":    NewQuery(BeginCommandID, nil),
+		"ROLLBACK": NewQuery(RollbackCommandID, nil),
+	}
+	for queryStr, query := range queries {
+		compute.EXPECT().HandleQuery(ctx, queryStr).Return(query, nil).AnyTimes()
+	}
+
+	storage1.EXPECT().Get(ctx, "key").Return("value1", true, nil)
+	storage1.EXPECT().Flush(ctx).Return(nil)
+	storage0.EXPECT().Get(ctx, "key").Return("value0", true, nil).Times(2)
+
+	for _, exchange := range [][2]string{
+		{"SELECT 1", "[ok]"},
+		{"GET key", "[ok] value1"},
+		{"FLUSHDB", "[ok]"},
+		{"SELECT 2", "[error] database index is out of range, there are 2 databases"},
+		{"BEGIN", "[ok]"},
+		{"SELECT 0", "[error] database can't be selected in a transaction"},
+		{"ROLLBACK", "[ok]"},
+		{"SELECT 0", "[ok]"},
+		{"GET key", "[ok] value0"},
+	} {
+		require.Equal(t, exchange[1], session.HandleQuery(ctx, exchange[0]), exchange[0])
+	}
+
+	// Other sessions keep their own keyspaces.
+	require.Equal(t, "[ok] value0", other.HandleQuery(ctx, "GET key"))
+	require.Equal(t, "[error] databases are selected by a session", databases[0].HandleQuery(ctx, "SELECT 1"))
+}
+
+func TestSession_PubSub(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storage0 := getMockComputeAndStorage(t)
+	_, storage1 := getMockComputeAndStorage(t)
+	broker, err := pubsub.NewBroker()
+	require.NoError(t, err)
+	databases, err := NewDatabases(
+		compute, []StorageLayer{storage0, storage1}, dlog.NewNonSlog(), WithPubSub(broker),
+	)
+	require.NoError(t, err)
+	subscriber := databases[0].NewSession()
+	defer subscriber.Close()
+	publisher := databases[1].NewSession()
+	defer publisher.Close()
+
+	queries := map[string]Query{
+		"SUBSCRIBE news sport":   NewQuery(SubscribeCommandID, []string{"news", "sport"}),
+		"PSUBSCRIBE new*":        NewQuery(PSubscribeCommandID, []string{"new*"}),
+		"UNSUBSCRIBE news":       NewQuery(UnsubscribeCommandID, []string{"news"}),
+		"UNSUBSCRIBE":            NewQuery(UnsubscribeCommandID, nil),
+		"PUNSUBSCRIBE":           NewQuery(PUnsubscribeCommandID, nil),
+		"PUBLISH news hello":     NewQuery(PublishCommandID, []string{"news", "hello"}),
+		"PUBLISH newsletter one": NewQuery(PublishCommandID, []string{"newsletter", "one"}),
+		"GET key":                NewQuery(GetCommandID, []string{"key"}),
+		"BEGIN":                  NewQuery(BeginCommandID, nil),
+	}
+	for queryStr, query := range queries {
+		compute.EXPECT().HandleQuery(ctx, queryStr).Return(query, nil).AnyTimes()
+	}
+	storage0.EXPECT().Get(ctx, "key").Return("value", true, nil)
+
+	require.Nil(t, subscriber.Messages())
+	for _, exchange := range [][2]string{
+		{"SUBSCRIBE news sport", "[ok] 2"},
+		{"PSUBSCRIBE new*", "[ok] 3"},
+		{"GET key", "[error] only subscription commands are allowed in push mode"},
+	} {
+		require.Equal(t, exchange[1], subscriber.HandleQuery(ctx, exchange[0]), exchange[0])
+	}
+
+	// Channels are shared by all keyspaces.
+	require.Equal(t, "[ok] 2", publisher.HandleQuery(ctx, "PUBLISH news hello"))
+	require.Equal(t, "[message] news hello", string(<-subscriber.Messages()))
+	require.Equal(t, "[pmessage] new* news hello", string(<-subscriber.Messages()))
+	require.Equal(t, "[ok] 1", databases[0].HandleQuery(ctx, "PUBLISH newsletter one"))
+	require.Equal(t, "[pmessage] new* newsletter one", string(<-subscriber.Messages()))
+
+	for _, exchange := range [][2]string{
+		{"UNSUBSCRIBE news", "[ok] 2"},
+		// The subscriptions to patterns are kept by UNSUBSCRIBE.
+		{"UNSUBSCRIBE", "[ok] 1"},
+		{"PUNSUBSCRIBE", "[ok] 0"},
+		{"UNSUBSCRIBE", "[ok] 0"},
+		{"GET key", "[ok] value"},
+		{"BEGIN", "[ok]"},
+		{"SUBSCRIBE news sport", "[error] command is not supported in a transaction"},
+	} {
+		require.Equal(t, exchange[1], subscriber.HandleQuery(ctx, exchange[0]), exchange[0])
+	}
+	require.Equal(t, "[ok] 0", publisher.HandleQuery(ctx, "PUBLISH news hello"))
+	require.Equal(t, "[error] subscriptions require a session", databases[0].HandleQuery(ctx, "UNSUBSCRIBE"))
+
+	require.Nil(t, subscriber.Messages())
+}
+
+func TestSession_Watch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storage0 := getMockComputeAndStorage(t)
+	_, storage1 := getMockComputeAndStorage(t)
+	broker, err := pubsub.NewBroker()
+	require.NoError(t, err)
+	databases, err := NewDatabases(
+		compute, []StorageLayer{storage0, storage1}, dlog.NewNonSlog(), WithPubSub(broker), WithKeyspaceEvents(),
+	)
+	require.NoError(t, err)
+	session := databases[0].NewSession()
+	defer session.Close()
+
+	queries := map[string]Query{
+		"SELECT 1":          NewQuery(SelectCommandID, []string{"1"}),
+		"WATCH user. order": NewQuery(WatchCommandID, []string{"user.", "order"}),
+		"SUBSCRIBE news":    NewQuery(SubscribeCommandID, []string{"news"}),
+		"UNSUBSCRIBE order": NewQuery(UnsubscribeCommandID, []string{"order"}),
+		"UNWATCH order":     NewQuery(UnwatchCommandID, []string{"order"}),
+		"UNSUBSCRIBE":       NewQuery(UnsubscribeCommandID, nil),
+		"UNWATCH":           NewQuery(UnwatchCommandID, nil),
+	}
+	for queryStr, query := range queries {
+		compute.EXPECT().HandleQuery(ctx, queryStr).Return(query, nil).AnyTimes()
+	}
+
+	for _, exchange := range [][2]string{
+		{"SELECT 1", "[ok]"},
+		{"WATCH user. order", "[ok] 2"},
+		{"SUBSCRIBE news", "[ok] 3"},
+		{"SELECT 1", "[error] only subscription commands are allowed in push mode"},
+	} {
+		require.Equal(t, exchange[1], session.HandleQuery(ctx, exchange[0]), exchange[0])
+	}
+
+	// Only the events of the selected keyspace are watched.
+	require.Equal(t, 0, broker.PublishEvent(0, "set", "user.1", "alice"))
+	require.Equal(t, 1, broker.PublishEvent(1, "set", "user.1", "alice"))
+	require.Equal(t, "[event] set user.1 alice", string(<-session.Messages()))
+	require.Equal(t, 1, broker.PublishEvent(1, "del", "orders", ""))
+	require.Equal(t, "[event] del orders", string(<-session.Messages()))
+
+	// A watched prefix is removed only by UNWATCH.
+	require.Equal(t, "[ok] 3", session.HandleQuery(ctx, "UNSUBSCRIBE order"))
+	require.Equal(t, "[ok] 2", session.HandleQuery(ctx, "UNWATCH order"))
+	require.Equal(t, 0, broker.PublishEvent(1, "del", "orders", ""))
+	require.Equal(t, "[ok] 1", session.HandleQuery(ctx, "UNSUBSCRIBE"))
+	require.Equal(t, "[ok] 0", session.HandleQuery(ctx, "UNWATCH"))
+	require.Nil(t, session.Messages())
+}
+
+func TestSession_PubSubDisabled(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storageLayer := getMockComputeAndStorage(t)
+	database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+	require.NoError(t, err)
+	session := database.NewSession()
+
+	compute.EXPECT().HandleQuery(ctx, "SUBSCRIBE news").
+		Return(NewQuery(SubscribeCommandID, []string{"news"}), nil)
+	compute.EXPECT().HandleQuery(ctx, "PUBLISH news hello").
+		Return(NewQuery(PublishCommandID, []string{"news", "hello"}), nil)
+
+	require.Equal(t, "[error] pubsub is disabled", session.HandleQuery(ctx, "SUBSCRIBE news"))
+	require.Equal(t, "[error] pubsub is disabled", session.HandleQuery(ctx, "PUBLISH news hello"))
+	require.Nil(t, session.Messages())
+
+	broker, err := pubsub.NewBroker()
+	require.NoError(t, err)
+	database, err = NewDatabase(compute, storageLayer, dlog.NewNonSlog(), WithPubSub(broker))
+	require.NoError(t, err)
+	session = database.NewSession()
+	compute.EXPECT().HandleQuery(ctx, "WATCH user.").
+		Return(NewQuery(WatchCommandID, []string{"user."}), nil)
+
+	require.Equal(t, "[error] keyspace events are disabled", session.HandleQuery(ctx, "WATCH user."))
+	require.Nil(t, session.Messages())
+}
+
+func TestDatabase_TransactionWithoutSession(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	compute, storageLayer := getMockComputeAndStorage(t)
+	database, err := NewDatabase(compute, storageLayer, dlog.NewNonSlog())
+	require.NoError(t, err)
+	compute.EXPECT().HandleQuery(ctx, "BEGIN").Return(NewQuery(BeginCommandID, nil), nil)
+
+	require.Equal(t, "[error] transactions require a session", database.HandleQuery(ctx, "BEGIN"))
+}
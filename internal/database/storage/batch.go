@@ -0,0 +1,56 @@
+package storage
+
+import "kv_db/internal/database/storage/wal"
+
+// batchLog returns a BatchOp log of the writes of the batch, which are
+// encoded as SetOp and DelOp logs.
+func batchLog(batch *Batch) wal.Log {
+	logs := make([]wal.Log, 0, batch.Len())
+	for _, w := range batch.Writes() {
+		switch {
+		case w.Deleted:
+			logs = append(logs, wal.NewLog(0, wal.DelOp, w.Key))
+		case !w.ExpiresAt.IsZero():
+			logs = append(logs, wal.NewLog(0, wal.SetOp, w.Key, w.Value, wal.FormatExpiration(w.ExpiresAt)))
+		default:
+			logs = append(logs, wal.NewLog(0, wal.SetOp, w.Key, w.Value))
+		}
+	}
+	return wal.NewBatchLog(0, logs)
+}
+
+// batchKeys returns the keys of the writes of the batch.
+func batchKeys(batch *Batch) []string {
+	keys := make([]string, 0, batch.Len())
+	for _, w := range batch.Writes() {
+		keys = append(keys, w.Key)
+	}
+	return keys
+}
+
+// parseBatchLog returns the batch of a BatchOp log.
+func parseBatchLog(log wal.Log) (*Batch, error) {
+	logs, err := log.BatchLogs()
+	if err != nil {
+		return nil, err
+	}
+
+	batch := NewBatch()
+	for _, log := range logs {
+		switch {
+		case log.Op == wal.SetOp && len(log.Args) == 2:
+			batch.Put(log.Args[0], log.Args[1])
+		case log.Op == wal.SetOp && len(log.Args) == 3:
+			expiresAt, err := wal.ParseExpiration(log.Args[2])
+			if err != nil {
+				return nil, err
+			}
+			batch.PutWithExpiration(log.Args[0], log.Args[1], expiresAt)
+		case log.Op == wal.DelOp && len(log.Args) == 1:
+			batch.Delete(log.Args[0])
+		default:
+			return nil, wal.ErrCorruptedLog
+		}
+	}
+	return batch, nil
+}
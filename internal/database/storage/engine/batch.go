@@ -0,0 +1,52 @@
+package engine
+
+import "time"
+
+// Write is a put or a delete of a batch.
+type Write struct {
+	Key   string
+	Value string
+	// ExpiresAt is the expiration time of a put, which is zero if the key
+	// doesn't expire.
+	ExpiresAt time.Time
+	Deleted   bool
+}
+
+// Batch collects puts and deletes, which an engine applies atomically in the
+// order they are added. A batch isn't safe for concurrent use.
+type Batch struct {
+	writes []Write
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+func (b *Batch) Put(key, value string) {
+	b.writes = append(b.writes, Write{Key: key, Value: value})
+}
+
+// PutWithExpiration puts the value that expires at the given time.
+func (b *Batch) PutWithExpiration(key, value string, expiresAt time.Time) {
+	b.writes = append(b.writes, Write{Key: key, Value: value, ExpiresAt: expiresAt})
+}
+
+func (b *Batch) Delete(key string) {
+	b.writes = append(b.writes, Write{Key: key, Deleted: true})
+}
+
+// Len returns the number of writes.
+func (b *Batch) Len() int {
+	return len(b.writes)
+}
+
+// Writes returns the writes in the order they are added. The slice must not
+// be modified.
+func (b *Batch) Writes() []Write {
+	return b.writes
+}
+
+// Reset removes all writes, so the batch can be reused.
+func (b *Batch) Reset() {
+	b.writes = b.writes[:0]
+}
@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+
+	expiresAt := time.Unix(10, 0)
+	batch := NewBatch()
+	require.Zero(t, batch.Len())
+
+	batch.Put("key1", "value1")
+	batch.Delete("key2")
+	batch.PutWithExpiration("key1", "value2", expiresAt)
+	require.Equal(t, 3, batch.Len())
+	require.Equal(t, []Write{
+		{Key: "key1", Value: "value1"},
+		{Key: "key2", Deleted: true},
+		{Key: "key1", Value: "value2", ExpiresAt: expiresAt},
+	}, batch.Writes())
+
+	batch.Reset()
+	require.Zero(t, batch.Len())
+	require.Empty(t, batch.Writes())
+}
@@ -0,0 +1,17 @@
+package engine
+
+import "errors"
+
+// ErrWrongType is returned by engines that keep values of several types when
+// an operation doesn't support the type of the value of a key.
+var ErrWrongType = errors.New("WRONGTYPE operation against a key holding the wrong kind of value")
+
+// ErrMemoryLimit is returned by engines with a memory limit when a write
+// doesn't fit into it. Such a write doesn't change the engine.
+var ErrMemoryLimit = errors.New("memory limit is reached")
+
+// ScoredMember is a member of a sorted set with its score.
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
@@ -0,0 +1,882 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kv_db/internal/database/storage/engine"
+	"kv_db/internal/database/storage/engine/scan"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
+	"kv_db/pkg/dlog"
+)
+
+const (
+	tablePrefix      = "sst_"
+	tableSuffix      = ".sst"
+	tmpSuffix        = ".tmp"
+	journalDirectory = "journal"
+)
+
+var ErrClosed = errors.New("lsm engine is closed")
+
+// LSM is a persistent engine. Mutations are appended to a journal and
+// applied to the memtable. A full memtable becomes immutable and is flushed
+// to a sorted table in the background. When the number of tables reaches
+// the compaction threshold, all of them are merged into one and tombstones
+// are dropped.
+//
+// The journal is written without fsync, so it survives a crash of the
+// process, but not of the machine. Flushed tables are always synced.
+//
+// Every write of a value gives the key a new version, which is kept in the
+// journal and the tables. The version counter doesn't go below the current
+// time in nanoseconds, so versions keep growing after a restart.
+type LSM struct {
+	directory           string
+	memtableSize        int
+	blockSize           int
+	compactionThreshold int
+	logger              *slog.Logger
+	clock               dclock.Clock
+
+	mutex     sync.RWMutex
+	flushCond *sync.Cond
+	journal   *wal.LogsManager
+	lsn       uint64
+	version   uint64
+	memtable  *memtable
+	immutable *memtable
+	closed    bool
+
+	tablesMutex sync.RWMutex
+	tables      []*sstable
+	nextSeq     uint64
+
+	flushes     chan struct{}
+	compactions chan struct{}
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+type Option func(*LSM)
+
+func WithClock(clock dclock.Clock) Option {
+	return func(engine *LSM) {
+		engine.clock = clock
+	}
+}
+
+func NewLSM(
+	directory string, memtableSize, blockSize, compactionThreshold int, logger *slog.Logger, options ...Option,
+) (*LSM, error) {
+	if directory == "" {
+		return nil, errors.New("lsm directory is invalid")
+	}
+
+	if memtableSize <= 0 {
+		return nil, errors.New("lsm memtable size is invalid")
+	}
+
+	if blockSize <= 0 {
+		return nil, errors.New("lsm block size is invalid")
+	}
+
+	if compactionThreshold < 2 {
+		return nil, errors.New("lsm compaction threshold is invalid")
+	}
+
+	if logger == nil {
+		return nil, errors.New("lsm logger is invalid")
+	}
+
+	journal, err := wal.NewLogsManager(filepath.Join(directory, journalDirectory), memtableSize, false, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	engine := &LSM{
+		directory:           directory,
+		memtableSize:        memtableSize,
+		blockSize:           blockSize,
+		compactionThreshold: compactionThreshold,
+		logger:              logger,
+		clock:               dclock.NewRealClock(),
+		journal:             journal,
+		memtable:            newMemtable(),
+		flushes:             make(chan struct{}, 1),
+		compactions:         make(chan struct{}, 1),
+		done:                make(chan struct{}),
+	}
+	engine.flushCond = sync.NewCond(&engine.mutex)
+	for _, option := range options {
+		option(engine)
+	}
+
+	if err := engine.recover(); err != nil {
+		engine.closeTables()
+		return nil, errors.Join(err, journal.Close())
+	}
+
+	engine.wg.Add(2)
+	go engine.runFlushes()
+	go engine.runCompactions()
+	engine.scheduleCompaction()
+
+	return engine, nil
+}
+
+func (l *LSM) Set(_ context.Context, key string, value string) error {
+	return l.write(entry{key: key, value: value})
+}
+
+func (l *LSM) SetWithExpiration(_ context.Context, key string, value string, expiresAt time.Time) error {
+	return l.write(entry{key: key, value: value, expiresAt: expiresAt.UnixNano()})
+}
+
+func (l *LSM) Delete(_ context.Context, key string) error {
+	return l.write(entry{key: key, deleted: true})
+}
+
+func (l *LSM) Get(ctx context.Context, key string) (string, bool, error) {
+	value, _, ok, err := l.GetWithVersion(ctx, key)
+	return value, ok, err
+}
+
+// GetWithVersion returns the value and the version of the key. A missing key
+// has version 0.
+func (l *LSM) GetWithVersion(_ context.Context, key string) (string, uint64, bool, error) {
+	l.mutex.RLock()
+	e, found := l.lookupMemtables(key)
+	l.mutex.RUnlock()
+
+	if !found {
+		var err error
+		if e, found, err = l.lookupTables(key); err != nil {
+			return "", 0, false, err
+		}
+	}
+
+	if !found || !l.live(e) {
+		return "", 0, false, nil
+	}
+	return e.value, e.version, true, nil
+}
+
+// Expire rewrites the value of an existing key with the new expiration time.
+func (l *LSM) Expire(_ context.Context, key string, expiresAt time.Time) (bool, error) {
+	return l.update(key, func(e entry) (entry, bool) {
+		e.expiresAt = expiresAt.UnixNano()
+		return e, true
+	})
+}
+
+func (l *LSM) Persist(_ context.Context, key string) (bool, error) {
+	return l.update(key, func(e entry) (entry, bool) {
+		if e.expiresAt == 0 {
+			return e, false
+		}
+		e.expiresAt = 0
+		return e, true
+	})
+}
+
+func (l *LSM) Expiration(_ context.Context, key string) (time.Time, bool, error) {
+	l.mutex.RLock()
+	e, found := l.lookupMemtables(key)
+	l.mutex.RUnlock()
+
+	if !found {
+		var err error
+		if e, found, err = l.lookupTables(key); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+
+	if !found || !l.live(e) {
+		return time.Time{}, false, nil
+	}
+
+	if e.expiresAt == 0 {
+		return time.Time{}, true, nil
+	}
+	return time.Unix(0, e.expiresAt), true, nil
+}
+
+// Scan returns about count keys that follow the cursor and the cursor of the
+// next call, which is zero at the end. Every call reads the memtables and
+// all tables, so it is slow, but writers are blocked only while the
+// memtables are read.
+func (l *LSM) Scan(_ context.Context, cursor uint64, count int) ([]string, uint64, error) {
+	now := l.clock.Now().UnixNano()
+	batch := scan.NewBatch(cursor, count)
+
+	// Keys of the memtables shadow older versions in the tables.
+	shadowed := make(map[string]struct{})
+	l.mutex.RLock()
+	l.memtableKeys(now, shadowed, batch.Add)
+	l.mutex.RUnlock()
+
+	l.tablesMutex.RLock()
+	defer l.tablesMutex.RUnlock()
+
+	err := mergeTables(l.tables, now, func(e entry) error {
+		if _, ok := shadowed[e.key]; !ok {
+			batch.Add(e.key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, next := batch.Result()
+	return keys, next, nil
+}
+
+// Flush deletes all keys with a single batch of tombstones, which are
+// dropped by the next compaction.
+func (l *LSM) Flush(context.Context) error {
+	now := l.clock.Now().UnixNano()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	var entries []entry
+	tombstone := func(key string) {
+		entries = append(entries, entry{key: key, deleted: true})
+	}
+
+	shadowed := make(map[string]struct{})
+	l.memtableKeys(now, shadowed, tombstone)
+
+	l.tablesMutex.RLock()
+	err := mergeTables(l.tables, now, func(e entry) error {
+		if _, ok := shadowed[e.key]; !ok {
+			tombstone(e.key)
+		}
+		return nil
+	})
+	l.tablesMutex.RUnlock()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	return l.applyLocked(entries)
+}
+
+// memtableKeys adds keys of the memtables to shadowed and passes the live
+// ones to yield. It has to be called under the lock.
+func (l *LSM) memtableKeys(now int64, shadowed map[string]struct{}, yield func(string)) {
+	for _, table := range []*memtable{l.memtable, l.immutable} {
+		if table == nil {
+			continue
+		}
+		for key, e := range table.entries {
+			if _, ok := shadowed[key]; ok {
+				continue
+			}
+			shadowed[key] = struct{}{}
+			if !e.deleted && !e.expired(now) {
+				yield(key)
+			}
+		}
+	}
+}
+
+// DeleteExpired doesn't delete anything, because expired entries are dropped
+// by the compaction.
+func (l *LSM) DeleteExpired(context.Context, int) (int, error) {
+	return 0, nil
+}
+
+// Close flushes the memtable and releases files. The engine can't be used
+// after that.
+func (l *LSM) Close() error {
+	l.mutex.Lock()
+	if l.closed {
+		l.mutex.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mutex.Unlock()
+
+	l.flushCond.Broadcast()
+	close(l.done)
+	l.wg.Wait()
+
+	// The immutable memtable is older than the current one, so it has to be
+	// flushed first.
+	err := l.flush()
+	if err == nil {
+		l.mutex.Lock()
+		if len(l.memtable.entries) != 0 {
+			l.immutable, l.memtable = l.memtable, newMemtable()
+		}
+		l.mutex.Unlock()
+		err = l.flush()
+	}
+
+	l.closeTables()
+	return errors.Join(err, l.journal.Close())
+}
+
+func (l *LSM) write(e entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+	if !e.deleted {
+		e.version = l.nextVersion()
+	}
+	return l.writeLocked(e)
+}
+
+// update applies the action to the live entry of the key. The action
+// returns false if the entry doesn't need to be changed.
+func (l *LSM) update(key string, action func(entry) (entry, bool)) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return false, ErrClosed
+	}
+
+	e, live, err := l.lookupLocked(key)
+	if err != nil || !live {
+		return false, err
+	}
+
+	e, changed := action(e)
+	if !changed {
+		return false, nil
+	}
+	return true, l.writeLocked(e)
+}
+
+// lookupLocked returns the entry of the key and whether it is live. It has
+// to be called under the write lock, which keeps the entry from changing.
+func (l *LSM) lookupLocked(key string) (entry, bool, error) {
+	e, found := l.lookupMemtables(key)
+	if !found {
+		var err error
+		if e, found, err = l.lookupTables(key); err != nil {
+			return entry{}, false, err
+		}
+	}
+
+	if !found || !l.live(e) {
+		return entry{}, false, nil
+	}
+	return e, true, nil
+}
+
+func (l *LSM) writeLocked(e entry) error {
+	if err := l.journal.Write([]wal.Log{journalLog(l.lsn+1, e)}); err != nil {
+		return err
+	}
+	l.lsn++
+	l.memtable.put(l.lsn, e)
+
+	if l.memtable.size >= l.memtableSize {
+		l.rotateMemtable()
+	}
+	return nil
+}
+
+// Apply applies the writes of the batch atomically. They are journaled as a
+// single batch log and put into the same memtable, so both readers and a
+// recovery observe either all or none of them.
+func (l *LSM) Apply(_ context.Context, batch *engine.Batch) error {
+	entries := make([]entry, 0, batch.Len())
+	for _, w := range batch.Writes() {
+		e := entry{key: w.Key, value: w.Value, deleted: w.Deleted}
+		if !w.ExpiresAt.IsZero() {
+			e.expiresAt = w.ExpiresAt.UnixNano()
+		}
+		entries = append(entries, e)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+	return l.applyLocked(entries)
+}
+
+// applyLocked journals the entries as a single batch log and puts them into
+// the memtable. It has to be called under the write lock.
+func (l *LSM) applyLocked(entries []entry) error {
+	logs := make([]wal.Log, 0, len(entries))
+	for idx := range entries {
+		if !entries[idx].deleted {
+			entries[idx].version = l.nextVersion()
+		}
+		logs = append(logs, journalLog(0, entries[idx]))
+	}
+	if err := l.journal.Write([]wal.Log{wal.NewBatchLog(l.lsn+1, logs)}); err != nil {
+		return err
+	}
+
+	l.lsn++
+	for _, e := range entries {
+		l.memtable.put(l.lsn, e)
+	}
+
+	if l.memtable.size >= l.memtableSize {
+		l.rotateMemtable()
+	}
+	return nil
+}
+
+// nextVersion returns a version that is greater than all given ones and not
+// less than the current time in nanoseconds. It has to be called under the
+// write lock.
+func (l *LSM) nextVersion() uint64 {
+	l.version = max(l.version+1, uint64(max(l.clock.Now().UnixNano(), 0)))
+	return l.version
+}
+
+func (l *LSM) lookupMemtables(key string) (entry, bool) {
+	e, found := l.memtable.get(key)
+	if !found && l.immutable != nil {
+		e, found = l.immutable.get(key)
+	}
+	return e, found
+}
+
+func (l *LSM) lookupTables(key string) (entry, bool, error) {
+	l.tablesMutex.RLock()
+	defer l.tablesMutex.RUnlock()
+
+	for _, table := range l.tables {
+		e, found, err := table.get(key)
+		if err != nil || found {
+			return e, found, err
+		}
+	}
+	return entry{}, false, nil
+}
+
+func (l *LSM) live(e entry) bool {
+	return !e.deleted && !e.expired(l.clock.Now().UnixNano())
+}
+
+// journalLog returns a delete log or a set log with the key, the value, the
+// expiration time, which is empty if the entry doesn't expire, and the
+// version. Journals written before versions were added have set logs without
+// the version and with the optional expiration time.
+func journalLog(lsn uint64, e entry) wal.Log {
+	if e.deleted {
+		return wal.NewLog(lsn, wal.DelOp, e.key)
+	}
+
+	var expiration string
+	if e.expiresAt != 0 {
+		expiration = wal.FormatExpiration(time.Unix(0, e.expiresAt))
+	}
+	return wal.NewLog(lsn, wal.SetOp, e.key, e.value, expiration, strconv.FormatUint(e.version, 10))
+}
+
+// rotateMemtable makes the memtable immutable and schedules its flush. If
+// the previous memtable is still being flushed, the writer waits for it.
+func (l *LSM) rotateMemtable() {
+	for l.immutable != nil {
+		if l.closed {
+			return
+		}
+		l.flushCond.Wait()
+	}
+
+	l.immutable, l.memtable = l.memtable, newMemtable()
+	select {
+	case l.flushes <- struct{}{}:
+	default:
+	}
+}
+
+func (l *LSM) runFlushes() {
+	defer l.wg.Done()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-l.flushes:
+			if err := l.flush(); err != nil {
+				l.logger.Error("failed to flush memtable", dlog.ErrAttr(err))
+			}
+		}
+	}
+}
+
+// flush writes the immutable memtable to a new table. The table is added
+// before the memtable is dropped, so readers always find the data in one of
+// them.
+func (l *LSM) flush() error {
+	l.mutex.RLock()
+	immutable := l.immutable
+	l.mutex.RUnlock()
+
+	if immutable == nil {
+		return nil
+	}
+
+	l.tablesMutex.Lock()
+	seq := l.nextSeq
+	l.nextSeq++
+	l.tablesMutex.Unlock()
+
+	path := filepath.Join(l.directory, tableName(seq))
+	if err := writeSSTable(path, immutable.sorted(), l.blockSize); err != nil {
+		return err
+	}
+
+	table, err := openSSTable(seq, path)
+	if err != nil {
+		return err
+	}
+
+	l.tablesMutex.Lock()
+	l.tables = append([]*sstable{table}, l.tables...)
+	tablesCount := len(l.tables)
+	l.tablesMutex.Unlock()
+
+	l.mutex.Lock()
+	l.immutable = nil
+	l.flushCond.Broadcast()
+	l.mutex.Unlock()
+
+	if err := l.journal.Truncate(immutable.lastLSN); err != nil {
+		l.logger.Warn("failed to truncate journal", dlog.ErrAttr(err))
+	}
+
+	if tablesCount >= l.compactionThreshold {
+		l.scheduleCompaction()
+	}
+	return nil
+}
+
+func (l *LSM) scheduleCompaction() {
+	select {
+	case l.compactions <- struct{}{}:
+	default:
+	}
+}
+
+func (l *LSM) runCompactions() {
+	defer l.wg.Done()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-l.compactions:
+			if err := l.compact(); err != nil {
+				l.logger.Error("failed to compact tables", dlog.ErrAttr(err))
+			}
+		}
+	}
+}
+
+// compact merges all current tables into a base table. Because the oldest
+// table is merged too, tombstones and expired entries are not needed anymore
+// and are dropped. The
+// result replaces the newest of the merged tables, so tables flushed during
+// the compaction stay newer than it. If the process stops before the other
+// inputs are removed, they are removed by the recovery.
+func (l *LSM) compact() error {
+	l.tablesMutex.RLock()
+	inputs := append([]*sstable(nil), l.tables...)
+	l.tablesMutex.RUnlock()
+
+	if len(inputs) < l.compactionThreshold {
+		return nil
+	}
+
+	output := inputs[0]
+	tmpPath := output.path + tmpSuffix
+	writer, err := newSSTableWriter(tmpPath, l.blockSize, true)
+	if err != nil {
+		return err
+	}
+
+	if err := mergeTables(inputs, l.clock.Now().UnixNano(), writer.add); err != nil {
+		writer.abort()
+		return err
+	}
+
+	if err := writer.finish(); err != nil {
+		writer.abort()
+		return err
+	}
+
+	l.tablesMutex.Lock()
+	defer l.tablesMutex.Unlock()
+
+	if err := os.Rename(tmpPath, output.path); err != nil {
+		return fmt.Errorf("failed to replace table: %w", err)
+	}
+
+	table, err := openSSTable(output.seq, output.path)
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[*sstable]struct{}, len(inputs))
+	for _, input := range inputs {
+		merged[input] = struct{}{}
+		if err := input.close(); err != nil {
+			l.logger.Warn("failed to close table", dlog.ErrAttr(err))
+		}
+
+		if input != output {
+			if err := os.Remove(input.path); err != nil {
+				l.logger.Warn("failed to remove table", dlog.ErrAttr(err))
+			}
+		}
+	}
+
+	tables := make([]*sstable, 0, len(l.tables)-len(inputs)+1)
+	for _, current := range l.tables {
+		if _, ok := merged[current]; !ok {
+			tables = append(tables, current)
+		}
+	}
+	l.tables = append(tables, table)
+
+	l.logger.Debug("tables are compacted", slog.Int("tables", len(inputs)))
+	return nil
+}
+
+// mergeTables passes live entries of the tables in the key order. Tables go
+// from the newest to the oldest, and the newest version of a key wins.
+func mergeTables(tables []*sstable, now int64, yield func(entry) error) error {
+	iterators := make([]*sstableIterator, len(tables))
+	heads := make([]*entry, len(tables))
+	for idx, table := range tables {
+		iterators[idx] = table.iterator()
+		if e, ok := iterators[idx].next(); ok {
+			heads[idx] = &e
+		}
+	}
+
+	for {
+		winner := -1
+		for idx, head := range heads {
+			if head != nil && (winner == -1 || head.key < heads[winner].key) {
+				winner = idx
+			}
+		}
+
+		if winner == -1 {
+			break
+		}
+
+		current := *heads[winner]
+		for idx, head := range heads {
+			if head == nil || head.key != current.key {
+				continue
+			}
+
+			heads[idx] = nil
+			if e, ok := iterators[idx].next(); ok {
+				heads[idx] = &e
+			}
+		}
+
+		if !current.deleted && !current.expired(now) {
+			if err := yield(current); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, iterator := range iterators {
+		if iterator.err != nil {
+			return iterator.err
+		}
+	}
+	return nil
+}
+
+func (l *LSM) recover() error {
+	entries, err := os.ReadDir(l.directory)
+	if err != nil {
+		return fmt.Errorf("failed to read lsm directory: %w", err)
+	}
+
+	for _, dirEntry := range entries {
+		name := dirEntry.Name()
+		if strings.HasSuffix(name, tmpSuffix) {
+			if err := os.Remove(filepath.Join(l.directory, name)); err != nil {
+				return fmt.Errorf("failed to remove temporary table: %w", err)
+			}
+			continue
+		}
+
+		seq, ok := parseTableName(name)
+		if !ok {
+			continue
+		}
+
+		table, err := openSSTable(seq, filepath.Join(l.directory, name))
+		if err != nil {
+			return err
+		}
+		l.tables = append(l.tables, table)
+
+		if seq >= l.nextSeq {
+			l.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(l.tables, func(i, j int) bool {
+		return l.tables[i].seq > l.tables[j].seq
+	})
+
+	if err := l.removeObsoleteTables(); err != nil {
+		return err
+	}
+
+	logs, err := l.journal.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	// The journal may contain logs that are already flushed. Replaying them
+	// in order gives the same result, because every log overwrites the key.
+	for _, log := range logs {
+		entries, err := journalEntries(log)
+		if err != nil {
+			return fmt.Errorf("failed to apply journal log %d: %w", log.LSN, err)
+		}
+		for _, e := range entries {
+			l.version = max(l.version, e.version)
+			l.memtable.put(log.LSN, e)
+		}
+		l.lsn = log.LSN
+	}
+
+	l.logger.Info("lsm engine is recovered", slog.Int("tables", len(l.tables)), slog.Int("logs", len(logs)))
+	return nil
+}
+
+// removeObsoleteTables removes tables that are older than the newest base
+// table. They are left after a compaction that was interrupted.
+func (l *LSM) removeObsoleteTables() error {
+	for idx, table := range l.tables {
+		if !table.base {
+			continue
+		}
+
+		for _, obsolete := range l.tables[idx+1:] {
+			if err := obsolete.close(); err != nil {
+				l.logger.Warn("failed to close table", dlog.ErrAttr(err))
+			}
+
+			if err := os.Remove(obsolete.path); err != nil {
+				return fmt.Errorf("failed to remove obsolete table: %w", err)
+			}
+		}
+		l.tables = l.tables[:idx+1]
+		return nil
+	}
+
+	return nil
+}
+
+func journalEntries(log wal.Log) ([]entry, error) {
+	if log.Op != wal.BatchOp {
+		e, err := journalEntry(log)
+		if err != nil {
+			return nil, err
+		}
+		return []entry{e}, nil
+	}
+
+	logs, err := log.BatchLogs()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entry, 0, len(logs))
+	for _, batchLog := range logs {
+		e, err := journalEntry(batchLog)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func journalEntry(log wal.Log) (entry, error) {
+	switch {
+	case log.Op == wal.SetOp && len(log.Args) >= 2 && len(log.Args) <= 4:
+		e := entry{key: log.Args[0], value: log.Args[1]}
+		if len(log.Args) >= 3 && log.Args[2] != "" {
+			expiresAt, err := wal.ParseExpiration(log.Args[2])
+			if err != nil {
+				return entry{}, err
+			}
+			e.expiresAt = expiresAt.UnixNano()
+		}
+		if len(log.Args) == 4 {
+			version, err := strconv.ParseUint(log.Args[3], 10, 64)
+			if err != nil {
+				return entry{}, wal.ErrCorruptedLog
+			}
+			e.version = version
+		}
+		return e, nil
+	case log.Op == wal.DelOp && len(log.Args) == 1:
+		return entry{key: log.Args[0], deleted: true}, nil
+	}
+	return entry{}, wal.ErrCorruptedLog
+}
+
+func (l *LSM) closeTables() {
+	l.tablesMutex.Lock()
+	defer l.tablesMutex.Unlock()
+
+	for _, table := range l.tables {
+		if err := table.close(); err != nil {
+			l.logger.Warn("failed to close table", dlog.ErrAttr(err))
+		}
+	}
+	l.tables = nil
+}
+
+func tableName(seq uint64) string {
+	return fmt.Sprintf("%s%020d%s", tablePrefix, seq, tableSuffix)
+}
+
+func parseTableName(name string) (uint64, bool) {
+	if !strings.HasPrefix(name, tablePrefix) || !strings.HasSuffix(name, tableSuffix) {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, tablePrefix), tableSuffix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return seq, true
+}
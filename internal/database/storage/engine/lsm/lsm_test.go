@@ -0,0 +1,374 @@
+package lsm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	storageengine "kv_db/internal/database/storage/engine"
+	"kv_db/pkg/dclock"
+	"kv_db/pkg/dlog"
+)
+
+func TestNewLSM(t *testing.T) {
+	t.Parallel()
+
+	testcases := map[string]struct {
+		directory           string
+		memtableSize        int
+		blockSize           int
+		compactionThreshold int
+	}{
+		"empty directory":       {directory: "", memtableSize: 1024, blockSize: 64, compactionThreshold: 4},
+		"invalid memtable size": {directory: t.TempDir(), memtableSize: 0, blockSize: 64, compactionThreshold: 4},
+		"invalid block size":    {directory: t.TempDir(), memtableSize: 1024, blockSize: 0, compactionThreshold: 4},
+		"invalid threshold":     {directory: t.TempDir(), memtableSize: 1024, blockSize: 64, compactionThreshold: 1},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			engine, err := NewLSM(tc.directory, tc.memtableSize, tc.blockSize, tc.compactionThreshold, dlog.NewNonSlog())
+			require.Error(t, err)
+			require.Nil(t, engine)
+		})
+	}
+
+	engine, err := NewLSM(t.TempDir(), 1024, 64, 4, nil)
+	require.Error(t, err)
+	require.Nil(t, engine)
+}
+
+func TestLSM(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine := newTestLSM(t, t.TempDir(), 1024)
+	defer func() { require.NoError(t, engine.Close()) }()
+
+	_, ok, err := engine.Get(ctx, "key")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, engine.Set(ctx, "key", "value"))
+	value, ok, err := engine.Get(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value", value)
+
+	require.NoError(t, engine.Delete(ctx, "key"))
+	_, ok, err = engine.Get(ctx, "key")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestLSMFlushesAndCompacts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	directory := t.TempDir()
+	engine := newTestLSM(t, directory, 128)
+
+	for i := 0; i < 200; i++ {
+		require.NoError(t, engine.Set(ctx, fmt.Sprintf("key%d", i%50), fmt.Sprintf("value%d", i)))
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, engine.Delete(ctx, fmt.Sprintf("key%d", i)))
+	}
+
+	require.Eventually(t, func() bool {
+		engine.tablesMutex.RLock()
+		defer engine.tablesMutex.RUnlock()
+		return len(engine.tables) != 0 && engine.tables[len(engine.tables)-1].base
+	}, time.Second, 10*time.Millisecond)
+
+	requireLSMData(t, engine)
+	require.NoError(t, engine.Close())
+
+	engine = newTestLSM(t, directory, 128)
+	defer func() { require.NoError(t, engine.Close()) }()
+	requireLSMData(t, engine)
+}
+
+func TestLSMRecoversJournal(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	directory := t.TempDir()
+	engine := newTestLSM(t, directory, 1<<20)
+
+	require.NoError(t, engine.Set(ctx, "key1", "value1"))
+	require.NoError(t, engine.Set(ctx, "key2", "value2"))
+	require.NoError(t, engine.Delete(ctx, "key1"))
+	_, version, _, err := engine.GetWithVersion(ctx, "key2")
+	require.NoError(t, err)
+
+	// Stop the background work without flushing the memtable, as if the
+	// process crashed.
+	close(engine.done)
+	engine.wg.Wait()
+
+	recovered := newTestLSM(t, directory, 1<<20)
+	defer func() { require.NoError(t, recovered.Close()) }()
+
+	_, ok, err := recovered.Get(ctx, "key1")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	value, recoveredVersion, ok, err := recovered.GetWithVersion(ctx, "key2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value2", value)
+	require.Equal(t, version, recoveredVersion)
+}
+
+func TestLSMRemovesObsoleteTables(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	directory := t.TempDir()
+
+	require.NoError(t, writeSSTable(filepath.Join(directory, tableName(1)), []entry{{key: "deleted", value: "value"}}, 64))
+
+	writer, err := newSSTableWriter(filepath.Join(directory, tableName(2)), 64, true)
+	require.NoError(t, err)
+	require.NoError(t, writer.add(entry{key: "key", value: "value"}))
+	require.NoError(t, writer.finish())
+
+	require.NoError(t, os.WriteFile(filepath.Join(directory, tableName(3)+tmpSuffix), []byte("tmp"), 0o644))
+
+	engine := newTestLSM(t, directory, 1024)
+	defer func() { require.NoError(t, engine.Close()) }()
+
+	_, ok, err := engine.Get(ctx, "deleted")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	value, ok, err := engine.Get(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value", value)
+
+	files, err := filepath.Glob(filepath.Join(directory, "*.sst*"))
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(directory, tableName(2))}, files)
+}
+
+func TestLSMConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine := newTestLSM(t, t.TempDir(), 256)
+	defer func() { require.NoError(t, engine.Close()) }()
+
+	workers := 8
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("key%d_%d", worker, j)
+				require.NoError(t, engine.Set(ctx, key, key))
+
+				value, ok, err := engine.Get(ctx, key)
+				require.NoError(t, err)
+				require.True(t, ok)
+				require.Equal(t, key, value)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLSMExpiration(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	directory := t.TempDir()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	engine, err := NewLSM(directory, 1024, 64, 2, dlog.NewNonSlog(), WithClock(clock))
+	require.NoError(t, err)
+
+	require.NoError(t, engine.SetWithExpiration(ctx, "key1", "value1", clock.Now().Add(time.Second)))
+	require.NoError(t, engine.SetWithExpiration(ctx, "key2", "value2", clock.Now().Add(time.Second)))
+	require.NoError(t, engine.Set(ctx, "key3", "value3"))
+
+	ok, err := engine.Persist(ctx, "key2")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = engine.Persist(ctx, "key3")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = engine.Expire(ctx, "key3", clock.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// The entries are read from a table after the reopening.
+	require.NoError(t, engine.Close())
+	engine, err = NewLSM(directory, 1024, 64, 2, dlog.NewNonSlog(), WithClock(clock))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, engine.Close()) }()
+
+	expiresAt, ok, err := engine.Expiration(ctx, "key1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, clock.Now().Add(time.Second), expiresAt)
+
+	clock.Advance(time.Second)
+
+	_, ok, err = engine.Get(ctx, "key1")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = engine.Expire(ctx, "key1", clock.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	value, ok, err := engine.Get(ctx, "key2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value2", value)
+
+	expiresAt, ok, err = engine.Expiration(ctx, "key3")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, time.Unix(60, 0), expiresAt)
+}
+
+func TestLSMApply(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	directory := t.TempDir()
+	engine := newTestLSM(t, directory, 1<<20)
+
+	require.NoError(t, engine.Set(ctx, "key2", "old"))
+	batch := storageengine.NewBatch()
+	batch.Put("key1", "value1")
+	batch.Delete("key2")
+	batch.PutWithExpiration("key3", "value3", time.Now().Add(time.Hour))
+	require.NoError(t, engine.Apply(ctx, batch))
+
+	// The batch is recovered from the journal.
+	close(engine.done)
+	engine.wg.Wait()
+
+	recovered := newTestLSM(t, directory, 1<<20)
+	defer func() { require.NoError(t, recovered.Close()) }()
+
+	for key, expValue := range map[string]string{"key1": "value1", "key3": "value3"} {
+		value, ok, err := recovered.Get(ctx, key)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, expValue, value)
+	}
+
+	_, ok, err := recovered.Get(ctx, "key2")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestLSMFlush(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	directory := t.TempDir()
+	engine := newTestLSM(t, directory, 64)
+
+	// Some of the keys are flushed to tables and the others stay in the
+	// memtables.
+	for i := 0; i < 50; i++ {
+		require.NoError(t, engine.Set(ctx, fmt.Sprintf("key%d", i), "value"))
+	}
+	require.NoError(t, engine.Flush(ctx))
+	require.NoError(t, engine.Set(ctx, "key50", "value"))
+
+	keys, _, err := engine.Scan(ctx, 0, 100)
+	require.NoError(t, err)
+	require.Equal(t, []string{"key50"}, keys)
+	require.NoError(t, engine.Close())
+
+	engine = newTestLSM(t, directory, 64)
+	defer func() { require.NoError(t, engine.Close()) }()
+
+	keys, _, err = engine.Scan(ctx, 0, 100)
+	require.NoError(t, err)
+	require.Equal(t, []string{"key50"}, keys)
+}
+
+func TestLSMScan(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine := newTestLSM(t, t.TempDir(), 128)
+	defer func() { require.NoError(t, engine.Close()) }()
+
+	for i := 0; i < 200; i++ {
+		require.NoError(t, engine.Set(ctx, fmt.Sprintf("key%d", i%50), fmt.Sprintf("value%d", i)))
+	}
+	expected := make([]string, 0, 40)
+	for i := 0; i < 50; i++ {
+		if i < 10 {
+			require.NoError(t, engine.Delete(ctx, fmt.Sprintf("key%d", i)))
+		} else {
+			expected = append(expected, fmt.Sprintf("key%d", i))
+		}
+	}
+
+	var keys []string
+	cursor := uint64(0)
+	for {
+		batch, next, err := engine.Scan(ctx, cursor, 7)
+		require.NoError(t, err)
+		keys = append(keys, batch...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	require.ElementsMatch(t, expected, keys)
+}
+
+func TestLSMClosed(t *testing.T) {
+	t.Parallel()
+
+	engine := newTestLSM(t, t.TempDir(), 1024)
+	require.NoError(t, engine.Close())
+	require.NoError(t, engine.Close())
+	require.ErrorIs(t, engine.Set(context.Background(), "key", "value"), ErrClosed)
+}
+
+func newTestLSM(t *testing.T, directory string, memtableSize int) *LSM {
+	t.Helper()
+
+	engine, err := NewLSM(directory, memtableSize, 64, 2, dlog.NewNonSlog())
+	require.NoError(t, err)
+	return engine
+}
+
+func requireLSMData(t *testing.T, engine *LSM) {
+	t.Helper()
+
+	for i := 0; i < 50; i++ {
+		value, ok, err := engine.Get(context.Background(), fmt.Sprintf("key%d", i))
+		require.NoError(t, err)
+		if i < 10 {
+			require.False(t, ok)
+			continue
+		}
+
+		require.True(t, ok)
+		require.Equal(t, fmt.Sprintf("value%d", 150+i), value)
+	}
+}
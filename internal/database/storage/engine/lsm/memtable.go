@@ -0,0 +1,54 @@
+package lsm
+
+import "sort"
+
+type entry struct {
+	key     string
+	value   string
+	deleted bool
+	// expiresAt is the expiration time in Unix nanoseconds, or zero if the
+	// entry doesn't expire.
+	expiresAt int64
+	version   uint64
+}
+
+func (e entry) expired(now int64) bool {
+	return e.expiresAt != 0 && e.expiresAt <= now
+}
+
+type memtable struct {
+	entries map[string]entry
+	size    int
+	lastLSN uint64
+}
+
+func newMemtable() *memtable {
+	return &memtable{entries: make(map[string]entry)}
+}
+
+func (m *memtable) put(lsn uint64, e entry) {
+	if old, ok := m.entries[e.key]; ok {
+		m.size -= len(old.key) + len(old.value)
+	}
+
+	m.entries[e.key] = e
+	m.size += len(e.key) + len(e.value)
+	m.lastLSN = lsn
+}
+
+func (m *memtable) get(key string) (entry, bool) {
+	e, ok := m.entries[key]
+	return e, ok
+}
+
+func (m *memtable) sorted() []entry {
+	entries := make([]entry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	return entries
+}
@@ -0,0 +1,32 @@
+package lsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemtable(t *testing.T) {
+	t.Parallel()
+
+	table := newMemtable()
+	table.put(1, entry{key: "b", value: "value"})
+	table.put(2, entry{key: "a", value: "value"})
+	table.put(3, entry{key: "b", value: "v", expiresAt: 10})
+	table.put(4, entry{key: "a", deleted: true})
+
+	require.Equal(t, uint64(4), table.lastLSN)
+	require.Equal(t, len("a")+len("b")+len("v"), table.size)
+
+	e, ok := table.get("a")
+	require.True(t, ok)
+	require.True(t, e.deleted)
+
+	_, ok = table.get("c")
+	require.False(t, ok)
+
+	require.Equal(t, []entry{
+		{key: "a", deleted: true},
+		{key: "b", value: "v", expiresAt: 10},
+	}, table.sorted())
+}
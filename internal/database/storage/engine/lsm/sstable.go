@@ -0,0 +1,404 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+)
+
+const (
+	footerSize    = 32
+	tableMagic    = 0x6b76646273737401
+	deletedFlag   = 1
+	expiringFlag  = 2
+	versionedFlag = 4
+	baseFlag      = 1
+)
+
+var ErrCorruptedTable = errors.New("corrupted sstable")
+
+// An SSTable file consists of data blocks with sorted entries, an index with
+// the first key, offset and size of every block and a footer with the index
+// offset, the index size, flags and the magic number. Every block and the
+// index end with CRC32 of their content.
+//
+// A base table is the result of a compaction. It contains the whole data of
+// the tables that are older than it, so they are obsolete.
+type blockHandle struct {
+	firstKey string
+	offset   int64
+	size     int64
+}
+
+type sstable struct {
+	seq   uint64
+	path  string
+	file  *os.File
+	index []blockHandle
+	base  bool
+}
+
+type sstableWriter struct {
+	file      *os.File
+	writer    *bufio.Writer
+	blockSize int
+	base      bool
+
+	offset   int64
+	index    []blockHandle
+	block    []byte
+	firstKey string
+}
+
+func newSSTableWriter(path string, blockSize int, base bool) (*sstableWriter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sstable: %w", err)
+	}
+
+	return &sstableWriter{
+		file:      file,
+		writer:    bufio.NewWriter(file),
+		blockSize: blockSize,
+		base:      base,
+	}, nil
+}
+
+// add appends the entry to the table. Entries have to be added in the key
+// order.
+func (w *sstableWriter) add(e entry) error {
+	if len(w.block) == 0 {
+		w.firstKey = e.key
+	}
+
+	w.block = appendEntry(w.block, e)
+	if len(w.block) >= w.blockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+func (w *sstableWriter) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+
+	w.block = binary.LittleEndian.AppendUint32(w.block, crc32.ChecksumIEEE(w.block))
+	if _, err := w.writer.Write(w.block); err != nil {
+		return fmt.Errorf("failed to write sstable: %w", err)
+	}
+
+	w.index = append(w.index, blockHandle{firstKey: w.firstKey, offset: w.offset, size: int64(len(w.block))})
+	w.offset += int64(len(w.block))
+	w.block = w.block[:0]
+	return nil
+}
+
+// finish writes the index and the footer and syncs the file.
+func (w *sstableWriter) finish() error {
+	if err := w.flushBlock(); err != nil {
+		return err
+	}
+
+	var indexData []byte
+	for _, handle := range w.index {
+		indexData = appendString(indexData, handle.firstKey)
+		indexData = binary.AppendUvarint(indexData, uint64(handle.offset))
+		indexData = binary.AppendUvarint(indexData, uint64(handle.size))
+	}
+	indexData = binary.LittleEndian.AppendUint32(indexData, crc32.ChecksumIEEE(indexData))
+
+	footer := binary.LittleEndian.AppendUint64(nil, uint64(w.offset))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(indexData)))
+	var flags uint64
+	if w.base {
+		flags |= baseFlag
+	}
+	footer = binary.LittleEndian.AppendUint64(footer, flags)
+	footer = binary.LittleEndian.AppendUint64(footer, tableMagic)
+
+	if _, err := w.writer.Write(indexData); err != nil {
+		return fmt.Errorf("failed to write sstable index: %w", err)
+	}
+
+	if _, err := w.writer.Write(footer); err != nil {
+		return fmt.Errorf("failed to write sstable footer: %w", err)
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write sstable: %w", err)
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync sstable: %w", err)
+	}
+
+	return w.file.Close()
+}
+
+func (w *sstableWriter) abort() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
+
+func writeSSTable(path string, entries []entry, blockSize int) error {
+	writer, err := newSSTableWriter(path, blockSize, false)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := writer.add(e); err != nil {
+			writer.abort()
+			return err
+		}
+	}
+
+	if err := writer.finish(); err != nil {
+		writer.abort()
+		return err
+	}
+	return nil
+}
+
+func openSSTable(seq uint64, path string) (*sstable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sstable: %w", err)
+	}
+
+	index, flags, err := readIndex(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to read sstable %s: %w", path, err)
+	}
+
+	return &sstable{seq: seq, path: path, file: file, index: index, base: flags&baseFlag != 0}, nil
+}
+
+func readIndex(file *os.File) ([]blockHandle, uint64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if info.Size() < footerSize {
+		return nil, 0, ErrCorruptedTable
+	}
+
+	footer := make([]byte, footerSize)
+	if _, err := file.ReadAt(footer, info.Size()-footerSize); err != nil {
+		return nil, 0, err
+	}
+
+	indexOffset := int64(binary.LittleEndian.Uint64(footer[0:8]))
+	indexSize := int64(binary.LittleEndian.Uint64(footer[8:16]))
+	flags := binary.LittleEndian.Uint64(footer[16:24])
+	if binary.LittleEndian.Uint64(footer[24:32]) != tableMagic || indexOffset+indexSize+footerSize != info.Size() {
+		return nil, 0, ErrCorruptedTable
+	}
+
+	indexData, err := readChecked(file, indexOffset, indexSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var index []blockHandle
+	for len(indexData) != 0 {
+		var handle blockHandle
+		if handle.firstKey, indexData, err = readString(indexData); err != nil {
+			return nil, 0, err
+		}
+
+		offset, n := binary.Uvarint(indexData)
+		if n <= 0 {
+			return nil, 0, ErrCorruptedTable
+		}
+		indexData = indexData[n:]
+
+		size, n := binary.Uvarint(indexData)
+		if n <= 0 {
+			return nil, 0, ErrCorruptedTable
+		}
+		indexData = indexData[n:]
+
+		handle.offset, handle.size = int64(offset), int64(size)
+		index = append(index, handle)
+	}
+
+	return index, flags, nil
+}
+
+// get looks for the key in the only block that may contain it.
+func (t *sstable) get(key string) (entry, bool, error) {
+	idx := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].firstKey > key
+	}) - 1
+	if idx < 0 {
+		return entry{}, false, nil
+	}
+
+	entries, err := t.readBlock(t.index[idx])
+	if err != nil {
+		return entry{}, false, err
+	}
+
+	pos := sort.Search(len(entries), func(i int) bool {
+		return entries[i].key >= key
+	})
+	if pos < len(entries) && entries[pos].key == key {
+		return entries[pos], true, nil
+	}
+	return entry{}, false, nil
+}
+
+// sstableIterator reads the table block by block, so the whole table is
+// never loaded into memory.
+type sstableIterator struct {
+	table   *sstable
+	block   int
+	entries []entry
+	err     error
+}
+
+func (t *sstable) iterator() *sstableIterator {
+	return &sstableIterator{table: t}
+}
+
+// next returns the next entry in the key order.
+func (it *sstableIterator) next() (entry, bool) {
+	for len(it.entries) == 0 {
+		if it.err != nil || it.block >= len(it.table.index) {
+			return entry{}, false
+		}
+
+		it.entries, it.err = it.table.readBlock(it.table.index[it.block])
+		it.block++
+	}
+
+	e := it.entries[0]
+	it.entries = it.entries[1:]
+	return e, true
+}
+
+func (t *sstable) readBlock(handle blockHandle) ([]entry, error) {
+	data, err := readChecked(t.file, handle.offset, handle.size)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	for len(data) != 0 {
+		var e entry
+		if e, data, err = readEntry(data); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (t *sstable) close() error {
+	return t.file.Close()
+}
+
+func readChecked(file *os.File, offset, size int64) ([]byte, error) {
+	if size < 4 {
+		return nil, ErrCorruptedTable
+	}
+
+	data := make([]byte, size)
+	if _, err := file.ReadAt(data, offset); err != nil {
+		return nil, err
+	}
+
+	content, checksum := data[:size-4], data[size-4:]
+	if crc32.ChecksumIEEE(content) != binary.LittleEndian.Uint32(checksum) {
+		return nil, ErrCorruptedTable
+	}
+	return content, nil
+}
+
+// appendEntry encodes the key, the flags, the optional expiration time and
+// version and the value. Entries of tables written before versions were
+// added have no version, so it is read as zero.
+func appendEntry(buffer []byte, e entry) []byte {
+	buffer = appendString(buffer, e.key)
+	if e.deleted {
+		return append(buffer, deletedFlag)
+	}
+
+	var flags byte
+	if e.expiresAt != 0 {
+		flags |= expiringFlag
+	}
+	if e.version != 0 {
+		flags |= versionedFlag
+	}
+	buffer = append(buffer, flags)
+	if e.expiresAt != 0 {
+		buffer = binary.AppendVarint(buffer, e.expiresAt)
+	}
+	if e.version != 0 {
+		buffer = binary.AppendUvarint(buffer, e.version)
+	}
+	return appendString(buffer, e.value)
+}
+
+func readEntry(buffer []byte) (entry, []byte, error) {
+	var e entry
+	var err error
+	if e.key, buffer, err = readString(buffer); err != nil {
+		return entry{}, nil, err
+	}
+
+	if len(buffer) == 0 {
+		return entry{}, nil, ErrCorruptedTable
+	}
+
+	flags := buffer[0]
+	buffer = buffer[1:]
+	if flags == deletedFlag {
+		e.deleted = true
+		return e, buffer, nil
+	}
+
+	if flags&expiringFlag != 0 {
+		expiresAt, n := binary.Varint(buffer)
+		if n <= 0 {
+			return entry{}, nil, ErrCorruptedTable
+		}
+		e.expiresAt, buffer = expiresAt, buffer[n:]
+	}
+
+	if flags&versionedFlag != 0 {
+		version, n := binary.Uvarint(buffer)
+		if n <= 0 {
+			return entry{}, nil, ErrCorruptedTable
+		}
+		e.version, buffer = version, buffer[n:]
+	}
+
+	if e.value, buffer, err = readString(buffer); err != nil {
+		return entry{}, nil, err
+	}
+	return e, buffer, nil
+}
+
+func appendString(buffer []byte, value string) []byte {
+	buffer = binary.AppendUvarint(buffer, uint64(len(value)))
+	return append(buffer, value...)
+}
+
+func readString(buffer []byte) (string, []byte, error) {
+	size, n := binary.Uvarint(buffer)
+	if n <= 0 || size > uint64(len(buffer)-n) {
+		return "", nil, ErrCorruptedTable
+	}
+
+	return string(buffer[n : n+int(size)]), buffer[n+int(size):], nil
+}
@@ -0,0 +1,86 @@
+package lsm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSTable(t *testing.T) {
+	t.Parallel()
+
+	entries := make([]entry, 0, 100)
+	for i := 0; i < 100; i++ {
+		entries = append(entries, entry{key: fmt.Sprintf("key%03d", i), value: fmt.Sprintf("value%d", i)})
+	}
+	entries[10].deleted = true
+	entries[10].value = ""
+	entries[20].expiresAt = 1_700_000_000_000_000_000
+	entries[20].version = 1_700_000_000_000_000_001
+	entries[30].version = 42
+
+	path := filepath.Join(t.TempDir(), tableName(1))
+	require.NoError(t, writeSSTable(path, entries, 64))
+
+	table, err := openSSTable(1, path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, table.close()) }()
+	require.Greater(t, len(table.index), 1)
+	require.False(t, table.base)
+
+	e, found, err := table.get("key042")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "value42", e.value)
+
+	e, found, err = table.get("key030")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, uint64(42), e.version)
+
+	e, found, err = table.get("key010")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.True(t, e.deleted)
+
+	for _, key := range []string{"a", "key0425", "z"} {
+		_, found, err = table.get(key)
+		require.NoError(t, err)
+		require.False(t, found)
+	}
+
+	var iterated []entry
+	iterator := table.iterator()
+	for e, ok := iterator.next(); ok; e, ok = iterator.next() {
+		iterated = append(iterated, e)
+	}
+	require.NoError(t, iterator.err)
+	require.Equal(t, entries, iterated)
+}
+
+func TestSSTableCorrupted(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), tableName(1))
+	require.NoError(t, writeSSTable(path, []entry{{key: "key", value: "value"}}, 64))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	data[0] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	table, err := openSSTable(1, path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, table.close()) }()
+
+	_, _, err = table.get("key")
+	require.ErrorIs(t, err, ErrCorruptedTable)
+
+	require.NoError(t, os.WriteFile(path, data[:len(data)-1], 0o644))
+	_, err = openSSTable(1, path)
+	require.ErrorIs(t, err, ErrCorruptedTable)
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"kv_db/internal/database/storage/engine"
+	"kv_db/pkg/dlock"
+)
+
+// keyState is the state of a key before a write, which is restored if the
+// batch fails.
+type keyState struct {
+	key       string
+	value     value
+	exists    bool
+	expiresAt time.Time
+	version   uint64
+}
+
+// Apply applies the writes of the batch atomically: readers observe either
+// all or none of them. If a write fails, the already applied ones are
+// reverted together with the keys that they have evicted.
+func (s *HashTable) Apply(_ context.Context, batch *engine.Batch) error {
+	var err error
+	dlock.WithLock(&s.mutex, func() {
+		now := s.clock.Now()
+
+		var undo []keyState
+		if undo, err = s.applyLocked(batch.Writes(), now); err != nil {
+			s.revert(undo, now)
+		}
+	})
+	return err
+}
+
+// Apply locks the shards of all written keys in the order of their indexes,
+// so concurrent batches don't deadlock.
+func (s *ShardedHashTable) Apply(_ context.Context, batch *engine.Batch) error {
+	shardWrites := make([][]engine.Write, len(s.shards))
+	for _, w := range batch.Writes() {
+		idx := s.shardIndex(w.Key)
+		shardWrites[idx] = append(shardWrites[idx], w)
+	}
+
+	for idx, writes := range shardWrites {
+		if len(writes) != 0 {
+			s.shards[idx].mutex.Lock()
+			defer s.shards[idx].mutex.Unlock()
+		}
+	}
+
+	now := s.shards[0].clock.Now()
+	undo := make([][]keyState, len(s.shards))
+	for idx, writes := range shardWrites {
+		if len(writes) == 0 {
+			continue
+		}
+
+		var err error
+		if undo[idx], err = s.shards[idx].applyLocked(writes, now); err != nil {
+			for ; idx >= 0; idx-- {
+				s.shards[idx].revert(undo[idx], now)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *HashTable) applyLocked(writes []engine.Write, now time.Time) ([]keyState, error) {
+	undo := make([]keyState, 0, len(writes))
+	s.removals = &undo
+	defer func() {
+		s.removals = nil
+	}()
+
+	for _, w := range writes {
+		undo = append(undo, s.state(w.Key))
+
+		if w.Deleted {
+			s.remove(w.Key)
+			continue
+		}
+
+		if err := s.set(w.Key, stringValue(w.Value), now); err != nil {
+			return undo, err
+		}
+		if w.ExpiresAt.IsZero() {
+			delete(s.expirations, w.Key)
+		} else {
+			s.expirations[w.Key] = w.ExpiresAt
+		}
+	}
+	return undo, nil
+}
+
+func (s *HashTable) state(key string) keyState {
+	state := keyState{key: key}
+	state.value, state.exists = s.data[key]
+	state.expiresAt = s.expirations[key]
+	state.version = s.versions[key]
+	return state
+}
+
+func (s *HashTable) revert(undo []keyState, now time.Time) {
+	for idx := len(undo) - 1; idx >= 0; idx-- {
+		state := undo[idx]
+		s.remove(state.key)
+		if !state.exists {
+			continue
+		}
+
+		s.put(state.key, state.value, now)
+		s.versions[state.key] = state.version
+		if !state.expiresAt.IsZero() {
+			s.expirations[state.key] = state.expiresAt
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage/engine"
+	"kv_db/pkg/dclock"
+)
+
+func TestHashTable_Apply(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock))
+	require.NoError(t, table.SetWithExpiration(ctx, "key1", "old", clock.Now().Add(time.Second)))
+	require.NoError(t, table.Set(ctx, "key2", "old"))
+
+	_, err := table.Push(ctx, "key4", true, []string{"value"})
+	require.NoError(t, err)
+
+	batch := engine.NewBatch()
+	batch.Put("key1", "value1")
+	batch.Delete("key2")
+	batch.PutWithExpiration("key3", "value3", time.Unix(10, 0))
+	batch.Put("key4", "value4")
+	batch.Delete("key4")
+	require.NoError(t, table.Apply(ctx, batch))
+
+	require.Equal(t, map[string]value{"key1": stringValue("value1"), "key3": stringValue("value3")}, table.data)
+	require.Equal(t, map[string]time.Time{"key3": time.Unix(10, 0)}, table.expirations)
+	require.NoError(t, table.Apply(ctx, engine.NewBatch()))
+}
+
+func TestHashTable_ApplyReverts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock), WithMaxMemory(12, NoEviction))
+	require.NoError(t, table.SetWithExpiration(ctx, "k1", "v1", clock.Now().Add(time.Second)))
+	require.NoError(t, table.Set(ctx, "k2", "v2"))
+
+	batch := engine.NewBatch()
+	batch.Put("k1", "1")
+	batch.Delete("k2")
+	batch.Put("k3", "v3")
+	batch.Put("k4", "too big")
+	require.ErrorIs(t, table.Apply(ctx, batch), ErrMemoryLimit)
+
+	require.Equal(t, map[string]value{"k1": stringValue("v1"), "k2": stringValue("v2")}, table.data)
+	require.Equal(t, map[string]time.Time{"k1": time.Unix(1, 0)}, table.expirations)
+	require.Equal(t, 8, table.used)
+}
+
+func TestHashTable_ApplyRevertsEvictions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock), WithMaxMemory(8, AllKeysLRU))
+	require.NoError(t, table.SetWithExpiration(ctx, "k1", "v1", clock.Now().Add(time.Second)))
+	require.NoError(t, table.Set(ctx, "k2", "v2"))
+
+	// The first write evicts both keys before the second one fails.
+	batch := engine.NewBatch()
+	batch.Put("k3", "value")
+	batch.Put("k4", "too big")
+	require.ErrorIs(t, table.Apply(ctx, batch), ErrMemoryLimit)
+
+	require.Equal(t, map[string]value{"k1": stringValue("v1"), "k2": stringValue("v2")}, table.data)
+	require.Equal(t, map[string]time.Time{"k1": time.Unix(1, 0)}, table.expirations)
+	require.Equal(t, 8, table.used)
+	require.Equal(t, 2, table.hashes.Len())
+}
+
+func TestShardedHashTable_Apply(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, err := NewShardedHashTable(8)
+	require.NoError(t, err)
+
+	keys := make([]string, 16)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+
+	// Every batch sets all keys to the same value, so a consistent snapshot
+	// never contains different values.
+	workers := 8
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				batch := engine.NewBatch()
+				for _, key := range keys {
+					batch.Put(key, fmt.Sprintf("%d_%d", worker, j))
+				}
+				require.NoError(t, table.Apply(ctx, batch))
+			}
+		}(i)
+	}
+
+	for i := 0; i < 50; i++ {
+		snapshot, err := table.Snapshot(ctx)
+		require.NoError(t, err)
+		for _, log := range snapshot {
+			require.Equal(t, snapshot[0].Args[1], log.Args[1])
+		}
+	}
+	wg.Wait()
+
+	snapshot, err := table.Snapshot(ctx)
+	require.NoError(t, err)
+	require.Len(t, snapshot, len(keys))
+}
+
+func TestShardedHashTable_ApplyReverts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, err := NewShardedHashTable(4, WithMaxMemory(64, NoEviction))
+	require.NoError(t, err)
+
+	batch := engine.NewBatch()
+	for i := 0; i < 20; i++ {
+		batch.Put(fmt.Sprintf("key%d", i), "value")
+	}
+	require.ErrorIs(t, table.Apply(ctx, batch), ErrMemoryLimit)
+
+	snapshot, err := table.Snapshot(ctx)
+	require.NoError(t, err)
+	require.Empty(t, snapshot)
+}
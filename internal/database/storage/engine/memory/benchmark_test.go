@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type benchmarkEngine interface {
+	Set(context.Context, string, string) error
+	Get(context.Context, string) (string, bool, error)
+}
+
+// BenchmarkEngines runs a read-heavy workload (one write per ten requests)
+// with the number of concurrent clients matching max_connections values.
+func BenchmarkEngines(b *testing.B) {
+	engines := map[string]func() benchmarkEngine{
+		"hash_table": func() benchmarkEngine {
+			return NewHashTable()
+		},
+		"sharded_hash_table_16": func() benchmarkEngine {
+			table, _ := NewShardedHashTable(16)
+			return table
+		},
+		"sharded_hash_table_64": func() benchmarkEngine {
+			table, _ := NewShardedHashTable(64)
+			return table
+		},
+	}
+
+	for _, connections := range []int{1, 10, 100, 1000} {
+		for _, name := range []string{"hash_table", "sharded_hash_table_16", "sharded_hash_table_64"} {
+			create := engines[name]
+			b.Run(fmt.Sprintf("%s/connections_%d", name, connections), func(b *testing.B) {
+				runEngineBenchmark(b, create(), connections)
+			})
+		}
+	}
+}
+
+func runEngineBenchmark(b *testing.B, engine benchmarkEngine, connections int) {
+	b.Helper()
+
+	ctx := context.Background()
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		_ = engine.Set(ctx, keys[i], "value")
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(connections)
+
+	b.ResetTimer()
+	for i := 0; i < connections; i++ {
+		requests := b.N / connections
+		if i < b.N%connections {
+			requests++
+		}
+
+		go func(connection int, requests int) {
+			defer wg.Done()
+			for op := 0; op < requests; op++ {
+				key := keys[(connection*requests+op)%len(keys)]
+				if op%10 == 0 {
+					_ = engine.Set(ctx, key, "value")
+				} else {
+					_, _, _ = engine.Get(ctx, key)
+				}
+			}
+		}(i, requests)
+	}
+	wg.Wait()
+}
+
+// BenchmarkScan measures a step of an iteration over a large keyspace, which
+// doesn't depend on the number of keys.
+func BenchmarkScan(b *testing.B) {
+	type scanEngine interface {
+		benchmarkEngine
+		Scan(context.Context, uint64, int) ([]string, uint64, error)
+	}
+
+	engines := map[string]func() scanEngine{
+		"hash_table": func() scanEngine {
+			return NewHashTable()
+		},
+		"sharded_hash_table_16": func() scanEngine {
+			table, _ := NewShardedHashTable(16)
+			return table
+		},
+	}
+
+	for _, keys := range []int{10_000, 1_000_000} {
+		for _, name := range []string{"hash_table", "sharded_hash_table_16"} {
+			engine := engines[name]()
+			b.Run(fmt.Sprintf("%s/keys_%d", name, keys), func(b *testing.B) {
+				ctx := context.Background()
+				for i := 0; i < keys; i++ {
+					_ = engine.Set(ctx, "key"+strconv.Itoa(i), "value")
+				}
+
+				cursor := uint64(0)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					_, cursor, _ = engine.Scan(ctx, cursor, 10)
+				}
+			})
+		}
+	}
+}
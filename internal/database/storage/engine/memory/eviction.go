@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"kv_db/internal/database/storage/engine"
+)
+
+var ErrMemoryLimit = engine.ErrMemoryLimit
+
+type EvictionPolicy int
+
+const (
+	NoEviction EvictionPolicy = iota
+	AllKeysLRU
+	AllKeysLFU
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case NoEviction:
+		return "noeviction"
+	case AllKeysLRU:
+		return "allkeys-lru"
+	case AllKeysLFU:
+		return "allkeys-lfu"
+	}
+	return "unknown"
+}
+
+const (
+	// evictionSamples is the number of keys compared to choose one to evict.
+	// Like in Redis, a small sample approximates the policy well enough
+	// without keeping the keys ordered.
+	evictionSamples = 5
+	// newKeyHits gives new keys a chance to be accessed before the LFU
+	// policy evicts them.
+	newKeyHits = 5
+	// hitsDecayPeriod halves the hits of a key every period it isn't
+	// accessed, so keys that were popular long ago can be evicted.
+	hitsDecayPeriod = time.Minute
+)
+
+// access is updated by readers under the read lock, so its fields are atomic.
+type access struct {
+	accessedAt atomic.Int64
+	hits       atomic.Uint32
+}
+
+func newAccess(now time.Time) *access {
+	a := &access{}
+	a.accessedAt.Store(now.UnixNano())
+	a.hits.Store(newKeyHits)
+	return a
+}
+
+func (a *access) touch(now time.Time) {
+	a.accessedAt.Store(now.UnixNano())
+	if hits := a.hits.Load(); hits < ^uint32(0) {
+		a.hits.CompareAndSwap(hits, hits+1)
+	}
+}
+
+func (a *access) decayedHits(now time.Time) uint32 {
+	periods := time.Duration(now.UnixNano()-a.accessedAt.Load()) / hitsDecayPeriod
+	if periods >= 32 {
+		return 0
+	}
+	return a.hits.Load() >> periods
+}
+
+// less reports whether a key with the access a should be evicted before a
+// key with the access other.
+func (a *access) less(other *access, policy EvictionPolicy, now time.Time) bool {
+	if policy == AllKeysLFU {
+		hits, otherHits := a.decayedHits(now), other.decayedHits(now)
+		if hits != otherHits {
+			return hits < otherHits
+		}
+	}
+	return a.accessedAt.Load() < other.accessedAt.Load()
+}
+
+type stats struct {
+	keys      int
+	used      int
+	maxMemory int
+	policy    EvictionPolicy
+	evicted   uint64
+}
+
+func (s stats) format() map[string]string {
+	return map[string]string{
+		"keys":            strconv.Itoa(s.keys),
+		"used_memory":     strconv.Itoa(s.used),
+		"max_memory":      strconv.Itoa(s.maxMemory),
+		"eviction_policy": s.policy.String(),
+		"evicted_keys":    strconv.FormatUint(s.evicted, 10),
+	}
+}
+
+func entrySize(key string, value value) int {
+	return len(key) + value.size()
+}
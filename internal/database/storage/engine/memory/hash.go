@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dlock"
+)
+
+// HashSet sets the fields of the hash to the values, which follow them in
+// pairs, and returns the number of new fields. A hash is created if the key
+// doesn't exist.
+func (s *HashTable) HashSet(_ context.Context, key string, pairs []string) (int, error) {
+	var added int
+	var err error
+	dlock.WithLock(&s.mutex, func() {
+		added, err = s.hashSet(key, pairs, s.clock.Now())
+	})
+	return added, err
+}
+
+func (s *HashTable) HashGet(_ context.Context, key, field string) (string, bool, error) {
+	var value string
+	var ok bool
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		now := s.clock.Now()
+		h, exists, lookupErr := lookupAs[*hash](s, key, now)
+		if err = lookupErr; err != nil || !exists {
+			return
+		}
+		if s.accesses != nil {
+			s.accesses[key].touch(now)
+		}
+		value, ok = h.fields[field]
+	})
+	return value, ok, err
+}
+
+// HashDelete deletes the fields of the hash and returns the number of deleted
+// ones. The key is deleted with the last field.
+func (s *HashTable) HashDelete(_ context.Context, key string, fields []string) (int, error) {
+	var deleted int
+	var err error
+	dlock.WithLock(&s.mutex, func() {
+		now := s.clock.Now()
+		h, ok, lookupErr := lookupAs[*hash](s, key, now)
+		if err = lookupErr; err != nil || !ok {
+			return
+		}
+
+		s.change(key, h, now, func() {
+			for _, field := range fields {
+				if h.delete(field) {
+					deleted++
+				}
+			}
+		})
+		if len(h.fields) == 0 {
+			s.remove(key)
+		}
+	})
+	return deleted, err
+}
+
+// HashGetAll returns a copy of the fields of the hash, which is empty if the
+// key doesn't exist.
+func (s *HashTable) HashGetAll(_ context.Context, key string) (map[string]string, error) {
+	var fields map[string]string
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		now := s.clock.Now()
+		h, ok, lookupErr := lookupAs[*hash](s, key, now)
+		if err = lookupErr; err != nil || !ok {
+			return
+		}
+		if s.accesses != nil {
+			s.accesses[key].touch(now)
+		}
+
+		fields = make(map[string]string, len(h.fields))
+		for field, value := range h.fields {
+			fields[field] = value
+		}
+	})
+	return fields, err
+}
+
+func (s *HashTable) HashLen(_ context.Context, key string) (int, error) {
+	var length int
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		h, ok, lookupErr := lookupAs[*hash](s, key, s.clock.Now())
+		if err = lookupErr; err == nil && ok {
+			length = len(h.fields)
+		}
+	})
+	return length, err
+}
+
+func (s *HashTable) hashSet(key string, pairs []string, now time.Time) (int, error) {
+	h, ok, err := lookupAs[*hash](s, key, now)
+	if err != nil {
+		return 0, err
+	}
+
+	// The size is computed for the last value of every field, because the
+	// memory is reserved before the hash is changed.
+	updates := make(map[string]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		updates[pairs[i]] = pairs[i+1]
+	}
+	size := len(key)
+	if ok {
+		size += h.size()
+	}
+	for field, value := range updates {
+		size += len(field) + len(value)
+		if ok {
+			if oldValue, exists := h.fields[field]; exists {
+				size -= len(field) + len(oldValue)
+			}
+		}
+	}
+	if err := s.reserve(key, size, now); err != nil {
+		return 0, err
+	}
+
+	if !ok {
+		h = &hash{fields: make(map[string]string, len(updates))}
+		s.create(key, h, now)
+	}
+
+	added := 0
+	s.change(key, h, now, func() {
+		for field, value := range updates {
+			if h.set(field, value) {
+				added++
+			}
+		}
+	})
+	return added, nil
+}
+
+// hash is a map of fields to values.
+type hash struct {
+	fields map[string]string
+	bytes  int
+}
+
+func (h *hash) log(key, expiration string) wal.Log {
+	args := make([]string, 0, 2*len(h.fields)+2)
+	args = append(args, key, expiration)
+	for field, value := range h.fields {
+		args = append(args, field, value)
+	}
+	return wal.NewLog(0, wal.HashOp, args...)
+}
+
+func (h *hash) size() int {
+	return h.bytes
+}
+
+// set returns true if the field is new.
+func (h *hash) set(field, value string) bool {
+	oldValue, exists := h.fields[field]
+	if exists {
+		h.bytes -= len(field) + len(oldValue)
+	}
+	h.fields[field] = value
+	h.bytes += len(field) + len(value)
+	return !exists
+}
+
+func (h *hash) delete(field string) bool {
+	value, ok := h.fields[field]
+	if ok {
+		h.bytes -= len(field) + len(value)
+		delete(h.fields, field)
+	}
+	return ok
+}
@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage/engine"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
+)
+
+func TestHashTable_Hashes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable()
+
+	added, err := table.HashSet(ctx, "user", []string{"name", "alice", "email", "a@b", "name", "bob"})
+	require.NoError(t, err)
+	require.Equal(t, 2, added)
+	added, err = table.HashSet(ctx, "user", []string{"name", "carol", "age", "30"})
+	require.NoError(t, err)
+	require.Equal(t, 1, added)
+
+	value, ok, err := table.HashGet(ctx, "user", "name")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "carol", value)
+	_, ok, err = table.HashGet(ctx, "user", "phone")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	fields, err := table.HashGetAll(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"name": "carol", "email": "a@b", "age": "30"}, fields)
+	length, err := table.HashLen(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, 3, length)
+	require.Equal(t, len("user")+len("namecarolemaila@bage30"), table.used)
+
+	deleted, err := table.HashDelete(ctx, "user", []string{"email", "phone"})
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	deleted, err = table.HashDelete(ctx, "user", []string{"name", "age"})
+	require.NoError(t, err)
+	require.Equal(t, 2, deleted)
+	require.NotContains(t, table.data, "user")
+	require.Zero(t, table.used)
+
+	fields, err = table.HashGetAll(ctx, "user")
+	require.NoError(t, err)
+	require.Empty(t, fields)
+	length, err = table.HashLen(ctx, "user")
+	require.NoError(t, err)
+	require.Zero(t, length)
+	deleted, err = table.HashDelete(ctx, "user", []string{"name"})
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+}
+
+func TestHashTable_HashesWrongType(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable()
+	require.NoError(t, table.Set(ctx, "string", "value"))
+	_, err := table.HashSet(ctx, "hash", []string{"field", "value"})
+	require.NoError(t, err)
+
+	_, err = table.HashSet(ctx, "string", []string{"field", "value"})
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, _, err = table.HashGet(ctx, "string", "field")
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, err = table.HashDelete(ctx, "string", []string{"field"})
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, err = table.HashGetAll(ctx, "string")
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, err = table.HashLen(ctx, "string")
+	require.ErrorIs(t, err, engine.ErrWrongType)
+
+	_, _, err = table.Get(ctx, "hash")
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, err = table.ListLen(ctx, "hash")
+	require.ErrorIs(t, err, engine.ErrWrongType)
+}
+
+func TestHashTable_HashesExpiration(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock))
+
+	_, err := table.HashSet(ctx, "hash", []string{"field", "value"})
+	require.NoError(t, err)
+	expiresAt := clock.Now().Add(time.Second)
+	_, err = table.Expire(ctx, "hash", expiresAt)
+	require.NoError(t, err)
+
+	log, ok, err := table.Dump(ctx, "hash")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, wal.NewLog(0, wal.HashOp, "hash", wal.FormatExpiration(expiresAt), "field", "value"), log)
+
+	clock.Advance(time.Second)
+	_, ok, err = table.HashGet(ctx, "hash", "field")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	added, err := table.HashSet(ctx, "hash", []string{"other", "value"})
+	require.NoError(t, err)
+	require.Equal(t, 1, added)
+	fields, err := table.HashGetAll(ctx, "hash")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"other": "value"}, fields)
+	require.NotContains(t, table.expirations, "hash")
+}
+
+func TestHashTable_HashesMaxMemory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable(WithMaxMemory(12, NoEviction))
+
+	_, err := table.HashSet(ctx, "hash", []string{"f", "abc"})
+	require.NoError(t, err)
+	_, err = table.HashSet(ctx, "hash", []string{"f", "abcdef"})
+	require.NoError(t, err)
+	_, err = table.HashSet(ctx, "hash", []string{"g", "a"})
+	require.ErrorIs(t, err, ErrMemoryLimit)
+	require.Equal(t, 11, table.used)
+}
@@ -0,0 +1,208 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dlock"
+)
+
+// Push pushes the values to the left or the right end of the list one by one
+// and returns the length of the list. A list is created if the key doesn't
+// exist.
+func (s *HashTable) Push(_ context.Context, key string, left bool, values []string) (int, error) {
+	var length int
+	var err error
+	dlock.WithLock(&s.mutex, func() {
+		length, err = s.push(key, left, values, s.clock.Now())
+	})
+	return length, err
+}
+
+// Pop removes and returns the value at the left or the right end of the list.
+// The key is deleted with the last value.
+func (s *HashTable) Pop(_ context.Context, key string, left bool) (string, bool, error) {
+	var value string
+	var ok bool
+	var err error
+	dlock.WithLock(&s.mutex, func() {
+		now := s.clock.Now()
+		var l *list
+		if l, ok, err = lookupAs[*list](s, key, now); err != nil || !ok {
+			return
+		}
+
+		s.change(key, l, now, func() {
+			if left {
+				value = l.popLeft()
+			} else {
+				value = l.popRight()
+			}
+		})
+		if l.len() == 0 {
+			s.remove(key)
+		}
+	})
+	return value, ok, err
+}
+
+// ListRange returns the values of the list between the indexes inclusively.
+// Negative indexes count from the right end, so -1 is the last value.
+func (s *HashTable) ListRange(_ context.Context, key string, start, stop int) ([]string, error) {
+	var values []string
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		now := s.clock.Now()
+		l, ok, lookupErr := lookupAs[*list](s, key, now)
+		if err = lookupErr; err != nil || !ok {
+			return
+		}
+		if s.accesses != nil {
+			s.accesses[key].touch(now)
+		}
+
+		if start < 0 {
+			start += l.len()
+		}
+		if stop < 0 {
+			stop += l.len()
+		}
+		start, stop = max(start, 0), min(stop, l.len()-1)
+		if start <= stop {
+			values = l.slice(start, stop)
+		}
+	})
+	return values, err
+}
+
+// ListLen returns the length of the list, which is zero if the key doesn't
+// exist.
+func (s *HashTable) ListLen(_ context.Context, key string) (int, error) {
+	var length int
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		l, ok, lookupErr := lookupAs[*list](s, key, s.clock.Now())
+		if err = lookupErr; err == nil && ok {
+			length = l.len()
+		}
+	})
+	return length, err
+}
+
+func (s *HashTable) push(key string, left bool, values []string, now time.Time) (int, error) {
+	l, ok, err := lookupAs[*list](s, key, now)
+	if err != nil {
+		return 0, err
+	}
+
+	size := len(key)
+	if ok {
+		size += l.size()
+	}
+	for _, value := range values {
+		size += len(value)
+	}
+	if err := s.reserve(key, size, now); err != nil {
+		return 0, err
+	}
+
+	if !ok {
+		l = &list{}
+		s.create(key, l, now)
+	}
+
+	s.change(key, l, now, func() {
+		for _, value := range values {
+			if left {
+				l.pushLeft(value)
+			} else {
+				l.pushRight(value)
+			}
+		}
+	})
+	return l.len(), nil
+}
+
+// list is a deque in a ring buffer, so both ends are pushed and popped in
+// constant time and elements are accessed by index.
+type list struct {
+	values []string
+	head   int
+	length int
+	bytes  int
+}
+
+func (l *list) log(key, expiration string) wal.Log {
+	args := make([]string, 0, l.length+2)
+	args = append(args, key, expiration)
+	return wal.NewLog(0, wal.ListOp, append(args, l.slice(0, l.length-1)...)...)
+}
+
+func (l *list) size() int {
+	return l.bytes
+}
+
+func (l *list) len() int {
+	return l.length
+}
+
+// at returns the element with the index from the left end.
+func (l *list) at(idx int) string {
+	return l.values[(l.head+idx)%len(l.values)]
+}
+
+func (l *list) pushLeft(value string) {
+	l.grow()
+	l.head = (l.head - 1 + len(l.values)) % len(l.values)
+	l.values[l.head] = value
+	l.length++
+	l.bytes += len(value)
+}
+
+func (l *list) pushRight(value string) {
+	l.grow()
+	l.values[(l.head+l.length)%len(l.values)] = value
+	l.length++
+	l.bytes += len(value)
+}
+
+func (l *list) popLeft() string {
+	value := l.values[l.head]
+	l.values[l.head] = ""
+	l.head = (l.head + 1) % len(l.values)
+	l.length--
+	l.bytes -= len(value)
+	return value
+}
+
+func (l *list) popRight() string {
+	idx := (l.head + l.length - 1) % len(l.values)
+	value := l.values[idx]
+	l.values[idx] = ""
+	l.length--
+	l.bytes -= len(value)
+	return value
+}
+
+// slice returns the elements between the indexes inclusively.
+func (l *list) slice(start, stop int) []string {
+	values := make([]string, 0, stop-start+1)
+	for idx := start; idx <= stop; idx++ {
+		values = append(values, l.at(idx))
+	}
+	return values
+}
+
+func (l *list) grow() {
+	if l.length < len(l.values) {
+		return
+	}
+
+	values := make([]string, max(2*len(l.values), 4))
+	for idx := 0; idx < l.length; idx++ {
+		values[idx] = l.at(idx)
+	}
+	l.values = values
+	l.head = 0
+}
@@ -0,0 +1,213 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage/engine"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
+)
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	l := &list{}
+	var expected []string
+	for i := 0; i < 100; i++ {
+		value := strconv.Itoa(i)
+		switch i % 3 {
+		case 0:
+			l.pushLeft(value)
+			expected = append([]string{value}, expected...)
+		case 1:
+			l.pushRight(value)
+			expected = append(expected, value)
+		case 2:
+			require.Equal(t, expected[0], l.popLeft())
+			expected = expected[1:]
+		}
+	}
+
+	require.Equal(t, len(expected), l.len())
+	require.Equal(t, expected, l.slice(0, l.len()-1))
+	require.Equal(t, expected[len(expected)-1], l.popRight())
+
+	size := 0
+	for _, value := range expected[:len(expected)-1] {
+		size += len(value)
+	}
+	require.Equal(t, size, l.size())
+}
+
+func TestHashTable_Lists(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable()
+
+	length, err := table.Push(ctx, "list", false, []string{"b", "c"})
+	require.NoError(t, err)
+	require.Equal(t, 2, length)
+	length, err = table.Push(ctx, "list", true, []string{"a", "z"})
+	require.NoError(t, err)
+	require.Equal(t, 4, length)
+
+	testcases := map[string]struct {
+		start, stop int
+		expValues   []string
+	}{
+		"all values":          {start: 0, stop: -1, expValues: []string{"z", "a", "b", "c"}},
+		"middle values":       {start: 1, stop: 2, expValues: []string{"a", "b"}},
+		"negative indexes":    {start: -2, stop: -1, expValues: []string{"b", "c"}},
+		"out of range stop":   {start: 2, stop: 100, expValues: []string{"b", "c"}},
+		"out of range start":  {start: -100, stop: 0, expValues: []string{"z"}},
+		"start after stop":    {start: 3, stop: 1},
+		"start after the end": {start: 4, stop: 10},
+	}
+	for name, tc := range testcases {
+		values, err := table.ListRange(ctx, "list", tc.start, tc.stop)
+		require.NoError(t, err, name)
+		require.Equal(t, tc.expValues, values, name)
+	}
+
+	value, ok, err := table.Pop(ctx, "list", true)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "z", value)
+	value, ok, err = table.Pop(ctx, "list", false)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "c", value)
+
+	length, err = table.ListLen(ctx, "list")
+	require.NoError(t, err)
+	require.Equal(t, 2, length)
+
+	for i := 0; i < 2; i++ {
+		_, ok, err = table.Pop(ctx, "list", true)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	require.NotContains(t, table.data, "list")
+	require.Zero(t, table.used)
+
+	_, ok, err = table.Pop(ctx, "list", true)
+	require.NoError(t, err)
+	require.False(t, ok)
+	length, err = table.ListLen(ctx, "list")
+	require.NoError(t, err)
+	require.Zero(t, length)
+	values, err := table.ListRange(ctx, "list", 0, -1)
+	require.NoError(t, err)
+	require.Empty(t, values)
+}
+
+func TestHashTable_ListsWrongType(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable()
+	require.NoError(t, table.Set(ctx, "string", "value"))
+	_, err := table.Push(ctx, "list", false, []string{"value"})
+	require.NoError(t, err)
+
+	_, err = table.Push(ctx, "string", false, []string{"value"})
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, _, err = table.Pop(ctx, "string", true)
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, err = table.ListRange(ctx, "string", 0, -1)
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, err = table.ListLen(ctx, "string")
+	require.ErrorIs(t, err, engine.ErrWrongType)
+
+	_, _, err = table.Get(ctx, "list")
+	require.ErrorIs(t, err, engine.ErrWrongType)
+
+	require.NoError(t, table.Set(ctx, "list", "value"))
+	value, ok, err := table.Get(ctx, "list")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value", value)
+}
+
+func TestHashTable_ListsExpiration(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock))
+
+	_, err := table.Push(ctx, "list", false, []string{"a", "b"})
+	require.NoError(t, err)
+	expiresAt := clock.Now().Add(time.Second)
+	ok, err := table.Expire(ctx, "list", expiresAt)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, err = table.Push(ctx, "list", false, []string{"c"})
+	require.NoError(t, err)
+	actExpiresAt, ok, err := table.Expiration(ctx, "list")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, expiresAt, actExpiresAt)
+
+	log, ok, err := table.Dump(ctx, "list")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, wal.NewLog(0, wal.ListOp, "list", wal.FormatExpiration(expiresAt), "a", "b", "c"), log)
+
+	clock.Advance(time.Second)
+	length, err := table.ListLen(ctx, "list")
+	require.NoError(t, err)
+	require.Zero(t, length)
+	_, ok, err = table.Dump(ctx, "list")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	length, err = table.Push(ctx, "list", false, []string{"d"})
+	require.NoError(t, err)
+	require.Equal(t, 1, length)
+	ok, err = table.Persist(ctx, "list")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, len("list")+len("d"), table.used)
+}
+
+func TestHashTable_ListsSnapshot(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable()
+	require.NoError(t, table.Set(ctx, "string", "value"))
+	_, err := table.Push(ctx, "list", true, []string{"a", "b"})
+	require.NoError(t, err)
+
+	logs, err := table.Snapshot(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []wal.Log{
+		wal.NewLog(0, wal.SetOp, "string", "value"),
+		wal.NewLog(0, wal.ListOp, "list", "", "b", "a"),
+	}, logs)
+}
+
+func TestHashTable_ListsMaxMemory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable(WithMaxMemory(10, NoEviction))
+
+	_, err := table.Push(ctx, "list", false, []string{"abc"})
+	require.NoError(t, err)
+	_, err = table.Push(ctx, "list", false, []string{"abcd"})
+	require.ErrorIs(t, err, ErrMemoryLimit)
+
+	values, err := table.ListRange(ctx, "list", 0, -1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"abc"}, values)
+	require.Equal(t, 7, table.used)
+}
@@ -2,44 +2,563 @@ package memory
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"time"
 
+	"kv_db/internal/database/storage/engine"
+	"kv_db/internal/database/storage/engine/scan"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
 	"kv_db/pkg/dlock"
+	"kv_db/pkg/dskiplist"
 )
 
+var ErrUnordered = errors.New("keys are not ordered")
+
+type HashTableOption func(*HashTable)
+
+func WithClock(clock dclock.Clock) HashTableOption {
+	return func(table *HashTable) {
+		table.clock = clock
+	}
+}
+
+// WithMaxMemory limits the approximate size of keys and values in bytes.
+// When the limit is reached, writes either fail with ErrMemoryLimit or evict
+// other keys according to the policy. Evictions aren't logged, so they are
+// lost by a recovery from a log and aren't replicated.
+func WithMaxMemory(limit int, policy EvictionPolicy) HashTableOption {
+	return func(table *HashTable) {
+		table.maxMemory = limit
+		table.policy = policy
+	}
+}
+
+// WithRemovalListener calls the listener for every key that the table
+// deletes by itself: an expired key deleted by DeleteExpired or a write, or a
+// key evicted by a write. It is called with the table locked, so it must not
+// wait or use the table.
+func WithRemovalListener(listener func(key string, evicted bool)) HashTableOption {
+	return func(table *HashTable) {
+		table.removed = listener
+	}
+}
+
+// WithOrderedKeys keeps keys in a skiplist besides the map, so they can be
+// iterated in order. It makes writes of new keys slower.
+func WithOrderedKeys() HashTableOption {
+	return func(table *HashTable) {
+		table.index = dskiplist.NewOrdered[string, struct{}]()
+	}
+}
+
+// value is the value of a key, which is either a string or a collection.
+// Operations of one type return engine.ErrWrongType for keys of others.
+type value interface {
+	// size is the approximate memory usage of the value in bytes.
+	size() int
+	// log returns a log that recreates the key with the value. The
+	// expiration is empty if the key doesn't expire.
+	log(key, expiration string) wal.Log
+}
+
+type stringValue string
+
+func (v stringValue) size() int {
+	return len(v)
+}
+
+func (v stringValue) log(key, expiration string) wal.Log {
+	if expiration == "" {
+		return wal.NewLog(0, wal.SetOp, key, string(v))
+	}
+	return wal.NewLog(0, wal.SetOp, key, string(v), expiration)
+}
+
+// HashTable keeps expiration times separately from values, because most keys
+// usually don't have them. An expired key is invisible right away, but it
+// stays in memory until DeleteExpired reaches it.
+//
+// Every write of a value gives the key a new version. Versions aren't
+// persisted, but the counter starts from the current time in nanoseconds, so
+// versions given after a restart are greater than the previous ones.
 type HashTable struct {
-	mutex sync.RWMutex
-	data  map[string]string
+	mutex       sync.RWMutex
+	data        map[string]value
+	expirations map[string]time.Time
+	versions    map[string]uint64
+	version     uint64
+	// accesses are tracked only if the eviction policy needs them.
+	accesses map[string]*access
+	// index is maintained only if keys are ordered, and hashes orders keys
+	// for Scan.
+	index   *dskiplist.SkipList[string, struct{}]
+	hashes  *dskiplist.SkipList[scan.HashedKey, struct{}]
+	clock   dclock.Clock
+	removed func(key string, evicted bool)
+
+	used      int
+	maxMemory int
+	policy    EvictionPolicy
+	evicted   uint64
+	// removals collect the states of the keys that are removed to make room
+	// for the writes of a batch, so they are restored if the batch fails.
+	removals *[]keyState
 }
 
-func NewHashTable() *HashTable {
-	return &HashTable{
-		data: make(map[string]string),
+func NewHashTable(options ...HashTableOption) *HashTable {
+	table := &HashTable{
+		data:        make(map[string]value),
+		expirations: make(map[string]time.Time),
+		versions:    make(map[string]uint64),
+		hashes:      newHashesIndex(),
+		clock:       dclock.NewRealClock(),
+	}
+	for _, option := range options {
+		option(table)
+	}
+	if table.policy != NoEviction {
+		table.accesses = make(map[string]*access)
 	}
+	return table
 }
 
 func (s *HashTable) Set(_ context.Context, key string, value string) error {
+	var err error
 	dlock.WithLock(&s.mutex, func() {
-		s.data[key] = value
+		if err = s.set(key, stringValue(value), s.clock.Now()); err == nil {
+			delete(s.expirations, key)
+		}
 	})
-	return nil
+	return err
+}
+
+func (s *HashTable) SetWithExpiration(_ context.Context, key string, value string, expiresAt time.Time) error {
+	var err error
+	dlock.WithLock(&s.mutex, func() {
+		if err = s.set(key, stringValue(value), s.clock.Now()); err == nil {
+			s.expirations[key] = expiresAt
+		}
+	})
+	return err
 }
 
 func (s *HashTable) Get(_ context.Context, key string) (string, bool, error) {
 	var value string
 	var ok bool
+	var err error
 	dlock.WithLock(s.mutex.RLocker(), func() {
-		value, ok = s.data[key]
+		now := s.clock.Now()
+		value, ok, err = s.get(key, now)
+		if ok && s.accesses != nil {
+			s.accesses[key].touch(now)
+		}
 	})
-	if !ok {
-		return "", false, nil
+	if err != nil || !ok {
+		return "", false, err
 	}
 	return value, true, nil
 }
 
+// GetWithVersion returns the value and the version of the key. A missing key
+// has version 0.
+func (s *HashTable) GetWithVersion(_ context.Context, key string) (string, uint64, bool, error) {
+	var value string
+	var version uint64
+	var ok bool
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		now := s.clock.Now()
+		value, ok, err = s.get(key, now)
+		if ok {
+			version = s.versions[key]
+			if s.accesses != nil {
+				s.accesses[key].touch(now)
+			}
+		}
+	})
+	if err != nil || !ok {
+		return "", 0, false, err
+	}
+	return value, version, true, nil
+}
+
 func (s *HashTable) Delete(_ context.Context, key string) error {
 	dlock.WithLock(&s.mutex, func() {
-		delete(s.data, key)
+		s.remove(key)
+	})
+	return nil
+}
+
+// Flush deletes all keys.
+func (s *HashTable) Flush(context.Context) error {
+	dlock.WithLock(&s.mutex, s.flush)
+	return nil
+}
+
+func (s *HashTable) flush() {
+	s.data = make(map[string]value)
+	s.expirations = make(map[string]time.Time)
+	s.versions = make(map[string]uint64)
+	if s.accesses != nil {
+		s.accesses = make(map[string]*access)
+	}
+	if s.index != nil {
+		s.index = dskiplist.NewOrdered[string, struct{}]()
+	}
+	s.hashes = newHashesIndex()
+	s.used = 0
+}
+
+// Expire sets the expiration time of an existing key. It returns false if
+// there is no such key.
+func (s *HashTable) Expire(_ context.Context, key string, expiresAt time.Time) (bool, error) {
+	var ok bool
+	dlock.WithLock(&s.mutex, func() {
+		if _, ok = s.lookup(key, s.clock.Now()); ok {
+			s.expirations[key] = expiresAt
+		}
+	})
+	return ok, nil
+}
+
+// Persist removes the expiration time of a key. It returns false if there is
+// no such key or it doesn't expire.
+func (s *HashTable) Persist(_ context.Context, key string) (bool, error) {
+	var ok bool
+	dlock.WithLock(&s.mutex, func() {
+		if _, ok = s.lookup(key, s.clock.Now()); ok {
+			_, ok = s.expirations[key]
+			delete(s.expirations, key)
+		}
+	})
+	return ok, nil
+}
+
+// Expiration returns the expiration time of a key, which is zero if the key
+// doesn't expire.
+func (s *HashTable) Expiration(_ context.Context, key string) (time.Time, bool, error) {
+	var expiresAt time.Time
+	var ok bool
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		if _, ok = s.lookup(key, s.clock.Now()); ok {
+			expiresAt = s.expirations[key]
+		}
+	})
+	return expiresAt, ok, nil
+}
+
+// Range calls yield for keys between start and end inclusively in ascending
+// order until yield returns false. Expired keys and collections are skipped.
+func (s *HashTable) Range(_ context.Context, start, end string, yield func(key, value string) bool) error {
+	if s.index == nil {
+		return ErrUnordered
+	}
+
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		now := s.clock.Now()
+		s.index.Ascend(start, func(key string, _ struct{}) bool {
+			if key > end {
+				return false
+			}
+			if value, ok := s.lookup(key, now); ok {
+				if value, ok := value.(stringValue); ok {
+					return yield(key, string(value))
+				}
+			}
+			return true
+		})
+	})
+	return nil
+}
+
+// Scan returns about count keys that follow the cursor and the cursor of the
+// next call, which is zero at the end. Every call reads the keys that follow
+// the cursor in the order of hashes under the read lock, but the lock isn't
+// held between calls.
+func (s *HashTable) Scan(_ context.Context, cursor uint64, count int) ([]string, uint64, error) {
+	batch := scan.NewBatch(cursor, count)
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		s.scan(batch, s.clock.Now())
+	})
+	keys, next := batch.Result()
+	return keys, next, nil
+}
+
+func (s *HashTable) scan(batch *scan.Batch, now time.Time) {
+	s.hashes.Ascend(scan.HashedKey{Hash: batch.Cursor()}, func(key scan.HashedKey, _ struct{}) bool {
+		if !batch.Accepts(key.Hash) {
+			return false
+		}
+		if expiresAt, ok := s.expirations[key.Key]; !ok || expiresAt.After(now) {
+			batch.AddHashed(key)
+		}
+		return true
+	})
+}
+
+func newHashesIndex() *dskiplist.SkipList[scan.HashedKey, struct{}] {
+	return dskiplist.New[scan.HashedKey, struct{}](scan.HashedKey.Less)
+}
+
+// DeleteExpired checks at most limit keys with an expiration time and
+// deletes the expired ones. Keys are checked in the random order of map
+// iteration, so the share of deleted keys estimates the share of expired
+// keys in the whole table.
+func (s *HashTable) DeleteExpired(_ context.Context, limit int) (int, error) {
+	deleted := 0
+	dlock.WithLock(&s.mutex, func() {
+		now := s.clock.Now()
+		checked := 0
+		for key, expiresAt := range s.expirations {
+			if checked >= limit {
+				break
+			}
+			checked++
+
+			if !expiresAt.After(now) {
+				s.remove(key)
+				s.notifyRemoved(key, false)
+				deleted++
+			}
+		}
+	})
+	return deleted, nil
+}
+
+// Snapshot returns logs that recreate the current data. Expired keys are
+// skipped.
+func (s *HashTable) Snapshot(_ context.Context) ([]wal.Log, error) {
+	var logs []wal.Log
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		logs = make([]wal.Log, 0, len(s.data))
+		logs = s.appendSnapshot(logs, s.clock.Now())
+	})
+	return logs, nil
+}
+
+// Info returns the memory usage and the eviction statistics.
+func (s *HashTable) Info(_ context.Context) (map[string]string, error) {
+	var info stats
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		info = s.stats()
+	})
+	return info.format(), nil
+}
+
+func (s *HashTable) stats() stats {
+	return stats{
+		keys:      len(s.data),
+		used:      s.used,
+		maxMemory: s.maxMemory,
+		policy:    s.policy,
+		evicted:   s.evicted,
+	}
+}
+
+// Dump returns a log that recreates the key with its value and expiration
+// time.
+func (s *HashTable) Dump(_ context.Context, key string) (wal.Log, bool, error) {
+	var log wal.Log
+	var ok bool
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		var value value
+		if value, ok = s.lookup(key, s.clock.Now()); ok {
+			log = value.log(key, s.expiration(key))
+		}
 	})
+	return log, ok, nil
+}
+
+func (s *HashTable) appendSnapshot(logs []wal.Log, now time.Time) []wal.Log {
+	for key, value := range s.data {
+		if expiresAt, ok := s.expirations[key]; !ok || expiresAt.After(now) {
+			logs = append(logs, value.log(key, s.expiration(key)))
+		}
+	}
+	return logs
+}
+
+// expiration returns the expiration time of the key formatted for a log.
+func (s *HashTable) expiration(key string) string {
+	if expiresAt, ok := s.expirations[key]; ok {
+		return wal.FormatExpiration(expiresAt)
+	}
+	return ""
+}
+
+// lookup returns the value of the key if it exists and isn't expired.
+func (s *HashTable) lookup(key string, now time.Time) (value, bool) {
+	value, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+
+	if expiresAt, ok := s.expirations[key]; ok && !expiresAt.After(now) {
+		return nil, false
+	}
+	return value, true
+}
+
+// lookupAs returns the value of the key if it exists and has the type T.
+func lookupAs[T value](s *HashTable, key string, now time.Time) (T, bool, error) {
+	var typed T
+	current, ok := s.lookup(key, now)
+	if !ok {
+		return typed, false, nil
+	}
+
+	if typed, ok = current.(T); !ok {
+		return typed, false, engine.ErrWrongType
+	}
+	return typed, true, nil
+}
+
+func (s *HashTable) get(key string, now time.Time) (string, bool, error) {
+	value, ok, err := lookupAs[stringValue](s, key, now)
+	return string(value), ok, err
+}
+
+func (s *HashTable) set(key string, value value, now time.Time) error {
+	if err := s.reserve(key, entrySize(key, value), now); err != nil {
+		return err
+	}
+
+	s.put(key, value, now)
 	return nil
 }
+
+// put sets the value without checking the memory limit.
+func (s *HashTable) put(key string, value value, now time.Time) {
+	if oldValue, ok := s.data[key]; ok {
+		s.used -= entrySize(key, oldValue)
+	} else {
+		s.hashes.Set(scan.NewHashedKey(key), struct{}{})
+		if s.index != nil {
+			s.index.Set(key, struct{}{})
+		}
+	}
+	s.data[key] = value
+	s.used += entrySize(key, value)
+	s.versions[key] = s.nextVersion(now)
+	s.touch(key, now)
+}
+
+// create replaces a missing or expired key with an empty collection.
+func (s *HashTable) create(key string, collection value, now time.Time) {
+	s.remove(key)
+	s.put(key, collection, now)
+}
+
+// change modifies a collection in place and updates the memory usage. The
+// memory has to be reserved before.
+func (s *HashTable) change(key string, collection value, now time.Time, action func()) {
+	s.used -= collection.size()
+	action()
+	s.used += collection.size()
+	s.versions[key] = s.nextVersion(now)
+	s.touch(key, now)
+}
+
+// nextVersion returns a version that is greater than all given ones and not
+// less than the current time in nanoseconds.
+func (s *HashTable) nextVersion(now time.Time) uint64 {
+	s.version = max(s.version+1, uint64(max(now.UnixNano(), 0)))
+	return s.version
+}
+
+// touch records a write access of the key for the eviction policy.
+func (s *HashTable) touch(key string, now time.Time) {
+	if s.accesses == nil {
+		return
+	}
+
+	if keyAccess, ok := s.accesses[key]; ok {
+		keyAccess.touch(now)
+	} else {
+		s.accesses[key] = newAccess(now)
+	}
+}
+
+// reserve makes room for a new value of the key by deleting expired keys
+// and, if the policy allows it, evicting other keys.
+func (s *HashTable) reserve(key string, size int, now time.Time) error {
+	if s.maxMemory == 0 {
+		return nil
+	}
+	if size > s.maxMemory {
+		return ErrMemoryLimit
+	}
+
+	for {
+		required := s.used + size
+		if oldValue, ok := s.data[key]; ok {
+			required -= entrySize(key, oldValue)
+		}
+		if required <= s.maxMemory {
+			return nil
+		}
+
+		victim, expired, ok := s.victim(key, now)
+		if !ok || (!expired && s.policy == NoEviction) {
+			return ErrMemoryLimit
+		}
+
+		if s.removals != nil {
+			*s.removals = append(*s.removals, s.state(victim))
+		}
+		s.remove(victim)
+		s.notifyRemoved(victim, !expired)
+		if !expired {
+			s.evicted++
+		}
+	}
+}
+
+// victim samples a few keys other than the given one and chooses the one to
+// delete. An expired key is chosen right away.
+func (s *HashTable) victim(key string, now time.Time) (string, bool, bool) {
+	var victim string
+	sampled := 0
+	for candidate := range s.data {
+		if candidate == key {
+			continue
+		}
+		if expiresAt, ok := s.expirations[candidate]; ok && !expiresAt.After(now) {
+			return candidate, true, true
+		}
+
+		if victim == "" || (s.accesses != nil && s.accesses[candidate].less(s.accesses[victim], s.policy, now)) {
+			victim = candidate
+		}
+
+		sampled++
+		if sampled == evictionSamples {
+			break
+		}
+	}
+	return victim, false, victim != ""
+}
+
+func (s *HashTable) notifyRemoved(key string, evicted bool) {
+	if s.removed != nil {
+		s.removed(key, evicted)
+	}
+}
+
+func (s *HashTable) remove(key string) {
+	if value, ok := s.data[key]; ok {
+		s.used -= entrySize(key, value)
+		s.hashes.Delete(scan.NewHashedKey(key))
+		if s.index != nil {
+			s.index.Delete(key)
+		}
+	}
+	delete(s.data, key)
+	delete(s.expirations, key)
+	delete(s.versions, key)
+	if s.accesses != nil {
+		delete(s.accesses, key)
+	}
+}
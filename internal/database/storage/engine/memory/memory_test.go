@@ -2,9 +2,15 @@ package memory
 
 import (
 	"context"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
 )
 
 func TestNewHashTable(t *testing.T) {
@@ -27,21 +33,21 @@ func TestHashTable_Set(t *testing.T) {
 		require.NoError(t, err)
 		actValue, ok := table.data[key]
 		require.True(t, ok)
-		require.Equal(t, value, actValue)
+		require.Equal(t, stringValue(value), actValue)
 	})
 
 	t.Run("test set existing key", func(t *testing.T) {
 		table := NewHashTable()
 		key := "set key"
 		value := "value"
-		table.data[key] = "old " + value
+		table.data[key] = stringValue("old " + value)
 
 		err := table.Set(context.Background(), key, value)
 
 		require.NoError(t, err)
 		actValue, ok := table.data[key]
 		require.True(t, ok)
-		require.Equal(t, value, actValue)
+		require.Equal(t, stringValue(value), actValue)
 	})
 }
 
@@ -52,7 +58,7 @@ func TestHashTable_Get(t *testing.T) {
 		table := NewHashTable()
 		key := "get key"
 		value := "get value"
-		table.data[key] = value
+		table.data[key] = stringValue(value)
 
 		actValue, ok, err := table.Get(context.Background(), key)
 
@@ -82,7 +88,7 @@ func TestHashTable_Delete(t *testing.T) {
 		table := NewHashTable()
 		key := "delete key"
 		value := "delete value"
-		table.data[key] = value
+		table.data[key] = stringValue(value)
 
 		err := table.Delete(context.Background(), key)
 
@@ -102,3 +108,361 @@ func TestHashTable_Delete(t *testing.T) {
 		require.False(t, ok)
 	})
 }
+
+func TestHashTable_Flush(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable(WithOrderedKeys(), WithMaxMemory(100, AllKeysLRU))
+	require.NoError(t, table.Set(ctx, "key1", "value"))
+	require.NoError(t, table.SetWithExpiration(ctx, "key2", "value", time.Now().Add(time.Hour)))
+	_, err := table.SetAdd(ctx, "set", []string{"member"})
+	require.NoError(t, err)
+
+	require.NoError(t, table.Flush(ctx))
+	require.Empty(t, table.data)
+	require.Empty(t, table.expirations)
+	require.Empty(t, table.versions)
+	require.Empty(t, table.accesses)
+	require.Zero(t, table.used)
+
+	require.NoError(t, table.Set(ctx, "key3", "value"))
+	var keys []string
+	require.NoError(t, table.Range(ctx, "a", "z", func(key, _ string) bool {
+		keys = append(keys, key)
+		return true
+	}))
+	require.Equal(t, []string{"key3"}, keys)
+}
+
+func TestHashTable_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock))
+	table.data["key1"] = stringValue("value1")
+	table.data["key2"] = stringValue("value2")
+	table.data["key3"] = stringValue("value3")
+	table.expirations["key2"] = time.Unix(10, 0)
+	table.expirations["key3"] = time.Unix(0, 0)
+
+	snapshot, err := table.Snapshot(context.Background())
+	require.NoError(t, err)
+
+	table.data["key1"] = stringValue("new value")
+	delete(table.data, "key2")
+
+	require.ElementsMatch(t, []wal.Log{
+		wal.NewLog(0, wal.SetOp, "key1", "value1"),
+		wal.NewLog(0, wal.SetOp, "key2", "value2", wal.FormatExpiration(time.Unix(10, 0))),
+	}, snapshot)
+}
+
+func TestHashTable_Expiration(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock))
+
+	ok, err := table.Expire(ctx, "key", clock.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, table.SetWithExpiration(ctx, "key", "value", clock.Now().Add(2*time.Second)))
+	require.NoError(t, table.Set(ctx, "persistent", "value"))
+
+	expiresAt, ok, err := table.Expiration(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, clock.Now().Add(2*time.Second), expiresAt)
+
+	expiresAt, ok, err = table.Expiration(ctx, "persistent")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, expiresAt.IsZero())
+
+	ok, err = table.Persist(ctx, "persistent")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	clock.Advance(time.Second)
+	value, ok, err := table.Get(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value", value)
+
+	clock.Advance(time.Second)
+	_, ok, err = table.Get(ctx, "key")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, ok, err = table.Expiration(ctx, "key")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = table.Expire(ctx, "key", clock.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Contains(t, table.data, "key")
+
+	deleted, err := table.DeleteExpired(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	require.NotContains(t, table.data, "key")
+	require.Empty(t, table.expirations)
+}
+
+func TestHashTable_Persist(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock))
+
+	require.NoError(t, table.SetWithExpiration(ctx, "key", "value", clock.Now().Add(time.Second)))
+
+	ok, err := table.Persist(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	clock.Advance(time.Hour)
+	value, ok, err := table.Get(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value", value)
+
+	require.NoError(t, table.SetWithExpiration(ctx, "key", "value", clock.Now().Add(time.Second)))
+	require.NoError(t, table.Set(ctx, "key", "new value"))
+	require.Empty(t, table.expirations)
+}
+
+func TestHashTable_MaxMemory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock), WithMaxMemory(12, NoEviction))
+
+	require.ErrorIs(t, table.Set(ctx, "key", "too big value"), ErrMemoryLimit)
+
+	require.NoError(t, table.Set(ctx, "k1", "v1"))
+	require.NoError(t, table.SetWithExpiration(ctx, "k2", "v2", clock.Now().Add(time.Second)))
+	require.NoError(t, table.Set(ctx, "k3", "v3"))
+	require.ErrorIs(t, table.Set(ctx, "k4", "v4"), ErrMemoryLimit)
+	require.ErrorIs(t, table.Set(ctx, "k1", "v11"), ErrMemoryLimit)
+	require.NoError(t, table.Set(ctx, "k1", "1"))
+
+	// Expired keys are deleted to make room even without eviction.
+	clock.Advance(time.Second)
+	require.NoError(t, table.Set(ctx, "k4", "v4"))
+	require.NotContains(t, table.data, "k2")
+
+	require.NoError(t, table.Delete(ctx, "k3"))
+	require.NoError(t, table.Set(ctx, "k5", "v5"))
+
+	info, err := table.Info(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"keys":            "3",
+		"used_memory":     "11",
+		"max_memory":      "12",
+		"eviction_policy": "noeviction",
+		"evicted_keys":    "0",
+	}, info)
+}
+
+func TestHashTable_Eviction(t *testing.T) {
+	t.Parallel()
+
+	testcases := map[string]struct {
+		policy   EvictionPolicy
+		accesses []string
+		evicted  string
+	}{
+		"lru evicts least recently used key": {
+			policy:   AllKeysLRU,
+			accesses: []string{"k1", "k1", "k1", "k2", "k3"},
+			evicted:  "k1",
+		},
+		"lfu evicts least frequently used key": {
+			policy:   AllKeysLFU,
+			accesses: []string{"k1", "k1", "k1", "k2", "k3"},
+			evicted:  "k2",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			clock := dclock.NewFakeClock(time.Unix(0, 0))
+			table := NewHashTable(WithClock(clock), WithMaxMemory(12, tc.policy))
+
+			for _, key := range []string{"k1", "k2", "k3"} {
+				require.NoError(t, table.Set(ctx, key, "v"+key[1:]))
+			}
+			for _, key := range tc.accesses {
+				clock.Advance(time.Millisecond)
+				_, ok, err := table.Get(ctx, key)
+				require.NoError(t, err)
+				require.True(t, ok)
+			}
+
+			require.NoError(t, table.Set(ctx, "k4", "v4"))
+			require.NotContains(t, table.data, tc.evicted)
+			require.Len(t, table.data, 3)
+
+			info, err := table.Info(ctx)
+			require.NoError(t, err)
+			require.Equal(t, "1", info["evicted_keys"])
+			require.Equal(t, tc.policy.String(), info["eviction_policy"])
+		})
+	}
+}
+
+func TestHashTable_RemovalListener(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	removed := make(map[string]bool)
+	table := NewHashTable(
+		WithClock(clock),
+		WithMaxMemory(12, AllKeysLRU),
+		WithRemovalListener(func(key string, evicted bool) {
+			removed[key] = evicted
+		}),
+	)
+
+	require.NoError(t, table.SetWithExpiration(ctx, "k1", "v1", clock.Now().Add(time.Second)))
+	require.NoError(t, table.SetWithExpiration(ctx, "k2", "v2", clock.Now().Add(time.Second)))
+	require.NoError(t, table.Set(ctx, "k3", "v3"))
+	require.NoError(t, table.Delete(ctx, "k3"))
+	require.Empty(t, removed)
+
+	// An expired key makes room for a write before others are evicted.
+	clock.Advance(time.Second)
+	require.NoError(t, table.Set(ctx, "k4", "v4"))
+	clock.Advance(time.Millisecond)
+	require.NoError(t, table.Set(ctx, "k5", "v5"))
+	require.Len(t, removed, 1)
+
+	deleted, err := table.DeleteExpired(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	require.Equal(t, map[string]bool{"k1": false, "k2": false}, removed)
+
+	clock.Advance(time.Millisecond)
+	require.NoError(t, table.Set(ctx, "k6", "v6"))
+	clock.Advance(time.Millisecond)
+	require.NoError(t, table.Set(ctx, "k7", "v7"))
+	require.Equal(t, map[string]bool{"k1": false, "k2": false, "k4": true}, removed)
+}
+
+func TestHashTable_Range(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock), WithOrderedKeys())
+
+	for _, key := range []string{"d", "b", "a", "e", "c"} {
+		require.NoError(t, table.Set(ctx, key, "v"+key))
+	}
+	require.NoError(t, table.Delete(ctx, "c"))
+	require.NoError(t, table.SetWithExpiration(ctx, "bb", "vbb", clock.Now().Add(time.Second)))
+	clock.Advance(time.Second)
+
+	collect := func(start, end string, limit int) []string {
+		var pairs []string
+		require.NoError(t, table.Range(ctx, start, end, func(key, value string) bool {
+			pairs = append(pairs, key+"="+value)
+			return len(pairs) < limit
+		}))
+		return pairs
+	}
+
+	require.Equal(t, []string{"b=vb", "d=vd"}, collect("b", "d", 10))
+	require.Equal(t, []string{"a=va", "b=vb"}, collect("", "z", 2))
+	require.Empty(t, collect("f", "z", 10))
+
+	err := NewHashTable().Range(ctx, "a", "z", func(string, string) bool { return true })
+	require.ErrorIs(t, err, ErrUnordered)
+}
+
+func TestHashTable_Scan(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock))
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, table.Set(ctx, key, "value"))
+	}
+	require.NoError(t, table.SetWithExpiration(ctx, "e", "value", clock.Now().Add(time.Second)))
+	clock.Advance(time.Second)
+
+	keys, next, err := table.Scan(ctx, 0, 3)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+	require.NotZero(t, next)
+
+	rest, next, err := table.Scan(ctx, next, 3)
+	require.NoError(t, err)
+	require.Zero(t, next)
+	require.ElementsMatch(t, []string{"a", "b", "c", "d"}, append(keys, rest...))
+}
+
+func TestHashTable_ScanLargeKeyspace(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable()
+
+	expected := make([]string, 0, 50_000)
+	for i := 0; i < 100_000; i++ {
+		key := "key" + strconv.Itoa(i)
+		require.NoError(t, table.Set(ctx, key, "value"))
+		if i%2 == 0 {
+			require.NoError(t, table.Delete(ctx, key))
+		} else {
+			expected = append(expected, key)
+		}
+	}
+
+	var keys []string
+	cursor := uint64(0)
+	for {
+		batch, next, err := table.Scan(ctx, cursor, 10)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(batch), 10)
+		keys = append(keys, batch...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	sort.Strings(expected)
+	sort.Strings(keys)
+	require.Equal(t, expected, keys)
+
+	require.NoError(t, table.Flush(ctx))
+	keys, _, err := table.Scan(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
+
+func TestAccessDecayedHits(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	keyAccess := newAccess(now)
+	keyAccess.touch(now)
+	require.Equal(t, uint32(newKeyHits+1), keyAccess.decayedHits(now))
+	require.Equal(t, uint32(newKeyHits+1)/4, keyAccess.decayedHits(now.Add(2*hitsDecayPeriod)))
+	require.Zero(t, keyAccess.decayedHits(now.Add(time.Hour)))
+}
@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dlock"
+)
+
+// SetAdd adds the members to the set and returns the number of new ones. A
+// set is created if the key doesn't exist.
+func (s *HashTable) SetAdd(_ context.Context, key string, members []string) (int, error) {
+	var added int
+	var err error
+	dlock.WithLock(&s.mutex, func() {
+		added, err = s.setAdd(key, members, s.clock.Now())
+	})
+	return added, err
+}
+
+// SetRemove removes the members of the set and returns the number of removed
+// ones. The key is deleted with the last member.
+func (s *HashTable) SetRemove(_ context.Context, key string, members []string) (int, error) {
+	var removed int
+	var err error
+	dlock.WithLock(&s.mutex, func() {
+		now := s.clock.Now()
+		st, ok, lookupErr := lookupAs[*set](s, key, now)
+		if err = lookupErr; err != nil || !ok {
+			return
+		}
+
+		s.change(key, st, now, func() {
+			for _, member := range members {
+				if st.remove(member) {
+					removed++
+				}
+			}
+		})
+		if len(st.members) == 0 {
+			s.remove(key)
+		}
+	})
+	return removed, err
+}
+
+func (s *HashTable) SetIsMember(_ context.Context, key, member string) (bool, error) {
+	var ok bool
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		now := s.clock.Now()
+		st, exists, lookupErr := lookupAs[*set](s, key, now)
+		if err = lookupErr; err != nil || !exists {
+			return
+		}
+		if s.accesses != nil {
+			s.accesses[key].touch(now)
+		}
+		_, ok = st.members[member]
+	})
+	return ok, err
+}
+
+// SetMembers returns the members of the set in no particular order, which are
+// empty if the key doesn't exist.
+func (s *HashTable) SetMembers(_ context.Context, key string) ([]string, error) {
+	var members []string
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		now := s.clock.Now()
+		st, ok, lookupErr := lookupAs[*set](s, key, now)
+		if err = lookupErr; err != nil || !ok {
+			return
+		}
+		if s.accesses != nil {
+			s.accesses[key].touch(now)
+		}
+		members = st.list()
+	})
+	return members, err
+}
+
+func (s *HashTable) setAdd(key string, members []string, now time.Time) (int, error) {
+	st, ok, err := lookupAs[*set](s, key, now)
+	if err != nil {
+		return 0, err
+	}
+
+	size := len(key)
+	if ok {
+		size += st.size()
+	}
+	additions := make(map[string]struct{}, len(members))
+	for _, member := range members {
+		if _, exists := additions[member]; exists {
+			continue
+		}
+		if ok {
+			if _, exists := st.members[member]; exists {
+				continue
+			}
+		}
+		additions[member] = struct{}{}
+		size += len(member)
+	}
+	if err := s.reserve(key, size, now); err != nil {
+		return 0, err
+	}
+
+	if !ok {
+		st = &set{members: make(map[string]struct{}, len(additions))}
+		s.create(key, st, now)
+	}
+	s.change(key, st, now, func() {
+		for member := range additions {
+			st.add(member)
+		}
+	})
+	return len(additions), nil
+}
+
+// set is an unordered set of unique members.
+type set struct {
+	members map[string]struct{}
+	bytes   int
+}
+
+func (st *set) log(key, expiration string) wal.Log {
+	return wal.NewLog(0, wal.MembersOp, append([]string{key, expiration}, st.list()...)...)
+}
+
+func (st *set) size() int {
+	return st.bytes
+}
+
+func (st *set) list() []string {
+	members := make([]string, 0, len(st.members))
+	for member := range st.members {
+		members = append(members, member)
+	}
+	return members
+}
+
+// add returns true if the member is new.
+func (st *set) add(member string) bool {
+	if _, ok := st.members[member]; ok {
+		return false
+	}
+	st.members[member] = struct{}{}
+	st.bytes += len(member)
+	return true
+}
+
+func (st *set) remove(member string) bool {
+	if _, ok := st.members[member]; !ok {
+		return false
+	}
+	delete(st.members, member)
+	st.bytes -= len(member)
+	return true
+}
@@ -0,0 +1,196 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage/engine"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
+)
+
+func TestHashTable_Sets(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable()
+
+	added, err := table.SetAdd(ctx, "tags", []string{"go", "db", "go"})
+	require.NoError(t, err)
+	require.Equal(t, 2, added)
+	added, err = table.SetAdd(ctx, "tags", []string{"db", "kv"})
+	require.NoError(t, err)
+	require.Equal(t, 1, added)
+	require.Equal(t, len("tags")+len("godbkv"), table.used)
+
+	ok, err := table.SetIsMember(ctx, "tags", "kv")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = table.SetIsMember(ctx, "tags", "sql")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	members, err := table.SetMembers(ctx, "tags")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"go", "db", "kv"}, members)
+
+	removed, err := table.SetRemove(ctx, "tags", []string{"go", "sql"})
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	removed, err = table.SetRemove(ctx, "tags", []string{"db", "kv"})
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	require.NotContains(t, table.data, "tags")
+	require.Zero(t, table.used)
+
+	members, err = table.SetMembers(ctx, "tags")
+	require.NoError(t, err)
+	require.Empty(t, members)
+	ok, err = table.SetIsMember(ctx, "tags", "go")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestHashTable_SortedSets(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable()
+
+	added, err := table.SortedSetAdd(ctx, "board", []engine.ScoredMember{
+		{Member: "alice", Score: 10},
+		{Member: "bob", Score: 20},
+		{Member: "carol", Score: 20},
+		{Member: "alice", Score: 30},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, added)
+	added, err = table.SortedSetAdd(ctx, "board", []engine.ScoredMember{
+		{Member: "bob", Score: 5},
+		{Member: "dave", Score: -1.5},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, added)
+	require.Equal(t, len("board")+len("alicebobcaroldave")+4*scoreSize, table.used)
+
+	members, err := table.SortedSetRange(ctx, "board", 0, -1)
+	require.NoError(t, err)
+	require.Equal(t, []engine.ScoredMember{
+		{Member: "dave", Score: -1.5},
+		{Member: "bob", Score: 5},
+		{Member: "carol", Score: 20},
+		{Member: "alice", Score: 30},
+	}, members)
+	members, err = table.SortedSetRange(ctx, "board", -2, 10)
+	require.NoError(t, err)
+	require.Equal(t, []engine.ScoredMember{{Member: "carol", Score: 20}, {Member: "alice", Score: 30}}, members)
+	members, err = table.SortedSetRange(ctx, "board", 3, 1)
+	require.NoError(t, err)
+	require.Empty(t, members)
+
+	members, err = table.SortedSetRangeByScore(ctx, "board", 5, 20)
+	require.NoError(t, err)
+	require.Equal(t, []engine.ScoredMember{{Member: "bob", Score: 5}, {Member: "carol", Score: 20}}, members)
+
+	rank, ok, err := table.SortedSetRank(ctx, "board", "carol")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 2, rank)
+	_, ok, err = table.SortedSetRank(ctx, "board", "eve")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	removed, err := table.SortedSetRemove(ctx, "board", []string{"bob", "eve"})
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	rank, _, err = table.SortedSetRank(ctx, "board", "carol")
+	require.NoError(t, err)
+	require.Equal(t, 1, rank)
+
+	removed, err = table.SortedSetRemove(ctx, "board", []string{"alice", "carol", "dave"})
+	require.NoError(t, err)
+	require.Equal(t, 3, removed)
+	require.NotContains(t, table.data, "board")
+	require.Zero(t, table.used)
+}
+
+func TestHashTable_SetsWrongType(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable()
+	require.NoError(t, table.Set(ctx, "string", "value"))
+	_, err := table.SetAdd(ctx, "set", []string{"member"})
+	require.NoError(t, err)
+
+	_, err = table.SetAdd(ctx, "string", []string{"member"})
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, err = table.SetMembers(ctx, "string")
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, err = table.SortedSetAdd(ctx, "set", []engine.ScoredMember{{Member: "member"}})
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, _, err = table.SortedSetRank(ctx, "set", "member")
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, err = table.SortedSetRange(ctx, "string", 0, -1)
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, err = table.SetRemove(ctx, "string", []string{"member"})
+	require.ErrorIs(t, err, engine.ErrWrongType)
+	_, _, err = table.Get(ctx, "set")
+	require.ErrorIs(t, err, engine.ErrWrongType)
+}
+
+func TestHashTable_SetsDump(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table := NewHashTable(WithClock(clock))
+
+	_, err := table.SetAdd(ctx, "set", []string{"member"})
+	require.NoError(t, err)
+	_, err = table.SortedSetAdd(ctx, "board", []engine.ScoredMember{
+		{Member: "bob", Score: 2.5},
+		{Member: "alice", Score: 1},
+	})
+	require.NoError(t, err)
+	expiresAt := clock.Now().Add(time.Second)
+	_, err = table.Expire(ctx, "board", expiresAt)
+	require.NoError(t, err)
+
+	log, ok, err := table.Dump(ctx, "set")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, wal.NewLog(0, wal.MembersOp, "set", "", "member"), log)
+
+	log, ok, err = table.Dump(ctx, "board")
+	require.NoError(t, err)
+	require.True(t, ok)
+	expLog := wal.NewLog(0, wal.SortedSetOp, "board", wal.FormatExpiration(expiresAt), "1", "alice", "2.5", "bob")
+	require.Equal(t, expLog, log)
+
+	clock.Advance(time.Second)
+	members, err := table.SortedSetRange(ctx, "board", 0, -1)
+	require.NoError(t, err)
+	require.Empty(t, members)
+}
+
+func TestHashTable_SetsMaxMemory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table := NewHashTable(WithMaxMemory(20, NoEviction))
+
+	_, err := table.SortedSetAdd(ctx, "z", []engine.ScoredMember{{Member: "a"}, {Member: "b"}})
+	require.NoError(t, err)
+	_, err = table.SortedSetAdd(ctx, "z", []engine.ScoredMember{{Member: "a", Score: 1}})
+	require.NoError(t, err)
+	_, err = table.SortedSetAdd(ctx, "z", []engine.ScoredMember{{Member: "c"}})
+	require.ErrorIs(t, err, ErrMemoryLimit)
+	require.Equal(t, 19, table.used)
+
+	_, err = table.SetAdd(ctx, "s", []string{"0123456789abcdefghi"})
+	require.ErrorIs(t, err, ErrMemoryLimit)
+}
@@ -0,0 +1,250 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"kv_db/internal/database/storage/engine"
+	"kv_db/internal/database/storage/engine/scan"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dlock"
+)
+
+// ShardedHashTable splits the keyspace into independently locked hash
+// tables, so operations on different shards don't block each other.
+type ShardedHashTable struct {
+	shards []*HashTable
+}
+
+func NewShardedHashTable(shardsNumber int, options ...HashTableOption) (*ShardedHashTable, error) {
+	if shardsNumber <= 0 {
+		return nil, errors.New("sharded hash table shards number is invalid")
+	}
+
+	shards := make([]*HashTable, shardsNumber)
+	for i := range shards {
+		shards[i] = NewHashTable(options...)
+		if shards[i].maxMemory != 0 {
+			shards[i].maxMemory = max(shards[i].maxMemory/shardsNumber, 1)
+		}
+	}
+
+	return &ShardedHashTable{shards: shards}, nil
+}
+
+func (s *ShardedHashTable) Set(ctx context.Context, key string, value string) error {
+	return s.shard(key).Set(ctx, key, value)
+}
+
+func (s *ShardedHashTable) Get(ctx context.Context, key string) (string, bool, error) {
+	return s.shard(key).Get(ctx, key)
+}
+
+// GetWithVersion returns the version of the key in its shard. Every shard
+// has its own counter, so only versions of the same key are comparable.
+func (s *ShardedHashTable) GetWithVersion(ctx context.Context, key string) (string, uint64, bool, error) {
+	return s.shard(key).GetWithVersion(ctx, key)
+}
+
+func (s *ShardedHashTable) Delete(ctx context.Context, key string) error {
+	return s.shard(key).Delete(ctx, key)
+}
+
+func (s *ShardedHashTable) SetWithExpiration(ctx context.Context, key, value string, expiresAt time.Time) error {
+	return s.shard(key).SetWithExpiration(ctx, key, value, expiresAt)
+}
+
+// Flush locks all shards in the order of their indexes, so readers observe
+// either all or none of them flushed.
+func (s *ShardedHashTable) Flush(context.Context) error {
+	for _, shard := range s.shards {
+		shard.mutex.Lock()
+		defer shard.mutex.Unlock()
+	}
+
+	for _, shard := range s.shards {
+		shard.flush()
+	}
+	return nil
+}
+
+func (s *ShardedHashTable) Expire(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	return s.shard(key).Expire(ctx, key, expiresAt)
+}
+
+func (s *ShardedHashTable) Persist(ctx context.Context, key string) (bool, error) {
+	return s.shard(key).Persist(ctx, key)
+}
+
+func (s *ShardedHashTable) Expiration(ctx context.Context, key string) (time.Time, bool, error) {
+	return s.shard(key).Expiration(ctx, key)
+}
+
+func (s *ShardedHashTable) Push(ctx context.Context, key string, left bool, values []string) (int, error) {
+	return s.shard(key).Push(ctx, key, left, values)
+}
+
+func (s *ShardedHashTable) Pop(ctx context.Context, key string, left bool) (string, bool, error) {
+	return s.shard(key).Pop(ctx, key, left)
+}
+
+func (s *ShardedHashTable) ListRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	return s.shard(key).ListRange(ctx, key, start, stop)
+}
+
+func (s *ShardedHashTable) ListLen(ctx context.Context, key string) (int, error) {
+	return s.shard(key).ListLen(ctx, key)
+}
+
+func (s *ShardedHashTable) HashSet(ctx context.Context, key string, pairs []string) (int, error) {
+	return s.shard(key).HashSet(ctx, key, pairs)
+}
+
+func (s *ShardedHashTable) HashGet(ctx context.Context, key, field string) (string, bool, error) {
+	return s.shard(key).HashGet(ctx, key, field)
+}
+
+func (s *ShardedHashTable) HashDelete(ctx context.Context, key string, fields []string) (int, error) {
+	return s.shard(key).HashDelete(ctx, key, fields)
+}
+
+func (s *ShardedHashTable) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return s.shard(key).HashGetAll(ctx, key)
+}
+
+func (s *ShardedHashTable) HashLen(ctx context.Context, key string) (int, error) {
+	return s.shard(key).HashLen(ctx, key)
+}
+
+func (s *ShardedHashTable) SetAdd(ctx context.Context, key string, members []string) (int, error) {
+	return s.shard(key).SetAdd(ctx, key, members)
+}
+
+func (s *ShardedHashTable) SetRemove(ctx context.Context, key string, members []string) (int, error) {
+	return s.shard(key).SetRemove(ctx, key, members)
+}
+
+func (s *ShardedHashTable) SetIsMember(ctx context.Context, key, member string) (bool, error) {
+	return s.shard(key).SetIsMember(ctx, key, member)
+}
+
+func (s *ShardedHashTable) SetMembers(ctx context.Context, key string) ([]string, error) {
+	return s.shard(key).SetMembers(ctx, key)
+}
+
+func (s *ShardedHashTable) SortedSetAdd(ctx context.Context, key string, members []engine.ScoredMember) (int, error) {
+	return s.shard(key).SortedSetAdd(ctx, key, members)
+}
+
+func (s *ShardedHashTable) SortedSetRemove(ctx context.Context, key string, members []string) (int, error) {
+	return s.shard(key).SortedSetRemove(ctx, key, members)
+}
+
+func (s *ShardedHashTable) SortedSetRange(
+	ctx context.Context, key string, start, stop int,
+) ([]engine.ScoredMember, error) {
+	return s.shard(key).SortedSetRange(ctx, key, start, stop)
+}
+
+func (s *ShardedHashTable) SortedSetRangeByScore(
+	ctx context.Context, key string, minScore, maxScore float64,
+) ([]engine.ScoredMember, error) {
+	return s.shard(key).SortedSetRangeByScore(ctx, key, minScore, maxScore)
+}
+
+func (s *ShardedHashTable) SortedSetRank(ctx context.Context, key, member string) (int, bool, error) {
+	return s.shard(key).SortedSetRank(ctx, key, member)
+}
+
+func (s *ShardedHashTable) Dump(ctx context.Context, key string) (wal.Log, bool, error) {
+	return s.shard(key).Dump(ctx, key)
+}
+
+// Scan locks shards one by one, and all of them fill the same batch, because
+// the order of keys doesn't depend on shards. Every shard reads only the keys
+// that the batch accepts, so a step costs O(count) per shard.
+func (s *ShardedHashTable) Scan(_ context.Context, cursor uint64, count int) ([]string, uint64, error) {
+	batch := scan.NewBatch(cursor, count)
+	for _, shard := range s.shards {
+		dlock.WithLock(shard.mutex.RLocker(), func() {
+			shard.scan(batch, shard.clock.Now())
+		})
+	}
+	keys, next := batch.Result()
+	return keys, next, nil
+}
+
+// DeleteExpired splits the limit between shards, so a call locks every shard
+// once for a short time.
+func (s *ShardedHashTable) DeleteExpired(ctx context.Context, limit int) (int, error) {
+	shardLimit := (limit + len(s.shards) - 1) / len(s.shards)
+
+	deleted := 0
+	for _, shard := range s.shards {
+		shardDeleted, err := shard.DeleteExpired(ctx, shardLimit)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += shardDeleted
+	}
+	return deleted, nil
+}
+
+// Snapshot holds read locks of all shards while copying them, so the copy
+// is consistent across shards.
+func (s *ShardedHashTable) Snapshot(_ context.Context) ([]wal.Log, error) {
+	size := 0
+	for _, shard := range s.shards {
+		shard.mutex.RLock()
+		defer shard.mutex.RUnlock()
+		size += len(shard.data)
+	}
+
+	now := s.shards[0].clock.Now()
+	logs := make([]wal.Log, 0, size)
+	for _, shard := range s.shards {
+		logs = shard.appendSnapshot(logs, now)
+	}
+	return logs, nil
+}
+
+// Info sums the statistics of all shards. Every shard has its own part of the
+// memory limit.
+func (s *ShardedHashTable) Info(_ context.Context) (map[string]string, error) {
+	var info stats
+	for _, shard := range s.shards {
+		dlock.WithLock(shard.mutex.RLocker(), func() {
+			shardInfo := shard.stats()
+			info.keys += shardInfo.keys
+			info.used += shardInfo.used
+			info.maxMemory += shardInfo.maxMemory
+			info.policy = shardInfo.policy
+			info.evicted += shardInfo.evicted
+		})
+	}
+	return info.format(), nil
+}
+
+func (s *ShardedHashTable) shard(key string) *HashTable {
+	return s.shards[s.shardIndex(key)]
+}
+
+func (s *ShardedHashTable) shardIndex(key string) int {
+	return int(hashKey(key) % uint32(len(s.shards)))
+}
+
+// hashKey is FNV-1a, inlined to avoid allocations of hash/fnv.
+func hashKey(key string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	hash := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime32
+	}
+	return hash
+}
@@ -0,0 +1,194 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
+)
+
+func TestNewShardedHashTable(t *testing.T) {
+	t.Parallel()
+
+	table, err := NewShardedHashTable(0)
+	require.Error(t, err)
+	require.Nil(t, table)
+
+	table, err = NewShardedHashTable(8)
+	require.NoError(t, err)
+	require.Len(t, table.shards, 8)
+}
+
+func TestShardedHashTable(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, err := NewShardedHashTable(4)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, table.Set(ctx, fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)))
+	}
+
+	for _, shard := range table.shards {
+		require.NotEmpty(t, shard.data)
+	}
+
+	value, ok, err := table.Get(ctx, "key42")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value42", value)
+
+	require.NoError(t, table.Delete(ctx, "key42"))
+
+	_, ok, err = table.Get(ctx, "key42")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	snapshot, err := table.Snapshot(ctx)
+	require.NoError(t, err)
+	require.Len(t, snapshot, 99)
+	require.Contains(t, snapshot, wal.NewLog(0, wal.SetOp, "key7", "value7"))
+}
+
+func TestShardedHashTableConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, err := NewShardedHashTable(4)
+	require.NoError(t, err)
+
+	workers := 16
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("key%d_%d", worker, j)
+				require.NoError(t, table.Set(ctx, key, key))
+				_, _, err := table.Get(ctx, key)
+				require.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	snapshot, err := table.Snapshot(ctx)
+	require.NoError(t, err)
+	require.Len(t, snapshot, workers*100)
+}
+
+func TestShardedHashTableExpiration(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	table, err := NewShardedHashTable(4, WithClock(clock))
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		require.NoError(t, table.SetWithExpiration(ctx, key, "value", clock.Now().Add(time.Duration(i%2+1)*time.Second)))
+	}
+
+	ok, err := table.Persist(ctx, "key0")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = table.Expire(ctx, "key2", clock.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	expiresAt, ok, err := table.Expiration(ctx, "key2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, clock.Now().Add(time.Minute), expiresAt)
+
+	clock.Advance(time.Second)
+
+	deleted, err := table.DeleteExpired(ctx, 100)
+	require.NoError(t, err)
+	require.Equal(t, 8, deleted)
+
+	snapshot, err := table.Snapshot(ctx)
+	require.NoError(t, err)
+	require.Len(t, snapshot, 12)
+}
+
+func TestShardedHashTableScan(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, err := NewShardedHashTable(4)
+	require.NoError(t, err)
+
+	expected := make([]string, 0, 50)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%d", i)
+		require.NoError(t, table.Set(ctx, key, "value"))
+		expected = append(expected, key)
+	}
+
+	var keys []string
+	cursor := uint64(0)
+	for {
+		batch, next, err := table.Scan(ctx, cursor, 8)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(batch), 8)
+		keys = append(keys, batch...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	require.ElementsMatch(t, expected, keys)
+}
+
+func TestShardedHashTableFlush(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, err := NewShardedHashTable(4)
+	require.NoError(t, err)
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, table.Set(ctx, fmt.Sprintf("key%d", i), "value"))
+	}
+	require.NoError(t, table.Flush(ctx))
+
+	keys, _, err := table.Scan(ctx, 0, 100)
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
+
+func TestShardedHashTableMaxMemory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, err := NewShardedHashTable(4, WithMaxMemory(400, AllKeysLRU))
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, table.Set(ctx, fmt.Sprintf("key%02d", i), "value"))
+	}
+
+	info, err := table.Info(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "400", info["max_memory"])
+	require.Equal(t, "allkeys-lru", info["eviction_policy"])
+
+	keys, err := strconv.Atoi(info["keys"])
+	require.NoError(t, err)
+	evicted, err := strconv.Atoi(info["evicted_keys"])
+	require.NoError(t, err)
+	require.LessOrEqual(t, keys, 40)
+	require.Equal(t, 100, keys+evicted)
+}
@@ -0,0 +1,248 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"kv_db/internal/database/storage/engine"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dlock"
+	"kv_db/pkg/dskiplist"
+)
+
+// scoreSize is the memory usage of a score besides its member.
+const scoreSize = 8
+
+// SortedSetAdd adds the members to the sorted set or updates their scores and
+// returns the number of new members. A sorted set is created if the key
+// doesn't exist.
+func (s *HashTable) SortedSetAdd(_ context.Context, key string, members []engine.ScoredMember) (int, error) {
+	var added int
+	var err error
+	dlock.WithLock(&s.mutex, func() {
+		added, err = s.sortedSetAdd(key, members, s.clock.Now())
+	})
+	return added, err
+}
+
+// SortedSetRemove removes the members of the sorted set and returns the
+// number of removed ones. The key is deleted with the last member.
+func (s *HashTable) SortedSetRemove(_ context.Context, key string, members []string) (int, error) {
+	var removed int
+	var err error
+	dlock.WithLock(&s.mutex, func() {
+		now := s.clock.Now()
+		z, ok, lookupErr := lookupAs[*sortedSet](s, key, now)
+		if err = lookupErr; err != nil || !ok {
+			return
+		}
+
+		s.change(key, z, now, func() {
+			for _, member := range members {
+				if z.remove(member) {
+					removed++
+				}
+			}
+		})
+		if len(z.scores) == 0 {
+			s.remove(key)
+		}
+	})
+	return removed, err
+}
+
+// SortedSetRange returns the members between the ranks inclusively in the
+// order of scores. Negative ranks count from the end, so -1 is the member
+// with the highest score.
+func (s *HashTable) SortedSetRange(_ context.Context, key string, start, stop int) ([]engine.ScoredMember, error) {
+	var members []engine.ScoredMember
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		now := s.clock.Now()
+		z, ok, lookupErr := lookupAs[*sortedSet](s, key, now)
+		if err = lookupErr; err != nil || !ok {
+			return
+		}
+		if s.accesses != nil {
+			s.accesses[key].touch(now)
+		}
+
+		length := len(z.scores)
+		if start < 0 {
+			start += length
+		}
+		if stop < 0 {
+			stop += length
+		}
+		start, stop = max(start, 0), min(stop, length-1)
+		if start > stop {
+			return
+		}
+
+		members = make([]engine.ScoredMember, 0, stop-start+1)
+		z.index.AscendAt(start, func(member engine.ScoredMember, _ struct{}) bool {
+			members = append(members, member)
+			return len(members) < cap(members)
+		})
+	})
+	return members, err
+}
+
+// SortedSetRangeByScore returns the members with scores between the bounds
+// inclusively in the order of scores.
+func (s *HashTable) SortedSetRangeByScore(
+	_ context.Context, key string, minScore, maxScore float64,
+) ([]engine.ScoredMember, error) {
+	var members []engine.ScoredMember
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		now := s.clock.Now()
+		z, ok, lookupErr := lookupAs[*sortedSet](s, key, now)
+		if err = lookupErr; err != nil || !ok {
+			return
+		}
+		if s.accesses != nil {
+			s.accesses[key].touch(now)
+		}
+
+		z.index.Ascend(engine.ScoredMember{Score: minScore}, func(member engine.ScoredMember, _ struct{}) bool {
+			if member.Score > maxScore {
+				return false
+			}
+			members = append(members, member)
+			return true
+		})
+	})
+	return members, err
+}
+
+// SortedSetRank returns the zero-based position of the member in the order of
+// scores.
+func (s *HashTable) SortedSetRank(_ context.Context, key, member string) (int, bool, error) {
+	var rank int
+	var ok bool
+	var err error
+	dlock.WithLock(s.mutex.RLocker(), func() {
+		now := s.clock.Now()
+		z, exists, lookupErr := lookupAs[*sortedSet](s, key, now)
+		if err = lookupErr; err != nil || !exists {
+			return
+		}
+		if s.accesses != nil {
+			s.accesses[key].touch(now)
+		}
+
+		score, exists := z.scores[member]
+		if exists {
+			rank, ok = z.index.Rank(engine.ScoredMember{Member: member, Score: score})
+		}
+	})
+	return rank, ok, err
+}
+
+func (s *HashTable) sortedSetAdd(key string, members []engine.ScoredMember, now time.Time) (int, error) {
+	z, ok, err := lookupAs[*sortedSet](s, key, now)
+	if err != nil {
+		return 0, err
+	}
+
+	// The last score of every member is written, so the size is computed
+	// for it.
+	updates := make(map[string]float64, len(members))
+	for _, member := range members {
+		updates[member.Member] = member.Score
+	}
+	size := len(key)
+	if ok {
+		size += z.size()
+	}
+	for member := range updates {
+		if ok {
+			if _, exists := z.scores[member]; exists {
+				continue
+			}
+		}
+		size += len(member) + scoreSize
+	}
+	if err := s.reserve(key, size, now); err != nil {
+		return 0, err
+	}
+
+	if !ok {
+		z = newSortedSet()
+		s.create(key, z, now)
+	}
+
+	added := 0
+	s.change(key, z, now, func() {
+		for member, score := range updates {
+			if z.add(member, score) {
+				added++
+			}
+		}
+	})
+	return added, nil
+}
+
+// sortedSet keeps members ordered by scores and then by members in a skip
+// list, and the scores of members in a map.
+type sortedSet struct {
+	scores map[string]float64
+	index  *dskiplist.SkipList[engine.ScoredMember, struct{}]
+	bytes  int
+}
+
+func newSortedSet() *sortedSet {
+	return &sortedSet{
+		scores: make(map[string]float64),
+		index:  dskiplist.New[engine.ScoredMember, struct{}](lessScoredMember),
+	}
+}
+
+func lessScoredMember(a, b engine.ScoredMember) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	return a.Member < b.Member
+}
+
+func (z *sortedSet) log(key, expiration string) wal.Log {
+	args := make([]string, 0, 2*len(z.scores)+2)
+	args = append(args, key, expiration)
+	z.index.AscendAt(0, func(member engine.ScoredMember, _ struct{}) bool {
+		args = append(args, wal.FormatScore(member.Score), member.Member)
+		return true
+	})
+	return wal.NewLog(0, wal.SortedSetOp, args...)
+}
+
+func (z *sortedSet) size() int {
+	return z.bytes
+}
+
+// add sets the score of the member and returns true if the member is new.
+func (z *sortedSet) add(member string, score float64) bool {
+	oldScore, exists := z.scores[member]
+	if exists {
+		if oldScore == score {
+			return false
+		}
+		z.index.Delete(engine.ScoredMember{Member: member, Score: oldScore})
+	} else {
+		z.bytes += len(member) + scoreSize
+	}
+	z.scores[member] = score
+	z.index.Set(engine.ScoredMember{Member: member, Score: score}, struct{}{})
+	return !exists
+}
+
+func (z *sortedSet) remove(member string) bool {
+	score, ok := z.scores[member]
+	if !ok {
+		return false
+	}
+	delete(z.scores, member)
+	z.index.Delete(engine.ScoredMember{Member: member, Score: score})
+	z.bytes -= len(member) + scoreSize
+	return true
+}
@@ -0,0 +1,145 @@
+package scan
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Batch selects keys for an iteration step. Engines iterate keys in the
+// order of their hashes, and a cursor is the hash to continue from, so an
+// iteration doesn't depend on how keys are stored. Every key that exists
+// during the whole iteration is returned exactly once, and keys that are
+// inserted or deleted concurrently may be returned or not.
+//
+// An engine passes all its keys to Add, which keeps only the keys with the
+// smallest hashes that are not less than the cursor. One more key than
+// requested is kept to find the cursor of the next step. An engine that keeps
+// its keys ordered by HashedKey passes only the keys that follow the cursor
+// until Accepts returns false, so a step costs O(count) instead of the size
+// of the engine.
+type Batch struct {
+	cursor uint64
+	count  int
+	keys   keysHeap
+}
+
+func NewBatch(cursor uint64, count int) *Batch {
+	return &Batch{
+		cursor: cursor,
+		count:  max(count, 1),
+	}
+}
+
+// Cursor returns the hash that the step starts from.
+func (b *Batch) Cursor() uint64 {
+	return b.cursor
+}
+
+func (b *Batch) Add(key string) {
+	b.AddHashed(NewHashedKey(key))
+}
+
+func (b *Batch) AddHashed(key HashedKey) {
+	if !b.Accepts(key.Hash) {
+		return
+	}
+
+	if len(b.keys) <= b.count {
+		heap.Push(&b.keys, key)
+		return
+	}
+
+	b.keys[0] = key
+	heap.Fix(&b.keys, 0)
+}
+
+// Accepts reports whether a key with the hash would be kept, which is never
+// the case for the keys that follow in the order of hashes once it is false.
+func (b *Batch) Accepts(hash uint64) bool {
+	return hash >= b.cursor && (len(b.keys) <= b.count || hash < b.keys[0].Hash)
+}
+
+// Result returns at most count keys and the cursor of the next step, which
+// is zero when the iteration is over. Keys with the largest hash are left for
+// the next step, because keys with the same hash could be dropped from the
+// batch, so the number of keys differs from count only if hashes collide.
+func (b *Batch) Result() ([]string, uint64) {
+	if len(b.keys) <= b.count {
+		return b.collect(math.MaxUint64), 0
+	}
+
+	last := b.keys[0].Hash
+	if last > b.cursor {
+		if keys := b.collect(last - 1); len(keys) != 0 {
+			return keys, last
+		}
+	}
+
+	// All keys of the batch have the same hash, so it is returned whole.
+	if last == math.MaxUint64 {
+		return b.collect(last), 0
+	}
+	return b.collect(last), last + 1
+}
+
+func (b *Batch) collect(maxHash uint64) []string {
+	keys := make([]string, 0, len(b.keys))
+	for _, hashed := range b.keys {
+		if hashed.Hash <= maxHash {
+			keys = append(keys, hashed.Key)
+		}
+	}
+	return keys
+}
+
+// Hash is 64-bit FNV-1a, so collisions are rare and the order is the same
+// after a restart.
+func Hash(key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+
+	hash := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= prime64
+	}
+	return hash
+}
+
+// HashedKey is a key together with its hash. Keys are ordered by hashes and
+// then by themselves, so the order has no ties.
+type HashedKey struct {
+	Hash uint64
+	Key  string
+}
+
+func NewHashedKey(key string) HashedKey {
+	return HashedKey{Hash: Hash(key), Key: key}
+}
+
+func (k HashedKey) Less(other HashedKey) bool {
+	if k.Hash != other.Hash {
+		return k.Hash < other.Hash
+	}
+	return k.Key < other.Key
+}
+
+// keysHeap keeps the key with the largest hash on top.
+type keysHeap []HashedKey
+
+func (h keysHeap) Len() int           { return len(h) }
+func (h keysHeap) Less(i, j int) bool { return h[i].Hash > h[j].Hash }
+func (h keysHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *keysHeap) Push(x any) {
+	*h = append(*h, x.(HashedKey))
+}
+
+func (h *keysHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
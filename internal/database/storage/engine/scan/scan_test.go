@@ -0,0 +1,75 @@
+package scan
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+
+	keys := make(map[string]struct{})
+	for i := 0; i < 1000; i++ {
+		keys["key"+strconv.Itoa(i)] = struct{}{}
+	}
+
+	step := func(cursor uint64) ([]string, uint64) {
+		batch := NewBatch(cursor, 7)
+		for key := range keys {
+			batch.Add(key)
+		}
+		return batch.Result()
+	}
+
+	// Keys that are deleted or inserted during the iteration may be returned
+	// or not, all other keys are returned exactly once.
+	stable := make(map[string]struct{}, len(keys))
+	for key := range keys {
+		stable[key] = struct{}{}
+	}
+
+	returned := make(map[string]int)
+	cursor, steps := uint64(0), 0
+	for {
+		batch, next := step(cursor)
+		require.LessOrEqual(t, len(batch), 7)
+		for _, key := range batch {
+			returned[key]++
+		}
+
+		delete(keys, "key"+strconv.Itoa(steps))
+		delete(stable, "key"+strconv.Itoa(steps))
+		keys["new"+strconv.Itoa(steps)] = struct{}{}
+
+		steps++
+		if next == 0 {
+			break
+		}
+		require.Greater(t, next, cursor)
+		cursor = next
+	}
+
+	for key := range stable {
+		require.Equal(t, 1, returned[key], key)
+	}
+	for key, count := range returned {
+		require.Equal(t, 1, count, key)
+	}
+}
+
+func TestBatchWithoutKeys(t *testing.T) {
+	t.Parallel()
+
+	keys, cursor := NewBatch(0, 10).Result()
+	require.Empty(t, keys)
+	require.Zero(t, cursor)
+}
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, uint64(14695981039346656037), Hash(""))
+	require.Equal(t, uint64(0xaf63dc4c8601ec8c), Hash("a"))
+}
@@ -0,0 +1,84 @@
+package storage
+
+import "kv_db/internal/database/storage/wal"
+
+// EventOp is the kind of a change of a key.
+type EventOp string
+
+const (
+	SetEvent EventOp = "set"
+	DelEvent EventOp = "del"
+	// UpdateEvent is a change of a collection, which is deleted with its
+	// last element. Its value is empty.
+	UpdateEvent EventOp = "update"
+	// ExpiredEvent and EvictedEvent are deletions of keys by the engine,
+	// which happen when the sweeper reaches an expired key or a write needs
+	// memory.
+	ExpiredEvent EventOp = "expired"
+	EvictedEvent EventOp = "evicted"
+	// FlushEvent is the deletion of all keys. Its key is empty.
+	FlushEvent EventOp = "flush"
+)
+
+// Event is a change of a key. The value is the new value of a SetEvent and
+// empty otherwise.
+type Event struct {
+	Op    EventOp
+	Key   string
+	Value string
+}
+
+// Events receives the changes of a storage. The changes of a key come in the
+// order they are applied to the engine, and changes of different keys can
+// come concurrently. Notify is called while the writers of the key are
+// blocked, so it must not wait.
+type Events interface {
+	Notify(Event)
+}
+
+// RemovalEvent returns the event of a key that the engine has deleted by
+// itself.
+func RemovalEvent(key string, evicted bool) Event {
+	if evicted {
+		return Event{Op: EvictedEvent, Key: key}
+	}
+	return Event{Op: ExpiredEvent, Key: key}
+}
+
+// notify reports the changes of the log.
+func (s *Storage) notify(log wal.Log) {
+	if s.events == nil {
+		return
+	}
+
+	switch log.Op {
+	case wal.SetOp:
+		if len(log.Args) >= 2 {
+			s.events.Notify(Event{Op: SetEvent, Key: log.Args[0], Value: log.Args[1]})
+		}
+	case wal.DelOp:
+		if len(log.Args) == 1 {
+			s.events.Notify(Event{Op: DelEvent, Key: log.Args[0]})
+		}
+	case wal.BatchOp:
+		batch, err := parseBatchLog(log)
+		if err != nil {
+			return
+		}
+		for _, w := range batch.Writes() {
+			if w.Deleted {
+				s.events.Notify(Event{Op: DelEvent, Key: w.Key})
+			} else {
+				s.events.Notify(Event{Op: SetEvent, Key: w.Key, Value: w.Value})
+			}
+		}
+	case wal.LPushOp, wal.RPushOp, wal.LPopOp, wal.RPopOp, wal.ListOp, wal.HSetOp, wal.HDelOp, wal.HashOp,
+		wal.SAddOp, wal.SRemOp, wal.MembersOp, wal.ZAddOp, wal.ZRemOp, wal.SortedSetOp:
+		if len(log.Args) != 0 {
+			s.events.Notify(Event{Op: UpdateEvent, Key: log.Args[0]})
+		}
+	case wal.FlushOp:
+		s.events.Notify(Event{Op: FlushEvent})
+	case wal.GuardOp, wal.UnknownOp:
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
+	"kv_db/pkg/dlog"
+)
+
+type recordedEvents []Event
+
+func (e *recordedEvents) Notify(event Event) {
+	*e = append(*e, event)
+}
+
+func TestStorage_Events(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(100, 0))
+	engine := getMockBatchEngine(t)
+	events := &recordedEvents{}
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithClock(clock), WithEvents(events))
+	require.NoError(t, err)
+
+	engine.MockEngine.EXPECT().Set(ctx, "key1", "value1").Return(nil)
+	engine.MockEngine.EXPECT().Set(ctx, "key2", "value2").Return(errors.New("test error"))
+	engine.MockEngine.EXPECT().SetWithExpiration(ctx, "key3", "value3", time.Unix(110, 0)).Return(nil)
+	engine.MockEngine.EXPECT().Get(ctx, "key1").Return("value1", true, nil)
+	engine.MockEngine.EXPECT().Delete(ctx, "key1").Return(nil)
+	engine.MockBatchEngine.EXPECT().Apply(ctx, gomock.Any()).Return(nil)
+
+	require.NoError(t, storage.Set(ctx, "key1", "value1"))
+	require.Error(t, storage.Set(ctx, "key2", "value2"))
+	require.NoError(t, storage.SetWithTTL(ctx, "key3", "value3", 10*time.Second))
+	ok, err := storage.SetIf(ctx, "key1", "value4", 0, IfNotExists)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, storage.Delete(ctx, "key1"))
+
+	tx := NewTransaction()
+	tx.Set("key4", "value4")
+	tx.Delete("key3")
+	require.NoError(t, storage.Commit(ctx, tx))
+
+	require.Equal(t, recordedEvents{
+		{Op: SetEvent, Key: "key1", Value: "value1"},
+		{Op: SetEvent, Key: "key3", Value: "value3"},
+		{Op: DelEvent, Key: "key1"},
+		{Op: SetEvent, Key: "key4", Value: "value4"},
+		{Op: DelEvent, Key: "key3"},
+	}, *events)
+}
+
+func TestStorage_CollectionEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine := getMockListEngine(t)
+	events := &recordedEvents{}
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithEvents(events))
+	require.NoError(t, err)
+
+	engine.EXPECT().ListLen(ctx, "list").Return(0, nil)
+	engine.EXPECT().Expiration(ctx, "list").Return(time.Time{}, false, nil)
+	engine.EXPECT().Push(ctx, "list", true, []string{"a", "b"}).Return(2, nil)
+	engine.EXPECT().Persist(ctx, "list").Return(false, nil)
+	engine.EXPECT().ListRange(ctx, "list", -1, -1).Return([]string{"a"}, nil)
+	engine.EXPECT().Pop(ctx, "list", false).Return("a", true, nil)
+	engine.EXPECT().ListRange(ctx, "list", -1, -1).Return(nil, nil)
+
+	_, err = storage.Push(ctx, "list", true, "a", "b")
+	require.NoError(t, err)
+	_, _, err = storage.Pop(ctx, "list", false)
+	require.NoError(t, err)
+	_, _, err = storage.Pop(ctx, "list", false)
+	require.NoError(t, err)
+
+	require.Equal(t, recordedEvents{
+		{Op: UpdateEvent, Key: "list"},
+		{Op: UpdateEvent, Key: "list"},
+	}, *events)
+}
+
+func TestStorage_AppliedChangesEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	engine := &mockFlushEngine{MockEngine: NewMockEngine(ctrl), MockFlushEngine: NewMockFlushEngine(ctrl)}
+	events := &recordedEvents{}
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithReadOnly(), WithEvents(events))
+	require.NoError(t, err)
+
+	engine.MockFlushEngine.EXPECT().Flush(ctx).Return(nil)
+	engine.MockEngine.EXPECT().Set(ctx, "key1", "value").Return(nil)
+	engine.MockEngine.EXPECT().Delete(ctx, "key2").Return(nil)
+
+	require.NoError(t, storage.ApplyChanges(ctx, Changes{
+		Snapshot: true,
+		Logs:     []wal.Log{wal.NewLog(0, wal.SetOp, "key1", "value"), wal.NewLog(0, wal.DelOp, "key2")},
+	}))
+
+	require.Equal(t, recordedEvents{
+		{Op: FlushEvent},
+		{Op: SetEvent, Key: "key1", Value: "value"},
+		{Op: DelEvent, Key: "key2"},
+	}, *events)
+	require.Equal(t, Event{Op: EvictedEvent, Key: "key"}, RemovalEvent("key", true))
+	require.Equal(t, Event{Op: ExpiredEvent, Key: "key"}, RemovalEvent("key", false))
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+
+	"kv_db/internal/database/storage/wal"
+)
+
+// errGuardUnknown is returned when the consensus has applied a guarded log
+// without ApplyChanges, by a snapshot that replaces the log, so the storage
+// doesn't know whether the log has been applied.
+var errGuardUnknown = errors.New("outcome of the write is unknown")
+
+// guards keep the outcomes of the guarded logs that the storage proposes by
+// their IDs.
+type guards struct {
+	mutex sync.Mutex
+	// outcomes are nil until the logs are applied.
+	outcomes map[string]*bool
+}
+
+func (g *guards) add() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(random)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.outcomes == nil {
+		g.outcomes = make(map[string]*bool)
+	}
+	g.outcomes[id] = nil
+	return id, nil
+}
+
+// resolve keeps the outcome of the log with the ID if the storage has
+// proposed it.
+func (g *guards) resolve(id string, applied bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, ok := g.outcomes[id]; ok {
+		g.outcomes[id] = &applied
+	}
+}
+
+// take removes the log with the ID and returns its outcome if it is known.
+func (g *guards) take(id string) (bool, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	outcome := g.outcomes[id]
+	delete(g.outcomes, id)
+	if outcome == nil {
+		return false, false
+	}
+	return *outcome, true
+}
+
+// planGuarded runs the plan and returns its log together with the keys
+// followed by their states, which no committed log changes in between.
+func (s *Storage) planGuarded(
+	ctx context.Context, keys []string, plan func() (*wal.Log, error),
+) (*wal.Log, []string, error) {
+	s.applyMutex.RLock()
+	defer s.applyMutex.RUnlock()
+
+	log, err := plan()
+	if err != nil || log == nil {
+		return nil, nil, err
+	}
+
+	states := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		state, err := s.keyState(ctx, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		states = append(states, key, state)
+	}
+	return log, states, nil
+}
+
+// proposeGuarded proposes the log guarded by the states of its keys and
+// returns whether it has been applied.
+func (s *Storage) proposeGuarded(ctx context.Context, log wal.Log, states []string) (bool, error) {
+	id, err := s.guards.add()
+	if err != nil {
+		return false, err
+	}
+
+	err = s.consensus.Propose(ctx, wal.NewGuardLog(0, id, log, states))
+	applied, ok := s.guards.take(id)
+	switch {
+	case err != nil:
+		return false, err
+	case !ok:
+		return false, errGuardUnknown
+	}
+	return applied, nil
+}
+
+// applyGuardLog applies the log of a GuardOp log if its keys have the states
+// and returns the applied log.
+func (s *Storage) applyGuardLog(ctx context.Context, guard wal.Log) (wal.Log, bool, error) {
+	id, log, states, err := guard.GuardedLog()
+	if err != nil {
+		return wal.Log{}, false, err
+	}
+
+	applied := true
+	for idx := 0; idx < len(states) && applied; idx += 2 {
+		state, err := s.keyState(ctx, states[idx])
+		if err != nil {
+			return wal.Log{}, false, err
+		}
+		applied = state == states[idx+1]
+	}
+	if applied {
+		if err := s.applyLog(ctx, log); err != nil {
+			return wal.Log{}, false, err
+		}
+	}
+
+	s.guards.resolve(id, applied)
+	return log, applied, nil
+}
+
+// keyState returns the hash of the value of the key together with its
+// expiration time, which is empty if the key doesn't exist. The hash is the
+// same on every node that has the same data, so the state of a collection is
+// hashed with its elements in order, and a write of a large collection is
+// as expensive as its dump.
+func (s *Storage) keyState(ctx context.Context, key string) (string, error) {
+	value, ok, err := s.engine.Get(ctx, key)
+	if errors.Is(err, ErrWrongType) {
+		var log *wal.Log
+		if log, err = s.dumpLog(ctx, key); err == nil {
+			return hashLog(orderedDump(*log)), nil
+		}
+	}
+	if err != nil || !ok {
+		return "", err
+	}
+
+	log, err := s.valueLog(ctx, key, value)
+	if err != nil {
+		return "", err
+	}
+	return hashLog(*log), nil
+}
+
+// orderedDump sorts the fields of a hash and the members of a set, which
+// are dumped in no particular order.
+func orderedDump(log wal.Log) wal.Log {
+	if len(log.Args) < 2 {
+		return log
+	}
+
+	args := append([]string(nil), log.Args...)
+	elements := args[2:]
+	if log.Op == wal.HashOp {
+		pairs := make([][2]string, 0, len(elements)/2)
+		for idx := 0; idx+1 < len(elements); idx += 2 {
+			pairs = append(pairs, [2]string{elements[idx], elements[idx+1]})
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			return pairs[i][0] < pairs[j][0]
+		})
+		for idx, pair := range pairs {
+			elements[2*idx], elements[2*idx+1] = pair[0], pair[1]
+		}
+	}
+	if log.Op == wal.MembersOp {
+		sort.Strings(elements)
+	}
+	return wal.NewLog(0, log.Op, args...)
+}
+
+func hashLog(log wal.Log) string {
+	hash := fnv.New64a()
+	_, _ = hash.Write(log.AppendTo(nil))
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"kv_db/internal/database/storage/wal"
+)
+
+// HashSet sets the fields of the hash to the values, which follow them in
+// pairs, and returns the number of new fields. A hash is created if the key
+// doesn't exist.
+func (s *Storage) HashSet(ctx context.Context, key string, pairs ...string) (int, error) {
+	engine, err := s.hashEngine()
+	if err != nil {
+		return 0, err
+	}
+
+	var added int
+	_, err = s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		fields := make([]string, 0, len(pairs)/2)
+		for idx := 0; idx < len(pairs); idx += 2 {
+			fields = append(fields, pairs[idx])
+		}
+
+		var err error
+		if added, err = countMissing(fields, func(field string) (bool, error) {
+			_, ok, err := engine.HashGet(ctx, key, field)
+			return ok, err
+		}); err != nil {
+			return nil, err
+		}
+
+		expiration, err := s.expirationArg(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return newLog(wal.HSetOp, append([]string{key, expiration}, pairs...)...), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+func (s *Storage) HashGet(ctx context.Context, key, field string) (string, bool, error) {
+	engine, err := s.hashEngine()
+	if err != nil {
+		return "", false, err
+	}
+	return engine.HashGet(ctx, key, field)
+}
+
+// HashDelete deletes the fields of the hash and returns the number of deleted
+// ones.
+func (s *Storage) HashDelete(ctx context.Context, key string, fields ...string) (int, error) {
+	engine, err := s.hashEngine()
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int
+	_, err = s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		missing, err := countMissing(fields, func(field string) (bool, error) {
+			_, ok, err := engine.HashGet(ctx, key, field)
+			return ok, err
+		})
+		if deleted = countUnique(fields) - missing; err != nil || deleted == 0 {
+			return nil, err
+		}
+		return newLog(wal.HDelOp, append([]string{key}, fields...)...), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// HashGetAll returns the fields of the hash with their values, which are
+// empty if the key doesn't exist.
+func (s *Storage) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	engine, err := s.hashEngine()
+	if err != nil {
+		return nil, err
+	}
+	return engine.HashGetAll(ctx, key)
+}
+
+// HashLen returns the number of fields of the hash.
+func (s *Storage) HashLen(ctx context.Context, key string) (int, error) {
+	engine, err := s.hashEngine()
+	if err != nil {
+		return 0, err
+	}
+	return engine.HashLen(ctx, key)
+}
+
+func (s *Storage) hashEngine() (HashEngine, error) {
+	engine, ok := s.engine.(HashEngine)
+	if !ok {
+		return nil, fmt.Errorf("%w: hashes", ErrUnsupportedType)
+	}
+	return engine, nil
+}
+
+// applyHashSetLog replays HSetOp and HashOp logs: it sets the fields and the
+// logged expiration time of the hash.
+func (s *Storage) applyHashSetLog(ctx context.Context, log wal.Log) error {
+	if len(log.Args) < 4 || len(log.Args)%2 != 0 {
+		return wal.ErrCorruptedLog
+	}
+
+	engine, err := s.hashEngine()
+	if err != nil {
+		return err
+	}
+
+	key := log.Args[0]
+	if log.Op == wal.HashOp {
+		if err := s.engine.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	if _, err := engine.HashSet(ctx, key, log.Args[2:]); err != nil {
+		return err
+	}
+	return s.restoreExpiration(ctx, key, log.Args[1])
+}
+
+func (s *Storage) applyHashDeleteLog(ctx context.Context, log wal.Log) error {
+	if len(log.Args) < 2 {
+		return wal.ErrCorruptedLog
+	}
+
+	engine, err := s.hashEngine()
+	if err != nil {
+		return err
+	}
+	_, err = engine.HashDelete(ctx, log.Args[0], log.Args[1:])
+	return err
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dfuture"
+	"kv_db/pkg/dlog"
+)
+
+func TestStorage_HashSet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	expiresAt := time.Unix(110, 0)
+
+	t.Run("unsupported engine", func(t *testing.T) {
+		storage, err := NewStorage(getMockEngine(t), dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		_, err = storage.HashSet(ctx, "key", "field", "value")
+		require.Error(t, err)
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		engine := getMockHashEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+		engine.EXPECT().HashGet(ctx, "key", "field").Return("", false, ErrWrongType)
+
+		_, err = storage.HashSet(ctx, "key", "field", "value")
+		require.ErrorIs(t, err, ErrWrongType)
+	})
+
+	t.Run("success with wal", func(t *testing.T) {
+		engine, journal := getMockHashEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+		require.NoError(t, err)
+
+		gomock.InOrder(
+			engine.EXPECT().HashGet(ctx, "key", "f1").Return("v0", true, nil),
+			engine.EXPECT().HashGet(ctx, "key", "f2").Return("", false, nil),
+			engine.EXPECT().Expiration(ctx, "key").Return(expiresAt, true, nil),
+			journal.EXPECT().
+				Append(ctx, wal.HSetOp, "key", wal.FormatExpiration(expiresAt), "f1", "v1", "f2", "v2").
+				Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().HashSet(ctx, "key", []string{"f1", "v1", "f2", "v2"}).Return(1, nil),
+			engine.EXPECT().Expire(ctx, "key", expiresAt).Return(true, nil),
+		)
+
+		added, err := storage.HashSet(ctx, "key", "f1", "v1", "f2", "v2")
+		require.NoError(t, err)
+		require.Equal(t, 1, added)
+	})
+}
+
+func TestStorage_HashDelete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine, journal := getMockHashEngine(t), getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.NoError(t, err)
+
+	gomock.InOrder(
+		engine.EXPECT().HashGet(ctx, "key", "f1").Return("v1", true, nil),
+		engine.EXPECT().HashGet(ctx, "key", "f2").Return("", false, nil),
+		journal.EXPECT().Append(ctx, wal.HDelOp, "key", "f1", "f2").Return(dfuture.NewResolvedFuture[error](nil)),
+		engine.EXPECT().HashDelete(ctx, "key", []string{"f1", "f2"}).Return(1, nil),
+		engine.EXPECT().HashGet(ctx, "key", "f3").Return("", false, nil),
+	)
+
+	deleted, err := storage.HashDelete(ctx, "key", "f1", "f2")
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	deleted, err = storage.HashDelete(ctx, "key", "f3")
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+}
+
+func TestStorage_HashReads(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine := getMockHashEngine(t)
+	storage, err := NewStorage(engine, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	engine.EXPECT().HashGet(ctx, "key", "field").Return("value", true, nil)
+	engine.EXPECT().HashGetAll(ctx, "key").Return(map[string]string{"field": "value"}, nil)
+	engine.EXPECT().HashLen(ctx, "key").Return(1, nil)
+
+	value, ok, err := storage.HashGet(ctx, "key", "field")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value", value)
+
+	fields, err := storage.HashGetAll(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"field": "value"}, fields)
+
+	length, err := storage.HashLen(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, 1, length)
+}
+
+func TestStorage_RecoverHashes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	expiresAt := time.Unix(110, 0)
+	engine, journal := getMockHashEngine(t), getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{
+		wal.NewLog(1, wal.HSetOp, "key", "", "f1", "v1", "f2", "v2"),
+		wal.NewLog(2, wal.HDelOp, "key", "f1"),
+		wal.NewLog(3, wal.HashOp, "key", wal.FormatExpiration(expiresAt), "f3", "v3"),
+	}, nil)
+
+	gomock.InOrder(
+		engine.EXPECT().HashSet(ctx, "key", []string{"f1", "v1", "f2", "v2"}).Return(2, nil),
+		engine.EXPECT().Persist(ctx, "key").Return(false, nil),
+		engine.EXPECT().HashDelete(ctx, "key", []string{"f1"}).Return(1, nil),
+		engine.EXPECT().Delete(ctx, "key").Return(nil),
+		engine.EXPECT().HashSet(ctx, "key", []string{"f3", "v3"}).Return(1, nil),
+		engine.EXPECT().Expire(ctx, "key", expiresAt).Return(true, nil),
+	)
+
+	_, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.NoError(t, err)
+
+	journal = getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{wal.NewLog(1, wal.HSetOp, "key", "", "field")}, nil)
+	_, err = NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.ErrorIs(t, err, wal.ErrCorruptedLog)
+}
+
+type mockHashEngine struct {
+	*MockEngine
+	*MockHashEngine
+}
+
+func getMockHashEngine(t *testing.T) *mockHashEngine {
+	t.Helper()
+
+	ctrl := gomock.NewController(t)
+	return &mockHashEngine{
+		MockEngine:     NewMockEngine(ctrl),
+		MockHashEngine: NewMockHashEngine(ctrl),
+	}
+}
+
+func (e *mockHashEngine) EXPECT() *mockHashEngineRecorder {
+	return &mockHashEngineRecorder{
+		MockEngineMockRecorder:     e.MockEngine.EXPECT(),
+		MockHashEngineMockRecorder: e.MockHashEngine.EXPECT(),
+	}
+}
+
+type mockHashEngineRecorder struct {
+	*MockEngineMockRecorder
+	*MockHashEngineMockRecorder
+}
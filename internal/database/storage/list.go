@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"kv_db/internal/database/storage/wal"
+)
+
+// Push pushes the values to the left or the right end of the list and
+// returns its length. A list is created if the key doesn't exist.
+func (s *Storage) Push(ctx context.Context, key string, left bool, values ...string) (int, error) {
+	engine, err := s.listEngine()
+	if err != nil {
+		return 0, err
+	}
+
+	var length int
+	_, err = s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		var err error
+		if length, err = engine.ListLen(ctx, key); err != nil {
+			return nil, err
+		}
+		length += len(values)
+
+		expiration, err := s.expirationArg(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		op := wal.RPushOp
+		if left {
+			op = wal.LPushOp
+		}
+		return newLog(op, append([]string{key, expiration}, values...)...), nil
+	})
+
+	// A wake-up after a failed push only makes the waiting pops try again.
+	s.listSignals.notify(key)
+	if err != nil {
+		return 0, err
+	}
+	return length, nil
+}
+
+// Pop removes and returns the value at the left or the right end of the list.
+func (s *Storage) Pop(ctx context.Context, key string, left bool) (string, bool, error) {
+	engine, err := s.listEngine()
+	if err != nil {
+		return "", false, err
+	}
+
+	var value string
+	var ok bool
+	_, err = s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		idx, op := -1, wal.RPopOp
+		if left {
+			idx, op = 0, wal.LPopOp
+		}
+		values, err := engine.ListRange(ctx, key, idx, idx)
+		if err != nil || len(values) == 0 {
+			return nil, err
+		}
+
+		value, ok = values[0], true
+		return newLog(op, key), nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return value, ok, nil
+}
+
+// BlockingPop pops a value like Pop, but if the list is empty, it waits for a
+// push for at most the timeout, which is zero to wait without a limit. It
+// returns false if the timeout is over. All pops waiting for the key are
+// woken up by a push, so the first one gets the value and the others keep
+// waiting.
+func (s *Storage) BlockingPop(
+	ctx context.Context, key string, left bool, timeout time.Duration,
+) (string, bool, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		// The wait starts before the pop, so a push between them isn't missed.
+		ready, stop := s.listSignals.wait(key)
+		value, ok, err := s.Pop(ctx, key, left)
+		if err != nil || ok {
+			stop()
+			return value, ok, err
+		}
+
+		select {
+		case <-ready:
+			stop()
+		case <-expired:
+			stop()
+			return "", false, nil
+		case <-ctx.Done():
+			stop()
+			return "", false, ctx.Err()
+		}
+	}
+}
+
+// ListRange returns the values of the list between the indexes inclusively.
+// Negative indexes count from the right end, so -1 is the last value.
+func (s *Storage) ListRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	engine, err := s.listEngine()
+	if err != nil {
+		return nil, err
+	}
+	return engine.ListRange(ctx, key, start, stop)
+}
+
+// ListLen returns the length of the list, which is zero if the key doesn't
+// exist.
+func (s *Storage) ListLen(ctx context.Context, key string) (int, error) {
+	engine, err := s.listEngine()
+	if err != nil {
+		return 0, err
+	}
+	return engine.ListLen(ctx, key)
+}
+
+func (s *Storage) listEngine() (ListEngine, error) {
+	engine, ok := s.engine.(ListEngine)
+	if !ok {
+		return nil, fmt.Errorf("%w: lists", ErrUnsupportedType)
+	}
+	return engine, nil
+}
+
+// applyListLog replays LPushOp, RPushOp and ListOp logs: it pushes the values
+// and sets the logged expiration time of the list.
+func (s *Storage) applyListLog(ctx context.Context, log wal.Log) error {
+	if len(log.Args) < 3 {
+		return wal.ErrCorruptedLog
+	}
+
+	engine, err := s.listEngine()
+	if err != nil {
+		return err
+	}
+
+	key := log.Args[0]
+	if log.Op == wal.ListOp {
+		if err := s.engine.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	if _, err := engine.Push(ctx, key, log.Op == wal.LPushOp, log.Args[2:]); err != nil {
+		return err
+	}
+	return s.restoreExpiration(ctx, key, log.Args[1])
+}
+
+func (s *Storage) applyPopLog(ctx context.Context, log wal.Log) error {
+	if len(log.Args) != 1 {
+		return wal.ErrCorruptedLog
+	}
+
+	engine, err := s.listEngine()
+	if err != nil {
+		return err
+	}
+	_, _, err = engine.Pop(ctx, log.Args[0], log.Op == wal.LPopOp)
+	return err
+}
+
+// notifyPush wakes up the blocking pops of the list that the log pushes to.
+func (s *Storage) notifyPush(log wal.Log) {
+	if (log.Op == wal.LPushOp || log.Op == wal.RPushOp || log.Op == wal.ListOp) && len(log.Args) != 0 {
+		s.listSignals.notify(log.Args[0])
+	}
+}
+
+// listSignals wakes up blocking pops when values are pushed to their keys.
+// The zero value is ready to use.
+type listSignals struct {
+	mutex   sync.Mutex
+	signals map[string]*listSignal
+}
+
+type listSignal struct {
+	ready   chan struct{}
+	waiters int
+}
+
+// wait returns a channel that is closed by the next push to the key and a
+// function that has to be called when the wait is over.
+func (l *listSignals) wait(key string) (<-chan struct{}, func()) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.signals == nil {
+		l.signals = make(map[string]*listSignal)
+	}
+	signal, ok := l.signals[key]
+	if !ok {
+		signal = &listSignal{ready: make(chan struct{})}
+		l.signals[key] = signal
+	}
+	signal.waiters++
+
+	return signal.ready, func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		signal.waiters--
+		if signal.waiters == 0 && l.signals[key] == signal {
+			delete(l.signals, key)
+		}
+	}
+}
+
+func (l *listSignals) notify(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if signal, ok := l.signals[key]; ok {
+		close(signal.ready)
+		delete(l.signals, key)
+	}
+}
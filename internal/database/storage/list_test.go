@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dfuture"
+	"kv_db/pkg/dlog"
+)
+
+func TestStorage_Push(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	expiresAt := time.Unix(110, 0)
+
+	t.Run("unsupported engine", func(t *testing.T) {
+		storage, err := NewStorage(getMockEngine(t), dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		_, err = storage.Push(ctx, "key", true, "value")
+		require.Error(t, err)
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		engine := getMockListEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+		engine.EXPECT().ListLen(ctx, "key").Return(0, ErrWrongType)
+
+		_, err = storage.Push(ctx, "key", true, "value")
+		require.ErrorIs(t, err, ErrWrongType)
+	})
+
+	testcases := map[string]struct {
+		left      bool
+		expiresAt time.Time
+		expLog    wal.Log
+	}{
+		"left push": {
+			left:   true,
+			expLog: wal.NewLog(0, wal.LPushOp, "key", "", "a", "b"),
+		},
+		"right push to expiring list": {
+			expiresAt: expiresAt,
+			expLog:    wal.NewLog(0, wal.RPushOp, "key", wal.FormatExpiration(expiresAt), "a", "b"),
+		},
+	}
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			engine, journal := getMockListEngine(t), getMockWAL(t)
+			journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+			storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+			require.NoError(t, err)
+
+			gomock.InOrder(
+				engine.EXPECT().ListLen(ctx, "key").Return(1, nil),
+				engine.EXPECT().Expiration(ctx, "key").Return(tc.expiresAt, true, nil),
+				journal.EXPECT().Append(ctx, tc.expLog.Op, tc.expLog.Args).
+					Return(dfuture.NewResolvedFuture[error](nil)),
+				engine.EXPECT().Push(ctx, "key", tc.left, []string{"a", "b"}).Return(3, nil),
+			)
+			if tc.expiresAt.IsZero() {
+				engine.EXPECT().Persist(ctx, "key").Return(false, nil)
+			} else {
+				engine.EXPECT().Expire(ctx, "key", tc.expiresAt).Return(true, nil)
+			}
+
+			length, err := storage.Push(ctx, "key", tc.left, "a", "b")
+			require.NoError(t, err)
+			require.Equal(t, 3, length)
+		})
+	}
+}
+
+func TestStorage_Pop(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine, journal := getMockListEngine(t), getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.NoError(t, err)
+
+	gomock.InOrder(
+		engine.EXPECT().ListRange(ctx, "key", -1, -1).Return([]string{"value"}, nil),
+		journal.EXPECT().Append(ctx, wal.RPopOp, "key").Return(dfuture.NewResolvedFuture[error](nil)),
+		engine.EXPECT().Pop(ctx, "key", false).Return("value", true, nil),
+		engine.EXPECT().ListRange(ctx, "key", 0, 0).Return(nil, nil),
+	)
+
+	value, ok, err := storage.Pop(ctx, "key", false)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value", value)
+
+	_, ok, err = storage.Pop(ctx, "key", true)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestStorage_BlockingPop(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("woken up by push", func(t *testing.T) {
+		engine := getMockListEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		waiting := make(chan struct{})
+		gomock.InOrder(
+			engine.EXPECT().ListRange(ctx, "key", 0, 0).DoAndReturn(func(context.Context, string, int, int) ([]string, error) {
+				close(waiting)
+				return nil, nil
+			}),
+			engine.EXPECT().ListLen(ctx, "key").Return(0, nil),
+			engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, false, nil),
+			engine.EXPECT().Push(ctx, "key", false, []string{"value"}).Return(1, nil),
+			engine.EXPECT().Persist(ctx, "key").Return(false, nil),
+			engine.EXPECT().ListRange(ctx, "key", 0, 0).Return([]string{"value"}, nil),
+			engine.EXPECT().Pop(ctx, "key", true).Return("value", true, nil),
+		)
+
+		type result struct {
+			value string
+			ok    bool
+			err   error
+		}
+		results := make(chan result)
+		go func() {
+			value, ok, err := storage.BlockingPop(ctx, "key", true, 0)
+			results <- result{value: value, ok: ok, err: err}
+		}()
+
+		<-waiting
+		_, err = storage.Push(ctx, "key", false, "value")
+		require.NoError(t, err)
+
+		popped := <-results
+		require.NoError(t, popped.err)
+		require.True(t, popped.ok)
+		require.Equal(t, "value", popped.value)
+		require.Empty(t, storage.listSignals.signals)
+	})
+
+	t.Run("woken up by applied push", func(t *testing.T) {
+		engine := getMockListEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		waiting := make(chan struct{})
+		gomock.InOrder(
+			engine.EXPECT().ListRange(ctx, "key", 0, 0).DoAndReturn(func(context.Context, string, int, int) ([]string, error) {
+				close(waiting)
+				return nil, nil
+			}),
+			engine.EXPECT().Push(ctx, "key", false, []string{"value"}).Return(1, nil),
+			engine.EXPECT().Persist(ctx, "key").Return(false, nil),
+			engine.EXPECT().ListRange(ctx, "key", 0, 0).Return([]string{"value"}, nil),
+			engine.EXPECT().Pop(ctx, "key", true).Return("value", true, nil),
+		)
+
+		popped := make(chan string)
+		go func() {
+			value, _, _ := storage.BlockingPop(ctx, "key", true, 0)
+			popped <- value
+		}()
+
+		<-waiting
+		require.NoError(t, storage.ApplyChanges(ctx, Changes{
+			Logs: []wal.Log{wal.NewLog(0, wal.RPushOp, "key", "", "value")},
+		}))
+		require.Equal(t, "value", <-popped)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		engine := getMockListEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+		engine.EXPECT().ListRange(ctx, "key", 0, 0).Return(nil, nil)
+
+		_, ok, err := storage.BlockingPop(ctx, "key", true, 10*time.Millisecond)
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.Empty(t, storage.listSignals.signals)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		engine := getMockListEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(ctx)
+		engine.EXPECT().ListRange(ctx, "key", 0, 0).DoAndReturn(func(context.Context, string, int, int) ([]string, error) {
+			cancel()
+			return nil, nil
+		})
+
+		_, _, err = storage.BlockingPop(ctx, "key", true, 0)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		engine := getMockListEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+		expErr := errors.New("test error")
+		engine.EXPECT().ListRange(ctx, "key", 0, 0).Return(nil, expErr)
+
+		_, _, err = storage.BlockingPop(ctx, "key", true, 0)
+		require.ErrorIs(t, err, expErr)
+	})
+}
+
+func TestStorage_ListExpiration(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine, journal := getMockListEngine(t), getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.NoError(t, err)
+
+	expiresAt := time.Unix(110, 0)
+	dump := wal.NewLog(0, wal.ListOp, "key", wal.FormatExpiration(expiresAt), "a", "b")
+	gomock.InOrder(
+		engine.EXPECT().Expiration(ctx, "key").Return(expiresAt, true, nil),
+		engine.EXPECT().Get(ctx, "key").Return("", false, ErrWrongType),
+		engine.EXPECT().Dump(ctx, "key").Return(dump, true, nil),
+		journal.EXPECT().Append(ctx, wal.ListOp, []string{"key", "", "a", "b"}).
+			Return(dfuture.NewResolvedFuture[error](nil)),
+		engine.EXPECT().Delete(ctx, "key").Return(nil),
+		engine.EXPECT().Push(ctx, "key", false, []string{"a", "b"}).Return(2, nil),
+		engine.EXPECT().Persist(ctx, "key").Return(true, nil),
+	)
+
+	ok, err := storage.Persist(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestStorage_RecoverLists(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	expiresAt := time.Unix(110, 0)
+	engine, journal := getMockListEngine(t), getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{
+		wal.NewLog(1, wal.RPushOp, "key", "", "a", "b"),
+		wal.NewLog(2, wal.LPopOp, "key"),
+		wal.NewLog(3, wal.ListOp, "key", wal.FormatExpiration(expiresAt), "c"),
+	}, nil)
+
+	gomock.InOrder(
+		engine.EXPECT().Push(ctx, "key", false, []string{"a", "b"}).Return(2, nil),
+		engine.EXPECT().Persist(ctx, "key").Return(false, nil),
+		engine.EXPECT().Pop(ctx, "key", true).Return("a", true, nil),
+		engine.EXPECT().Delete(ctx, "key").Return(nil),
+		engine.EXPECT().Push(ctx, "key", false, []string{"c"}).Return(1, nil),
+		engine.EXPECT().Expire(ctx, "key", expiresAt).Return(true, nil),
+	)
+
+	_, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.NoError(t, err)
+
+	journal = getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{wal.NewLog(1, wal.LPushOp, "key", "")}, nil)
+	_, err = NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.ErrorIs(t, err, wal.ErrCorruptedLog)
+}
+
+type mockListEngine struct {
+	*MockEngine
+	*MockListEngine
+	*MockDumpEngine
+}
+
+func getMockListEngine(t *testing.T) *mockListEngine {
+	t.Helper()
+
+	ctrl := gomock.NewController(t)
+	return &mockListEngine{
+		MockEngine:     NewMockEngine(ctrl),
+		MockListEngine: NewMockListEngine(ctrl),
+		MockDumpEngine: NewMockDumpEngine(ctrl),
+	}
+}
+
+func (e *mockListEngine) EXPECT() *mockListEngineRecorder {
+	return &mockListEngineRecorder{
+		MockEngineMockRecorder:     e.MockEngine.EXPECT(),
+		MockListEngineMockRecorder: e.MockListEngine.EXPECT(),
+		MockDumpEngineMockRecorder: e.MockDumpEngine.EXPECT(),
+	}
+}
+
+type mockListEngineRecorder struct {
+	*MockEngineMockRecorder
+	*MockListEngineMockRecorder
+	*MockDumpEngineMockRecorder
+}
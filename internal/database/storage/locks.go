@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// lockStripes is the number of parts of the key locks, so locking a key waits
+// only for the keys of its part and only while its lock is looked up.
+const lockStripes = 64
+
+// keyLocks serializes the mutations of every key, while mutations of
+// different keys run concurrently. Mutations of the whole storage lock all
+// keys: they wait for the mutations in progress and block new ones.
+type keyLocks struct {
+	all     sync.RWMutex
+	stripes [lockStripes]lockStripe
+}
+
+type lockStripe struct {
+	mutex sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mutex sync.Mutex
+	refs  int
+}
+
+// lock locks the keys and returns the function that unlocks them. Keys are
+// locked in ascending order, so mutations of several keys don't deadlock.
+func (l *keyLocks) lock(keys []string) func() {
+	l.all.RLock()
+
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	locks := make([]*keyLock, 0, len(sorted))
+	for idx, key := range sorted {
+		if idx != 0 && key == sorted[idx-1] {
+			continue
+		}
+
+		lock := l.acquire(key)
+		lock.mutex.Lock()
+		locks = append(locks, lock)
+	}
+
+	return func() {
+		for _, lock := range locks {
+			lock.mutex.Unlock()
+		}
+		for idx, key := range sorted {
+			if idx == 0 || key != sorted[idx-1] {
+				l.release(key)
+			}
+		}
+		l.all.RUnlock()
+	}
+}
+
+// lockAll waits for the mutations in progress, blocks new ones and returns
+// the function that unblocks them.
+func (l *keyLocks) lockAll() func() {
+	l.all.Lock()
+	return l.all.Unlock
+}
+
+func (l *keyLocks) acquire(key string) *keyLock {
+	stripe := l.stripe(key)
+	stripe.mutex.Lock()
+	defer stripe.mutex.Unlock()
+
+	if stripe.locks == nil {
+		stripe.locks = make(map[string]*keyLock)
+	}
+	lock, ok := stripe.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		stripe.locks[key] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+func (l *keyLocks) release(key string) {
+	stripe := l.stripe(key)
+	stripe.mutex.Lock()
+	defer stripe.mutex.Unlock()
+
+	lock := stripe.locks[key]
+	lock.refs--
+	if lock.refs == 0 {
+		delete(stripe.locks, key)
+	}
+}
+
+func (l *keyLocks) stripe(key string) *lockStripe {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return &l.stripes[hash.Sum32()%lockStripes]
+}
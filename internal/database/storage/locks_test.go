@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyLocks(t *testing.T) {
+	t.Parallel()
+
+	var locks keyLocks
+	unlockA := locks.lock([]string{"a", "b", "a"})
+
+	locked := make(chan struct{})
+	go func() {
+		unlock := locks.lock([]string{"c"})
+		unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("lock of another key is blocked")
+	}
+
+	locked = make(chan struct{})
+	go func() {
+		unlock := locks.lock([]string{"b"})
+		unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("lock of a locked key isn't blocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	lockedAll := make(chan struct{})
+	go func() {
+		<-locked
+		unlock := locks.lockAll()
+		unlock()
+		close(lockedAll)
+	}()
+
+	unlockA()
+	select {
+	case <-lockedAll:
+	case <-time.After(time.Second):
+		t.Fatal("keys aren't unlocked")
+	}
+
+	for idx := range locks.stripes {
+		require.Empty(t, locks.stripes[idx].locks)
+	}
+}
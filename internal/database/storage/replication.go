@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"kv_db/internal/database/storage/wal"
+)
+
+// maxChangesLogs is the number of backlog logs that Changes returns at once,
+// so a lagging replica catches up in several responses of a limited size.
+const maxChangesLogs = 1000
+
+// Changes are the mutations of a storage that follow an offset. Offsets count
+// the mutations since the start of the storage, which is identified by ID, so
+// offsets of different starts are never mixed up.
+type Changes struct {
+	ID string
+	// Offset is the offset of the last of the logs.
+	Offset uint64
+	// Head is the offset of the last mutation of the storage, which is
+	// greater than Offset if there are more changes.
+	Head uint64
+	// Snapshot means that the logs recreate the whole data, which replaces
+	// the current one.
+	Snapshot bool
+	Logs     []wal.Log
+}
+
+// backlog keeps the last mutations for replicas. The zero offset means that
+// there are no mutations yet.
+type backlog struct {
+	id     string
+	size   int
+	offset uint64
+	// logs end with the log of the offset.
+	logs []wal.Log
+	// changed is closed and replaced by the next mutation.
+	changed chan struct{}
+}
+
+func (b *backlog) init() error {
+	if b.size <= 0 {
+		return errors.New("storage replication backlog size is invalid")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	b.id = hex.EncodeToString(id)
+	b.changed = make(chan struct{})
+	return nil
+}
+
+func (b *backlog) append(log wal.Log) {
+	b.offset++
+	b.logs = append(b.logs, log)
+	if len(b.logs) > b.size {
+		b.logs = b.logs[len(b.logs)-b.size:]
+	}
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// contains reports whether the mutations that follow the offset of the
+// start with the ID are in the backlog.
+func (b *backlog) contains(id string, offset uint64) bool {
+	return id == b.id && offset <= b.offset && b.offset-offset <= uint64(len(b.logs))
+}
+
+// Changes returns the mutations that follow the offset of the start with the
+// ID. It waits for them until the context is done and returns no logs then.
+// If the mutations are not in the backlog anymore, Changes returns a snapshot
+// together with its offset instead.
+func (s *Storage) Changes(ctx context.Context, id string, offset uint64) (Changes, error) {
+	if s.backlog == nil {
+		return Changes{}, errors.New("replication backlog is disabled")
+	}
+
+	for {
+		var changes Changes
+		var changed <-chan struct{}
+		var stale bool
+		err := s.withLog(func() error {
+			if !s.backlog.contains(id, offset) {
+				stale = true
+				return nil
+			}
+
+			if offset == s.backlog.offset {
+				changed = s.backlog.changed
+				return nil
+			}
+
+			logs := s.backlog.logs[uint64(len(s.backlog.logs))-(s.backlog.offset-offset):]
+			if len(logs) > maxChangesLogs {
+				logs = logs[:maxChangesLogs]
+			}
+			changes = Changes{
+				ID:     id,
+				Offset: offset + uint64(len(logs)),
+				Head:   s.backlog.offset,
+				Logs:   append([]wal.Log(nil), logs...),
+			}
+			return nil
+		})
+		if stale {
+			return s.snapshotChanges(ctx)
+		}
+		if err != nil || changed == nil {
+			return changes, err
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return Changes{ID: id, Offset: offset, Head: offset}, nil
+		}
+	}
+}
+
+// snapshotChanges returns a snapshot together with the offset of the backlog
+// it corresponds to. All keys are locked, so no mutation is in the snapshot
+// but not in the backlog yet.
+func (s *Storage) snapshotChanges(ctx context.Context) (Changes, error) {
+	unlock := s.keys.lockAll()
+	defer unlock()
+
+	var changes Changes
+	err := s.withLog(func() error {
+		logs, err := s.engine.(SnapshotEngine).Snapshot(ctx)
+		changes = Changes{
+			ID:       s.backlog.id,
+			Offset:   s.backlog.offset,
+			Head:     s.backlog.offset,
+			Snapshot: true,
+			Logs:     logs,
+		}
+		return err
+	})
+	return changes, err
+}
+
+// ApplyChanges applies the changes of a primary storage, which are applied
+// even if the storage is read-only, and reports them to the events. A
+// snapshot deletes all keys first, so readers may observe the storage
+// partially restored until it is applied. A guarded log of the consensus is
+// applied only if its keys are in the planned states. Pushes wake up the
+// blocking pops of their lists like local ones.
+func (s *Storage) ApplyChanges(ctx context.Context, changes Changes) error {
+	s.applyMutex.Lock()
+	defer s.applyMutex.Unlock()
+
+	return s.withLog(func() error {
+		if changes.Snapshot {
+			engine, ok := s.engine.(FlushEngine)
+			if !ok {
+				return errors.New("storage engine doesn't support flush")
+			}
+			if err := engine.Flush(ctx); err != nil {
+				return err
+			}
+			s.notify(wal.NewLog(0, wal.FlushOp))
+		}
+
+		for _, log := range changes.Logs {
+			applied := true
+			var err error
+			if log.Op == wal.GuardOp {
+				log, applied, err = s.applyGuardLog(ctx, log)
+			} else {
+				err = s.applyLog(ctx, log)
+			}
+			if err != nil {
+				return err
+			}
+			if applied {
+				s.notify(log)
+				s.notifyPush(log)
+			}
+		}
+		return nil
+	})
+}
+
+// SnapshotLogs returns logs that recreate the current data. Unlike a snapshot
+// for replicas, it doesn't lock the keys: the consensus calls it between
+// applies, when writers wait for the consensus and don't mutate the data.
+func (s *Storage) SnapshotLogs(ctx context.Context) ([]wal.Log, error) {
+	engine, ok := s.engine.(SnapshotEngine)
+	if !ok {
+		return nil, errors.New("storage engine doesn't support snapshots")
+	}
+	return engine.Snapshot(ctx)
+}
+
+// ReplicationOffset returns the ID of the start of the storage and the offset
+// of its last mutation.
+func (s *Storage) ReplicationOffset() (string, uint64) {
+	if s.backlog == nil {
+		return "", 0
+	}
+
+	var id string
+	var offset uint64
+	_ = s.withLog(func() error {
+		id, offset = s.backlog.id, s.backlog.offset
+		return nil
+	})
+	return id, offset
+}
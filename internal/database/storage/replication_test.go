@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
+	"kv_db/pkg/dlog"
+)
+
+func TestNewStorageWithReplicationBacklog(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewStorage(getMockEngine(t), dlog.NewNonSlog(), WithReplicationBacklog(10))
+	require.Error(t, err)
+
+	_, err = NewStorage(getMockSnapshotEngine(t), dlog.NewNonSlog(), WithReplicationBacklog(0))
+	require.Error(t, err)
+
+	storage, err := NewStorage(getMockSnapshotEngine(t), dlog.NewNonSlog(), WithReplicationBacklog(10))
+	require.NoError(t, err)
+	id, offset := storage.ReplicationOffset()
+	require.NotEmpty(t, id)
+	require.Zero(t, offset)
+
+	storage, err = NewStorage(getMockEngine(t), dlog.NewNonSlog())
+	require.NoError(t, err)
+	_, err = storage.Changes(context.Background(), id, 0)
+	require.Error(t, err)
+}
+
+func TestStorage_Changes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine := getMockSnapshotEngine(t)
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithReplicationBacklog(2))
+	require.NoError(t, err)
+	id, _ := storage.ReplicationOffset()
+
+	snapshot := []wal.Log{wal.NewLog(0, wal.SetOp, "key", "value")}
+	engine.EXPECT().Snapshot(ctx).Return(snapshot, nil)
+	changes, err := storage.Changes(ctx, "?", 0)
+	require.NoError(t, err)
+	require.Equal(t, Changes{ID: id, Snapshot: true, Logs: snapshot}, changes)
+
+	engine.EXPECT().Set(ctx, gomock.Any(), "value").Return(nil).Times(3)
+	require.NoError(t, storage.Set(ctx, "key1", "value"))
+	require.NoError(t, storage.Set(ctx, "key2", "value"))
+
+	changes, err = storage.Changes(ctx, id, 1)
+	require.NoError(t, err)
+	require.Equal(t, Changes{
+		ID:     id,
+		Offset: 2,
+		Head:   2,
+		Logs:   []wal.Log{wal.NewLog(0, wal.SetOp, "key2", "value")},
+	}, changes)
+
+	// A waiting replica gets the next mutation as soon as it happens.
+	result := make(chan Changes)
+	go func() {
+		changes, _ := storage.Changes(ctx, id, 2)
+		result <- changes
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, storage.Set(ctx, "key3", "value"))
+	require.Equal(t, Changes{
+		ID:     id,
+		Offset: 3,
+		Head:   3,
+		Logs:   []wal.Log{wal.NewLog(0, wal.SetOp, "key3", "value")},
+	}, <-result)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	changes, err = storage.Changes(timeoutCtx, id, 3)
+	require.NoError(t, err)
+	require.Equal(t, Changes{ID: id, Offset: 3, Head: 3}, changes)
+
+	// The first mutation has left the backlog, so it is replaced by a
+	// snapshot, as well as unknown offsets and offsets of another start.
+	for _, offset := range []uint64{0, 4} {
+		engine.EXPECT().Snapshot(ctx).Return(snapshot, nil)
+		changes, err = storage.Changes(ctx, id, offset)
+		require.NoError(t, err)
+		require.Equal(t, Changes{ID: id, Offset: 3, Head: 3, Snapshot: true, Logs: snapshot}, changes)
+	}
+
+	engine.EXPECT().Snapshot(ctx).Return(snapshot, nil)
+	changes, err = storage.Changes(ctx, "other", 3)
+	require.NoError(t, err)
+	require.True(t, changes.Snapshot)
+}
+
+func TestStorage_ApplyChanges(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	engine := &mockFlushEngine{MockEngine: NewMockEngine(ctrl), MockFlushEngine: NewMockFlushEngine(ctrl)}
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithReadOnly())
+	require.NoError(t, err)
+
+	require.ErrorIs(t, storage.Set(ctx, "key", "value"), ErrReadOnly)
+	require.ErrorIs(t, storage.Flush(ctx), ErrReadOnly)
+
+	gomock.InOrder(
+		engine.MockFlushEngine.EXPECT().Flush(ctx).Return(nil),
+		engine.MockEngine.EXPECT().Set(ctx, "key1", "value").Return(nil),
+		engine.MockEngine.EXPECT().Delete(ctx, "key2").Return(nil),
+	)
+	require.NoError(t, storage.ApplyChanges(ctx, Changes{
+		Snapshot: true,
+		Logs:     []wal.Log{wal.NewLog(0, wal.SetOp, "key1", "value")},
+	}))
+	require.NoError(t, storage.ApplyChanges(ctx, Changes{
+		Logs: []wal.Log{wal.NewLog(0, wal.DelOp, "key2")},
+	}))
+
+	storage, err = NewStorage(getMockEngine(t), dlog.NewNonSlog(), WithReadOnly())
+	require.NoError(t, err)
+	require.Error(t, storage.ApplyChanges(ctx, Changes{Snapshot: true}))
+}
+
+func TestStorage_Consensus(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	consensus := NewMockConsensus(ctrl)
+	clock := dclock.NewFakeClock(time.Unix(100, 0))
+	engine := getMockEngine(t)
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithConsensus(consensus), WithClock(clock))
+	require.NoError(t, err)
+
+	// The logs are applied to the engine by ApplyChanges, not by the writes.
+	gomock.InOrder(
+		consensus.EXPECT().Propose(ctx, wal.NewLog(0, wal.SetOp, "key", "value")).Return(nil),
+		consensus.EXPECT().
+			Propose(ctx, wal.NewLog(0, wal.SetOp, "key", "value", wal.FormatExpiration(time.Unix(110, 0)))).
+			Return(nil),
+		consensus.EXPECT().Propose(ctx, wal.NewLog(0, wal.DelOp, "key")).Return(errors.New("test error")),
+	)
+	require.NoError(t, storage.Set(ctx, "key", "value"))
+	require.NoError(t, storage.SetWithTTL(ctx, "key", "value", 10*time.Second))
+	require.Error(t, storage.Delete(ctx, "key"))
+
+	// A write that depends on the state is planned on 5, but another node
+	// changes the key to 7 before it is applied, so it is planned again.
+	expectValue := func(value string) {
+		engine.EXPECT().Get(ctx, "key").Return(value, true, nil)
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil)
+	}
+	apply := func(_ context.Context, log wal.Log) error {
+		return storage.ApplyChanges(ctx, Changes{Logs: []wal.Log{log}})
+	}
+	gomock.InOrder(
+		// The plan and the state of the key.
+		engine.EXPECT().Get(ctx, "key").Return("5", true, nil),
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil),
+		engine.EXPECT().Get(ctx, "key").Return("5", true, nil),
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil),
+		consensus.EXPECT().Propose(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, log wal.Log) error {
+			expectValue("7")
+			return apply(ctx, log)
+		}),
+		engine.EXPECT().Get(ctx, "key").Return("7", true, nil),
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil),
+		engine.EXPECT().Get(ctx, "key").Return("7", true, nil),
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil),
+		consensus.EXPECT().Propose(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, log wal.Log) error {
+			expectValue("7")
+			engine.EXPECT().Set(ctx, "key", "8").Return(nil)
+			return apply(ctx, log)
+		}),
+	)
+	result, err := storage.Increment(ctx, "key", 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), result)
+
+	// The outcome of a guarded log that isn't applied by ApplyChanges is
+	// unknown.
+	gomock.InOrder(
+		engine.EXPECT().Get(ctx, "key").Return("8", true, nil),
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil),
+		engine.EXPECT().Get(ctx, "key").Return("8", true, nil),
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil),
+		consensus.EXPECT().Propose(ctx, gomock.Any()).Return(nil),
+	)
+	_, err = storage.Increment(ctx, "key", 1)
+	require.ErrorIs(t, err, errGuardUnknown)
+}
+
+func TestStorage_SnapshotLogs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine := getMockSnapshotEngine(t)
+	storage, err := NewStorage(engine, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	logs := []wal.Log{wal.NewLog(0, wal.SetOp, "key", "value")}
+	engine.MockSnapshotEngine.EXPECT().Snapshot(ctx).Return(logs, nil)
+	result, err := storage.SnapshotLogs(ctx)
+	require.NoError(t, err)
+	require.Equal(t, logs, result)
+
+	storage, err = NewStorage(getMockEngine(t), dlog.NewNonSlog())
+	require.NoError(t, err)
+	_, err = storage.SnapshotLogs(ctx)
+	require.Error(t, err)
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"kv_db/internal/database/storage/wal"
+)
+
+// SetAdd adds the members to the set and returns the number of new ones. A
+// set is created if the key doesn't exist.
+func (s *Storage) SetAdd(ctx context.Context, key string, members ...string) (int, error) {
+	engine, err := s.setEngine()
+	if err != nil {
+		return 0, err
+	}
+
+	var added int
+	_, err = s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		var err error
+		if added, err = countMissing(members, func(member string) (bool, error) {
+			return engine.SetIsMember(ctx, key, member)
+		}); err != nil {
+			return nil, err
+		}
+
+		expiration, err := s.expirationArg(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return newLog(wal.SAddOp, append([]string{key, expiration}, members...)...), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// SetRemove removes the members of the set and returns the number of removed
+// ones.
+func (s *Storage) SetRemove(ctx context.Context, key string, members ...string) (int, error) {
+	engine, err := s.setEngine()
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	_, err = s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		missing, err := countMissing(members, func(member string) (bool, error) {
+			return engine.SetIsMember(ctx, key, member)
+		})
+		if removed = countUnique(members) - missing; err != nil || removed == 0 {
+			return nil, err
+		}
+		return newLog(wal.SRemOp, append([]string{key}, members...)...), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+func (s *Storage) SetIsMember(ctx context.Context, key, member string) (bool, error) {
+	engine, err := s.setEngine()
+	if err != nil {
+		return false, err
+	}
+	return engine.SetIsMember(ctx, key, member)
+}
+
+// SetMembers returns the members of the set in no particular order.
+func (s *Storage) SetMembers(ctx context.Context, key string) ([]string, error) {
+	engine, err := s.setEngine()
+	if err != nil {
+		return nil, err
+	}
+	return engine.SetMembers(ctx, key)
+}
+
+// SetIntersect returns the members that belong to all the sets. The sets are
+// read one by one, so the result isn't atomic with respect to writes.
+func (s *Storage) SetIntersect(ctx context.Context, keys ...string) ([]string, error) {
+	counts, err := s.countMembers(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []string
+	for member, count := range counts {
+		if count == len(keys) {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+// SetUnion returns the members that belong to any of the sets. The sets are
+// read one by one, so the result isn't atomic with respect to writes.
+func (s *Storage) SetUnion(ctx context.Context, keys ...string) ([]string, error) {
+	counts, err := s.countMembers(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0, len(counts))
+	for member := range counts {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// countMembers returns the number of the sets that every member belongs to.
+// A repeated key is counted as many times as it is given.
+func (s *Storage) countMembers(ctx context.Context, keys []string) (map[string]int, error) {
+	engine, err := s.setEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, key := range keys {
+		members, err := engine.SetMembers(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			counts[member]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *Storage) setEngine() (SetEngine, error) {
+	engine, ok := s.engine.(SetEngine)
+	if !ok {
+		return nil, fmt.Errorf("%w: sets", ErrUnsupportedType)
+	}
+	return engine, nil
+}
+
+// applySetAddLog replays SAddOp and MembersOp logs: it adds the members and
+// sets the logged expiration time of the set.
+func (s *Storage) applySetAddLog(ctx context.Context, log wal.Log) error {
+	if len(log.Args) < 3 {
+		return wal.ErrCorruptedLog
+	}
+
+	engine, err := s.setEngine()
+	if err != nil {
+		return err
+	}
+
+	key := log.Args[0]
+	if log.Op == wal.MembersOp {
+		if err := s.engine.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	if _, err := engine.SetAdd(ctx, key, log.Args[2:]); err != nil {
+		return err
+	}
+	return s.restoreExpiration(ctx, key, log.Args[1])
+}
+
+func (s *Storage) applySetRemoveLog(ctx context.Context, log wal.Log) error {
+	if len(log.Args) < 2 {
+		return wal.ErrCorruptedLog
+	}
+
+	engine, err := s.setEngine()
+	if err != nil {
+		return err
+	}
+	_, err = engine.SetRemove(ctx, log.Args[0], log.Args[1:])
+	return err
+}
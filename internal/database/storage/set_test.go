@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dfuture"
+	"kv_db/pkg/dlog"
+)
+
+func TestStorage_SetWrites(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	expiresAt := time.Unix(110, 0)
+
+	t.Run("unsupported engine", func(t *testing.T) {
+		storage, err := NewStorage(getMockEngine(t), dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		_, err = storage.SetAdd(ctx, "key", "member")
+		require.Error(t, err)
+		_, err = storage.SetUnion(ctx, "key")
+		require.Error(t, err)
+	})
+
+	t.Run("success with wal", func(t *testing.T) {
+		engine, journal := getMockSetEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+		require.NoError(t, err)
+
+		gomock.InOrder(
+			engine.EXPECT().SetIsMember(ctx, "key", "a").Return(false, nil),
+			engine.EXPECT().SetIsMember(ctx, "key", "b").Return(false, nil),
+			engine.EXPECT().Expiration(ctx, "key").Return(expiresAt, true, nil),
+			journal.EXPECT().
+				Append(ctx, wal.SAddOp, "key", wal.FormatExpiration(expiresAt), "a", "b", "a").
+				Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().SetAdd(ctx, "key", []string{"a", "b", "a"}).Return(2, nil),
+			engine.EXPECT().Expire(ctx, "key", expiresAt).Return(true, nil),
+			engine.EXPECT().SetIsMember(ctx, "key", "a").Return(true, nil),
+			journal.EXPECT().Append(ctx, wal.SRemOp, "key", "a").Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().SetRemove(ctx, "key", []string{"a"}).Return(1, nil),
+			engine.EXPECT().SetIsMember(ctx, "key", "c").Return(false, nil),
+		)
+
+		added, err := storage.SetAdd(ctx, "key", "a", "b", "a")
+		require.NoError(t, err)
+		require.Equal(t, 2, added)
+		removed, err := storage.SetRemove(ctx, "key", "a")
+		require.NoError(t, err)
+		require.Equal(t, 1, removed)
+		removed, err = storage.SetRemove(ctx, "key", "c")
+		require.NoError(t, err)
+		require.Zero(t, removed)
+	})
+}
+
+func TestStorage_SetIntersectAndUnion(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine := getMockSetEngine(t)
+	storage, err := NewStorage(engine, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	engine.EXPECT().SetMembers(ctx, "first").Return([]string{"a", "b", "c"}, nil).Times(2)
+	engine.EXPECT().SetMembers(ctx, "second").Return([]string{"b", "c", "d"}, nil).Times(2)
+	engine.EXPECT().SetMembers(ctx, "missing").Return(nil, nil)
+	engine.EXPECT().SetMembers(ctx, "string").Return(nil, ErrWrongType)
+
+	members, err := storage.SetIntersect(ctx, "first", "second")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"b", "c"}, members)
+
+	members, err = storage.SetUnion(ctx, "first", "second", "missing")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"a", "b", "c", "d"}, members)
+
+	_, err = storage.SetIntersect(ctx, "string")
+	require.ErrorIs(t, err, ErrWrongType)
+}
+
+func TestStorage_RecoverSets(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	expiresAt := time.Unix(110, 0)
+	engine, journal := getMockSetEngine(t), getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{
+		wal.NewLog(1, wal.SAddOp, "key", "", "a", "b"),
+		wal.NewLog(2, wal.SRemOp, "key", "a"),
+		wal.NewLog(3, wal.MembersOp, "key", wal.FormatExpiration(expiresAt), "c"),
+	}, nil)
+
+	gomock.InOrder(
+		engine.EXPECT().SetAdd(ctx, "key", []string{"a", "b"}).Return(2, nil),
+		engine.EXPECT().Persist(ctx, "key").Return(false, nil),
+		engine.EXPECT().SetRemove(ctx, "key", []string{"a"}).Return(1, nil),
+		engine.EXPECT().Delete(ctx, "key").Return(nil),
+		engine.EXPECT().SetAdd(ctx, "key", []string{"c"}).Return(1, nil),
+		engine.EXPECT().Expire(ctx, "key", expiresAt).Return(true, nil),
+	)
+
+	_, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.NoError(t, err)
+
+	journal = getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{wal.NewLog(1, wal.SAddOp, "key", "")}, nil)
+	_, err = NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.ErrorIs(t, err, wal.ErrCorruptedLog)
+}
+
+type mockSetEngine struct {
+	*MockEngine
+	*MockSetEngine
+}
+
+func getMockSetEngine(t *testing.T) *mockSetEngine {
+	t.Helper()
+
+	ctrl := gomock.NewController(t)
+	return &mockSetEngine{
+		MockEngine:    NewMockEngine(ctrl),
+		MockSetEngine: NewMockSetEngine(ctrl),
+	}
+}
+
+func (e *mockSetEngine) EXPECT() *mockSetEngineRecorder {
+	return &mockSetEngineRecorder{
+		MockEngineMockRecorder:    e.MockEngine.EXPECT(),
+		MockSetEngineMockRecorder: e.MockSetEngine.EXPECT(),
+	}
+}
+
+type mockSetEngineRecorder struct {
+	*MockEngineMockRecorder
+	*MockSetEngineMockRecorder
+}
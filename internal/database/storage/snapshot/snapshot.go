@@ -0,0 +1,248 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dlog"
+)
+
+const (
+	snapshotPrefix = "snapshot_"
+	snapshotSuffix = ".snap"
+	tmpSuffix      = ".tmp"
+	trailerSize    = 12
+
+	// keepSnapshots is the number of the newest snapshots that are kept, so
+	// there is a fallback if the newest one is damaged.
+	keepSnapshots = 2
+)
+
+var ErrCorruptedSnapshot = errors.New("corrupted snapshot")
+
+// Manager stores snapshots as files named by the LSN of the last mutation
+// they contain. A snapshot is a sequence of logs that recreate the data when
+// applied to an empty engine. The file contains the logs encoded like in the
+// WAL followed by the number of logs and the CRC32 of all preceding bytes.
+// Files are written to a temporary name and renamed when complete.
+type Manager struct {
+	directory string
+	logger    *slog.Logger
+}
+
+func NewManager(directory string, logger *slog.Logger) (*Manager, error) {
+	if directory == "" {
+		return nil, errors.New("snapshot manager directory is invalid")
+	}
+
+	if logger == nil {
+		return nil, errors.New("snapshot manager logger is invalid")
+	}
+
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	return &Manager{directory: directory, logger: logger}, nil
+}
+
+// Write stores the snapshot with the given LSN and returns the LSN of the
+// oldest snapshot that is kept. Load may fall back to that one, so the logs
+// following it are still needed.
+func (m *Manager) Write(lsn uint64, logs []wal.Log) (uint64, error) {
+	path := filepath.Join(m.directory, snapshotName(lsn))
+	tmpPath := path + tmpSuffix
+
+	if err := m.writeFile(tmpPath, logs); err != nil {
+		if err := os.Remove(tmpPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			m.logger.Warn("failed to remove temporary snapshot", dlog.ErrAttr(err))
+		}
+		return 0, err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, fmt.Errorf("failed to rename snapshot: %w", err)
+	}
+
+	if err := syncDirectory(m.directory); err != nil {
+		return 0, err
+	}
+
+	return m.removeOldSnapshots(), nil
+}
+
+// Load returns the newest valid snapshot. Damaged snapshots are skipped. If
+// there is no snapshot, it returns zero LSN and no logs.
+func (m *Manager) Load() (uint64, []wal.Log, error) {
+	snapshots, err := m.snapshots()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for idx := len(snapshots) - 1; idx >= 0; idx-- {
+		logs, err := m.readFile(filepath.Join(m.directory, snapshots[idx].name))
+		if err != nil {
+			m.logger.Warn("failed to load snapshot", slog.String("snapshot", snapshots[idx].name), dlog.ErrAttr(err))
+			continue
+		}
+		return snapshots[idx].lsn, logs, nil
+	}
+
+	return 0, nil, nil
+}
+
+func (m *Manager) writeFile(path string, logs []wal.Log) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	checksum := crc32.NewIEEE()
+	writer := bufio.NewWriter(io.MultiWriter(file, checksum))
+
+	var buffer []byte
+	for _, log := range logs {
+		buffer = log.AppendTo(buffer[:0])
+		if _, err := writer.Write(buffer); err != nil {
+			_ = file.Close()
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	trailer := binary.LittleEndian.AppendUint64(nil, uint64(len(logs)))
+	trailer = binary.LittleEndian.AppendUint32(trailer, checksum.Sum32())
+	if _, err := file.Write(trailer); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+
+	return file.Close()
+}
+
+func (m *Manager) readFile(path string) ([]wal.Log, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) < trailerSize {
+		return nil, ErrCorruptedSnapshot
+	}
+
+	body, trailer := content[:len(content)-trailerSize], content[len(content)-trailerSize:]
+	count := binary.LittleEndian.Uint64(trailer[:8])
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(trailer[8:]) {
+		return nil, ErrCorruptedSnapshot
+	}
+
+	logs, err := wal.DecodeLogs(bytes.NewReader(body))
+	if err != nil || uint64(len(logs)) != count {
+		return nil, ErrCorruptedSnapshot
+	}
+
+	return logs, nil
+}
+
+// removeOldSnapshots returns the LSN of the oldest snapshot that is left,
+// which is zero if it can't be determined.
+func (m *Manager) removeOldSnapshots() uint64 {
+	snapshots, err := m.snapshots()
+	if err != nil {
+		m.logger.Warn("failed to list snapshots", dlog.ErrAttr(err))
+		return 0
+	}
+
+	oldest := 0
+	for ; oldest < len(snapshots)-keepSnapshots; oldest++ {
+		if err := os.Remove(filepath.Join(m.directory, snapshots[oldest].name)); err != nil {
+			m.logger.Warn("failed to remove snapshot", slog.String("snapshot", snapshots[oldest].name), dlog.ErrAttr(err))
+			return snapshots[oldest].lsn
+		}
+	}
+
+	if oldest == len(snapshots) {
+		return 0
+	}
+	return snapshots[oldest].lsn
+}
+
+type snapshotInfo struct {
+	name string
+	lsn  uint64
+}
+
+func (m *Manager) snapshots() ([]snapshotInfo, error) {
+	entries, err := os.ReadDir(m.directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	snapshots := make([]snapshotInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		lsn, ok := parseSnapshotName(entry.Name())
+		if !ok {
+			continue
+		}
+		snapshots = append(snapshots, snapshotInfo{name: entry.Name(), lsn: lsn})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].lsn < snapshots[j].lsn
+	})
+	return snapshots, nil
+}
+
+func syncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot directory: %w", err)
+	}
+
+	if err := dir.Sync(); err != nil {
+		_ = dir.Close()
+		return fmt.Errorf("failed to sync snapshot directory: %w", err)
+	}
+	return dir.Close()
+}
+
+func snapshotName(lsn uint64) string {
+	return fmt.Sprintf("%s%020d%s", snapshotPrefix, lsn, snapshotSuffix)
+}
+
+func parseSnapshotName(name string) (uint64, bool) {
+	if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+		return 0, false
+	}
+
+	lsn, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return lsn, true
+}
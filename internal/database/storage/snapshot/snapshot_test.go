@@ -0,0 +1,138 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dlog"
+)
+
+func TestNewManager(t *testing.T) {
+	t.Parallel()
+
+	manager, err := NewManager("", dlog.NewNonSlog())
+	require.Error(t, err)
+	require.Nil(t, manager)
+
+	manager, err = NewManager(t.TempDir(), nil)
+	require.Error(t, err)
+	require.Nil(t, manager)
+
+	dir := filepath.Join(t.TempDir(), "nested")
+	manager, err = NewManager(dir, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.NotNil(t, manager)
+	require.DirExists(t, dir)
+}
+
+func TestManager_LoadEmpty(t *testing.T) {
+	t.Parallel()
+
+	manager, err := NewManager(t.TempDir(), dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	lsn, logs, err := manager.Load()
+	require.NoError(t, err)
+	require.Zero(t, lsn)
+	require.Empty(t, logs)
+}
+
+func TestManager_WriteLoad(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manager, err := NewManager(dir, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	oldest, err := manager.Write(5, []wal.Log{wal.NewLog(0, wal.SetOp, "key1", "value1")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), oldest)
+
+	oldest, err = manager.Write(10, []wal.Log{
+		wal.NewLog(0, wal.SetOp, "key1", "value1"),
+		wal.NewLog(0, wal.SetOp, "key2", "", "1700000000000000000"),
+		wal.NewLog(0, wal.SetOp, "", "value3"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), oldest)
+
+	lsn, logs, err := manager.Load()
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), lsn)
+	require.Equal(t, []wal.Log{
+		wal.NewLog(0, wal.SetOp, "key1", "value1"),
+		wal.NewLog(0, wal.SetOp, "key2", "", "1700000000000000000"),
+		wal.NewLog(0, wal.SetOp, "", "value3"),
+	}, logs)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestManager_RemoveOldSnapshots(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manager, err := NewManager(dir, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	for lsn := uint64(1); lsn <= 5; lsn++ {
+		oldest, err := manager.Write(lsn, []wal.Log{wal.NewLog(0, wal.SetOp, "key", "value")})
+		require.NoError(t, err)
+		require.Equal(t, max(lsn-1, 1), oldest)
+	}
+
+	snapshots, err := manager.snapshots()
+	require.NoError(t, err)
+	require.Equal(t, []snapshotInfo{
+		{name: snapshotName(4), lsn: 4},
+		{name: snapshotName(5), lsn: 5},
+	}, snapshots)
+}
+
+func TestManager_LoadSkipsCorruptedSnapshot(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manager, err := NewManager(dir, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	_, err = manager.Write(1, []wal.Log{wal.NewLog(0, wal.SetOp, "key", "old")})
+	require.NoError(t, err)
+	_, err = manager.Write(2, []wal.Log{wal.NewLog(0, wal.SetOp, "key", "new")})
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, snapshotName(2))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content[0] ^= 0xff
+	require.NoError(t, os.WriteFile(path, content, 0o644))
+
+	lsn, logs, err := manager.Load()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), lsn)
+	require.Equal(t, []wal.Log{wal.NewLog(0, wal.SetOp, "key", "old")}, logs)
+}
+
+func TestManager_LoadSkipsTruncatedSnapshot(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manager, err := NewManager(dir, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	_, err = manager.Write(1, []wal.Log{wal.NewLog(0, wal.SetOp, "key", "value")})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, snapshotName(2)), []byte{1, 2, 3}, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, snapshotName(3)+tmpSuffix), []byte{1, 2, 3}, 0o644))
+
+	lsn, logs, err := manager.Load()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), lsn)
+	require.Equal(t, []wal.Log{wal.NewLog(0, wal.SetOp, "key", "value")}, logs)
+}
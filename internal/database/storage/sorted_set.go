@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"kv_db/internal/database/storage/wal"
+)
+
+// SortedSetAdd adds the members to the sorted set or updates their scores
+// and returns the number of new members. A sorted set is created if the key
+// doesn't exist.
+func (s *Storage) SortedSetAdd(ctx context.Context, key string, members ...ScoredMember) (int, error) {
+	engine, err := s.sortedSetEngine()
+	if err != nil {
+		return 0, err
+	}
+
+	var added int
+	_, err = s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		names := make([]string, 0, len(members))
+		for _, member := range members {
+			names = append(names, member.Member)
+		}
+
+		var err error
+		if added, err = countMissing(names, func(member string) (bool, error) {
+			_, ok, err := engine.SortedSetRank(ctx, key, member)
+			return ok, err
+		}); err != nil {
+			return nil, err
+		}
+
+		expiration, err := s.expirationArg(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		args := make([]string, 0, 2*len(members)+2)
+		args = append(args, key, expiration)
+		for _, member := range members {
+			args = append(args, wal.FormatScore(member.Score), member.Member)
+		}
+		return newLog(wal.ZAddOp, args...), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// SortedSetRemove removes the members of the sorted set and returns the
+// number of removed ones.
+func (s *Storage) SortedSetRemove(ctx context.Context, key string, members ...string) (int, error) {
+	engine, err := s.sortedSetEngine()
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	_, err = s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		missing, err := countMissing(members, func(member string) (bool, error) {
+			_, ok, err := engine.SortedSetRank(ctx, key, member)
+			return ok, err
+		})
+		if removed = countUnique(members) - missing; err != nil || removed == 0 {
+			return nil, err
+		}
+		return newLog(wal.ZRemOp, append([]string{key}, members...)...), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// SortedSetRange returns the members between the ranks inclusively in the
+// order of scores. Negative ranks count from the end.
+func (s *Storage) SortedSetRange(ctx context.Context, key string, start, stop int) ([]ScoredMember, error) {
+	engine, err := s.sortedSetEngine()
+	if err != nil {
+		return nil, err
+	}
+	return engine.SortedSetRange(ctx, key, start, stop)
+}
+
+// SortedSetRangeByScore returns the members with scores between the bounds
+// inclusively in the order of scores.
+func (s *Storage) SortedSetRangeByScore(
+	ctx context.Context, key string, minScore, maxScore float64,
+) ([]ScoredMember, error) {
+	engine, err := s.sortedSetEngine()
+	if err != nil {
+		return nil, err
+	}
+	return engine.SortedSetRangeByScore(ctx, key, minScore, maxScore)
+}
+
+// SortedSetRank returns the zero-based rank of the member in the order of
+// scores.
+func (s *Storage) SortedSetRank(ctx context.Context, key, member string) (int, bool, error) {
+	engine, err := s.sortedSetEngine()
+	if err != nil {
+		return 0, false, err
+	}
+	return engine.SortedSetRank(ctx, key, member)
+}
+
+func (s *Storage) sortedSetEngine() (SortedSetEngine, error) {
+	engine, ok := s.engine.(SortedSetEngine)
+	if !ok {
+		return nil, fmt.Errorf("%w: sorted sets", ErrUnsupportedType)
+	}
+	return engine, nil
+}
+
+// applySortedSetAddLog replays ZAddOp and SortedSetOp logs: it adds the
+// members and sets the logged expiration time of the sorted set.
+func (s *Storage) applySortedSetAddLog(ctx context.Context, log wal.Log) error {
+	if len(log.Args) < 4 || len(log.Args)%2 != 0 {
+		return wal.ErrCorruptedLog
+	}
+
+	engine, err := s.sortedSetEngine()
+	if err != nil {
+		return err
+	}
+
+	members := make([]ScoredMember, 0, len(log.Args)/2-1)
+	for i := 2; i < len(log.Args); i += 2 {
+		score, err := wal.ParseScore(log.Args[i])
+		if err != nil {
+			return err
+		}
+		members = append(members, ScoredMember{Member: log.Args[i+1], Score: score})
+	}
+
+	key := log.Args[0]
+	if log.Op == wal.SortedSetOp {
+		if err := s.engine.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	if _, err := engine.SortedSetAdd(ctx, key, members); err != nil {
+		return err
+	}
+	return s.restoreExpiration(ctx, key, log.Args[1])
+}
+
+func (s *Storage) applySortedSetRemoveLog(ctx context.Context, log wal.Log) error {
+	if len(log.Args) < 2 {
+		return wal.ErrCorruptedLog
+	}
+
+	engine, err := s.sortedSetEngine()
+	if err != nil {
+		return err
+	}
+	_, err = engine.SortedSetRemove(ctx, log.Args[0], log.Args[1:])
+	return err
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dfuture"
+	"kv_db/pkg/dlog"
+)
+
+func TestStorage_SortedSetWrites(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("unsupported engine", func(t *testing.T) {
+		storage, err := NewStorage(getMockEngine(t), dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		_, err = storage.SortedSetAdd(ctx, "key", ScoredMember{Member: "member"})
+		require.Error(t, err)
+	})
+
+	t.Run("success with wal", func(t *testing.T) {
+		engine, journal := getMockSortedSetEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+		require.NoError(t, err)
+
+		members := []ScoredMember{{Member: "a", Score: 1.5}, {Member: "b", Score: -2}}
+		gomock.InOrder(
+			engine.EXPECT().SortedSetRank(ctx, "key", "a").Return(0, false, nil),
+			engine.EXPECT().SortedSetRank(ctx, "key", "b").Return(0, true, nil),
+			engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil),
+			journal.EXPECT().
+				Append(ctx, wal.ZAddOp, "key", "", "1.5", "a", "-2", "b").
+				Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().SortedSetAdd(ctx, "key", members).Return(1, nil),
+			engine.EXPECT().Persist(ctx, "key").Return(false, nil),
+			engine.EXPECT().SortedSetRank(ctx, "key", "a").Return(1, true, nil),
+			engine.EXPECT().SortedSetRank(ctx, "key", "c").Return(0, false, nil),
+			journal.EXPECT().Append(ctx, wal.ZRemOp, "key", "a", "c").Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().SortedSetRemove(ctx, "key", []string{"a", "c"}).Return(1, nil),
+			engine.EXPECT().SortedSetRank(ctx, "key", "c").Return(0, false, nil),
+		)
+
+		added, err := storage.SortedSetAdd(ctx, "key", members...)
+		require.NoError(t, err)
+		require.Equal(t, 1, added)
+		removed, err := storage.SortedSetRemove(ctx, "key", "a", "c")
+		require.NoError(t, err)
+		require.Equal(t, 1, removed)
+		removed, err = storage.SortedSetRemove(ctx, "key", "c")
+		require.NoError(t, err)
+		require.Zero(t, removed)
+	})
+}
+
+func TestStorage_RecoverSortedSets(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	expiresAt := time.Unix(110, 0)
+	engine, journal := getMockSortedSetEngine(t), getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{
+		wal.NewLog(1, wal.ZAddOp, "key", "", "1", "a", "2.5", "b"),
+		wal.NewLog(2, wal.ZRemOp, "key", "a"),
+		wal.NewLog(3, wal.SortedSetOp, "key", wal.FormatExpiration(expiresAt), "-inf", "c"),
+	}, nil)
+
+	gomock.InOrder(
+		engine.EXPECT().SortedSetAdd(ctx, "key", []ScoredMember{{Member: "a", Score: 1}, {Member: "b", Score: 2.5}}).
+			Return(2, nil),
+		engine.EXPECT().Persist(ctx, "key").Return(false, nil),
+		engine.EXPECT().SortedSetRemove(ctx, "key", []string{"a"}).Return(1, nil),
+		engine.EXPECT().Delete(ctx, "key").Return(nil),
+		engine.EXPECT().SortedSetAdd(ctx, "key", []ScoredMember{{Member: "c", Score: math.Inf(-1)}}).Return(1, nil),
+		engine.EXPECT().Expire(ctx, "key", expiresAt).Return(true, nil),
+	)
+
+	_, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.NoError(t, err)
+
+	for _, log := range []wal.Log{
+		wal.NewLog(1, wal.ZAddOp, "key", "", "1"),
+		wal.NewLog(1, wal.ZAddOp, "key", "", "score", "a"),
+	} {
+		journal = getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{log}, nil)
+		_, err = NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+		require.ErrorIs(t, err, wal.ErrCorruptedLog)
+	}
+}
+
+type mockSortedSetEngine struct {
+	*MockEngine
+	*MockSortedSetEngine
+}
+
+func getMockSortedSetEngine(t *testing.T) *mockSortedSetEngine {
+	t.Helper()
+
+	ctrl := gomock.NewController(t)
+	return &mockSortedSetEngine{
+		MockEngine:          NewMockEngine(ctrl),
+		MockSortedSetEngine: NewMockSortedSetEngine(ctrl),
+	}
+}
+
+func (e *mockSortedSetEngine) EXPECT() *mockSortedSetEngineRecorder {
+	return &mockSortedSetEngineRecorder{
+		MockEngineMockRecorder:          e.MockEngine.EXPECT(),
+		MockSortedSetEngineMockRecorder: e.MockSortedSetEngine.EXPECT(),
+	}
+}
+
+type mockSortedSetEngineRecorder struct {
+	*MockEngineMockRecorder
+	*MockSortedSetEngineMockRecorder
+}
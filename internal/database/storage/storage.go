@@ -3,21 +3,322 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kv_db/internal/database/storage/engine"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
+	"kv_db/pkg/dfuture"
+	"kv_db/pkg/dlog"
+)
+
+const (
+	defaultSweepInterval = 100 * time.Millisecond
+
+	// keysBatchSize is the number of keys that KEYS reads from the engine at
+	// once, so the engine isn't locked for the whole iteration.
+	keysBatchSize = 1000
+
+	// sweepLimit is the number of keys with an expiration time that are
+	// checked at once. If at least a quarter of them has expired, the sweep
+	// continues, because there are likely many more.
+	sweepLimit = 100
+)
+
+var (
+	ErrNotInteger = errors.New("value is not an integer")
+	ErrOverflow   = errors.New("increment or decrement would overflow")
+	ErrWrongType  = engine.ErrWrongType
+	// ErrVersionConflict is returned by SetIfVersion when the version of the
+	// key has changed.
+	ErrVersionConflict = errors.New("version of the key has changed")
+	// ErrMemoryLimit is returned by writes that don't fit into the memory
+	// limit of the engine.
+	ErrMemoryLimit = engine.ErrMemoryLimit
+	// ErrUnsupportedType is returned by the operations of lists, hashes, sets
+	// and sorted sets if the engine keeps strings only, like the lsm engine.
+	ErrUnsupportedType = errors.New("type isn't supported by the storage engine")
+	// ErrReadOnly is returned by writes to a replica.
+	ErrReadOnly = errors.New("READONLY you can't write against a read-only replica")
+)
+
+// SetCondition is the condition of a conditional write.
+type SetCondition int
+
+const (
+	// IfNotExists writes a key that doesn't exist.
+	IfNotExists SetCondition = iota
+	// IfExists writes a key that exists.
+	IfExists
 )
 
+// Batch collects puts and deletes that are applied atomically by
+// Storage.Apply.
+type Batch = engine.Batch
+
+// Write is a put or a delete of a batch.
+type Write = engine.Write
+
+func NewBatch() *Batch {
+	return engine.NewBatch()
+}
+
+// ScoredMember is a member of a sorted set with its score.
+type ScoredMember = engine.ScoredMember
+
+// NoExpiration is the TTL of a key that doesn't expire.
+const NoExpiration time.Duration = -1
+
+// Engine keeps expiration times as absolute times. Expired keys have to be
+// invisible for all operations even if they are not deleted yet.
 type Engine interface {
 	Set(context.Context, string, string) error
+	SetWithExpiration(context.Context, string, string, time.Time) error
 	Get(context.Context, string) (string, bool, error)
+	// GetWithVersion returns the value and the version of the key. Every
+	// write of a value gives the key a greater version, and a missing key
+	// has version 0.
+	GetWithVersion(context.Context, string) (string, uint64, bool, error)
 	Delete(context.Context, string) error
+	Expire(context.Context, string, time.Time) (bool, error)
+	Persist(context.Context, string) (bool, error)
+	Expiration(context.Context, string) (time.Time, bool, error)
+	DeleteExpired(context.Context, int) (int, error)
+	// Scan returns about the given number of keys that follow the cursor
+	// and the cursor of the next call, which is zero at the end. Keys that
+	// exist during the whole iteration are returned exactly once.
+	Scan(context.Context, uint64, int) ([]string, uint64, error)
+}
+
+type SnapshotEngine interface {
+	// Snapshot returns logs that recreate the current engine data. They are
+	// not changed by following mutations.
+	Snapshot(context.Context) ([]wal.Log, error)
+}
+
+// BatchEngine applies the writes of a batch atomically, so readers observe
+// either all or none of them.
+type BatchEngine interface {
+	Apply(context.Context, *Batch) error
+}
+
+// RangeEngine iterates keys in ascending order.
+type RangeEngine interface {
+	// Range calls yield for keys between start and end inclusively until
+	// yield returns false.
+	Range(ctx context.Context, start, end string, yield func(key, value string) bool) error
+}
+
+// ListEngine keeps lists besides strings. Operations fail with ErrWrongType
+// for keys of another type.
+type ListEngine interface {
+	// Push pushes the values to the left or the right end of the list one
+	// by one and returns the length of the list.
+	Push(ctx context.Context, key string, left bool, values []string) (int, error)
+	// Pop removes a value from the left or the right end of the list. The key
+	// is deleted with the last value.
+	Pop(ctx context.Context, key string, left bool) (string, bool, error)
+	// ListRange returns the values between the indexes inclusively. Negative
+	// indexes count from the right end.
+	ListRange(ctx context.Context, key string, start, stop int) ([]string, error)
+	ListLen(ctx context.Context, key string) (int, error)
+}
+
+// HashEngine keeps hashes, which map fields to values, besides strings.
+// Operations fail with ErrWrongType for keys of another type.
+type HashEngine interface {
+	// HashSet sets the fields to the values, which follow them in pairs, and
+	// returns the number of new fields.
+	HashSet(ctx context.Context, key string, pairs []string) (int, error)
+	HashGet(ctx context.Context, key, field string) (string, bool, error)
+	// HashDelete returns the number of deleted fields. The key is deleted
+	// with the last field.
+	HashDelete(ctx context.Context, key string, fields []string) (int, error)
+	HashGetAll(ctx context.Context, key string) (map[string]string, error)
+	HashLen(ctx context.Context, key string) (int, error)
+}
+
+// SetEngine keeps sets of unique members besides strings. Operations fail
+// with ErrWrongType for keys of another type.
+type SetEngine interface {
+	// SetAdd returns the number of new members.
+	SetAdd(ctx context.Context, key string, members []string) (int, error)
+	// SetRemove returns the number of removed members. The key is deleted
+	// with the last member.
+	SetRemove(ctx context.Context, key string, members []string) (int, error)
+	SetIsMember(ctx context.Context, key, member string) (bool, error)
+	// SetMembers returns the members in no particular order.
+	SetMembers(ctx context.Context, key string) ([]string, error)
+}
+
+// SortedSetEngine keeps sets of members ordered by scores besides strings.
+// Members with equal scores are ordered by themselves. Operations fail with
+// ErrWrongType for keys of another type.
+type SortedSetEngine interface {
+	// SortedSetAdd adds the members or updates their scores and returns the
+	// number of new members.
+	SortedSetAdd(ctx context.Context, key string, members []ScoredMember) (int, error)
+	// SortedSetRemove returns the number of removed members. The key is
+	// deleted with the last member.
+	SortedSetRemove(ctx context.Context, key string, members []string) (int, error)
+	// SortedSetRange returns the members between the ranks inclusively.
+	// Negative ranks count from the end.
+	SortedSetRange(ctx context.Context, key string, start, stop int) ([]ScoredMember, error)
+	// SortedSetRangeByScore returns the members with scores between the
+	// bounds inclusively.
+	SortedSetRangeByScore(ctx context.Context, key string, minScore, maxScore float64) ([]ScoredMember, error)
+	// SortedSetRank returns the zero-based rank of the member.
+	SortedSetRank(ctx context.Context, key, member string) (int, bool, error)
+}
+
+// DumpEngine is required by engines that keep collections, because changes
+// of their expiration times are logged with the whole value.
+type DumpEngine interface {
+	// Dump returns a log that recreates the key with its value and
+	// expiration time. It returns false if there is no such key.
+	Dump(context.Context, string) (wal.Log, bool, error)
+}
+
+// FlushEngine deletes all keys at once.
+type FlushEngine interface {
+	Flush(context.Context) error
+}
+
+type InfoEngine interface {
+	// Info returns engine statistics as named fields.
+	Info(context.Context) (map[string]string, error)
+}
+
+type WAL interface {
+	Recover(uint64) ([]wal.Log, error)
+	LastLSN() uint64
+	Truncate(uint64) error
+	Append(context.Context, wal.Op, ...string) *dfuture.Future[error]
+}
+
+// Consensus replicates logs between the nodes of a cluster, which apply them
+// to their storages in the same order.
+type Consensus interface {
+	// Propose returns after the log is committed and applied to this storage
+	// by ApplyChanges.
+	Propose(context.Context, wal.Log) error
+}
+
+type Snapshots interface {
+	Load() (uint64, []wal.Log, error)
+	// Write returns the LSN of the oldest snapshot that is kept.
+	Write(uint64, []wal.Log) (uint64, error)
+}
+
+type StorageOption func(*Storage)
+
+func WithClock(clock dclock.Clock) StorageOption {
+	return func(storage *Storage) {
+		storage.clock = clock
+	}
+}
+
+func WithSweepInterval(interval time.Duration) StorageOption {
+	return func(storage *Storage) {
+		storage.sweepInterval = interval
+	}
+}
+
+func WithWAL(wal WAL) StorageOption {
+	return func(storage *Storage) {
+		storage.wal = wal
+	}
+}
+
+func WithSnapshots(snapshots Snapshots, interval time.Duration) StorageOption {
+	return func(storage *Storage) {
+		storage.snapshots = snapshots
+		storage.snapshotInterval = interval
+	}
+}
+
+// WithReadOnly rejects writes with ErrReadOnly. The data of a read-only
+// storage is changed only by ApplyChanges.
+func WithReadOnly() StorageOption {
+	return func(storage *Storage) {
+		storage.readOnly = true
+	}
+}
+
+// WithReplicationBacklog keeps the given number of the last mutations for
+// replicas, which read them by Changes.
+func WithReplicationBacklog(size int) StorageOption {
+	return func(storage *Storage) {
+		storage.backlog = &backlog{size: size}
+	}
+}
+
+// WithConsensus replicates the logs of all writes by the consensus, and
+// ApplyChanges applies them. Writes that depend on the current state, like
+// INCR or CAS, are planned on the state of the node that receives them, which
+// can lag behind the cluster, so their logs are applied only if the keys are
+// still in the planned states, and they are planned again otherwise.
+func WithConsensus(consensus Consensus) StorageOption {
+	return func(storage *Storage) {
+		storage.consensus = consensus
+	}
+}
+
+// WithEvents reports the changes of the storage to the events. The events of
+// a key come in the order of the engine.
+func WithEvents(events Events) StorageOption {
+	return func(storage *Storage) {
+		storage.events = events
+	}
 }
 
 type Storage struct {
-	engine Engine
-	logger *slog.Logger
+	engine        Engine
+	wal           WAL
+	readOnly      bool
+	consensus     Consensus
+	clock         dclock.Clock
+	sweepInterval time.Duration
+	expiredKeys   atomic.Uint64
+	logger        *slog.Logger
+
+	snapshots        Snapshots
+	snapshotInterval time.Duration
+	snapshotMutex    sync.Mutex
+	snapshotLSN      uint64
+	// truncateLSN is the LSN of the oldest kept snapshot. The WAL is never
+	// truncated beyond it, because recovery falls back to that snapshot if
+	// the newer ones are damaged.
+	truncateLSN uint64
+
+	listSignals listSignals
+
+	// applyMutex keeps ApplyChanges from changing the keys while the plans
+	// of guarded logs read them, and guards has the outcomes of the guarded
+	// logs that the storage proposes.
+	applyMutex sync.RWMutex
+	guards     guards
+
+	// keys keep the order of the mutations of every key the same in the
+	// engine, in the WAL, in the backlog and in the events, so a replay
+	// produces the same state. Mutations of different keys commute, so they
+	// are applied concurrently, and their writers share a flush of the WAL.
+	keys    keyLocks
+	events  Events
+	backlog *backlog
+	// mutex guards the backlog.
+	mutex sync.Mutex
 }
 
-func NewStorage(engine Engine, logger *slog.Logger) (*Storage, error) {
+func NewStorage(engine Engine, logger *slog.Logger, options ...StorageOption) (*Storage, error) {
 	if engine == nil {
 		return nil, errors.New("storage engine is invalid")
 	}
@@ -25,25 +326,771 @@ func NewStorage(engine Engine, logger *slog.Logger) (*Storage, error) {
 	if logger == nil {
 		return nil, errors.New("storage logger is invalid")
 	}
-	return &Storage{engine: engine, logger: logger}, nil
+
+	storage := &Storage{
+		engine:        engine,
+		clock:         dclock.NewRealClock(),
+		sweepInterval: defaultSweepInterval,
+		logger:        logger,
+	}
+	for _, option := range options {
+		option(storage)
+	}
+
+	if storage.sweepInterval <= 0 {
+		return nil, errors.New("storage sweep interval is invalid")
+	}
+
+	if storage.snapshots != nil {
+		if _, ok := engine.(SnapshotEngine); !ok {
+			return nil, errors.New("storage engine doesn't support snapshots")
+		}
+
+		if storage.snapshotInterval <= 0 {
+			return nil, errors.New("storage snapshot interval is invalid")
+		}
+	}
+
+	if storage.backlog != nil {
+		if _, ok := engine.(SnapshotEngine); !ok {
+			return nil, errors.New("storage engine doesn't support snapshots")
+		}
+
+		if err := storage.backlog.init(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := storage.recover(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return storage, nil
 }
 
-func MustStorage(engine Engine, logger *slog.Logger) *Storage {
-	storage, err := NewStorage(engine, logger)
+func MustStorage(engine Engine, logger *slog.Logger, options ...StorageOption) *Storage {
+	storage, err := NewStorage(engine, logger, options...)
 	if err != nil {
 		panic(err)
 	}
 	return storage
 }
 
+// Set returns after the mutation is durable when the WAL is enabled. The
+// engine is updated only after that, so other connections never observe a
+// value that can be lost by a restart. With the consensus, Set returns after
+// the value is committed by the cluster and applied to the engine.
 func (s *Storage) Set(ctx context.Context, key string, value string) error {
-	return s.engine.Set(ctx, key, value)
+	return s.write(ctx, []string{key}, newLog(wal.SetOp, key, value))
+}
+
+// SetWithTTL sets the value that expires after the TTL.
+func (s *Storage) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	expiresAt := s.clock.Now().Add(ttl)
+	return s.write(ctx, []string{key}, newLog(wal.SetOp, key, value, wal.FormatExpiration(expiresAt)))
+}
+
+// SetIf sets the value if the condition holds and returns whether it has
+// been set. A zero TTL means that the key doesn't expire.
+func (s *Storage) SetIf(
+	ctx context.Context, key, value string, ttl time.Duration, condition SetCondition,
+) (bool, error) {
+	var expiresAt time.Time
+	if ttl != 0 {
+		expiresAt = s.clock.Now().Add(ttl)
+	}
+
+	return s.setIf(ctx, key, value, expiresAt, func(_ string, exists bool) bool {
+		return exists == (condition == IfExists)
+	})
+}
+
+// CompareAndSwap sets the value if the current value of the key equals the
+// expected one and returns whether it has been set. Like SET, it removes the
+// TTL of the key.
+func (s *Storage) CompareAndSwap(ctx context.Context, key, expected, value string) (bool, error) {
+	return s.setIf(ctx, key, value, time.Time{}, func(current string, exists bool) bool {
+		return exists && current == expected
+	})
+}
+
+func (s *Storage) setIf(
+	ctx context.Context, key, value string, expiresAt time.Time, condition func(string, bool) bool,
+) (bool, error) {
+	return s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		current, exists, err := s.engine.Get(ctx, key)
+		if errors.Is(err, ErrWrongType) {
+			// A collection is overwritten like a string.
+			exists, err = true, nil
+		}
+		if err != nil || !condition(current, exists) {
+			return nil, err
+		}
+
+		if expiresAt.IsZero() {
+			return newLog(wal.SetOp, key, value), nil
+		}
+		return newLog(wal.SetOp, key, value, wal.FormatExpiration(expiresAt)), nil
+	})
+}
+
+// Increment adds the delta to the integer value of the key and returns the
+// result. A key that doesn't exist is treated as 0.
+func (s *Storage) Increment(ctx context.Context, key string, delta int64) (int64, error) {
+	var result int64
+	_, err := s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		current, exists, err := s.engine.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		var number int64
+		if exists {
+			if number, err = strconv.ParseInt(current, 10, 64); err != nil {
+				return nil, ErrNotInteger
+			}
+		}
+
+		if (delta > 0 && number > math.MaxInt64-delta) || (delta < 0 && number < math.MinInt64-delta) {
+			return nil, ErrOverflow
+		}
+		result = number + delta
+		return s.valueLog(ctx, key, strconv.FormatInt(result, 10))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result, nil
 }
 
 func (s *Storage) Get(ctx context.Context, key string) (string, bool, error) {
 	return s.engine.Get(ctx, key)
 }
 
+// GetWithVersion returns the value and the version of the key.
+func (s *Storage) GetWithVersion(ctx context.Context, key string) (string, uint64, bool, error) {
+	return s.engine.GetWithVersion(ctx, key)
+}
+
+// SetIfVersion sets the value if the version of the key equals the expected
+// one and returns the new version. The expected version of a missing key is
+// 0. Like SET, it removes the TTL of the key.
+func (s *Storage) SetIfVersion(ctx context.Context, key, value string, expected uint64) (uint64, error) {
+	var version uint64
+	_, err := s.mutateThen(ctx, []string{key}, func() (*wal.Log, error) {
+		_, current, _, err := s.engine.GetWithVersion(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if current != expected {
+			return nil, ErrVersionConflict
+		}
+		return newLog(wal.SetOp, key, value), nil
+	}, func() error {
+		var err error
+		_, version, _, err = s.engine.GetWithVersion(ctx, key)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
 func (s *Storage) Delete(ctx context.Context, key string) error {
-	return s.engine.Delete(ctx, key)
+	return s.write(ctx, []string{key}, newLog(wal.DelOp, key))
+}
+
+// Flush deletes all keys of the storage.
+func (s *Storage) Flush(ctx context.Context) error {
+	if _, ok := s.engine.(FlushEngine); !ok {
+		return errors.New("storage engine doesn't support flush")
+	}
+
+	return s.write(ctx, nil, newLog(wal.FlushOp))
+}
+
+// Expire sets the TTL of an existing key. It returns false if there is no
+// such key.
+func (s *Storage) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	expiresAt := s.clock.Now().Add(ttl)
+	return s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		_, ok, err := s.engine.Expiration(ctx, key)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return s.keyLog(ctx, key, wal.FormatExpiration(expiresAt))
+	})
+}
+
+// Persist removes the TTL of a key. It returns false if there is no such key
+// or it doesn't have a TTL.
+func (s *Storage) Persist(ctx context.Context, key string) (bool, error) {
+	return s.mutate(ctx, []string{key}, func() (*wal.Log, error) {
+		expiresAt, ok, err := s.engine.Expiration(ctx, key)
+		if err != nil || !ok || expiresAt.IsZero() {
+			return nil, err
+		}
+		return s.keyLog(ctx, key, "")
+	})
+}
+
+// Commit applies the writes of the transaction atomically. They are logged
+// as a single batch, so a recovery restores either all or none of them.
+//
+// Transactions are isolated only by buffering: a transaction reads the
+// latest committed values together with its own writes, and concurrent
+// commits of the same keys are not detected, so the last one wins.
+func (s *Storage) Commit(ctx context.Context, tx *Transaction) error {
+	return s.Apply(ctx, tx.batch(s.clock.Now()))
+}
+
+// Apply applies the writes of the batch atomically. They are logged as a
+// single BatchOp log, so a recovery restores either all or none of them.
+func (s *Storage) Apply(ctx context.Context, batch *Batch) error {
+	if _, ok := s.engine.(BatchEngine); !ok {
+		return errors.New("storage engine doesn't support batches")
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	log := batchLog(batch)
+	return s.write(ctx, batchKeys(batch), &log)
+}
+
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Range returns at most limit keys between start and end inclusively in
+// ascending order. A non-positive limit means no limit.
+func (s *Storage) Range(ctx context.Context, start, end string, limit int) ([]KeyValue, error) {
+	engine, ok := s.engine.(RangeEngine)
+	if !ok {
+		return nil, errors.New("storage engine doesn't support ranges")
+	}
+
+	var pairs []KeyValue
+	err := engine.Range(ctx, start, end, func(key, value string) bool {
+		pairs = append(pairs, KeyValue{Key: key, Value: value})
+		return limit <= 0 || len(pairs) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// Scan returns the keys of an iteration step that match the glob pattern and
+// the cursor of the next step. The pattern is applied after the keys are
+// read, so a step may return no keys before the iteration is over.
+func (s *Storage) Scan(ctx context.Context, cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	keys, next, err := s.engine.Scan(ctx, cursor, count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matched := keys[:0]
+	for _, key := range keys {
+		ok, err := path.Match(pattern, key)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			matched = append(matched, key)
+		}
+	}
+	return matched, next, nil
+}
+
+// Keys returns all keys that match the glob pattern in ascending order.
+func (s *Storage) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	cursor := uint64(0)
+	for {
+		batch, next, err := s.Scan(ctx, cursor, pattern, keysBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+
+		if next == 0 {
+			sort.Strings(keys)
+			return keys, nil
+		}
+		cursor = next
+	}
+}
+
+// TTL returns the remaining time to live of a key or NoExpiration if the key
+// doesn't expire.
+func (s *Storage) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	expiresAt, ok, err := s.engine.Expiration(ctx, key)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	if expiresAt.IsZero() {
+		return NoExpiration, true, nil
+	}
+	return expiresAt.Sub(s.clock.Now()), true, nil
+}
+
+// keyLog returns a log that sets the current value of the key with the
+// formatted expiration time, which is empty if the key doesn't expire.
+// Changes of the expiration time are logged this way, because an expiring
+// key can be already expired when the log is replayed.
+func (s *Storage) keyLog(ctx context.Context, key, expiration string) (*wal.Log, error) {
+	value, ok, err := s.engine.Get(ctx, key)
+	if errors.Is(err, ErrWrongType) {
+		log, err := s.dumpLog(ctx, key)
+		if err != nil || log.Op == wal.DelOp {
+			return log, err
+		}
+		// Collections are dumped with the expiration time after the key.
+		log.Args[1] = expiration
+		return log, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !ok:
+		return newLog(wal.DelOp, key), nil
+	case expiration == "":
+		return newLog(wal.SetOp, key, value), nil
+	}
+	return newLog(wal.SetOp, key, value, expiration), nil
+}
+
+// dumpLog returns a log that recreates a collection, which can't be logged as
+// a SetOp.
+func (s *Storage) dumpLog(ctx context.Context, key string) (*wal.Log, error) {
+	engine, ok := s.engine.(DumpEngine)
+	if !ok {
+		return nil, errors.New("storage engine doesn't support dumps")
+	}
+
+	log, ok, err := engine.Dump(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return newLog(wal.DelOp, key), nil
+	}
+	return &log, nil
+}
+
+// expirationArg returns the expiration time of a collection formatted for the
+// log of a write. It is logged, because the collection that is written
+// to can be already expired when the log is replayed.
+func (s *Storage) expirationArg(ctx context.Context, key string) (string, error) {
+	expiresAt, _, err := s.engine.Expiration(ctx, key)
+	if err != nil || expiresAt.IsZero() {
+		return "", err
+	}
+	return wal.FormatExpiration(expiresAt), nil
+}
+
+// restoreExpiration sets the expiration time of a collection that is written
+// by a replayed log.
+func (s *Storage) restoreExpiration(ctx context.Context, key, expiration string) error {
+	if expiration == "" {
+		_, err := s.engine.Persist(ctx, key)
+		return err
+	}
+
+	expiresAt, err := wal.ParseExpiration(expiration)
+	if err != nil {
+		return err
+	}
+	_, err = s.engine.Expire(ctx, key, expiresAt)
+	return err
+}
+
+// valueLog returns a log that sets the value of the key with its current
+// expiration time.
+func (s *Storage) valueLog(ctx context.Context, key, value string) (*wal.Log, error) {
+	expiresAt, _, err := s.engine.Expiration(ctx, key)
+	switch {
+	case err != nil:
+		return nil, err
+	case expiresAt.IsZero():
+		return newLog(wal.SetOp, key, value), nil
+	}
+	return newLog(wal.SetOp, key, value, wal.FormatExpiration(expiresAt)), nil
+}
+
+// mutate appends the log of a mutation of the keys, which the plan returns,
+// to the WAL and applies it to the engine after it is durable, so a write
+// that fails is never observed. Then the log is reported to the events and
+// appended to the replication backlog. Nil keys mean all keys. With the
+// consensus, the log is proposed instead and applied by ApplyChanges when it
+// is committed.
+//
+// The keys are locked, so the plan reads the state that the log is applied
+// to. The plan validates the mutation, and a nil log means that nothing has
+// to be changed. The engine can still reject a durable log over its memory
+// limit, and the recovery skips such a log as well.
+//
+// The consensus applies the logs of other nodes without the locks, so the
+// log is proposed together with the states of the keys that the plan has
+// read, and it is applied only if the keys still have them. Otherwise the
+// plan runs again on the state that has the conflicting logs.
+func (s *Storage) mutate(ctx context.Context, keys []string, plan func() (*wal.Log, error)) (bool, error) {
+	return s.mutateThen(ctx, keys, plan, nil)
+}
+
+// mutateThen is mutate that calls the action after the log is applied, while
+// the keys are still locked.
+func (s *Storage) mutateThen(
+	ctx context.Context, keys []string, plan func() (*wal.Log, error), action func() error,
+) (bool, error) {
+	return s.execute(ctx, keys, plan, action, true)
+}
+
+// write is mutate of a log that doesn't depend on the current state of the
+// keys, so the consensus applies it unconditionally.
+func (s *Storage) write(ctx context.Context, keys []string, log *wal.Log) error {
+	_, err := s.execute(ctx, keys, func() (*wal.Log, error) {
+		return log, nil
+	}, nil, false)
+	return err
+}
+
+func (s *Storage) execute(
+	ctx context.Context, keys []string, plan func() (*wal.Log, error), action func() error, guarded bool,
+) (bool, error) {
+	if s.readOnly {
+		return false, ErrReadOnly
+	}
+
+	unlock := s.lock(keys)
+	defer unlock()
+
+	for {
+		var log *wal.Log
+		var err error
+		applied := true
+		switch {
+		case s.consensus == nil:
+			if log, err = plan(); err == nil && log != nil {
+				err = s.commit(ctx, *log)
+			}
+		case guarded:
+			var states []string
+			if log, states, err = s.planGuarded(ctx, keys, plan); err == nil && log != nil {
+				applied, err = s.proposeGuarded(ctx, *log, states)
+			}
+		default:
+			if log, err = plan(); err == nil && log != nil {
+				err = s.consensus.Propose(ctx, *log)
+			}
+		}
+		if err != nil || log == nil {
+			return false, err
+		}
+		if !applied {
+			continue
+		}
+
+		if action != nil {
+			return true, action()
+		}
+		return true, nil
+	}
+}
+
+// commit appends the log to the WAL, applies it after it is durable and
+// reports it to the events and the replication backlog.
+func (s *Storage) commit(ctx context.Context, log wal.Log) error {
+	if s.wal != nil {
+		if err := s.wal.Append(ctx, log.Op, log.Args...).Get(); err != nil {
+			return err
+		}
+	}
+	if err := s.applyLog(ctx, log); err != nil {
+		return err
+	}
+
+	s.notify(log)
+	if s.backlog != nil {
+		_ = s.withLog(func() error {
+			s.backlog.append(log)
+			return nil
+		})
+	}
+	return nil
+}
+
+// lock locks the keys, or all keys if they are nil, and returns the function
+// that unlocks them.
+func (s *Storage) lock(keys []string) func() {
+	if keys == nil {
+		return s.keys.lockAll()
+	}
+	return s.keys.lock(keys)
+}
+
+// countMissing returns the number of the unique elements of a collection
+// that it doesn't contain yet. Checks of a key of another type fail with
+// ErrWrongType, so they validate the writes to the collection as well.
+func countMissing(elements []string, contains func(string) (bool, error)) (int, error) {
+	missing := 0
+	seen := make(map[string]struct{}, len(elements))
+	for _, element := range elements {
+		if _, ok := seen[element]; ok {
+			continue
+		}
+		seen[element] = struct{}{}
+
+		ok, err := contains(element)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			missing++
+		}
+	}
+	return missing, nil
+}
+
+func countUnique(elements []string) int {
+	seen := make(map[string]struct{}, len(elements))
+	for _, element := range elements {
+		seen[element] = struct{}{}
+	}
+	return len(seen)
+}
+
+func newLog(op wal.Op, args ...string) *wal.Log {
+	log := wal.NewLog(0, op, args...)
+	return &log
+}
+
+func (s *Storage) withLog(action func() error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return action()
+}
+
+// Start takes snapshots and deletes expired keys periodically until the
+// context is done.
+func (s *Storage) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	if s.snapshots != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runPeriodically(ctx, s.snapshotInterval, s.Snapshot, "failed to take snapshot")
+		}()
+	}
+
+	s.runPeriodically(ctx, s.sweepInterval, s.Sweep, "failed to delete expired keys")
+}
+
+func (s *Storage) runPeriodically(
+	ctx context.Context, interval time.Duration, action func(context.Context) error, errMessage string,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := action(ctx); err != nil {
+				s.logger.Error(errMessage, dlog.ErrAttr(err))
+			}
+		}
+	}
+}
+
+// Sweep deletes expired keys from the engine. Deletions are not logged,
+// because expired keys are invisible after a recovery anyway.
+func (s *Storage) Sweep(ctx context.Context) error {
+	for ctx.Err() == nil {
+		deleted, err := s.engine.DeleteExpired(ctx, sweepLimit)
+		if err != nil {
+			return err
+		}
+		s.expiredKeys.Add(uint64(deleted))
+
+		if deleted < sweepLimit/4 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Info returns the engine statistics, if the engine provides them, together
+// with the number of keys deleted by the sweeper.
+func (s *Storage) Info(ctx context.Context) (map[string]string, error) {
+	info := make(map[string]string)
+	if engine, ok := s.engine.(InfoEngine); ok {
+		var err error
+		if info, err = engine.Info(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	info["expired_keys"] = strconv.FormatUint(s.expiredKeys.Load(), 10)
+	return info, nil
+}
+
+// Snapshot writes a point-in-time copy of the engine and removes the WAL
+// segments that are covered by the oldest kept snapshot. The copy is taken together with the last
+// LSN, so the snapshot contains exactly the mutations up to that LSN, and
+// only the copy blocks writers. Encoding and writing happen concurrently
+// with the traffic.
+func (s *Storage) Snapshot(ctx context.Context) error {
+	if s.snapshots == nil {
+		return errors.New("snapshots are disabled")
+	}
+
+	s.snapshotMutex.Lock()
+	defer s.snapshotMutex.Unlock()
+
+	var lsn uint64
+	unlock := s.keys.lockAll()
+	if s.wal != nil {
+		lsn = s.wal.LastLSN()
+	}
+	logs, err := s.engine.(SnapshotEngine).Snapshot(ctx)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	// The WAL is truncated even if nothing has changed, because the logs up
+	// to the LSN could still be unflushed at the time of the previous
+	// truncation.
+	if lsn == 0 || lsn != s.snapshotLSN {
+		oldestLSN, err := s.snapshots.Write(lsn, logs)
+		if err != nil {
+			return err
+		}
+		s.snapshotLSN, s.truncateLSN = lsn, oldestLSN
+		s.logger.Info("snapshot is taken", slog.Uint64("lsn", lsn), slog.Int("logs", len(logs)))
+	}
+
+	if s.wal != nil {
+		if err := s.wal.Truncate(s.truncateLSN); err != nil {
+			return fmt.Errorf("failed to truncate wal: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// recover loads the newest snapshot and replays the WAL logs that follow it.
+func (s *Storage) recover(ctx context.Context) error {
+	if s.snapshots != nil {
+		lsn, logs, err := s.snapshots.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load snapshot: %w", err)
+		}
+
+		for _, log := range logs {
+			if err := s.applyLog(ctx, log); err != nil {
+				return fmt.Errorf("failed to apply snapshot: %w", err)
+			}
+		}
+
+		s.snapshotLSN = lsn
+		s.logger.Info("storage is recovered from snapshot", slog.Uint64("lsn", lsn), slog.Int("logs", len(logs)))
+	}
+
+	if s.wal == nil {
+		return nil
+	}
+
+	logs, err := s.wal.Recover(s.snapshotLSN)
+	if err != nil {
+		return fmt.Errorf("failed to recover wal: %w", err)
+	}
+
+	for _, log := range logs {
+		err := s.applyLog(ctx, log)
+		if errors.Is(err, ErrMemoryLimit) {
+			// A logged write that the engine rejects doesn't change it.
+			s.logger.Warn("log exceeds memory limit", slog.Uint64("lsn", log.LSN))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply log %d: %w", log.LSN, err)
+		}
+	}
+
+	s.logger.Info("storage is recovered from wal", slog.Int("logs", len(logs)))
+	return nil
+}
+
+func (s *Storage) applyLog(ctx context.Context, log wal.Log) error {
+	switch log.Op {
+	case wal.SetOp:
+		if len(log.Args) == 2 {
+			return s.engine.Set(ctx, log.Args[0], log.Args[1])
+		}
+		if len(log.Args) != 3 {
+			return wal.ErrCorruptedLog
+		}
+
+		expiresAt, err := wal.ParseExpiration(log.Args[2])
+		if err != nil {
+			return err
+		}
+		return s.engine.SetWithExpiration(ctx, log.Args[0], log.Args[1], expiresAt)
+	case wal.DelOp:
+		if len(log.Args) != 1 {
+			return wal.ErrCorruptedLog
+		}
+		return s.engine.Delete(ctx, log.Args[0])
+	case wal.BatchOp:
+		batch, err := parseBatchLog(log)
+		if err != nil {
+			return err
+		}
+
+		engine, ok := s.engine.(BatchEngine)
+		if !ok {
+			return errors.New("storage engine doesn't support batches")
+		}
+		return engine.Apply(ctx, batch)
+	case wal.LPushOp, wal.RPushOp, wal.ListOp:
+		return s.applyListLog(ctx, log)
+	case wal.LPopOp, wal.RPopOp:
+		return s.applyPopLog(ctx, log)
+	case wal.HSetOp, wal.HashOp:
+		return s.applyHashSetLog(ctx, log)
+	case wal.HDelOp:
+		return s.applyHashDeleteLog(ctx, log)
+	case wal.SAddOp, wal.MembersOp:
+		return s.applySetAddLog(ctx, log)
+	case wal.SRemOp:
+		return s.applySetRemoveLog(ctx, log)
+	case wal.ZAddOp, wal.SortedSetOp:
+		return s.applySortedSetAddLog(ctx, log)
+	case wal.ZRemOp:
+		return s.applySortedSetRemoveLog(ctx, log)
+	case wal.FlushOp:
+		engine, ok := s.engine.(FlushEngine)
+		if !ok {
+			return errors.New("storage engine doesn't support flush")
+		}
+		return engine.Flush(ctx)
+	case wal.GuardOp:
+		return errors.New("guarded log is applied only by the consensus")
+	case wal.UnknownOp:
+	}
+
+	return fmt.Errorf("unknown wal operation %d", log.Op)
 }
@@ -11,7 +11,10 @@ package storage
 
 import (
 	context "context"
+	wal "kv_db/internal/database/storage/wal"
+	dfuture "kv_db/pkg/dfuture"
 	reflect "reflect"
+	time "time"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -53,6 +56,52 @@ func (mr *MockEngineMockRecorder) Delete(arg0, arg1 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockEngine)(nil).Delete), arg0, arg1)
 }
 
+// DeleteExpired mocks base method.
+func (m *MockEngine) DeleteExpired(arg0 context.Context, arg1 int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpired", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpired indicates an expected call of DeleteExpired.
+func (mr *MockEngineMockRecorder) DeleteExpired(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpired", reflect.TypeOf((*MockEngine)(nil).DeleteExpired), arg0, arg1)
+}
+
+// Expiration mocks base method.
+func (m *MockEngine) Expiration(arg0 context.Context, arg1 string) (time.Time, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Expiration", arg0, arg1)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Expiration indicates an expected call of Expiration.
+func (mr *MockEngineMockRecorder) Expiration(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expiration", reflect.TypeOf((*MockEngine)(nil).Expiration), arg0, arg1)
+}
+
+// Expire mocks base method.
+func (m *MockEngine) Expire(arg0 context.Context, arg1 string, arg2 time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Expire", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Expire indicates an expected call of Expire.
+func (mr *MockEngineMockRecorder) Expire(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expire", reflect.TypeOf((*MockEngine)(nil).Expire), arg0, arg1, arg2)
+}
+
 // Get mocks base method.
 func (m *MockEngine) Get(arg0 context.Context, arg1 string) (string, bool, error) {
 	m.ctrl.T.Helper()
@@ -69,6 +118,54 @@ func (mr *MockEngineMockRecorder) Get(arg0, arg1 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockEngine)(nil).Get), arg0, arg1)
 }
 
+// GetWithVersion mocks base method.
+func (m *MockEngine) GetWithVersion(arg0 context.Context, arg1 string) (string, uint64, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWithVersion", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(uint64)
+	ret2, _ := ret[2].(bool)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// GetWithVersion indicates an expected call of GetWithVersion.
+func (mr *MockEngineMockRecorder) GetWithVersion(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithVersion", reflect.TypeOf((*MockEngine)(nil).GetWithVersion), arg0, arg1)
+}
+
+// Persist mocks base method.
+func (m *MockEngine) Persist(arg0 context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Persist", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Persist indicates an expected call of Persist.
+func (mr *MockEngineMockRecorder) Persist(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Persist", reflect.TypeOf((*MockEngine)(nil).Persist), arg0, arg1)
+}
+
+// Scan mocks base method.
+func (m *MockEngine) Scan(arg0 context.Context, arg1 uint64, arg2 int) ([]string, uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Scan", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(uint64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Scan indicates an expected call of Scan.
+func (mr *MockEngineMockRecorder) Scan(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scan", reflect.TypeOf((*MockEngine)(nil).Scan), arg0, arg1, arg2)
+}
+
 // Set mocks base method.
 func (m *MockEngine) Set(arg0 context.Context, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
@@ -82,3 +179,784 @@ func (mr *MockEngineMockRecorder) Set(arg0, arg1, arg2 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockEngine)(nil).Set), arg0, arg1, arg2)
 }
+
+// SetWithExpiration mocks base method.
+func (m *MockEngine) SetWithExpiration(arg0 context.Context, arg1, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetWithExpiration", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetWithExpiration indicates an expected call of SetWithExpiration.
+func (mr *MockEngineMockRecorder) SetWithExpiration(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWithExpiration", reflect.TypeOf((*MockEngine)(nil).SetWithExpiration), arg0, arg1, arg2, arg3)
+}
+
+// MockSnapshotEngine is a mock of SnapshotEngine interface.
+type MockSnapshotEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockSnapshotEngineMockRecorder
+}
+
+// MockSnapshotEngineMockRecorder is the mock recorder for MockSnapshotEngine.
+type MockSnapshotEngineMockRecorder struct {
+	mock *MockSnapshotEngine
+}
+
+// NewMockSnapshotEngine creates a new mock instance.
+func NewMockSnapshotEngine(ctrl *gomock.Controller) *MockSnapshotEngine {
+	mock := &MockSnapshotEngine{ctrl: ctrl}
+	mock.recorder = &MockSnapshotEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSnapshotEngine) EXPECT() *MockSnapshotEngineMockRecorder {
+	return m.recorder
+}
+
+// Snapshot mocks base method.
+func (m *MockSnapshotEngine) Snapshot(arg0 context.Context) ([]wal.Log, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Snapshot", arg0)
+	ret0, _ := ret[0].([]wal.Log)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Snapshot indicates an expected call of Snapshot.
+func (mr *MockSnapshotEngineMockRecorder) Snapshot(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Snapshot", reflect.TypeOf((*MockSnapshotEngine)(nil).Snapshot), arg0)
+}
+
+// MockBatchEngine is a mock of BatchEngine interface.
+type MockBatchEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockBatchEngineMockRecorder
+}
+
+// MockBatchEngineMockRecorder is the mock recorder for MockBatchEngine.
+type MockBatchEngineMockRecorder struct {
+	mock *MockBatchEngine
+}
+
+// NewMockBatchEngine creates a new mock instance.
+func NewMockBatchEngine(ctrl *gomock.Controller) *MockBatchEngine {
+	mock := &MockBatchEngine{ctrl: ctrl}
+	mock.recorder = &MockBatchEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBatchEngine) EXPECT() *MockBatchEngineMockRecorder {
+	return m.recorder
+}
+
+// Apply mocks base method.
+func (m *MockBatchEngine) Apply(arg0 context.Context, arg1 *Batch) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Apply", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Apply indicates an expected call of Apply.
+func (mr *MockBatchEngineMockRecorder) Apply(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Apply", reflect.TypeOf((*MockBatchEngine)(nil).Apply), arg0, arg1)
+}
+
+// MockRangeEngine is a mock of RangeEngine interface.
+type MockRangeEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockRangeEngineMockRecorder
+}
+
+// MockRangeEngineMockRecorder is the mock recorder for MockRangeEngine.
+type MockRangeEngineMockRecorder struct {
+	mock *MockRangeEngine
+}
+
+// NewMockRangeEngine creates a new mock instance.
+func NewMockRangeEngine(ctrl *gomock.Controller) *MockRangeEngine {
+	mock := &MockRangeEngine{ctrl: ctrl}
+	mock.recorder = &MockRangeEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRangeEngine) EXPECT() *MockRangeEngineMockRecorder {
+	return m.recorder
+}
+
+// Range mocks base method.
+func (m *MockRangeEngine) Range(ctx context.Context, start, end string, yield func(string, string) bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Range", ctx, start, end, yield)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Range indicates an expected call of Range.
+func (mr *MockRangeEngineMockRecorder) Range(ctx, start, end, yield any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Range", reflect.TypeOf((*MockRangeEngine)(nil).Range), ctx, start, end, yield)
+}
+
+// MockListEngine is a mock of ListEngine interface.
+type MockListEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockListEngineMockRecorder
+}
+
+// MockListEngineMockRecorder is the mock recorder for MockListEngine.
+type MockListEngineMockRecorder struct {
+	mock *MockListEngine
+}
+
+// NewMockListEngine creates a new mock instance.
+func NewMockListEngine(ctrl *gomock.Controller) *MockListEngine {
+	mock := &MockListEngine{ctrl: ctrl}
+	mock.recorder = &MockListEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockListEngine) EXPECT() *MockListEngineMockRecorder {
+	return m.recorder
+}
+
+// ListLen mocks base method.
+func (m *MockListEngine) ListLen(ctx context.Context, key string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLen", ctx, key)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLen indicates an expected call of ListLen.
+func (mr *MockListEngineMockRecorder) ListLen(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLen", reflect.TypeOf((*MockListEngine)(nil).ListLen), ctx, key)
+}
+
+// ListRange mocks base method.
+func (m *MockListEngine) ListRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListRange", ctx, key, start, stop)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListRange indicates an expected call of ListRange.
+func (mr *MockListEngineMockRecorder) ListRange(ctx, key, start, stop any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRange", reflect.TypeOf((*MockListEngine)(nil).ListRange), ctx, key, start, stop)
+}
+
+// Pop mocks base method.
+func (m *MockListEngine) Pop(ctx context.Context, key string, left bool) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pop", ctx, key, left)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Pop indicates an expected call of Pop.
+func (mr *MockListEngineMockRecorder) Pop(ctx, key, left any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pop", reflect.TypeOf((*MockListEngine)(nil).Pop), ctx, key, left)
+}
+
+// Push mocks base method.
+func (m *MockListEngine) Push(ctx context.Context, key string, left bool, values []string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Push", ctx, key, left, values)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Push indicates an expected call of Push.
+func (mr *MockListEngineMockRecorder) Push(ctx, key, left, values any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Push", reflect.TypeOf((*MockListEngine)(nil).Push), ctx, key, left, values)
+}
+
+// MockHashEngine is a mock of HashEngine interface.
+type MockHashEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockHashEngineMockRecorder
+}
+
+// MockHashEngineMockRecorder is the mock recorder for MockHashEngine.
+type MockHashEngineMockRecorder struct {
+	mock *MockHashEngine
+}
+
+// NewMockHashEngine creates a new mock instance.
+func NewMockHashEngine(ctrl *gomock.Controller) *MockHashEngine {
+	mock := &MockHashEngine{ctrl: ctrl}
+	mock.recorder = &MockHashEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHashEngine) EXPECT() *MockHashEngineMockRecorder {
+	return m.recorder
+}
+
+// HashDelete mocks base method.
+func (m *MockHashEngine) HashDelete(ctx context.Context, key string, fields []string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashDelete", ctx, key, fields)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HashDelete indicates an expected call of HashDelete.
+func (mr *MockHashEngineMockRecorder) HashDelete(ctx, key, fields any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashDelete", reflect.TypeOf((*MockHashEngine)(nil).HashDelete), ctx, key, fields)
+}
+
+// HashGet mocks base method.
+func (m *MockHashEngine) HashGet(ctx context.Context, key, field string) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashGet", ctx, key, field)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// HashGet indicates an expected call of HashGet.
+func (mr *MockHashEngineMockRecorder) HashGet(ctx, key, field any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashGet", reflect.TypeOf((*MockHashEngine)(nil).HashGet), ctx, key, field)
+}
+
+// HashGetAll mocks base method.
+func (m *MockHashEngine) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashGetAll", ctx, key)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HashGetAll indicates an expected call of HashGetAll.
+func (mr *MockHashEngineMockRecorder) HashGetAll(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashGetAll", reflect.TypeOf((*MockHashEngine)(nil).HashGetAll), ctx, key)
+}
+
+// HashLen mocks base method.
+func (m *MockHashEngine) HashLen(ctx context.Context, key string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashLen", ctx, key)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HashLen indicates an expected call of HashLen.
+func (mr *MockHashEngineMockRecorder) HashLen(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashLen", reflect.TypeOf((*MockHashEngine)(nil).HashLen), ctx, key)
+}
+
+// HashSet mocks base method.
+func (m *MockHashEngine) HashSet(ctx context.Context, key string, pairs []string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashSet", ctx, key, pairs)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HashSet indicates an expected call of HashSet.
+func (mr *MockHashEngineMockRecorder) HashSet(ctx, key, pairs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashSet", reflect.TypeOf((*MockHashEngine)(nil).HashSet), ctx, key, pairs)
+}
+
+// MockSetEngine is a mock of SetEngine interface.
+type MockSetEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockSetEngineMockRecorder
+}
+
+// MockSetEngineMockRecorder is the mock recorder for MockSetEngine.
+type MockSetEngineMockRecorder struct {
+	mock *MockSetEngine
+}
+
+// NewMockSetEngine creates a new mock instance.
+func NewMockSetEngine(ctrl *gomock.Controller) *MockSetEngine {
+	mock := &MockSetEngine{ctrl: ctrl}
+	mock.recorder = &MockSetEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSetEngine) EXPECT() *MockSetEngineMockRecorder {
+	return m.recorder
+}
+
+// SetAdd mocks base method.
+func (m *MockSetEngine) SetAdd(ctx context.Context, key string, members []string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAdd", ctx, key, members)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetAdd indicates an expected call of SetAdd.
+func (mr *MockSetEngineMockRecorder) SetAdd(ctx, key, members any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAdd", reflect.TypeOf((*MockSetEngine)(nil).SetAdd), ctx, key, members)
+}
+
+// SetIsMember mocks base method.
+func (m *MockSetEngine) SetIsMember(ctx context.Context, key, member string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetIsMember", ctx, key, member)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetIsMember indicates an expected call of SetIsMember.
+func (mr *MockSetEngineMockRecorder) SetIsMember(ctx, key, member any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetIsMember", reflect.TypeOf((*MockSetEngine)(nil).SetIsMember), ctx, key, member)
+}
+
+// SetMembers mocks base method.
+func (m *MockSetEngine) SetMembers(ctx context.Context, key string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMembers", ctx, key)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetMembers indicates an expected call of SetMembers.
+func (mr *MockSetEngineMockRecorder) SetMembers(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMembers", reflect.TypeOf((*MockSetEngine)(nil).SetMembers), ctx, key)
+}
+
+// SetRemove mocks base method.
+func (m *MockSetEngine) SetRemove(ctx context.Context, key string, members []string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRemove", ctx, key, members)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetRemove indicates an expected call of SetRemove.
+func (mr *MockSetEngineMockRecorder) SetRemove(ctx, key, members any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRemove", reflect.TypeOf((*MockSetEngine)(nil).SetRemove), ctx, key, members)
+}
+
+// MockSortedSetEngine is a mock of SortedSetEngine interface.
+type MockSortedSetEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockSortedSetEngineMockRecorder
+}
+
+// MockSortedSetEngineMockRecorder is the mock recorder for MockSortedSetEngine.
+type MockSortedSetEngineMockRecorder struct {
+	mock *MockSortedSetEngine
+}
+
+// NewMockSortedSetEngine creates a new mock instance.
+func NewMockSortedSetEngine(ctrl *gomock.Controller) *MockSortedSetEngine {
+	mock := &MockSortedSetEngine{ctrl: ctrl}
+	mock.recorder = &MockSortedSetEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSortedSetEngine) EXPECT() *MockSortedSetEngineMockRecorder {
+	return m.recorder
+}
+
+// SortedSetAdd mocks base method.
+func (m *MockSortedSetEngine) SortedSetAdd(ctx context.Context, key string, members []ScoredMember) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SortedSetAdd", ctx, key, members)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SortedSetAdd indicates an expected call of SortedSetAdd.
+func (mr *MockSortedSetEngineMockRecorder) SortedSetAdd(ctx, key, members any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SortedSetAdd", reflect.TypeOf((*MockSortedSetEngine)(nil).SortedSetAdd), ctx, key, members)
+}
+
+// SortedSetRange mocks base method.
+func (m *MockSortedSetEngine) SortedSetRange(ctx context.Context, key string, start, stop int) ([]ScoredMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SortedSetRange", ctx, key, start, stop)
+	ret0, _ := ret[0].([]ScoredMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SortedSetRange indicates an expected call of SortedSetRange.
+func (mr *MockSortedSetEngineMockRecorder) SortedSetRange(ctx, key, start, stop any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SortedSetRange", reflect.TypeOf((*MockSortedSetEngine)(nil).SortedSetRange), ctx, key, start, stop)
+}
+
+// SortedSetRangeByScore mocks base method.
+func (m *MockSortedSetEngine) SortedSetRangeByScore(ctx context.Context, key string, minScore, maxScore float64) ([]ScoredMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SortedSetRangeByScore", ctx, key, minScore, maxScore)
+	ret0, _ := ret[0].([]ScoredMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SortedSetRangeByScore indicates an expected call of SortedSetRangeByScore.
+func (mr *MockSortedSetEngineMockRecorder) SortedSetRangeByScore(ctx, key, minScore, maxScore any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SortedSetRangeByScore", reflect.TypeOf((*MockSortedSetEngine)(nil).SortedSetRangeByScore), ctx, key, minScore, maxScore)
+}
+
+// SortedSetRank mocks base method.
+func (m *MockSortedSetEngine) SortedSetRank(ctx context.Context, key, member string) (int, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SortedSetRank", ctx, key, member)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SortedSetRank indicates an expected call of SortedSetRank.
+func (mr *MockSortedSetEngineMockRecorder) SortedSetRank(ctx, key, member any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SortedSetRank", reflect.TypeOf((*MockSortedSetEngine)(nil).SortedSetRank), ctx, key, member)
+}
+
+// SortedSetRemove mocks base method.
+func (m *MockSortedSetEngine) SortedSetRemove(ctx context.Context, key string, members []string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SortedSetRemove", ctx, key, members)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SortedSetRemove indicates an expected call of SortedSetRemove.
+func (mr *MockSortedSetEngineMockRecorder) SortedSetRemove(ctx, key, members any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SortedSetRemove", reflect.TypeOf((*MockSortedSetEngine)(nil).SortedSetRemove), ctx, key, members)
+}
+
+// MockDumpEngine is a mock of DumpEngine interface.
+type MockDumpEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockDumpEngineMockRecorder
+}
+
+// MockDumpEngineMockRecorder is the mock recorder for MockDumpEngine.
+type MockDumpEngineMockRecorder struct {
+	mock *MockDumpEngine
+}
+
+// NewMockDumpEngine creates a new mock instance.
+func NewMockDumpEngine(ctrl *gomock.Controller) *MockDumpEngine {
+	mock := &MockDumpEngine{ctrl: ctrl}
+	mock.recorder = &MockDumpEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDumpEngine) EXPECT() *MockDumpEngineMockRecorder {
+	return m.recorder
+}
+
+// Dump mocks base method.
+func (m *MockDumpEngine) Dump(arg0 context.Context, arg1 string) (wal.Log, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Dump", arg0, arg1)
+	ret0, _ := ret[0].(wal.Log)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Dump indicates an expected call of Dump.
+func (mr *MockDumpEngineMockRecorder) Dump(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Dump", reflect.TypeOf((*MockDumpEngine)(nil).Dump), arg0, arg1)
+}
+
+// MockFlushEngine is a mock of FlushEngine interface.
+type MockFlushEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockFlushEngineMockRecorder
+}
+
+// MockFlushEngineMockRecorder is the mock recorder for MockFlushEngine.
+type MockFlushEngineMockRecorder struct {
+	mock *MockFlushEngine
+}
+
+// NewMockFlushEngine creates a new mock instance.
+func NewMockFlushEngine(ctrl *gomock.Controller) *MockFlushEngine {
+	mock := &MockFlushEngine{ctrl: ctrl}
+	mock.recorder = &MockFlushEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFlushEngine) EXPECT() *MockFlushEngineMockRecorder {
+	return m.recorder
+}
+
+// Flush mocks base method.
+func (m *MockFlushEngine) Flush(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush.
+func (mr *MockFlushEngineMockRecorder) Flush(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockFlushEngine)(nil).Flush), arg0)
+}
+
+// MockInfoEngine is a mock of InfoEngine interface.
+type MockInfoEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockInfoEngineMockRecorder
+}
+
+// MockInfoEngineMockRecorder is the mock recorder for MockInfoEngine.
+type MockInfoEngineMockRecorder struct {
+	mock *MockInfoEngine
+}
+
+// NewMockInfoEngine creates a new mock instance.
+func NewMockInfoEngine(ctrl *gomock.Controller) *MockInfoEngine {
+	mock := &MockInfoEngine{ctrl: ctrl}
+	mock.recorder = &MockInfoEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockInfoEngine) EXPECT() *MockInfoEngineMockRecorder {
+	return m.recorder
+}
+
+// Info mocks base method.
+func (m *MockInfoEngine) Info(arg0 context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Info", arg0)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Info indicates an expected call of Info.
+func (mr *MockInfoEngineMockRecorder) Info(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Info", reflect.TypeOf((*MockInfoEngine)(nil).Info), arg0)
+}
+
+// MockWAL is a mock of WAL interface.
+type MockWAL struct {
+	ctrl     *gomock.Controller
+	recorder *MockWALMockRecorder
+}
+
+// MockWALMockRecorder is the mock recorder for MockWAL.
+type MockWALMockRecorder struct {
+	mock *MockWAL
+}
+
+// NewMockWAL creates a new mock instance.
+func NewMockWAL(ctrl *gomock.Controller) *MockWAL {
+	mock := &MockWAL{ctrl: ctrl}
+	mock.recorder = &MockWALMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWAL) EXPECT() *MockWALMockRecorder {
+	return m.recorder
+}
+
+// Append mocks base method.
+func (m *MockWAL) Append(arg0 context.Context, arg1 wal.Op, arg2 ...string) *dfuture.Future[error] {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Append", varargs...)
+	ret0, _ := ret[0].(*dfuture.Future[error])
+	return ret0
+}
+
+// Append indicates an expected call of Append.
+func (mr *MockWALMockRecorder) Append(arg0, arg1 any, arg2 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Append", reflect.TypeOf((*MockWAL)(nil).Append), varargs...)
+}
+
+// LastLSN mocks base method.
+func (m *MockWAL) LastLSN() uint64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LastLSN")
+	ret0, _ := ret[0].(uint64)
+	return ret0
+}
+
+// LastLSN indicates an expected call of LastLSN.
+func (mr *MockWALMockRecorder) LastLSN() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LastLSN", reflect.TypeOf((*MockWAL)(nil).LastLSN))
+}
+
+// Recover mocks base method.
+func (m *MockWAL) Recover(arg0 uint64) ([]wal.Log, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Recover", arg0)
+	ret0, _ := ret[0].([]wal.Log)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Recover indicates an expected call of Recover.
+func (mr *MockWALMockRecorder) Recover(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Recover", reflect.TypeOf((*MockWAL)(nil).Recover), arg0)
+}
+
+// Truncate mocks base method.
+func (m *MockWAL) Truncate(arg0 uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Truncate", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Truncate indicates an expected call of Truncate.
+func (mr *MockWALMockRecorder) Truncate(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Truncate", reflect.TypeOf((*MockWAL)(nil).Truncate), arg0)
+}
+
+// MockConsensus is a mock of Consensus interface.
+type MockConsensus struct {
+	ctrl     *gomock.Controller
+	recorder *MockConsensusMockRecorder
+}
+
+// MockConsensusMockRecorder is the mock recorder for MockConsensus.
+type MockConsensusMockRecorder struct {
+	mock *MockConsensus
+}
+
+// NewMockConsensus creates a new mock instance.
+func NewMockConsensus(ctrl *gomock.Controller) *MockConsensus {
+	mock := &MockConsensus{ctrl: ctrl}
+	mock.recorder = &MockConsensusMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockConsensus) EXPECT() *MockConsensusMockRecorder {
+	return m.recorder
+}
+
+// Propose mocks base method.
+func (m *MockConsensus) Propose(arg0 context.Context, arg1 wal.Log) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Propose", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Propose indicates an expected call of Propose.
+func (mr *MockConsensusMockRecorder) Propose(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Propose", reflect.TypeOf((*MockConsensus)(nil).Propose), arg0, arg1)
+}
+
+// MockSnapshots is a mock of Snapshots interface.
+type MockSnapshots struct {
+	ctrl     *gomock.Controller
+	recorder *MockSnapshotsMockRecorder
+}
+
+// MockSnapshotsMockRecorder is the mock recorder for MockSnapshots.
+type MockSnapshotsMockRecorder struct {
+	mock *MockSnapshots
+}
+
+// NewMockSnapshots creates a new mock instance.
+func NewMockSnapshots(ctrl *gomock.Controller) *MockSnapshots {
+	mock := &MockSnapshots{ctrl: ctrl}
+	mock.recorder = &MockSnapshotsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSnapshots) EXPECT() *MockSnapshotsMockRecorder {
+	return m.recorder
+}
+
+// Load mocks base method.
+func (m *MockSnapshots) Load() (uint64, []wal.Log, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Load")
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].([]wal.Log)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Load indicates an expected call of Load.
+func (mr *MockSnapshotsMockRecorder) Load() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Load", reflect.TypeOf((*MockSnapshots)(nil).Load))
+}
+
+// Write mocks base method.
+func (m *MockSnapshots) Write(arg0 uint64, arg1 []wal.Log) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Write", arg0, arg1)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Write indicates an expected call of Write.
+func (mr *MockSnapshotsMockRecorder) Write(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockSnapshots)(nil).Write), arg0, arg1)
+}
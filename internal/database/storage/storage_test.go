@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 
+	"kv_db/internal/database/storage/wal"
+	"kv_db/pkg/dclock"
+	"kv_db/pkg/dfuture"
 	"kv_db/pkg/dlog"
 )
 
@@ -28,11 +32,296 @@ func TestNewStorage(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, storage)
 
+	storage, err = NewStorage(engine, dlog.NewNonSlog(), WithSweepInterval(0))
+	require.Error(t, err)
+	require.Nil(t, storage)
+
 	storage, err = NewStorage(engine, dlog.NewNonSlog())
 	require.NoError(t, err)
 	require.NotNil(t, storage)
 }
 
+func TestNewStorageWithWAL(t *testing.T) {
+	t.Parallel()
+
+	t.Run("recover", func(t *testing.T) {
+		engine, journal := getMockEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{
+			wal.NewLog(1, wal.SetOp, "key1", "value1"),
+			wal.NewLog(2, wal.SetOp, "key2", "value2"),
+			wal.NewLog(3, wal.DelOp, "key1"),
+		}, nil)
+		gomock.InOrder(
+			engine.EXPECT().Set(gomock.Any(), "key1", "value1").Return(nil),
+			engine.EXPECT().Set(gomock.Any(), "key2", "value2").Return(nil),
+			engine.EXPECT().Delete(gomock.Any(), "key1").Return(nil),
+		)
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+
+		require.NoError(t, err)
+		require.NotNil(t, storage)
+	})
+
+	t.Run("recover expiring key", func(t *testing.T) {
+		engine, journal := getMockEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{
+			wal.NewLog(1, wal.SetOp, "key", "value", wal.FormatExpiration(time.Unix(10, 0))),
+		}, nil)
+		engine.EXPECT().SetWithExpiration(gomock.Any(), "key", "value", time.Unix(10, 0)).Return(nil)
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+
+		require.NoError(t, err)
+		require.NotNil(t, storage)
+	})
+
+	t.Run("recover log over memory limit", func(t *testing.T) {
+		engine, journal := getMockEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{
+			wal.NewLog(1, wal.SetOp, "key1", "value1"),
+			wal.NewLog(2, wal.SetOp, "key2", "value2"),
+		}, nil)
+		gomock.InOrder(
+			engine.EXPECT().Set(gomock.Any(), "key1", "value1").Return(ErrMemoryLimit),
+			engine.EXPECT().Set(gomock.Any(), "key2", "value2").Return(nil),
+		)
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+
+		require.NoError(t, err)
+		require.NotNil(t, storage)
+	})
+
+	t.Run("corrupted expiration", func(t *testing.T) {
+		engine, journal := getMockEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{
+			wal.NewLog(1, wal.SetOp, "key", "value", "incorrect"),
+		}, nil)
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+
+		require.ErrorIs(t, err, wal.ErrCorruptedLog)
+		require.Nil(t, storage)
+	})
+
+	t.Run("recover error", func(t *testing.T) {
+		engine, journal := getMockEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return(nil, errors.New("test error"))
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+
+		require.Error(t, err)
+		require.Nil(t, storage)
+	})
+
+	t.Run("corrupted log", func(t *testing.T) {
+		engine, journal := getMockEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{wal.NewLog(1, wal.SetOp, "key")}, nil)
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+
+		require.ErrorIs(t, err, wal.ErrCorruptedLog)
+		require.Nil(t, storage)
+	})
+
+	t.Run("recover batch", func(t *testing.T) {
+		engine, journal := getMockBatchEngine(t), getMockWAL(t)
+		logs := []wal.Log{
+			wal.NewLog(0, wal.SetOp, "key1", "value1"),
+			wal.NewLog(0, wal.DelOp, "key2"),
+			wal.NewLog(0, wal.SetOp, "key3", "value3", wal.FormatExpiration(time.Unix(10, 0))),
+		}
+		journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{wal.NewBatchLog(1, logs)}, nil)
+		batch := NewBatch()
+		batch.Put("key1", "value1")
+		batch.Delete("key2")
+		batch.PutWithExpiration("key3", "value3", time.Unix(10, 0))
+		engine.MockBatchEngine.EXPECT().Apply(gomock.Any(), batch).Return(nil)
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+
+		require.NoError(t, err)
+		require.NotNil(t, storage)
+	})
+
+	t.Run("batch without batch engine", func(t *testing.T) {
+		engine, journal := getMockEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{wal.NewBatchLog(1, nil)}, nil)
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+
+		require.Error(t, err)
+		require.Nil(t, storage)
+	})
+
+	t.Run("unknown operation", func(t *testing.T) {
+		engine, journal := getMockEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{wal.NewLog(1, wal.UnknownOp)}, nil)
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+
+		require.Error(t, err)
+		require.Nil(t, storage)
+	})
+}
+
+func TestNewStorageWithSnapshots(t *testing.T) {
+	t.Parallel()
+
+	t.Run("engine without snapshots", func(t *testing.T) {
+		engine, snapshots := getMockEngine(t), getMockSnapshots(t)
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithSnapshots(snapshots, time.Minute))
+
+		require.Error(t, err)
+		require.Nil(t, storage)
+	})
+
+	t.Run("invalid interval", func(t *testing.T) {
+		engine, snapshots := getMockSnapshotEngine(t), getMockSnapshots(t)
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithSnapshots(snapshots, 0))
+
+		require.Error(t, err)
+		require.Nil(t, storage)
+	})
+
+	t.Run("recover snapshot and wal tail", func(t *testing.T) {
+		engine, snapshots, journal := getMockSnapshotEngine(t), getMockSnapshots(t), getMockWAL(t)
+		snapshots.EXPECT().Load().Return(uint64(10), []wal.Log{wal.NewLog(0, wal.SetOp, "key1", "value1")}, nil)
+		journal.EXPECT().Recover(uint64(10)).Return([]wal.Log{
+			wal.NewLog(11, wal.SetOp, "key2", "value2"),
+		}, nil)
+		gomock.InOrder(
+			engine.EXPECT().Set(gomock.Any(), "key1", "value1").Return(nil),
+			engine.EXPECT().Set(gomock.Any(), "key2", "value2").Return(nil),
+		)
+
+		storage, err := NewStorage(
+			engine, dlog.NewNonSlog(), WithWAL(journal), WithSnapshots(snapshots, time.Minute),
+		)
+
+		require.NoError(t, err)
+		require.NotNil(t, storage)
+	})
+
+	t.Run("load error", func(t *testing.T) {
+		engine, snapshots := getMockSnapshotEngine(t), getMockSnapshots(t)
+		snapshots.EXPECT().Load().Return(uint64(0), nil, errors.New("test error"))
+
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithSnapshots(snapshots, time.Minute))
+
+		require.Error(t, err)
+		require.Nil(t, storage)
+	})
+}
+
+func TestStorage_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	data := []wal.Log{wal.NewLog(0, wal.SetOp, "key", "value")}
+
+	t.Run("disabled", func(t *testing.T) {
+		storage, err := NewStorage(getMockEngine(t), dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		require.Error(t, storage.Snapshot(ctx))
+	})
+
+	t.Run("snapshot with wal", func(t *testing.T) {
+		engine, snapshots, journal := getMockSnapshotEngine(t), getMockSnapshots(t), getMockWAL(t)
+		snapshots.EXPECT().Load().Return(uint64(0), nil, nil)
+		journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+		storage, err := NewStorage(
+			engine, dlog.NewNonSlog(), WithWAL(journal), WithSnapshots(snapshots, time.Minute),
+		)
+		require.NoError(t, err)
+
+		gomock.InOrder(
+			journal.EXPECT().LastLSN().Return(uint64(5)),
+			engine.EXPECT().Snapshot(ctx).Return(data, nil),
+			snapshots.EXPECT().Write(uint64(5), data).Return(uint64(5), nil),
+			journal.EXPECT().Truncate(uint64(5)).Return(nil),
+		)
+		require.NoError(t, storage.Snapshot(ctx))
+
+		// The WAL is truncated only up to the oldest kept snapshot, which
+		// recovery falls back to if the newest one is damaged.
+		gomock.InOrder(
+			journal.EXPECT().LastLSN().Return(uint64(8)),
+			engine.EXPECT().Snapshot(ctx).Return(data, nil),
+			snapshots.EXPECT().Write(uint64(8), data).Return(uint64(5), nil),
+			journal.EXPECT().Truncate(uint64(5)).Return(nil),
+		)
+		require.NoError(t, storage.Snapshot(ctx))
+
+		// Nothing has changed since the last snapshot, but the WAL is still
+		// truncated.
+		journal.EXPECT().LastLSN().Return(uint64(8))
+		engine.EXPECT().Snapshot(ctx).Return(data, nil)
+		journal.EXPECT().Truncate(uint64(5)).Return(nil)
+		require.NoError(t, storage.Snapshot(ctx))
+	})
+
+	t.Run("snapshot without wal", func(t *testing.T) {
+		engine, snapshots := getMockSnapshotEngine(t), getMockSnapshots(t)
+		snapshots.EXPECT().Load().Return(uint64(0), nil, nil)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithSnapshots(snapshots, time.Minute))
+		require.NoError(t, err)
+
+		engine.EXPECT().Snapshot(ctx).Return(data, nil)
+		snapshots.EXPECT().Write(uint64(0), data).Return(uint64(0), nil)
+
+		require.NoError(t, storage.Snapshot(ctx))
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		engine, snapshots := getMockSnapshotEngine(t), getMockSnapshots(t)
+		snapshots.EXPECT().Load().Return(uint64(0), nil, nil)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithSnapshots(snapshots, time.Minute))
+		require.NoError(t, err)
+
+		expErr := errors.New("test error")
+		engine.EXPECT().Snapshot(ctx).Return(data, nil)
+		snapshots.EXPECT().Write(uint64(0), data).Return(uint64(0), expErr)
+
+		require.ErrorIs(t, storage.Snapshot(ctx), expErr)
+	})
+}
+
+func TestStorage_Start(t *testing.T) {
+	t.Parallel()
+
+	engine, snapshots := getMockSnapshotEngine(t), getMockSnapshots(t)
+	snapshots.EXPECT().Load().Return(uint64(0), nil, nil)
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithSnapshots(snapshots, time.Millisecond))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	taken := make(chan struct{})
+	engine.EXPECT().DeleteExpired(gomock.Any(), sweepLimit).Return(0, nil).AnyTimes()
+	engine.EXPECT().Snapshot(gomock.Any()).Return(nil, nil).MinTimes(1)
+	snapshots.EXPECT().Write(uint64(0), gomock.Any()).DoAndReturn(func(uint64, []wal.Log) (uint64, error) {
+		select {
+		case taken <- struct{}{}:
+		default:
+		}
+		return 0, nil
+	}).MinTimes(1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		storage.Start(ctx)
+	}()
+
+	<-taken
+	cancel()
+	<-done
+}
+
 func TestMustStorage(t *testing.T) {
 	t.Parallel()
 
@@ -81,6 +370,48 @@ func TestStorage_Set(t *testing.T) {
 
 		require.ErrorIs(t, err, expErr)
 	})
+
+	t.Run("success with wal", func(t *testing.T) {
+		ctx := context.Background()
+		storage, engine, journal := getStorageWithWAL(t)
+		gomock.InOrder(
+			journal.EXPECT().
+				Append(gomock.Eq(ctx), wal.SetOp, gomock.Eq(key), gomock.Eq(value)).
+				Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().Set(gomock.Eq(ctx), gomock.Eq(key), gomock.Eq(value)).Return(nil),
+		)
+
+		err := storage.Set(ctx, key, value)
+
+		require.NoError(t, err)
+	})
+
+	t.Run("wal flush error", func(t *testing.T) {
+		ctx := context.Background()
+		storage, _, journal := getStorageWithWAL(t)
+		journal.EXPECT().
+			Append(gomock.Eq(ctx), wal.SetOp, gomock.Eq(key), gomock.Eq(value)).
+			Return(dfuture.NewResolvedFuture(expErr))
+
+		err := storage.Set(ctx, key, value)
+
+		require.ErrorIs(t, err, expErr)
+	})
+
+	t.Run("error with wal", func(t *testing.T) {
+		ctx := context.Background()
+		storage, engine, journal := getStorageWithWAL(t)
+		journal.EXPECT().
+			Append(gomock.Eq(ctx), wal.SetOp, gomock.Eq(key), gomock.Eq(value)).
+			Return(dfuture.NewResolvedFuture[error](nil))
+		engine.EXPECT().
+			Set(gomock.Eq(ctx), gomock.Eq(key), gomock.Eq(value)).
+			Return(expErr)
+
+		err := storage.Set(ctx, key, value)
+
+		require.ErrorIs(t, err, expErr)
+	})
 }
 
 func TestStorage_Get(t *testing.T) {
@@ -172,6 +503,696 @@ func TestStorage_Delete(t *testing.T) {
 
 		require.ErrorIs(t, err, expErr)
 	})
+
+	t.Run("success with wal", func(t *testing.T) {
+		ctx := context.Background()
+		storage, engine, journal := getStorageWithWAL(t)
+		gomock.InOrder(
+			journal.EXPECT().
+				Append(gomock.Eq(ctx), wal.DelOp, gomock.Eq(key)).
+				Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().Delete(gomock.Eq(ctx), gomock.Eq(key)).Return(nil),
+		)
+
+		err := storage.Delete(ctx, key)
+
+		require.NoError(t, err)
+	})
+
+	t.Run("wal flush error", func(t *testing.T) {
+		ctx := context.Background()
+		storage, _, journal := getStorageWithWAL(t)
+		journal.EXPECT().
+			Append(gomock.Eq(ctx), wal.DelOp, gomock.Eq(key)).
+			Return(dfuture.NewResolvedFuture(expErr))
+
+		err := storage.Delete(ctx, key)
+
+		require.ErrorIs(t, err, expErr)
+	})
+
+	t.Run("error with wal", func(t *testing.T) {
+		ctx := context.Background()
+		storage, engine, journal := getStorageWithWAL(t)
+		journal.EXPECT().
+			Append(gomock.Eq(ctx), wal.DelOp, gomock.Eq(key)).
+			Return(dfuture.NewResolvedFuture[error](nil))
+		engine.EXPECT().
+			Delete(gomock.Eq(ctx), gomock.Eq(key)).
+			Return(expErr)
+
+		err := storage.Delete(ctx, key)
+
+		require.ErrorIs(t, err, expErr)
+	})
+}
+
+func TestStorage_SetWithTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(100, 0))
+	expiresAt := time.Unix(110, 0)
+
+	t.Run("success", func(t *testing.T) {
+		engine := getMockEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithClock(clock))
+		require.NoError(t, err)
+		engine.EXPECT().SetWithExpiration(ctx, "key", "value", expiresAt).Return(nil)
+
+		require.NoError(t, storage.SetWithTTL(ctx, "key", "value", 10*time.Second))
+	})
+
+	t.Run("success with wal", func(t *testing.T) {
+		storage, engine, journal := getStorageWithWAL(t, WithClock(clock))
+		gomock.InOrder(
+			journal.EXPECT().
+				Append(ctx, wal.SetOp, "key", "value", wal.FormatExpiration(expiresAt)).
+				Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().SetWithExpiration(ctx, "key", "value", expiresAt).Return(nil),
+		)
+
+		require.NoError(t, storage.SetWithTTL(ctx, "key", "value", 10*time.Second))
+	})
+}
+
+func TestStorage_SetIf(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(100, 0))
+	expiresAt := time.Unix(110, 0)
+	resolved := dfuture.NewResolvedFuture[error](nil)
+
+	t.Run("if not exists", func(t *testing.T) {
+		storage, engine, journal := getStorageWithWAL(t, WithClock(clock))
+
+		engine.EXPECT().Get(ctx, "key").Return("old", true, nil)
+		ok, err := storage.SetIf(ctx, "key", "value", 0, IfNotExists)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		gomock.InOrder(
+			engine.EXPECT().Get(ctx, "key").Return("", false, nil),
+			journal.EXPECT().Append(ctx, wal.SetOp, "key", "value", wal.FormatExpiration(expiresAt)).Return(resolved),
+			engine.EXPECT().SetWithExpiration(ctx, "key", "value", expiresAt).Return(nil),
+		)
+		ok, err = storage.SetIf(ctx, "key", "value", 10*time.Second, IfNotExists)
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("if exists", func(t *testing.T) {
+		storage, engine, journal := getStorageWithWAL(t, WithClock(clock))
+
+		engine.EXPECT().Get(ctx, "key").Return("", false, nil)
+		ok, err := storage.SetIf(ctx, "key", "value", 0, IfExists)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		gomock.InOrder(
+			engine.EXPECT().Get(ctx, "key").Return("", false, ErrWrongType),
+			journal.EXPECT().Append(ctx, wal.SetOp, "key", "value").Return(resolved),
+			engine.EXPECT().Set(ctx, "key", "value").Return(nil),
+		)
+		ok, err = storage.SetIf(ctx, "key", "value", 0, IfExists)
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("compare and swap", func(t *testing.T) {
+		storage, engine, journal := getStorageWithWAL(t, WithClock(clock))
+
+		engine.EXPECT().Get(ctx, "key").Return("", false, nil)
+		ok, err := storage.CompareAndSwap(ctx, "key", "old", "value")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		engine.EXPECT().Get(ctx, "key").Return("other", true, nil)
+		ok, err = storage.CompareAndSwap(ctx, "key", "old", "value")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		gomock.InOrder(
+			engine.EXPECT().Get(ctx, "key").Return("old", true, nil),
+			journal.EXPECT().Append(ctx, wal.SetOp, "key", "value").Return(resolved),
+			engine.EXPECT().Set(ctx, "key", "value").Return(nil),
+		)
+		ok, err = storage.CompareAndSwap(ctx, "key", "old", "value")
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("engine error", func(t *testing.T) {
+		engine := getMockEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		expErr := errors.New("test error")
+		engine.EXPECT().Get(ctx, "key").Return("", false, expErr)
+		_, err = storage.CompareAndSwap(ctx, "key", "old", "value")
+		require.ErrorIs(t, err, expErr)
+	})
+}
+
+func TestStorage_SetIfVersion(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("set", func(t *testing.T) {
+		storage, engine, journal := getStorageWithWAL(t)
+
+		gomock.InOrder(
+			engine.EXPECT().GetWithVersion(ctx, "key").Return("old", uint64(7), true, nil),
+			journal.EXPECT().Append(ctx, wal.SetOp, "key", "value").Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().Set(ctx, "key", "value").Return(nil),
+			engine.EXPECT().GetWithVersion(ctx, "key").Return("value", uint64(8), true, nil),
+		)
+		version, err := storage.SetIfVersion(ctx, "key", "value", 7)
+		require.NoError(t, err)
+		require.Equal(t, uint64(8), version)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		storage, engine, _ := getStorageWithWAL(t)
+
+		engine.EXPECT().GetWithVersion(ctx, "key").Return("old", uint64(6), true, nil)
+		_, err := storage.SetIfVersion(ctx, "key", "value", 7)
+		require.ErrorIs(t, err, ErrVersionConflict)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		storage, engine, _ := getStorageWithWAL(t)
+
+		engine.EXPECT().GetWithVersion(ctx, "key").Return("value", uint64(8), true, nil)
+		value, version, ok, err := storage.GetWithVersion(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "value", value)
+		require.Equal(t, uint64(8), version)
+	})
+}
+
+func TestStorage_Increment(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	expiresAt := time.Unix(110, 0)
+
+	t.Run("success with wal", func(t *testing.T) {
+		storage, engine, journal := getStorageWithWAL(t)
+
+		gomock.InOrder(
+			engine.EXPECT().Get(ctx, "key").Return("", false, nil),
+			engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, false, nil),
+			journal.EXPECT().Append(ctx, wal.SetOp, "key", "5").Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().Set(ctx, "key", "5").Return(nil),
+		)
+		result, err := storage.Increment(ctx, "key", 5)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), result)
+
+		gomock.InOrder(
+			engine.EXPECT().Get(ctx, "key").Return("5", true, nil),
+			engine.EXPECT().Expiration(ctx, "key").Return(expiresAt, true, nil),
+			journal.EXPECT().
+				Append(ctx, wal.SetOp, "key", "-2", wal.FormatExpiration(expiresAt)).
+				Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().SetWithExpiration(ctx, "key", "-2", expiresAt).Return(nil),
+		)
+		result, err = storage.Increment(ctx, "key", -7)
+		require.NoError(t, err)
+		require.Equal(t, int64(-2), result)
+	})
+
+	testcases := map[string]struct {
+		current string
+		delta   int64
+		expErr  error
+	}{
+		"not integer":        {current: "value", delta: 1, expErr: ErrNotInteger},
+		"too big integer":    {current: "9223372036854775808", delta: 1, expErr: ErrNotInteger},
+		"increment overflow": {current: "9223372036854775800", delta: 8, expErr: ErrOverflow},
+		"decrement overflow": {current: "-9223372036854775800", delta: -9, expErr: ErrOverflow},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			engine := getMockEngine(t)
+			storage, err := NewStorage(engine, dlog.NewNonSlog())
+			require.NoError(t, err)
+
+			engine.EXPECT().Get(ctx, "key").Return(tc.current, true, nil)
+			_, err = storage.Increment(ctx, "key", tc.delta)
+			require.ErrorIs(t, err, tc.expErr)
+		})
+	}
+}
+
+func TestStorage_Expire(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(100, 0))
+	expiresAt := time.Unix(110, 0)
+	expErr := errors.New("test error")
+
+	t.Run("success", func(t *testing.T) {
+		engine := getMockEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithClock(clock))
+		require.NoError(t, err)
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil)
+		engine.EXPECT().Get(ctx, "key").Return("value", true, nil)
+		engine.EXPECT().SetWithExpiration(ctx, "key", "value", expiresAt).Return(nil)
+
+		ok, err := storage.Expire(ctx, "key", 10*time.Second)
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		engine := getMockEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithClock(clock))
+		require.NoError(t, err)
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, false, nil)
+
+		ok, err := storage.Expire(ctx, "key", 10*time.Second)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		engine := getMockEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithClock(clock))
+		require.NoError(t, err)
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, false, expErr)
+
+		_, err = storage.Expire(ctx, "key", 10*time.Second)
+		require.ErrorIs(t, err, expErr)
+	})
+
+	t.Run("success with wal", func(t *testing.T) {
+		storage, engine, journal := getStorageWithWAL(t, WithClock(clock))
+		gomock.InOrder(
+			engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil),
+			engine.EXPECT().Get(ctx, "key").Return("value", true, nil),
+			journal.EXPECT().
+				Append(ctx, wal.SetOp, "key", "value", wal.FormatExpiration(expiresAt)).
+				Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().SetWithExpiration(ctx, "key", "value", expiresAt).Return(nil),
+		)
+
+		ok, err := storage.Expire(ctx, "key", 10*time.Second)
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("wal error", func(t *testing.T) {
+		storage, engine, journal := getStorageWithWAL(t, WithClock(clock))
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil)
+		engine.EXPECT().Get(ctx, "key").Return("value", true, nil)
+		journal.EXPECT().
+			Append(ctx, wal.SetOp, "key", "value", wal.FormatExpiration(expiresAt)).
+			Return(dfuture.NewResolvedFuture[error](expErr))
+
+		ok, err := storage.Expire(ctx, "key", 10*time.Second)
+		require.ErrorIs(t, err, expErr)
+		require.False(t, ok)
+	})
+}
+
+func TestStorage_Persist(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		engine := getMockEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Unix(110, 0), true, nil)
+		engine.EXPECT().Get(ctx, "key").Return("value", true, nil)
+		engine.EXPECT().Set(ctx, "key", "value").Return(nil)
+
+		ok, err := storage.Persist(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("success with wal", func(t *testing.T) {
+		storage, engine, journal := getStorageWithWAL(t)
+		gomock.InOrder(
+			engine.EXPECT().Expiration(ctx, "key").Return(time.Unix(110, 0), true, nil),
+			engine.EXPECT().Get(ctx, "key").Return("value", true, nil),
+			journal.EXPECT().
+				Append(ctx, wal.SetOp, "key", "value").
+				Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.EXPECT().Set(ctx, "key", "value").Return(nil),
+		)
+
+		ok, err := storage.Persist(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("without expiration with wal", func(t *testing.T) {
+		storage, engine, _ := getStorageWithWAL(t)
+		engine.EXPECT().Expiration(ctx, "key").Return(time.Time{}, true, nil)
+
+		ok, err := storage.Persist(ctx, "key")
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+}
+
+func TestStorage_TTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(100, 0))
+	engine := getMockEngine(t)
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithClock(clock))
+	require.NoError(t, err)
+
+	engine.EXPECT().Expiration(ctx, "missing").Return(time.Time{}, false, nil)
+	_, ok, err := storage.TTL(ctx, "missing")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	engine.EXPECT().Expiration(ctx, "persistent").Return(time.Time{}, true, nil)
+	ttl, ok, err := storage.TTL(ctx, "persistent")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, NoExpiration, ttl)
+
+	engine.EXPECT().Expiration(ctx, "expiring").Return(time.Unix(110, 0), true, nil)
+	ttl, ok, err = storage.TTL(ctx, "expiring")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 10*time.Second, ttl)
+}
+
+func TestStorage_Sweep(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("many expired keys", func(t *testing.T) {
+		engine := getMockEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		gomock.InOrder(
+			engine.EXPECT().DeleteExpired(ctx, sweepLimit).Return(sweepLimit, nil),
+			engine.EXPECT().DeleteExpired(ctx, sweepLimit).Return(sweepLimit/4, nil),
+			engine.EXPECT().DeleteExpired(ctx, sweepLimit).Return(0, nil),
+		)
+		require.NoError(t, storage.Sweep(ctx))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		engine := getMockEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		expErr := errors.New("test error")
+		engine.EXPECT().DeleteExpired(ctx, sweepLimit).Return(0, expErr)
+		require.ErrorIs(t, storage.Sweep(ctx), expErr)
+	})
+}
+
+func TestStorage_UnsupportedTypes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storage, err := NewStorage(getMockEngine(t), dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	_, err = storage.Push(ctx, "key", true, "value")
+	require.ErrorIs(t, err, ErrUnsupportedType)
+	_, err = storage.HashSet(ctx, "key", "field", "value")
+	require.ErrorIs(t, err, ErrUnsupportedType)
+	_, err = storage.SetAdd(ctx, "key", "member")
+	require.ErrorIs(t, err, ErrUnsupportedType)
+	_, err = storage.SortedSetAdd(ctx, "key", ScoredMember{Member: "member", Score: 1})
+	require.ErrorIs(t, err, ErrUnsupportedType)
+}
+
+func TestStorage_Info(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("engine without info", func(t *testing.T) {
+		engine := getMockEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		engine.EXPECT().DeleteExpired(ctx, sweepLimit).Return(3, nil)
+		require.NoError(t, storage.Sweep(ctx))
+
+		info, err := storage.Info(ctx)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"expired_keys": "3"}, info)
+	})
+
+	t.Run("engine with info", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		engine := struct {
+			*MockEngine
+			*MockInfoEngine
+		}{NewMockEngine(ctrl), NewMockInfoEngine(ctrl)}
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		engine.MockInfoEngine.EXPECT().Info(ctx).Return(map[string]string{"keys": "10"}, nil)
+		info, err := storage.Info(ctx)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"keys": "10", "expired_keys": "0"}, info)
+
+		expErr := errors.New("test error")
+		engine.MockInfoEngine.EXPECT().Info(ctx).Return(nil, expErr)
+		_, err = storage.Info(ctx)
+		require.ErrorIs(t, err, expErr)
+	})
+}
+
+func TestStorage_Range(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("engine without ranges", func(t *testing.T) {
+		storage, err := NewStorage(getMockEngine(t), dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		_, err = storage.Range(ctx, "a", "z", 0)
+		require.Error(t, err)
+	})
+
+	t.Run("engine with ranges", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		engine := struct {
+			*MockEngine
+			*MockRangeEngine
+		}{NewMockEngine(ctrl), NewMockRangeEngine(ctrl)}
+		storage, err := NewStorage(engine, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		engine.MockRangeEngine.EXPECT().Range(ctx, "a", "z", gomock.Any()).Times(2).DoAndReturn(
+			func(_ context.Context, _, _ string, yield func(string, string) bool) error {
+				for _, key := range []string{"a", "b", "c"} {
+					if !yield(key, "v"+key) {
+						break
+					}
+				}
+				return nil
+			})
+
+		pairs, err := storage.Range(ctx, "a", "z", 2)
+		require.NoError(t, err)
+		require.Equal(t, []KeyValue{{Key: "a", Value: "va"}, {Key: "b", Value: "vb"}}, pairs)
+
+		pairs, err = storage.Range(ctx, "a", "z", 0)
+		require.NoError(t, err)
+		require.Len(t, pairs, 3)
+
+		expErr := errors.New("test error")
+		engine.MockRangeEngine.EXPECT().Range(ctx, "a", "z", gomock.Any()).Return(expErr)
+		_, err = storage.Range(ctx, "a", "z", 0)
+		require.ErrorIs(t, err, expErr)
+	})
+}
+
+func TestStorage_Scan(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine := getMockEngine(t)
+	storage, err := NewStorage(engine, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	engine.EXPECT().Scan(ctx, uint64(0), 3).Return([]string{"user_1", "order_1", "user_2"}, uint64(42), nil)
+	keys, next, err := storage.Scan(ctx, 0, "user_*", 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"user_1", "user_2"}, keys)
+	require.Equal(t, uint64(42), next)
+
+	engine.EXPECT().Scan(ctx, uint64(42), 3).Return([]string{"key"}, uint64(0), nil)
+	_, _, err = storage.Scan(ctx, 42, "[", 3)
+	require.Error(t, err)
+
+	expErr := errors.New("test error")
+	engine.EXPECT().Scan(ctx, uint64(0), 3).Return(nil, uint64(0), expErr)
+	_, _, err = storage.Scan(ctx, 0, "*", 3)
+	require.ErrorIs(t, err, expErr)
+}
+
+func TestStorage_Keys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine := getMockEngine(t)
+	storage, err := NewStorage(engine, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	gomock.InOrder(
+		engine.EXPECT().Scan(ctx, uint64(0), keysBatchSize).Return([]string{"k3", "x1", "k1"}, uint64(7), nil),
+		engine.EXPECT().Scan(ctx, uint64(7), keysBatchSize).Return([]string{"k2"}, uint64(0), nil),
+	)
+	keys, err := storage.Keys(ctx, "k?")
+	require.NoError(t, err)
+	require.Equal(t, []string{"k1", "k2", "k3"}, keys)
+
+	expErr := errors.New("test error")
+	engine.EXPECT().Scan(ctx, uint64(0), keysBatchSize).Return(nil, uint64(0), expErr)
+	_, err = storage.Keys(ctx, "*")
+	require.ErrorIs(t, err, expErr)
+}
+
+func TestStorage_Commit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := dclock.NewFakeClock(time.Unix(0, 0))
+	tx := NewTransaction()
+	tx.Set("key1", "value1")
+	tx.SetWithTTL("key2", "value2", time.Second)
+	batch := tx.batch(clock.Now())
+
+	t.Run("commit without wal", func(t *testing.T) {
+		engine := getMockBatchEngine(t)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithClock(clock))
+		require.NoError(t, err)
+
+		engine.MockBatchEngine.EXPECT().Apply(ctx, batch).Return(nil)
+		require.NoError(t, storage.Commit(ctx, tx))
+
+		require.NoError(t, storage.Commit(ctx, NewTransaction()))
+	})
+
+	t.Run("commit with wal", func(t *testing.T) {
+		engine, journal := getMockBatchEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal), WithClock(clock))
+		require.NoError(t, err)
+
+		log := wal.NewBatchLog(0, []wal.Log{
+			wal.NewLog(0, wal.SetOp, "key1", "value1"),
+			wal.NewLog(0, wal.SetOp, "key2", "value2", wal.FormatExpiration(time.Unix(1, 0))),
+		})
+		gomock.InOrder(
+			journal.EXPECT().Append(ctx, wal.BatchOp, log.Args[0], log.Args[1]).
+				Return(dfuture.NewResolvedFuture[error](nil)),
+			engine.MockBatchEngine.EXPECT().Apply(ctx, batch).Return(nil),
+		)
+		require.NoError(t, storage.Commit(ctx, tx))
+	})
+
+	t.Run("engine error", func(t *testing.T) {
+		engine, journal := getMockBatchEngine(t), getMockWAL(t)
+		journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+		storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal), WithClock(clock))
+		require.NoError(t, err)
+
+		expErr := errors.New("test error")
+		journal.EXPECT().Append(ctx, wal.BatchOp, gomock.Any(), gomock.Any()).
+			Return(dfuture.NewResolvedFuture[error](nil))
+		engine.MockBatchEngine.EXPECT().Apply(ctx, batch).Return(expErr)
+		require.ErrorIs(t, storage.Commit(ctx, tx), expErr)
+	})
+
+	t.Run("engine without batches", func(t *testing.T) {
+		storage, err := NewStorage(getMockEngine(t), dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		require.Error(t, storage.Commit(ctx, tx))
+	})
+}
+
+func TestStorage_Apply(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	engine, journal := getMockBatchEngine(t), getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.NoError(t, err)
+
+	// Writes of the same key are kept in order.
+	batch := NewBatch()
+	batch.Put("key", "value")
+	batch.Delete("key")
+	log := wal.NewBatchLog(0, []wal.Log{
+		wal.NewLog(0, wal.SetOp, "key", "value"),
+		wal.NewLog(0, wal.DelOp, "key"),
+	})
+	gomock.InOrder(
+		journal.EXPECT().Append(ctx, wal.BatchOp, log.Args[0], log.Args[1]).
+			Return(dfuture.NewResolvedFuture[error](nil)),
+		engine.MockBatchEngine.EXPECT().Apply(ctx, batch).Return(nil),
+	)
+	require.NoError(t, storage.Apply(ctx, batch))
+	require.NoError(t, storage.Apply(ctx, NewBatch()))
+
+	// The batch is recovered from its log.
+	recovered, err := parseBatchLog(log)
+	require.NoError(t, err)
+	require.Equal(t, batch, recovered)
+
+	_, err = parseBatchLog(wal.NewBatchLog(0, []wal.Log{wal.NewLog(0, wal.SetOp, "key")}))
+	require.ErrorIs(t, err, wal.ErrCorruptedLog)
+}
+
+func TestStorage_Flush(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	engine := &mockFlushEngine{MockEngine: NewMockEngine(ctrl), MockFlushEngine: NewMockFlushEngine(ctrl)}
+	journal := getMockWAL(t)
+
+	// The flush is replayed from its log.
+	gomock.InOrder(
+		journal.EXPECT().Recover(uint64(0)).Return([]wal.Log{wal.NewLog(1, wal.FlushOp)}, nil),
+		engine.MockFlushEngine.EXPECT().Flush(ctx).Return(nil),
+	)
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), WithWAL(journal))
+	require.NoError(t, err)
+
+	gomock.InOrder(
+		journal.EXPECT().Append(ctx, wal.FlushOp).Return(dfuture.NewResolvedFuture[error](nil)),
+		engine.MockFlushEngine.EXPECT().Flush(ctx).Return(nil),
+	)
+	require.NoError(t, storage.Flush(ctx))
+
+	storage, err = NewStorage(getMockEngine(t), dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.Error(t, storage.Flush(ctx))
 }
 
 func getMockEngine(t *testing.T) *MockEngine {
@@ -180,3 +1201,76 @@ func getMockEngine(t *testing.T) *MockEngine {
 	ctrl := gomock.NewController(t)
 	return NewMockEngine(ctrl)
 }
+
+func getMockWAL(t *testing.T) *MockWAL {
+	t.Helper()
+
+	ctrl := gomock.NewController(t)
+	return NewMockWAL(ctrl)
+}
+
+func getStorageWithWAL(t *testing.T, options ...StorageOption) (*Storage, *MockEngine, *MockWAL) {
+	t.Helper()
+
+	engine, journal := getMockEngine(t), getMockWAL(t)
+	journal.EXPECT().Recover(uint64(0)).Return(nil, nil)
+
+	storage, err := NewStorage(engine, dlog.NewNonSlog(), append(options, WithWAL(journal))...)
+	require.NoError(t, err)
+
+	return storage, engine, journal
+}
+
+type mockBatchEngine struct {
+	*MockEngine
+	*MockBatchEngine
+}
+
+func getMockBatchEngine(t *testing.T) *mockBatchEngine {
+	t.Helper()
+
+	ctrl := gomock.NewController(t)
+	return &mockBatchEngine{
+		MockEngine:      NewMockEngine(ctrl),
+		MockBatchEngine: NewMockBatchEngine(ctrl),
+	}
+}
+
+type mockFlushEngine struct {
+	*MockEngine
+	*MockFlushEngine
+}
+
+type mockSnapshotEngine struct {
+	*MockEngine
+	*MockSnapshotEngine
+}
+
+func getMockSnapshotEngine(t *testing.T) *mockSnapshotEngine {
+	t.Helper()
+
+	ctrl := gomock.NewController(t)
+	return &mockSnapshotEngine{
+		MockEngine:         NewMockEngine(ctrl),
+		MockSnapshotEngine: NewMockSnapshotEngine(ctrl),
+	}
+}
+
+func (e *mockSnapshotEngine) EXPECT() *mockSnapshotEngineRecorder {
+	return &mockSnapshotEngineRecorder{
+		MockEngineMockRecorder:         e.MockEngine.EXPECT(),
+		MockSnapshotEngineMockRecorder: e.MockSnapshotEngine.EXPECT(),
+	}
+}
+
+type mockSnapshotEngineRecorder struct {
+	*MockEngineMockRecorder
+	*MockSnapshotEngineMockRecorder
+}
+
+func getMockSnapshots(t *testing.T) *MockSnapshots {
+	t.Helper()
+
+	ctrl := gomock.NewController(t)
+	return NewMockSnapshots(ctrl)
+}
@@ -0,0 +1,77 @@
+package storage
+
+import "time"
+
+type transactionWrite struct {
+	value   string
+	ttl     time.Duration
+	deleted bool
+}
+
+// Transaction buffers writes until they are committed by Storage.Commit.
+// Only the last write of every key is kept. A transaction is not safe for
+// concurrent use.
+type Transaction struct {
+	writes map[string]transactionWrite
+	keys   []string
+}
+
+func NewTransaction() *Transaction {
+	return &Transaction{
+		writes: make(map[string]transactionWrite),
+	}
+}
+
+func (t *Transaction) Set(key, value string) {
+	t.write(key, transactionWrite{value: value})
+}
+
+// SetWithTTL sets the value that expires after the TTL. The TTL is counted
+// from the commit.
+func (t *Transaction) SetWithTTL(key, value string, ttl time.Duration) {
+	t.write(key, transactionWrite{value: value, ttl: ttl})
+}
+
+func (t *Transaction) Delete(key string) {
+	t.write(key, transactionWrite{deleted: true})
+}
+
+// Get returns the value written by the transaction. The last result is false
+// if the transaction hasn't written the key, so it has to be read from the
+// storage.
+func (t *Transaction) Get(key string) (string, bool, bool) {
+	w, ok := t.writes[key]
+	if !ok {
+		return "", false, false
+	}
+	return w.value, !w.deleted, true
+}
+
+// Len returns the number of written keys.
+func (t *Transaction) Len() int {
+	return len(t.keys)
+}
+
+func (t *Transaction) write(key string, w transactionWrite) {
+	if _, ok := t.writes[key]; !ok {
+		t.keys = append(t.keys, key)
+	}
+	t.writes[key] = w
+}
+
+// batch returns the writes in the order of the first write of every key.
+func (t *Transaction) batch(now time.Time) *Batch {
+	batch := NewBatch()
+	for _, key := range t.keys {
+		w := t.writes[key]
+		switch {
+		case w.deleted:
+			batch.Delete(key)
+		case w.ttl > 0:
+			batch.PutWithExpiration(key, w.value, now.Add(w.ttl))
+		default:
+			batch.Put(key, w.value)
+		}
+	}
+	return batch
+}
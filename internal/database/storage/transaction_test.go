@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransaction(t *testing.T) {
+	t.Parallel()
+
+	tx := NewTransaction()
+	require.Zero(t, tx.Len())
+
+	_, _, ok := tx.Get("key1")
+	require.False(t, ok)
+
+	tx.Set("key1", "value")
+	tx.SetWithTTL("key2", "value2", time.Second)
+	tx.Delete("key3")
+	tx.Set("key1", "value1")
+	require.Equal(t, 3, tx.Len())
+
+	value, found, ok := tx.Get("key1")
+	require.True(t, ok)
+	require.True(t, found)
+	require.Equal(t, "value1", value)
+
+	_, found, ok = tx.Get("key3")
+	require.True(t, ok)
+	require.False(t, found)
+
+	require.Equal(t, []Write{
+		{Key: "key1", Value: "value1"},
+		{Key: "key2", Value: "value2", ExpiresAt: time.Unix(1, 0)},
+		{Key: "key3", Deleted: true},
+	}, tx.batch(time.Unix(0, 0)).Writes())
+}
@@ -0,0 +1,294 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Op byte
+
+const (
+	UnknownOp Op = iota
+	SetOp
+	DelOp
+	// BatchOp applies logs, which are encoded as its arguments, atomically.
+	BatchOp
+	// LPushOp and RPushOp push values to a list. Their arguments are the key,
+	// the expiration time of the list after the push, which is empty if the
+	// list doesn't expire, and the values.
+	LPushOp
+	RPushOp
+	// LPopOp and RPopOp pop a value of a list. Their argument is the key.
+	LPopOp
+	RPopOp
+	// ListOp replaces the value of a key with a list. Its arguments are the
+	// same as the ones of RPushOp.
+	ListOp
+	// HSetOp sets fields of a hash. Its arguments are the key, the expiration
+	// time of the hash after the write and field value pairs.
+	HSetOp
+	// HDelOp deletes fields of a hash. Its arguments are the key and the
+	// fields.
+	HDelOp
+	// HashOp replaces the value of a key with a hash. Its arguments are the
+	// same as the ones of HSetOp.
+	HashOp
+	// SAddOp adds members to a set. Its arguments are the key, the expiration
+	// time of the set after the write and the members.
+	SAddOp
+	// SRemOp removes members of a set. Its arguments are the key and the
+	// members.
+	SRemOp
+	// MembersOp replaces the value of a key with a set. Its arguments are the
+	// same as the ones of SAddOp.
+	MembersOp
+	// ZAddOp adds members to a sorted set. Its arguments are the key, the
+	// expiration time of the sorted set after the write and score member
+	// pairs, where scores are formatted by FormatScore.
+	ZAddOp
+	// ZRemOp removes members of a sorted set. Its arguments are the key and
+	// the members.
+	ZRemOp
+	// SortedSetOp replaces the value of a key with a sorted set. Its
+	// arguments are the same as the ones of ZAddOp.
+	SortedSetOp
+	// FlushOp deletes all keys. It has no arguments.
+	FlushOp
+	// GuardOp applies a log only if its keys are in the states that the log
+	// is planned on. Its arguments are the ID of the proposal, the log
+	// encoded like the logs of a batch and the keys followed by their states.
+	GuardOp
+)
+
+const logHeaderSize = 8
+
+var ErrCorruptedLog = errors.New("corrupted log")
+
+type Log struct {
+	LSN  uint64
+	Op   Op
+	Args []string
+}
+
+func NewLog(lsn uint64, op Op, args ...string) Log {
+	return Log{
+		LSN:  lsn,
+		Op:   op,
+		Args: args,
+	}
+}
+
+// NewBatchLog returns a log that applies the logs atomically. The logs are
+// encoded as arguments, so the whole batch is written, checked and
+// recovered as a single frame.
+func NewBatchLog(lsn uint64, logs []Log) Log {
+	args := make([]string, 0, len(logs))
+	for _, log := range logs {
+		args = append(args, string(log.AppendTo(nil)))
+	}
+	return NewLog(lsn, BatchOp, args...)
+}
+
+// BatchLogs decodes the logs of a BatchOp log.
+func (l Log) BatchLogs() ([]Log, error) {
+	if l.Op != BatchOp {
+		return nil, fmt.Errorf("%w: not a batch", ErrCorruptedLog)
+	}
+
+	logs := make([]Log, 0, len(l.Args))
+	for _, arg := range l.Args {
+		decoded, err := DecodeLogs(strings.NewReader(arg))
+		if err != nil {
+			return nil, err
+		}
+		if len(decoded) != 1 {
+			return nil, fmt.Errorf("%w: invalid batch", ErrCorruptedLog)
+		}
+		logs = append(logs, decoded[0])
+	}
+	return logs, nil
+}
+
+// NewGuardLog returns a GuardOp log of the log with the ID, which applies the
+// log if the keys have the states that follow them in pairs.
+func NewGuardLog(lsn uint64, id string, log Log, states []string) Log {
+	args := make([]string, 0, len(states)+2)
+	args = append(args, id, string(log.AppendTo(nil)))
+	return NewLog(lsn, GuardOp, append(args, states...)...)
+}
+
+// GuardedLog decodes a GuardOp log into its ID, its log and the keys followed
+// by their states.
+func (l Log) GuardedLog() (string, Log, []string, error) {
+	if l.Op != GuardOp || len(l.Args) < 2 || len(l.Args)%2 != 0 {
+		return "", Log{}, nil, fmt.Errorf("%w: invalid guard", ErrCorruptedLog)
+	}
+
+	decoded, err := DecodeLogs(strings.NewReader(l.Args[1]))
+	if err != nil {
+		return "", Log{}, nil, err
+	}
+	if len(decoded) != 1 {
+		return "", Log{}, nil, fmt.Errorf("%w: invalid guard", ErrCorruptedLog)
+	}
+	return l.Args[0], decoded[0], l.Args[2:], nil
+}
+
+// FormatExpiration formats an expiration time as a log argument. Logs keep
+// absolute times, so a replay doesn't extend the lifetime of keys.
+func FormatExpiration(expiresAt time.Time) string {
+	return strconv.FormatInt(expiresAt.UnixNano(), 10)
+}
+
+func ParseExpiration(arg string) (time.Time, error) {
+	nanos, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid expiration", ErrCorruptedLog)
+	}
+	return time.Unix(0, nanos), nil
+}
+
+// FormatScore formats a score of a sorted set as a log argument, which is
+// parsed back to the same value.
+func FormatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+func ParseScore(arg string) (float64, error) {
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, fmt.Errorf("%w: invalid score", ErrCorruptedLog)
+	}
+	return score, nil
+}
+
+// AppendTo appends the log encoded as a frame: payload size (4 bytes), CRC32
+// of the payload (4 bytes) and the payload itself (LSN, operation and
+// arguments).
+func (l Log) AppendTo(buffer []byte) []byte {
+	payload := binary.AppendUvarint(nil, l.LSN)
+	payload = append(payload, byte(l.Op))
+	payload = binary.AppendUvarint(payload, uint64(len(l.Args)))
+	for _, arg := range l.Args {
+		payload = binary.AppendUvarint(payload, uint64(len(arg)))
+		payload = append(payload, arg...)
+	}
+
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(payload)))
+	buffer = binary.LittleEndian.AppendUint32(buffer, crc32.ChecksumIEEE(payload))
+	return append(buffer, payload...)
+}
+
+// MarshalText encodes the frame of the log in base64, so the log can be sent
+// as a single line of a text protocol.
+func (l Log) MarshalText() ([]byte, error) {
+	frame := l.AppendTo(nil)
+	text := make([]byte, base64.StdEncoding.EncodedLen(len(frame)))
+	base64.StdEncoding.Encode(text, frame)
+	return text, nil
+}
+
+func (l *Log) UnmarshalText(text []byte) error {
+	frame := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+	n, err := base64.StdEncoding.Decode(frame, text)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCorruptedLog, err)
+	}
+
+	logs, err := DecodeLogs(bytes.NewReader(frame[:n]))
+	if err != nil {
+		return err
+	}
+	if len(logs) != 1 {
+		return fmt.Errorf("%w: invalid text", ErrCorruptedLog)
+	}
+	*l = logs[0]
+	return nil
+}
+
+func encodeLogs(logs []Log) []byte {
+	var buffer []byte
+	for _, log := range logs {
+		buffer = log.AppendTo(buffer)
+	}
+	return buffer
+}
+
+// DecodeLogs reads logs until the end of the reader. A partially written
+// frame at the tail is treated as the end of the data, because it is the
+// expected result of a crash in the middle of a write.
+func DecodeLogs(r io.Reader) ([]Log, error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, logHeaderSize)
+
+	var logs []Log
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return logs, nil
+			}
+			return nil, err
+		}
+
+		size := binary.LittleEndian.Uint32(header[:4])
+		checksum := binary.LittleEndian.Uint32(header[4:])
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return logs, nil
+			}
+			return nil, err
+		}
+
+		if crc32.ChecksumIEEE(payload) != checksum {
+			return logs, ErrCorruptedLog
+		}
+
+		log, err := decodeLog(payload)
+		if err != nil {
+			return logs, err
+		}
+		logs = append(logs, log)
+	}
+}
+
+func decodeLog(payload []byte) (Log, error) {
+	var log Log
+
+	lsn, n := binary.Uvarint(payload)
+	if n <= 0 || n >= len(payload) {
+		return Log{}, fmt.Errorf("%w: invalid lsn", ErrCorruptedLog)
+	}
+	log.LSN = lsn
+	log.Op = Op(payload[n])
+	payload = payload[n+1:]
+
+	argsCount, n := binary.Uvarint(payload)
+	if n <= 0 || argsCount > uint64(len(payload)) {
+		return Log{}, fmt.Errorf("%w: invalid arguments count", ErrCorruptedLog)
+	}
+	payload = payload[n:]
+
+	log.Args = make([]string, 0, argsCount)
+	for i := uint64(0); i < argsCount; i++ {
+		size, n := binary.Uvarint(payload)
+		if n <= 0 || size > uint64(len(payload)-n) {
+			return Log{}, fmt.Errorf("%w: invalid argument size", ErrCorruptedLog)
+		}
+		log.Args = append(log.Args, string(payload[n:n+int(size)]))
+		payload = payload[n+int(size):]
+	}
+
+	return log, nil
+}
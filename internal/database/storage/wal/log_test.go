@@ -0,0 +1,144 @@
+package wal
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecodeLogs(t *testing.T) {
+	t.Parallel()
+
+	logs := []Log{
+		NewLog(1, SetOp, "key", "value"),
+		NewLog(2, DelOp, "key"),
+		NewLog(300, SetOp, "", ""),
+	}
+
+	decoded, err := DecodeLogs(bytes.NewReader(encodeLogs(logs)))
+
+	require.NoError(t, err)
+	require.Equal(t, logs, decoded)
+}
+
+func TestDecodeLogsWithTornTail(t *testing.T) {
+	t.Parallel()
+
+	logs := []Log{
+		NewLog(1, SetOp, "key1", "value1"),
+		NewLog(2, SetOp, "key2", "value2"),
+	}
+	data := encodeLogs(logs)
+
+	t.Run("partial header", func(t *testing.T) {
+		torn := append(encodeLogs(logs[:1]), data[len(encodeLogs(logs[:1])):][:3]...)
+
+		decoded, err := DecodeLogs(bytes.NewReader(torn))
+
+		require.NoError(t, err)
+		require.Equal(t, logs[:1], decoded)
+	})
+
+	t.Run("partial payload", func(t *testing.T) {
+		decoded, err := DecodeLogs(bytes.NewReader(data[:len(data)-1]))
+
+		require.NoError(t, err)
+		require.Equal(t, logs[:1], decoded)
+	})
+}
+
+func TestDecodeCorruptedLogs(t *testing.T) {
+	t.Parallel()
+
+	logs := []Log{
+		NewLog(1, SetOp, "key1", "value1"),
+		NewLog(2, SetOp, "key2", "value2"),
+	}
+	data := encodeLogs(logs)
+	data[len(data)-1] ^= 0xff
+
+	decoded, err := DecodeLogs(bytes.NewReader(data))
+
+	require.ErrorIs(t, err, ErrCorruptedLog)
+	require.Equal(t, logs[:1], decoded)
+}
+
+func TestBatchLog(t *testing.T) {
+	t.Parallel()
+
+	logs := []Log{
+		NewLog(0, SetOp, "key1", "value1"),
+		NewLog(0, DelOp, "key2"),
+	}
+	batch := NewBatchLog(7, logs)
+	require.Equal(t, BatchOp, batch.Op)
+
+	decoded, err := DecodeLogs(bytes.NewReader(encodeLogs([]Log{batch})))
+	require.NoError(t, err)
+	require.Equal(t, []Log{batch}, decoded)
+
+	batchLogs, err := decoded[0].BatchLogs()
+	require.NoError(t, err)
+	require.Equal(t, logs, batchLogs)
+
+	_, err = logs[0].BatchLogs()
+	require.ErrorIs(t, err, ErrCorruptedLog)
+
+	batch.Args[1] = batch.Args[1][:len(batch.Args[1])-1]
+	_, err = batch.BatchLogs()
+	require.ErrorIs(t, err, ErrCorruptedLog)
+}
+
+func TestGuardLog(t *testing.T) {
+	t.Parallel()
+
+	log := NewLog(0, SetOp, "key", "2")
+	guard := NewGuardLog(0, "id", log, []string{"key", "state"})
+	require.Equal(t, GuardOp, guard.Op)
+
+	id, guarded, states, err := guard.GuardedLog()
+	require.NoError(t, err)
+	require.Equal(t, "id", id)
+	require.Equal(t, log, guarded)
+	require.Equal(t, []string{"key", "state"}, states)
+
+	_, _, _, err = log.GuardedLog()
+	require.ErrorIs(t, err, ErrCorruptedLog)
+
+	guard.Args = guard.Args[:3]
+	_, _, _, err = guard.GuardedLog()
+	require.ErrorIs(t, err, ErrCorruptedLog)
+}
+
+func TestLogText(t *testing.T) {
+	t.Parallel()
+
+	log := NewBatchLog(3, []Log{NewLog(0, SetOp, "key", "value\nwith line break")})
+	text, err := log.MarshalText()
+	require.NoError(t, err)
+	require.NotContains(t, string(text), "\n")
+
+	var decoded Log
+	require.NoError(t, decoded.UnmarshalText(text))
+	require.Equal(t, log, decoded)
+
+	require.ErrorIs(t, decoded.UnmarshalText([]byte("not base64!")), ErrCorruptedLog)
+	require.ErrorIs(t, decoded.UnmarshalText(text[:len(text)-8]), ErrCorruptedLog)
+}
+
+func TestScore(t *testing.T) {
+	t.Parallel()
+
+	for _, score := range []float64{0, -1.5, 0.1, 1e300, math.Inf(1), math.Inf(-1)} {
+		parsed, err := ParseScore(FormatScore(score))
+		require.NoError(t, err)
+		require.Equal(t, score, parsed)
+	}
+
+	_, err := ParseScore("NaN")
+	require.ErrorIs(t, err, ErrCorruptedLog)
+	_, err = ParseScore("score")
+	require.ErrorIs(t, err, ErrCorruptedLog)
+}
@@ -0,0 +1,293 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kv_db/pkg/dlog"
+)
+
+const (
+	segmentPrefix = "wal_"
+	segmentSuffix = ".log"
+)
+
+type LogsManager struct {
+	directory      string
+	maxSegmentSize int
+	fsync          bool
+	logger         *slog.Logger
+
+	segment     *os.File
+	segmentSize int
+	// torn is set when the segment may end with a part of a failed batch
+	// after segmentSize.
+	torn bool
+}
+
+func NewLogsManager(directory string, maxSegmentSize int, fsync bool, logger *slog.Logger) (*LogsManager, error) {
+	if directory == "" {
+		return nil, errors.New("logs manager directory is invalid")
+	}
+
+	if maxSegmentSize <= 0 {
+		return nil, errors.New("logs manager max segment size is invalid")
+	}
+
+	if logger == nil {
+		return nil, errors.New("logs manager logger is invalid")
+	}
+
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create wal directory: %w", err)
+	}
+
+	return &LogsManager{
+		directory:      directory,
+		maxSegmentSize: maxSegmentSize,
+		fsync:          fsync,
+		logger:         logger,
+	}, nil
+}
+
+// Write appends logs to the current segment. A new segment is started when
+// the current one has reached the max segment size, so a batch is never
+// split between two segments. If a batch fails, the segment is truncated
+// back to the end of the previous batch, and no log is written until that
+// succeeds, so a torn batch can't be left behind in a segment that isn't the
+// last one.
+func (m *LogsManager) Write(logs []Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	if m.torn {
+		if err := m.repairSegment(); err != nil {
+			return err
+		}
+	}
+
+	if m.segment == nil || m.segmentSize >= m.maxSegmentSize {
+		if err := m.rotateSegment(logs[0].LSN); err != nil {
+			return err
+		}
+	}
+
+	data := encodeLogs(logs)
+	if _, err := m.segment.Write(data); err != nil {
+		m.tearSegment()
+		return fmt.Errorf("failed to write logs: %w", err)
+	}
+
+	if m.fsync {
+		if err := m.segment.Sync(); err != nil {
+			m.tearSegment()
+			return fmt.Errorf("failed to sync logs: %w", err)
+		}
+	}
+
+	m.segmentSize += len(data)
+	return nil
+}
+
+// Read returns all logs stored in the directory ordered by LSN. Corruption
+// is tolerated only at the tail of the last segment, which is truncated to
+// its last valid log so that new segments can be appended after it.
+func (m *LogsManager) Read() ([]Log, error) {
+	segments, err := m.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []Log
+	for idx, segment := range segments {
+		isLast := idx == len(segments)-1
+
+		segmentLogs, err := m.readSegment(segment.name)
+		if err != nil {
+			if !errors.Is(err, ErrCorruptedLog) || !isLast {
+				return nil, fmt.Errorf("failed to read segment %s: %w", segment.name, err)
+			}
+			m.logger.Warn("wal tail is corrupted", slog.String("segment", segment.name), dlog.ErrAttr(err))
+		}
+
+		if isLast {
+			if err := m.truncateSegment(segment.name, len(encodeLogs(segmentLogs))); err != nil {
+				return nil, err
+			}
+		}
+		logs = append(logs, segmentLogs...)
+	}
+
+	return logs, nil
+}
+
+// Truncate removes segments that contain only logs with LSN less than or
+// equal to the given one. The last segment is never removed, because it may
+// be the one that is being written.
+func (m *LogsManager) Truncate(lsn uint64) error {
+	segments, err := m.segments()
+	if err != nil {
+		return err
+	}
+
+	for idx := 0; idx < len(segments)-1; idx++ {
+		if segments[idx+1].firstLSN > lsn+1 {
+			break
+		}
+
+		if err := os.Remove(filepath.Join(m.directory, segments[idx].name)); err != nil {
+			return fmt.Errorf("failed to remove segment %s: %w", segments[idx].name, err)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the current segment. A segment that can't be repaired is left
+// torn, which is tolerated by Read while it is the last one.
+func (m *LogsManager) Close() error {
+	if m.segment == nil {
+		return nil
+	}
+
+	if m.torn {
+		if err := m.repairSegment(); err != nil {
+			m.logger.Warn("failed to repair segment", dlog.ErrAttr(err))
+		}
+		m.torn = false
+	}
+
+	err := m.segment.Close()
+	m.segment = nil
+	return err
+}
+
+// tearSegment marks the segment as torn and tries to repair it right away.
+func (m *LogsManager) tearSegment() {
+	m.torn = true
+	if err := m.repairSegment(); err != nil {
+		m.logger.Warn("failed to repair segment", dlog.ErrAttr(err))
+	}
+}
+
+// repairSegment truncates the segment back to the end of the last batch that
+// has been written successfully.
+func (m *LogsManager) repairSegment() error {
+	if err := m.segment.Truncate(int64(m.segmentSize)); err != nil {
+		return fmt.Errorf("failed to truncate torn segment: %w", err)
+	}
+
+	if m.fsync {
+		if err := m.segment.Sync(); err != nil {
+			return fmt.Errorf("failed to sync torn segment: %w", err)
+		}
+	}
+
+	m.torn = false
+	return nil
+}
+
+func (m *LogsManager) rotateSegment(firstLSN uint64) error {
+	if err := m.Close(); err != nil {
+		m.logger.Warn("failed to close segment", dlog.ErrAttr(err))
+	}
+
+	path := filepath.Join(m.directory, segmentName(firstLSN))
+	segment, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+
+	info, err := segment.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat segment: %w", err)
+	}
+
+	m.segment = segment
+	m.segmentSize = int(info.Size())
+	return nil
+}
+
+func (m *LogsManager) readSegment(name string) ([]Log, error) {
+	file, err := os.Open(filepath.Join(m.directory, name))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			m.logger.Warn("failed to close segment", dlog.ErrAttr(err))
+		}
+	}()
+
+	return DecodeLogs(file)
+}
+
+func (m *LogsManager) truncateSegment(name string, size int) error {
+	path := filepath.Join(m.directory, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat segment: %w", err)
+	}
+
+	if info.Size() <= int64(size) {
+		return nil
+	}
+
+	if err := os.Truncate(path, int64(size)); err != nil {
+		return fmt.Errorf("failed to truncate segment: %w", err)
+	}
+	return nil
+}
+
+type segmentInfo struct {
+	name     string
+	firstLSN uint64
+}
+
+func (m *LogsManager) segments() ([]segmentInfo, error) {
+	entries, err := os.ReadDir(m.directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wal directory: %w", err)
+	}
+
+	segments := make([]segmentInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		firstLSN, ok := parseSegmentName(entry.Name())
+		if !ok {
+			continue
+		}
+		segments = append(segments, segmentInfo{name: entry.Name(), firstLSN: firstLSN})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].firstLSN < segments[j].firstLSN
+	})
+	return segments, nil
+}
+
+func segmentName(firstLSN uint64) string {
+	return fmt.Sprintf("%s%020d%s", segmentPrefix, firstLSN, segmentSuffix)
+}
+
+func parseSegmentName(name string) (uint64, bool) {
+	if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+		return 0, false
+	}
+
+	lsn, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return lsn, true
+}
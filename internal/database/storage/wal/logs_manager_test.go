@@ -0,0 +1,238 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/pkg/dlog"
+)
+
+func TestNewLogsManager(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	manager, err := NewLogsManager("", 1024, true, dlog.NewNonSlog())
+	require.Error(t, err)
+	require.Nil(t, manager)
+
+	manager, err = NewLogsManager(dir, 0, true, dlog.NewNonSlog())
+	require.Error(t, err)
+	require.Nil(t, manager)
+
+	manager, err = NewLogsManager(dir, 1024, true, nil)
+	require.Error(t, err)
+	require.Nil(t, manager)
+
+	manager, err = NewLogsManager(filepath.Join(dir, "nested"), 1024, true, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.NotNil(t, manager)
+	require.DirExists(t, filepath.Join(dir, "nested"))
+}
+
+func TestLogsManager_WriteRead(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manager, err := NewLogsManager(dir, 64, true, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	batches := [][]Log{
+		{NewLog(1, SetOp, "key1", "value1"), NewLog(2, SetOp, "key2", "value2")},
+		{NewLog(3, DelOp, "key1")},
+		{NewLog(4, SetOp, "key3", "value3"), NewLog(5, SetOp, "key4", "value4"), NewLog(6, DelOp, "key3")},
+		{NewLog(7, SetOp, "key5", "value5")},
+	}
+	var expected []Log
+	for _, batch := range batches {
+		require.NoError(t, manager.Write(batch))
+		expected = append(expected, batch...)
+	}
+	require.NoError(t, manager.Close())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Greater(t, len(entries), 1)
+
+	logs, err := manager.Read()
+	require.NoError(t, err)
+	require.Equal(t, expected, logs)
+}
+
+func TestLogsManager_ReadEmptyDirectory(t *testing.T) {
+	t.Parallel()
+
+	manager, err := NewLogsManager(t.TempDir(), 1024, false, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	logs, err := manager.Read()
+
+	require.NoError(t, err)
+	require.Empty(t, logs)
+}
+
+func TestLogsManager_ReadCorruptedTail(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manager, err := NewLogsManager(dir, 1024, false, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	valid := []Log{NewLog(1, SetOp, "key1", "value1")}
+	require.NoError(t, manager.Write(valid))
+	require.NoError(t, manager.Write([]Log{NewLog(2, SetOp, "key2", "value2")}))
+	require.NoError(t, manager.Close())
+
+	path := filepath.Join(dir, segmentName(1))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	logs, err := manager.Read()
+	require.NoError(t, err)
+	require.Equal(t, valid, logs)
+
+	next := []Log{NewLog(2, SetOp, "key3", "value3")}
+	require.NoError(t, manager.Write(next))
+	require.NoError(t, manager.Close())
+
+	logs, err = manager.Read()
+	require.NoError(t, err)
+	require.Equal(t, append(valid, next...), logs)
+}
+
+func TestLogsManager_ReadCorruptedMiddleSegment(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manager, err := NewLogsManager(dir, 1, false, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	require.NoError(t, manager.Write([]Log{NewLog(1, SetOp, "key1", "value1")}))
+	require.NoError(t, manager.Write([]Log{NewLog(2, SetOp, "key2", "value2")}))
+	require.NoError(t, manager.Close())
+
+	path := filepath.Join(dir, segmentName(1))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	logs, err := manager.Read()
+	require.ErrorIs(t, err, ErrCorruptedLog)
+	require.Nil(t, logs)
+}
+
+func TestLogsManager_WriteRepairsTornSegment(t *testing.T) {
+	t.Parallel()
+
+	frame := encodeLogs([]Log{NewLog(2, SetOp, "key2", "value2")})
+	corrupted := append([]byte(nil), frame...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	tests := map[string]struct {
+		tail []byte
+	}{
+		"partially written batch": {
+			tail: frame[:len(frame)/2],
+		},
+		"corrupted batch": {
+			tail: corrupted,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			valid := []Log{NewLog(1, SetOp, "key1", "value1")}
+			dir := t.TempDir()
+			manager, err := NewLogsManager(dir, len(encodeLogs(valid))+1, false, dlog.NewNonSlog())
+			require.NoError(t, err)
+			require.NoError(t, manager.Write(valid))
+
+			// The batch fails after a part of it has been written, and the
+			// segment can't be truncated through the read-only file.
+			path := filepath.Join(dir, segmentName(1))
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+			require.NoError(t, err)
+			_, err = file.Write(test.tail)
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+
+			segment := manager.segment
+			manager.segment, err = os.Open(path)
+			require.NoError(t, err)
+			require.Error(t, manager.Write([]Log{NewLog(2, SetOp, "key2", "value2")}))
+
+			// No segment is started after the torn one until it is repaired.
+			require.Error(t, manager.Write([]Log{NewLog(3, SetOp, "key3", "value3")}))
+			require.NoFileExists(t, filepath.Join(dir, segmentName(3)))
+
+			require.NoError(t, manager.segment.Close())
+			manager.segment = segment
+
+			// The repaired segment fills up, so the torn batch would end up in
+			// the middle of the WAL.
+			next := []Log{NewLog(4, SetOp, "key4", "value4"), NewLog(5, SetOp, "key5", "value5")}
+			require.NoError(t, manager.Write(next[:1]))
+			require.NoError(t, manager.Write(next[1:]))
+			require.FileExists(t, filepath.Join(dir, segmentName(5)))
+			require.NoError(t, manager.Close())
+
+			logs, err := manager.Read()
+			require.NoError(t, err)
+			require.Equal(t, append(valid, next...), logs)
+		})
+	}
+}
+
+func TestLogsManager_Truncate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manager, err := NewLogsManager(dir, 1, false, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	require.NoError(t, manager.Write([]Log{NewLog(1, SetOp, "key1", "value1"), NewLog(2, SetOp, "key2", "value2")}))
+	require.NoError(t, manager.Write([]Log{NewLog(3, SetOp, "key3", "value3"), NewLog(4, SetOp, "key4", "value4")}))
+	require.NoError(t, manager.Write([]Log{NewLog(5, SetOp, "key5", "value5")}))
+
+	require.NoError(t, manager.Truncate(1))
+	require.FileExists(t, filepath.Join(dir, segmentName(1)))
+
+	require.NoError(t, manager.Truncate(3))
+	require.NoFileExists(t, filepath.Join(dir, segmentName(1)))
+	require.FileExists(t, filepath.Join(dir, segmentName(3)))
+
+	// The last segment is kept even if it is fully covered.
+	require.NoError(t, manager.Truncate(5))
+	require.NoFileExists(t, filepath.Join(dir, segmentName(3)))
+	require.FileExists(t, filepath.Join(dir, segmentName(5)))
+
+	require.NoError(t, manager.Write([]Log{NewLog(6, SetOp, "key6", "value6")}))
+	require.NoError(t, manager.Close())
+
+	logs, err := manager.Read()
+	require.NoError(t, err)
+	require.Equal(t, []Log{NewLog(5, SetOp, "key5", "value5"), NewLog(6, SetOp, "key6", "value6")}, logs)
+}
+
+func TestParseSegmentName(t *testing.T) {
+	t.Parallel()
+
+	lsn, ok := parseSegmentName(segmentName(42))
+	require.True(t, ok)
+	require.Equal(t, uint64(42), lsn)
+
+	_, ok = parseSegmentName("wal_abc.log")
+	require.False(t, ok)
+
+	_, ok = parseSegmentName("snapshot_1.log")
+	require.False(t, ok)
+}
@@ -0,0 +1,207 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"kv_db/pkg/dfuture"
+	"kv_db/pkg/dlock"
+	"kv_db/pkg/dlog"
+)
+
+var ErrClosed = errors.New("wal is closed")
+
+type logsWriter interface {
+	Write([]Log) error
+	Read() ([]Log, error)
+	Truncate(uint64) error
+	Close() error
+}
+
+type batch struct {
+	logs   []Log
+	future *dfuture.Future[error]
+}
+
+func newBatch(size int) *batch {
+	return &batch{
+		logs:   make([]Log, 0, size),
+		future: dfuture.NewFuture[error](),
+	}
+}
+
+// WAL groups logs of concurrent writers into batches. A batch is written and
+// synced by a single flush, after which every writer of the batch is
+// notified through the future returned by Append.
+type WAL struct {
+	manager      logsWriter
+	batchSize    int
+	batchTimeout time.Duration
+	logger       *slog.Logger
+
+	mutex     sync.Mutex
+	batchCond *sync.Cond
+	lsn       uint64
+	batch     *batch
+	batchFull chan struct{}
+	closed    bool
+}
+
+func NewWAL(manager logsWriter, batchSize int, batchTimeout time.Duration, logger *slog.Logger) (*WAL, error) {
+	if manager == nil {
+		return nil, errors.New("wal logs manager is invalid")
+	}
+
+	if batchSize <= 0 {
+		return nil, errors.New("wal flushing batch size is invalid")
+	}
+
+	if batchTimeout <= 0 {
+		return nil, errors.New("wal flushing batch timeout is invalid")
+	}
+
+	if logger == nil {
+		return nil, errors.New("wal logger is invalid")
+	}
+
+	wal := &WAL{
+		manager:      manager,
+		batchSize:    batchSize,
+		batchTimeout: batchTimeout,
+		logger:       logger,
+		batch:        newBatch(batchSize),
+		batchFull:    make(chan struct{}, 1),
+	}
+	wal.batchCond = sync.NewCond(&wal.mutex)
+
+	return wal, nil
+}
+
+// Recover reads stored logs with LSN greater than the given one, which is
+// the LSN of the snapshot the state is restored from. Numbering continues
+// after the last log or the snapshot. It has to be called before the first
+// write.
+func (w *WAL) Recover(afterLSN uint64) ([]Log, error) {
+	logs, err := w.manager.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := sort.Search(len(logs), func(i int) bool {
+		return logs[i].LSN > afterLSN
+	})
+	logs = logs[idx:]
+
+	dlock.WithLock(&w.mutex, func() {
+		w.lsn = afterLSN
+		if len(logs) != 0 {
+			w.lsn = logs[len(logs)-1].LSN
+		}
+	})
+	return logs, nil
+}
+
+// LastLSN returns the LSN of the last accepted log. The log may be not
+// flushed yet.
+func (w *WAL) LastLSN() uint64 {
+	var lsn uint64
+	dlock.WithLock(&w.mutex, func() {
+		lsn = w.lsn
+	})
+	return lsn
+}
+
+// Truncate removes segments that are fully covered by a snapshot with the
+// given LSN.
+func (w *WAL) Truncate(lsn uint64) error {
+	return w.manager.Truncate(lsn)
+}
+
+// Start flushes the accumulated batch every time it becomes full or the
+// batch timeout expires. Batches are swapped only from here, so logs are
+// written in LSN order. When the context is done the last batch is flushed,
+// the current segment is closed and all following writes fail.
+func (w *WAL) Start(ctx context.Context) {
+	ticker := time.NewTicker(w.batchTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.flush(w.swapBatch(true))
+			if err := w.manager.Close(); err != nil {
+				w.logger.Warn("failed to close wal", dlog.ErrAttr(err))
+			}
+			return
+		case <-w.batchFull:
+			w.flush(w.swapBatch(false))
+			ticker.Reset(w.batchTimeout)
+		case <-ticker.C:
+			w.flush(w.swapBatch(false))
+		}
+	}
+}
+
+// Append adds a log of the mutation to the current batch. The future is
+// resolved when the batch is flushed.
+func (w *WAL) Append(_ context.Context, op Op, args ...string) *dfuture.Future[error] {
+	return w.push(op, args...)
+}
+
+// push appends a log to the current batch. If the batch is full, the writer
+// waits until the flusher takes it, so a batch never exceeds the batch size.
+func (w *WAL) push(op Op, args ...string) *dfuture.Future[error] {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for !w.closed && len(w.batch.logs) >= w.batchSize {
+		w.batchCond.Wait()
+	}
+
+	if w.closed {
+		return dfuture.NewResolvedFuture(ErrClosed)
+	}
+
+	w.lsn++
+	w.batch.logs = append(w.batch.logs, NewLog(w.lsn, op, args...))
+	if len(w.batch.logs) >= w.batchSize {
+		select {
+		case w.batchFull <- struct{}{}:
+		default:
+		}
+	}
+
+	return w.batch.future
+}
+
+func (w *WAL) swapBatch(closed bool) *batch {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.closed = closed
+	w.batchCond.Broadcast()
+
+	if len(w.batch.logs) == 0 {
+		return nil
+	}
+
+	current := w.batch
+	w.batch = newBatch(w.batchSize)
+	return current
+}
+
+func (w *WAL) flush(current *batch) {
+	if current == nil {
+		return
+	}
+
+	err := w.manager.Write(current.logs)
+	if err != nil {
+		w.logger.Error("failed to flush wal batch", slog.Int("size", len(current.logs)), dlog.ErrAttr(err))
+	}
+	current.future.Resolve(err)
+}
@@ -0,0 +1,60 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"kv_db/pkg/dlog"
+)
+
+// BenchmarkWAL compares a sync per write (batch size 1) with group commit,
+// where concurrent writers share a single sync of the batch.
+func BenchmarkWAL(b *testing.B) {
+	writers := 64
+	for _, batchSize := range []int{1, 16, 64, 256} {
+		batchSize := batchSize
+		b.Run(fmt.Sprintf("batch_size_%d", batchSize), func(b *testing.B) {
+			benchmarkWAL(b, batchSize, writers)
+		})
+	}
+}
+
+func benchmarkWAL(b *testing.B, batchSize int, writers int) {
+	b.Helper()
+
+	manager, err := NewLogsManager(b.TempDir(), 64<<20, true, dlog.NewNonSlog())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	wal, err := NewWAL(manager, batchSize, time.Millisecond, dlog.NewNonSlog())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wal.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	value := string(make([]byte, 64))
+
+	b.SetParallelism(writers)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := wal.Append(ctx, SetOp, "key", value).Get(); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,303 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/pkg/dlog"
+)
+
+type memoryLogsWriter struct {
+	mutex    sync.Mutex
+	stored   []Log
+	batches  [][]Log
+	closed   bool
+	writeErr error
+}
+
+func (w *memoryLogsWriter) Write(logs []Log) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.batches = append(w.batches, logs)
+	return w.writeErr
+}
+
+func (w *memoryLogsWriter) Read() ([]Log, error) {
+	return w.stored, nil
+}
+
+func (w *memoryLogsWriter) Truncate(uint64) error {
+	return nil
+}
+
+func (w *memoryLogsWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.closed = true
+	return nil
+}
+
+func (w *memoryLogsWriter) written() [][]Log {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return append([][]Log(nil), w.batches...)
+}
+
+func TestNewWAL(t *testing.T) {
+	t.Parallel()
+
+	writer := &memoryLogsWriter{}
+
+	wal, err := NewWAL(nil, 10, time.Millisecond, dlog.NewNonSlog())
+	require.Error(t, err)
+	require.Nil(t, wal)
+
+	wal, err = NewWAL(writer, 0, time.Millisecond, dlog.NewNonSlog())
+	require.Error(t, err)
+	require.Nil(t, wal)
+
+	wal, err = NewWAL(writer, 10, 0, dlog.NewNonSlog())
+	require.Error(t, err)
+	require.Nil(t, wal)
+
+	wal, err = NewWAL(writer, 10, time.Millisecond, nil)
+	require.Error(t, err)
+	require.Nil(t, wal)
+
+	wal, err = NewWAL(writer, 10, time.Millisecond, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.NotNil(t, wal)
+}
+
+func TestWAL_Recover(t *testing.T) {
+	t.Parallel()
+
+	writer := &memoryLogsWriter{stored: []Log{
+		NewLog(1, SetOp, "key", "value"),
+		NewLog(2, DelOp, "key"),
+	}}
+	wal, err := NewWAL(writer, 1, time.Hour, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	logs, err := wal.Recover(0)
+	require.NoError(t, err)
+	require.Equal(t, writer.stored, logs)
+	require.Equal(t, uint64(2), wal.LastLSN())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	future := wal.Append(ctx, SetOp, "key", "value")
+	wal.Start(ctx)
+
+	require.NoError(t, future.Get())
+	require.Equal(t, [][]Log{{NewLog(3, SetOp, "key", "value")}}, writer.written())
+}
+
+func TestWAL_RecoverAfterSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("wal tail after snapshot", func(t *testing.T) {
+		writer := &memoryLogsWriter{stored: []Log{
+			NewLog(1, SetOp, "key", "value"),
+			NewLog(2, DelOp, "key"),
+			NewLog(3, SetOp, "key", "value"),
+		}}
+		wal, err := NewWAL(writer, 1, time.Hour, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		logs, err := wal.Recover(2)
+		require.NoError(t, err)
+		require.Equal(t, writer.stored[2:], logs)
+		require.Equal(t, uint64(3), wal.LastLSN())
+	})
+
+	t.Run("snapshot covers wal", func(t *testing.T) {
+		writer := &memoryLogsWriter{stored: []Log{
+			NewLog(1, SetOp, "key", "value"),
+		}}
+		wal, err := NewWAL(writer, 1, time.Hour, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		logs, err := wal.Recover(10)
+		require.NoError(t, err)
+		require.Empty(t, logs)
+		require.Equal(t, uint64(10), wal.LastLSN())
+	})
+}
+
+func TestWAL_FlushFullBatch(t *testing.T) {
+	t.Parallel()
+
+	writer := &memoryLogsWriter{}
+	wal, err := NewWAL(writer, 2, time.Hour, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wal.Start(ctx)
+
+	future1 := wal.Append(ctx, SetOp, "key1", "value1")
+	future2 := wal.Append(ctx, DelOp, "key2")
+
+	require.NoError(t, future1.Get())
+	require.NoError(t, future2.Get())
+	require.Equal(t, [][]Log{{
+		NewLog(1, SetOp, "key1", "value1"),
+		NewLog(2, DelOp, "key2"),
+	}}, writer.written())
+}
+
+func TestWAL_FlushByTimeout(t *testing.T) {
+	t.Parallel()
+
+	writer := &memoryLogsWriter{}
+	wal, err := NewWAL(writer, 100, 10*time.Millisecond, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wal.Start(ctx)
+
+	future := wal.Append(ctx, SetOp, "key", "value")
+
+	require.NoError(t, future.Get())
+	require.Equal(t, [][]Log{{NewLog(1, SetOp, "key", "value")}}, writer.written())
+}
+
+func TestWAL_BatchSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	writer := &memoryLogsWriter{}
+	wal, err := NewWAL(writer, 2, time.Hour, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writers := 5
+	var wg sync.WaitGroup
+	wg.Add(writers)
+	for i := 0; i < writers; i++ {
+		go func() {
+			defer wg.Done()
+			require.NoError(t, wal.Append(ctx, SetOp, "key", "value").Get())
+		}()
+	}
+
+	// The flusher is not started yet, so writers beyond the batch size wait.
+	time.Sleep(10 * time.Millisecond)
+	wal.mutex.Lock()
+	require.Len(t, wal.batch.logs, 2)
+	wal.mutex.Unlock()
+
+	go wal.Start(ctx)
+	go func() {
+		// The last batch is not full, so it is flushed on the stop.
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	wg.Wait()
+
+	total := 0
+	for _, batch := range writer.written() {
+		require.LessOrEqual(t, len(batch), 2)
+		total += len(batch)
+	}
+	require.Equal(t, writers, total)
+}
+
+func TestWAL_FlushError(t *testing.T) {
+	t.Parallel()
+
+	expErr := errors.New("test error")
+	writer := &memoryLogsWriter{writeErr: expErr}
+	wal, err := NewWAL(writer, 1, time.Hour, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wal.Start(ctx)
+
+	require.ErrorIs(t, wal.Append(ctx, SetOp, "key", "value").Get(), expErr)
+}
+
+func TestWAL_Closed(t *testing.T) {
+	t.Parallel()
+
+	wal, err := NewWAL(&memoryLogsWriter{}, 1, time.Hour, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	wal.Start(ctx)
+
+	require.ErrorIs(t, wal.Append(ctx, SetOp, "key", "value").Get(), ErrClosed)
+	require.ErrorIs(t, wal.Append(ctx, DelOp, "key").Get(), ErrClosed)
+}
+
+func TestWAL_FlushOnStop(t *testing.T) {
+	t.Parallel()
+
+	writer := &memoryLogsWriter{}
+	wal, err := NewWAL(writer, 100, time.Hour, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wal.Start(ctx)
+	}()
+
+	future := wal.Append(ctx, SetOp, "key", "value")
+	cancel()
+	<-done
+
+	require.NoError(t, future.Get())
+	require.Equal(t, [][]Log{{NewLog(1, SetOp, "key", "value")}}, writer.written())
+	require.True(t, writer.closed)
+}
+
+func TestWAL_WithLogsManager(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manager, err := NewLogsManager(dir, 1024, true, dlog.NewNonSlog())
+	require.NoError(t, err)
+	wal, err := NewWAL(manager, 10, time.Millisecond, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wal.Start(ctx)
+	}()
+
+	require.NoError(t, wal.Append(ctx, SetOp, "key1", "value1").Get())
+	require.NoError(t, wal.Append(ctx, SetOp, "key2", "value2").Get())
+	require.NoError(t, wal.Append(ctx, DelOp, "key1").Get())
+	cancel()
+	<-done
+
+	manager, err = NewLogsManager(dir, 1024, true, dlog.NewNonSlog())
+	require.NoError(t, err)
+	wal, err = NewWAL(manager, 10, time.Millisecond, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	logs, err := wal.Recover(0)
+	require.NoError(t, err)
+	require.Equal(t, []Log{
+		NewLog(1, SetOp, "key1", "value1"),
+		NewLog(2, SetOp, "key2", "value2"),
+		NewLog(3, DelOp, "key1"),
+	}, logs)
+}
@@ -0,0 +1,77 @@
+package initialization
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"kv_db/config"
+	"kv_db/internal/cluster"
+	"kv_db/internal/network"
+)
+
+const (
+	// clusterRequestTimeout is longer than the time a leader waits for the
+	// commit of a proposal forwarded by a follower.
+	clusterRequestTimeout = 10 * time.Second
+
+	defaultClusterDataDirectory = "data/cluster"
+)
+
+// createCluster creates the member of the cluster, which serves the Raft
+// protocol on its own address from the list of the nodes.
+func (i *Initializer) createCluster(cfg config.ClusterConfig) error {
+	members := make(map[string]string, len(cfg.Nodes))
+	for _, member := range cfg.Nodes {
+		if _, ok := members[member.ID]; ok {
+			return fmt.Errorf("cluster node %s is duplicated", member.ID)
+		}
+		members[member.ID] = member.Address
+	}
+
+	var options []cluster.NodeOption
+	if cfg.ElectionTimeout != 0 {
+		options = append(options, cluster.WithElectionTimeout(cfg.ElectionTimeout))
+	}
+	if cfg.HeartbeatInterval != 0 {
+		options = append(options, cluster.WithHeartbeatInterval(cfg.HeartbeatInterval))
+	}
+	if cfg.SnapshotThreshold != 0 {
+		options = append(options, cluster.WithSnapshotThreshold(cfg.SnapshotThreshold))
+	}
+
+	dataDirectory := defaultClusterDataDirectory
+	if cfg.DataDirectory != "" {
+		dataDirectory = cfg.DataDirectory
+	}
+	store, err := cluster.NewFileStore(dataDirectory)
+	if err != nil {
+		return err
+	}
+	options = append(options, cluster.WithStore(store))
+
+	transport, err := cluster.NewTCPTransport(clusterRequestTimeout)
+	if err != nil {
+		return err
+	}
+
+	logger := i.logger.With(slog.String("layer", "cluster"))
+	node, err := cluster.NewNode(cfg.NodeID, members, transport, logger, options...)
+	if err != nil {
+		_ = store.Close()
+		return err
+	}
+
+	server, err := network.NewTCPServer(
+		members[cfg.NodeID], defaultMaxConnectionNumber, defaultIdleTimeout, logger,
+		network.WithMaxQuerySize(cluster.MaxRequestSize),
+	)
+	if err != nil {
+		_ = store.Close()
+		return err
+	}
+
+	i.node, i.transport, i.clusterStore, i.clusterServer = node, transport, store, server
+	i.replication = node
+	return nil
+}
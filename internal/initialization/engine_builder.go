@@ -2,23 +2,130 @@ package initialization
 
 import (
 	"errors"
+	"fmt"
+	"log/slog"
 
 	"kv_db/config"
 	"kv_db/internal/database/storage"
+	"kv_db/internal/database/storage/engine/lsm"
 	"kv_db/internal/database/storage/engine/memory"
+	"kv_db/pkg/dclock"
 )
 
 const (
-	inMemoryEngine = "in_memory"
+	inMemoryEngine        = "in_memory"
+	inMemoryShardedEngine = "in_memory_sharded"
+	inMemoryOrderedEngine = "in_memory_ordered"
+	lsmEngine             = "lsm"
 )
 
-func CreateEngine(cfg config.EngineConfig) (storage.Engine, error) {
+const (
+	defaultShardsNumber        = 16
+	defaultLSMDataDirectory    = "data/lsm"
+	defaultMemtableSize        = 4 << 20
+	defaultBlockSize           = 4 << 10
+	defaultCompactionThreshold = 4
+)
+
+var evictionPolicies = map[string]memory.EvictionPolicy{
+	"":            memory.NoEviction,
+	"noeviction":  memory.NoEviction,
+	"allkeys-lru": memory.AllKeysLRU,
+	"allkeys-lfu": memory.AllKeysLFU,
+}
+
+// CreateEngine creates the engine of the type. The hash table options are
+// used by the in-memory engines only.
+func CreateEngine(
+	cfg config.EngineConfig, clock dclock.Clock, logger *slog.Logger, hashTableOptions ...memory.HashTableOption,
+) (storage.Engine, error) {
 	switch cfg.Type {
-	case "":
-		return memory.NewHashTable(), nil
-	case inMemoryEngine:
-		return memory.NewHashTable(), nil
+	case "", inMemoryEngine, inMemoryShardedEngine, inMemoryOrderedEngine:
+		options, err := createHashTableOptions(cfg, clock)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, hashTableOptions...)
+
+		if cfg.Type == inMemoryOrderedEngine {
+			options = append(options, memory.WithOrderedKeys())
+		}
+		if cfg.Type != inMemoryShardedEngine {
+			return memory.NewHashTable(options...), nil
+		}
+
+		shardsNumber := defaultShardsNumber
+		if cfg.Shards != 0 {
+			shardsNumber = cfg.Shards
+		}
+		engine, err := memory.NewShardedHashTable(shardsNumber, options...)
+		if err != nil {
+			return nil, err
+		}
+		return engine, nil
+	case lsmEngine:
+		if cfg.MaxMemory != "" {
+			return nil, errors.New("max memory can't be used with the lsm engine")
+		}
+
+		engine, err := createLSMEngine(cfg, clock, logger)
+		if err != nil {
+			return nil, err
+		}
+		return engine, nil
 	}
 
 	return nil, errors.New("engine type is incorrect")
 }
+
+func createHashTableOptions(cfg config.EngineConfig, clock dclock.Clock) ([]memory.HashTableOption, error) {
+	options := []memory.HashTableOption{memory.WithClock(clock)}
+
+	policy, ok := evictionPolicies[cfg.EvictionPolicy]
+	if !ok {
+		return nil, errors.New("eviction policy is incorrect")
+	}
+
+	if cfg.MaxMemory != "" {
+		maxMemory, err := parseSize(cfg.MaxMemory)
+		if err != nil {
+			return nil, fmt.Errorf("max memory is incorrect: %w", err)
+		}
+		options = append(options, memory.WithMaxMemory(maxMemory, policy))
+	}
+
+	return options, nil
+}
+
+func createLSMEngine(cfg config.EngineConfig, clock dclock.Clock, logger *slog.Logger) (*lsm.LSM, error) {
+	dataDirectory := defaultLSMDataDirectory
+	memtableSize := defaultMemtableSize
+	blockSize := defaultBlockSize
+	compactionThreshold := defaultCompactionThreshold
+
+	if cfg.DataDirectory != "" {
+		dataDirectory = cfg.DataDirectory
+	}
+
+	if cfg.MemtableSize != "" {
+		size, err := parseSize(cfg.MemtableSize)
+		if err != nil {
+			return nil, fmt.Errorf("memtable size is incorrect: %w", err)
+		}
+		memtableSize = size
+	}
+
+	if cfg.BlockSize != "" {
+		size, err := parseSize(cfg.BlockSize)
+		if err != nil {
+			return nil, fmt.Errorf("block size is incorrect: %w", err)
+		}
+		blockSize = size
+	}
+
+	if cfg.CompactionThreshold != 0 {
+		compactionThreshold = cfg.CompactionThreshold
+	}
+
+	return lsm.NewLSM(dataDirectory, memtableSize, blockSize, compactionThreshold, logger, lsm.WithClock(clock))
+}
@@ -1,17 +1,22 @@
 package initialization
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"kv_db/config"
+	"kv_db/internal/database/storage"
+	"kv_db/internal/database/storage/engine/lsm"
+	"kv_db/pkg/dclock"
+	"kv_db/pkg/dlog"
 )
 
 func TestCreateEngineWithEmptyConfigFields(t *testing.T) {
 	t.Parallel()
 
-	engine, err := CreateEngine(config.EngineConfig{})
+	engine, err := CreateEngine(config.EngineConfig{}, dclock.NewRealClock(), dlog.NewNonSlog())
 	require.NoError(t, err)
 	require.NotNil(t, engine)
 }
@@ -19,7 +24,7 @@ func TestCreateEngineWithEmptyConfigFields(t *testing.T) {
 func TestCreateEngineWithIncorrectType(t *testing.T) {
 	t.Parallel()
 
-	engine, err := CreateEngine(config.EngineConfig{Type: "incorrect"})
+	engine, err := CreateEngine(config.EngineConfig{Type: "incorrect"}, dclock.NewRealClock(), dlog.NewNonSlog())
 	require.Error(t, err)
 	require.Nil(t, engine)
 }
@@ -29,7 +34,90 @@ func TestCreateEngine(t *testing.T) {
 
 	cfg := config.EngineConfig{Type: "in_memory"}
 
-	engine, err := CreateEngine(cfg)
+	engine, err := CreateEngine(cfg, dclock.NewRealClock(), dlog.NewNonSlog())
 	require.NoError(t, err)
 	require.NotNil(t, engine)
 }
+
+func TestCreateShardedEngine(t *testing.T) {
+	t.Parallel()
+
+	clock := dclock.NewRealClock()
+	engine, err := CreateEngine(config.EngineConfig{Type: "in_memory_sharded"}, clock, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.NotNil(t, engine)
+
+	engine, err = CreateEngine(config.EngineConfig{Type: "in_memory_sharded", Shards: 4}, clock, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.NotNil(t, engine)
+
+	engine, err = CreateEngine(config.EngineConfig{Type: "in_memory_sharded", Shards: -1}, clock, dlog.NewNonSlog())
+	require.Error(t, err)
+	require.Nil(t, engine)
+}
+
+func TestCreateOrderedEngine(t *testing.T) {
+	t.Parallel()
+
+	engine, err := CreateEngine(config.EngineConfig{Type: "in_memory_ordered"}, dclock.NewRealClock(), dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.Implements(t, (*storage.RangeEngine)(nil), engine)
+	require.NoError(t, engine.(storage.RangeEngine).Range(context.Background(), "a", "z", func(string, string) bool {
+		return true
+	}))
+}
+
+func TestCreateEngineWithMaxMemory(t *testing.T) {
+	t.Parallel()
+
+	clock := dclock.NewRealClock()
+	for _, cfg := range []config.EngineConfig{
+		{MaxMemory: "1MB"},
+		{MaxMemory: "1MB", EvictionPolicy: "allkeys-lru"},
+		{Type: "in_memory_sharded", MaxMemory: "1MB", EvictionPolicy: "allkeys-lfu"},
+	} {
+		engine, err := CreateEngine(cfg, clock, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		info, err := engine.(storage.InfoEngine).Info(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "1048576", info["max_memory"])
+	}
+
+	for _, incorrect := range []config.EngineConfig{
+		{MaxMemory: "incorrect"},
+		{MaxMemory: "1MB", EvictionPolicy: "incorrect"},
+	} {
+		engine, err := CreateEngine(incorrect, clock, dlog.NewNonSlog())
+		require.Error(t, err)
+		require.Nil(t, engine)
+	}
+}
+
+func TestCreateLSMEngine(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.EngineConfig{
+		Type:                "lsm",
+		DataDirectory:       t.TempDir(),
+		MemtableSize:        "1KB",
+		BlockSize:           "128B",
+		CompactionThreshold: 2,
+	}
+
+	engine, err := CreateEngine(cfg, dclock.NewRealClock(), dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.NotNil(t, engine)
+	require.NoError(t, engine.(*lsm.LSM).Close())
+
+	for _, incorrect := range []config.EngineConfig{
+		{Type: "lsm", DataDirectory: t.TempDir(), MemtableSize: "incorrect"},
+		{Type: "lsm", DataDirectory: t.TempDir(), BlockSize: "incorrect"},
+		{Type: "lsm", DataDirectory: t.TempDir(), CompactionThreshold: -1},
+		{Type: "lsm", DataDirectory: t.TempDir(), MaxMemory: "1MB"},
+	} {
+		engine, err = CreateEngine(incorrect, dclock.NewRealClock(), dlog.NewNonSlog())
+		require.Error(t, err)
+		require.Nil(t, engine)
+	}
+}
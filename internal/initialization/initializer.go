@@ -2,24 +2,65 @@ package initialization
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"path/filepath"
+	"sync"
 
 	"kv_db/config"
+	"kv_db/internal/cluster"
 	"kv_db/internal/database"
 	"kv_db/internal/database/compute"
 	"kv_db/internal/database/compute/analyzer"
 	"kv_db/internal/database/compute/parser"
 	"kv_db/internal/database/storage"
+	"kv_db/internal/database/storage/engine/memory"
+	"kv_db/internal/database/storage/wal"
 	"kv_db/internal/network"
+	"kv_db/internal/pubsub"
+	"kv_db/internal/replication"
+	"kv_db/internal/sharding"
+	"kv_db/pkg/dclock"
 	"kv_db/pkg/dlog"
 )
 
+// defaultDatabases is the number of keyspaces without the databases setting.
+const defaultDatabases = 1
+
 type Initializer struct {
-	engine storage.Engine
-	server *network.TCPServer
-	logger *slog.Logger
+	keyspaces []keyspace
+	server    *network.TCPServer
+	logger    *slog.Logger
+
+	// replication is the primary or the replica if the replication is
+	// enabled, and replica is the replica only. The node of a cluster reports
+	// its state as the replication too.
+	replication database.ReplicationLayer
+	replica     *replication.Replica
+
+	// node is the member of the cluster if the cluster is enabled, which
+	// serves other members by clusterServer.
+	node          *cluster.Node
+	transport     *cluster.TCPTransport
+	clusterStore  *cluster.FileStore
+	clusterServer *network.TCPServer
+
+	// slots are the owners of the slots if the sharding is enabled.
+	slots *sharding.Map
+
+	// broker is shared by all keyspaces, like clients of the same server.
+	// It also gets the changes of keys if keyspace events are enabled.
+	broker         *pubsub.Broker
+	keyspaceEvents bool
+}
+
+// keyspace is an isolated database with its own engine, WAL and snapshots.
+type keyspace struct {
+	engine  storage.Engine
+	storage *storage.Storage
+	wal     *wal.WAL
 }
 
 func NewInitializer(cfg config.Config, logW io.Writer) (*Initializer, error) {
@@ -28,25 +69,200 @@ func NewInitializer(cfg config.Config, logW io.Writer) (*Initializer, error) {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
-	dbEngine, err := CreateEngine(cfg.Engine)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize engine: %w", err)
+	// The lsm engine keeps its own journal, so the WAL would only duplicate
+	// it without ever being truncated.
+	if cfg.Engine.Type == lsmEngine && cfg.WAL != nil {
+		return nil, errors.New("wal can't be used with the lsm engine")
+	}
+
+	// A replica gets a snapshot of the primary after every start, so its own
+	// persistence would never be used.
+	if cfg.Replication != nil && cfg.Replication.MasterAddress != "" && (cfg.WAL != nil || cfg.Snapshot != nil) {
+		return nil, errors.New("wal and snapshots can't be used by a replica")
+	}
+
+	databases := defaultDatabases
+	if cfg.Engine.Databases != 0 {
+		databases = cfg.Engine.Databases
+	}
+	if databases < 0 {
+		return nil, errors.New("databases number is incorrect")
 	}
 
-	tcpServer, err := CreateNetwork(
+	// The Raft log and its snapshots are the persistence and the replication
+	// of a cluster, and they have the data of a single keyspace.
+	if cfg.Cluster != nil {
+		if cfg.WAL != nil || cfg.Snapshot != nil || cfg.Replication != nil {
+			return nil, errors.New("wal, snapshots and replication can't be used by a cluster")
+		}
+		if databases != 1 {
+			return nil, errors.New("cluster supports a single database only")
+		}
+		// The Raft log is compacted by snapshots of the engine, which the lsm
+		// engine doesn't provide, so the log would grow without a limit.
+		if cfg.Engine.Type == lsmEngine {
+			return nil, errors.New("cluster can't be used with the lsm engine")
+		}
+	}
+
+	// Clients with slot routing can't select a database, because they send
+	// the queries of a session to different nodes.
+	if cfg.Sharding != nil && databases != 1 {
+		return nil, errors.New("sharding supports a single database only")
+	}
+
+	// Evictions aren't logged, so the evicted keys would come back after a
+	// recovery from the WAL and stay on replicas and other nodes.
+	evicts := cfg.Engine.MaxMemory != "" && cfg.Engine.EvictionPolicy != "" && cfg.Engine.EvictionPolicy != "noeviction"
+	if evicts && (cfg.WAL != nil || cfg.Replication != nil || cfg.Cluster != nil) {
+		return nil, errors.New("eviction can't be used with wal, replication or cluster")
+	}
+
+	// The engine and the storage must agree on the current time, otherwise a
+	// key could expire in one of them earlier than in the other.
+	clock := dclock.NewRealClock()
+	initializer := &Initializer{
+		keyspaces:      make([]keyspace, 0, databases),
+		logger:         logger,
+		keyspaceEvents: cfg.PubSub.KeyspaceEvents,
+	}
+
+	if initializer.broker, err = CreateBroker(cfg.PubSub); err != nil {
+		return nil, fmt.Errorf("failed to initialize pubsub: %w", err)
+	}
+
+	var options []storage.StorageOption
+	if cfg.Cluster != nil {
+		if err := initializer.createCluster(*cfg.Cluster); err != nil {
+			return nil, fmt.Errorf("failed to initialize cluster: %w", err)
+		}
+		options = append(options, storage.WithConsensus(initializer.node))
+	}
+
+	for idx := 0; idx < databases; idx++ {
+		var events *keyspaceEvents
+		if cfg.PubSub.KeyspaceEvents {
+			events = &keyspaceEvents{broker: initializer.broker, index: idx}
+		}
+		space, err := createKeyspace(cfg, idx, clock, events, logger.With(slog.Int("db", idx)), options...)
+		if err != nil {
+			initializer.closeEngines()
+			return nil, err
+		}
+		initializer.keyspaces = append(initializer.keyspaces, space)
+	}
+
+	if cfg.Replication != nil {
+		if err := initializer.createReplication(*cfg.Replication); err != nil {
+			initializer.closeEngines()
+			return nil, fmt.Errorf("failed to initialize replication: %w", err)
+		}
+	}
+
+	if cfg.Sharding != nil {
+		if initializer.slots, err = CreateSharding(*cfg.Sharding, cfg.Network); err != nil {
+			initializer.closeEngines()
+			return nil, fmt.Errorf("failed to initialize sharding: %w", err)
+		}
+	}
+
+	initializer.server, err = CreateNetwork(
 		cfg.Network, logger.With(slog.String("layer", "server")),
 	)
 	if err != nil {
+		initializer.closeEngines()
 		return nil, fmt.Errorf("failed to initialize network: %w", err)
 	}
 
-	initializer := &Initializer{
-		engine: dbEngine,
-		server: tcpServer,
-		logger: logger,
+	return initializer, nil
+}
+
+// createKeyspace creates the keyspace with the index and the options of its
+// storage, which reports its changes to the events if they aren't nil. The
+// keyspace 0 keeps its data in the configured directories and others in their
+// subdirectories.
+func createKeyspace(
+	cfg config.Config,
+	index int,
+	clock dclock.Clock,
+	events *keyspaceEvents,
+	logger *slog.Logger,
+	options ...storage.StorageOption,
+) (keyspace, error) {
+	engineCfg := cfg.Engine
+	if engineCfg.Type == lsmEngine {
+		engineCfg.DataDirectory = keyspaceDirectory(engineCfg.DataDirectory, defaultLSMDataDirectory, index)
 	}
 
-	return initializer, nil
+	var engineOptions []memory.HashTableOption
+	if events != nil {
+		engineOptions = append(engineOptions, memory.WithRemovalListener(events.removed))
+		options = append(options, storage.WithEvents(events))
+	}
+	dbEngine, err := CreateEngine(engineCfg, clock, logger.With(slog.String("layer", "engine")), engineOptions...)
+	if err != nil {
+		return keyspace{}, fmt.Errorf("failed to initialize engine: %w", err)
+	}
+	space := keyspace{engine: dbEngine}
+
+	options = append(options, storage.WithClock(clock))
+	if cfg.Engine.SweepInterval != 0 {
+		options = append(options, storage.WithSweepInterval(cfg.Engine.SweepInterval))
+	}
+
+	if cfg.WAL != nil {
+		walCfg := *cfg.WAL
+		walCfg.DataDirectory = keyspaceDirectory(walCfg.DataDirectory, defaultWALDataDirectory, index)
+		space.wal, err = CreateWAL(walCfg, logger.With(slog.String("layer", "wal")))
+		if err != nil {
+			space.close(logger)
+			return keyspace{}, fmt.Errorf("failed to initialize wal: %w", err)
+		}
+		options = append(options, storage.WithWAL(space.wal))
+	}
+
+	if cfg.Replication != nil {
+		option, err := CreateReplicationOption(*cfg.Replication)
+		if err != nil {
+			space.close(logger)
+			return keyspace{}, fmt.Errorf("failed to initialize replication: %w", err)
+		}
+		options = append(options, option)
+	}
+
+	if cfg.Snapshot != nil {
+		snapshotCfg := *cfg.Snapshot
+		snapshotCfg.DataDirectory = keyspaceDirectory(snapshotCfg.DataDirectory, defaultSnapshotDataDirectory, index)
+		snapshots, interval, err := CreateSnapshotManager(snapshotCfg, logger.With(slog.String("layer", "snapshot")))
+		if err != nil {
+			space.close(logger)
+			return keyspace{}, fmt.Errorf("failed to initialize snapshots: %w", err)
+		}
+		options = append(options, storage.WithSnapshots(snapshots, interval))
+	}
+
+	// The snapshot and the WAL are replayed into the engine here, before the
+	// server accepts any connection.
+	space.storage, err = storage.NewStorage(
+		dbEngine, logger.With(slog.String("layer", "storage")), options...,
+	)
+	if err != nil {
+		space.close(logger)
+		return keyspace{}, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	return space, nil
+}
+
+// keyspaceDirectory returns the data directory of the keyspace with the index.
+func keyspaceDirectory(directory, defaultDirectory string, index int) string {
+	if directory == "" {
+		directory = defaultDirectory
+	}
+	if index == 0 {
+		return directory
+	}
+	return filepath.Join(directory, fmt.Sprintf("db%d", index))
 }
 
 func (i *Initializer) Start(ctx context.Context) error {
@@ -55,27 +271,131 @@ func (i *Initializer) Start(ctx context.Context) error {
 		return err
 	}
 
-	storageLayer, err := i.createStorageLayer()
-	if err != nil {
-		return err
+	storageLayers := make([]database.StorageLayer, 0, len(i.keyspaces))
+	for _, space := range i.keyspaces {
+		storageLayers = append(storageLayers, space.storage)
 	}
-
-	db, err := database.NewDatabase(
+	options := []database.DatabaseOption{database.WithPubSub(i.broker)}
+	if i.keyspaceEvents {
+		options = append(options, database.WithKeyspaceEvents())
+	}
+	if i.replication != nil {
+		options = append(options, database.WithReplication(i.replication))
+	}
+	if i.slots != nil {
+		options = append(options, database.WithSharding(i.slots))
+	}
+	databases, err := database.NewDatabases(
 		computeLayer,
-		storageLayer,
+		storageLayers,
 		i.logger.With(slog.String("layer", "database")),
+		options...,
 	)
 	if err != nil {
 		i.logger.Error("failed to start database", dlog.ErrAttr(err))
 		return err
 	}
 
-	return i.server.HandleQueries(ctx, func(ctx context.Context, query []byte) []byte {
-		response := db.HandleQuery(ctx, string(query))
-		return []byte(response)
+	defer i.closeEngines()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// A node that can't serve other members stops the whole server.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The WAL outlives the server, so queries that are still being handled
+	// during the shutdown are flushed too.
+	walCtx, stopWAL := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopWAL()
+
+	for _, space := range i.keyspaces {
+		space := space
+		if space.wal != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				space.wal.Start(walCtx)
+			}()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			space.storage.Start(ctx)
+		}()
+	}
+
+	if i.replica != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i.replica.Start(ctx)
+		}()
+	}
+
+	if i.node != nil {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			i.node.Start(ctx, i.keyspaces[0].storage)
+			// The servers of other members wait until their connections are
+			// closed.
+			i.transport.Close()
+			if err := i.clusterStore.Close(); err != nil {
+				i.logger.Error("failed to close cluster store", dlog.ErrAttr(err))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := i.clusterServer.HandleQueries(ctx, i.node.HandleRequest); err != nil {
+				i.logger.Error("failed to start cluster server", dlog.ErrAttr(err))
+				cancel()
+			}
+		}()
+	}
+
+	return i.server.HandleSessions(ctx, func() network.TCPSession {
+		return tcpSession{session: databases[0].NewSession()}
 	})
 }
 
+type tcpSession struct {
+	session *database.Session
+}
+
+func (s tcpSession) HandleQuery(ctx context.Context, query []byte) []byte {
+	return []byte(s.session.HandleQuery(ctx, string(query)))
+}
+
+func (s tcpSession) Messages() <-chan []byte {
+	return s.session.Messages()
+}
+
+func (s tcpSession) Close() {
+	s.session.Close()
+}
+
+// closeEngines releases resources of persistent engines after all queries
+// are handled.
+func (i *Initializer) closeEngines() {
+	for _, space := range i.keyspaces {
+		space.close(i.logger)
+	}
+}
+
+func (s keyspace) close(logger *slog.Logger) {
+	closer, ok := s.engine.(io.Closer)
+	if !ok {
+		return
+	}
+
+	if err := closer.Close(); err != nil {
+		logger.Error("failed to close engine", dlog.ErrAttr(err))
+	}
+}
+
 func (i *Initializer) createComputeLayer() (*compute.Compute, error) {
 	queryParser, err := parser.NewParser(
 		i.logger.With(slog.String("layer", "parser")),
@@ -103,15 +423,3 @@ func (i *Initializer) createComputeLayer() (*compute.Compute, error) {
 
 	return computeLayer, nil
 }
-
-func (i *Initializer) createStorageLayer() (*storage.Storage, error) {
-	storageLayer, err := storage.NewStorage(
-		i.engine, i.logger.With(slog.String("layer", "storage")),
-	)
-	if err != nil {
-		i.logger.Error("failed to initialize storage layer", dlog.ErrAttr(err))
-		return nil, err
-	}
-
-	return storageLayer, nil
-}
@@ -2,13 +2,23 @@ package initialization
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"kv_db/config"
+	"kv_db/internal/database"
+	"kv_db/internal/database/storage"
+	"kv_db/internal/network"
 )
 
 func TestInitializer(t *testing.T) {
@@ -37,8 +47,1539 @@ func TestFailedInitializerCreation(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, initializer)
 
+	cfg = config.Config{WAL: &config.WALConfig{MaxSegmentSize: "incorrect"}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{Engine: config.EngineConfig{Type: "lsm"}, WAL: &config.WALConfig{}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{Engine: config.EngineConfig{SweepInterval: -time.Second}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{Snapshot: &config.SnapshotConfig{DataDirectory: string([]byte{0})}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
 	cfg = config.Config{Network: config.NetworkConfig{MaxConnections: -1}}
 	initializer, err = NewInitializer(cfg, io.Discard)
 	require.Error(t, err)
 	require.Nil(t, initializer)
+
+	cfg = config.Config{Engine: config.EngineConfig{Databases: -1}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{
+		WAL:         &config.WALConfig{DataDirectory: t.TempDir()},
+		Replication: &config.ReplicationConfig{MasterAddress: "localhost:3223"},
+	}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{Replication: &config.ReplicationConfig{BacklogSize: -1}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	for _, cfg := range []config.Config{
+		{WAL: &config.WALConfig{DataDirectory: t.TempDir()}},
+		{Replication: &config.ReplicationConfig{}},
+	} {
+		cfg.Engine = config.EngineConfig{MaxMemory: "1MB", EvictionPolicy: "allkeys-lru"}
+		initializer, err = NewInitializer(cfg, io.Discard)
+		require.ErrorContains(t, err, "eviction")
+		require.Nil(t, initializer)
+	}
+
+	clusterCfg := &config.ClusterConfig{
+		NodeID: "node1",
+		Nodes:  []config.ClusterNodeConfig{{ID: "node1", Address: "localhost:3323"}},
+	}
+	cfg = config.Config{Cluster: clusterCfg, Replication: &config.ReplicationConfig{}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{Cluster: clusterCfg, Engine: config.EngineConfig{Databases: 2}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{Cluster: clusterCfg, Engine: config.EngineConfig{Type: "lsm", DataDirectory: t.TempDir()}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.ErrorContains(t, err, "lsm")
+	require.Nil(t, initializer)
+
+	cfg = config.Config{Cluster: &config.ClusterConfig{
+		NodeID:        "node2",
+		Nodes:         clusterCfg.Nodes,
+		DataDirectory: t.TempDir(),
+	}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{Cluster: &config.ClusterConfig{
+		NodeID:        "node1",
+		Nodes:         append(clusterCfg.Nodes, clusterCfg.Nodes...),
+		DataDirectory: t.TempDir(),
+	}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{Sharding: &config.ShardingConfig{
+		Nodes: []config.ShardingNodeConfig{{Address: "localhost:3223", Slots: "0-100"}},
+	}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{Sharding: &config.ShardingConfig{
+		Nodes: []config.ShardingNodeConfig{{Address: "localhost:3223", Slots: "all"}},
+	}}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.Error(t, err)
+	require.Nil(t, initializer)
+
+	cfg = config.Config{
+		Engine: config.EngineConfig{Databases: 2},
+		Sharding: &config.ShardingConfig{
+			Nodes: []config.ShardingNodeConfig{{Address: "localhost:3223", Slots: "0-16383"}},
+		},
+		Network: config.NetworkConfig{Address: "localhost:3223"},
+	}
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.ErrorContains(t, err, "single database")
+	require.Nil(t, initializer)
+}
+
+func TestInitializerRecoversWAL(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		WAL: &config.WALConfig{
+			FlushingBatchTimeout: time.Millisecond,
+			DataDirectory:        t.TempDir(),
+		},
+		Network: config.NetworkConfig{Address: "localhost:20011"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	response, err := client.Send([]byte("SET key value\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[ok]", string(response))
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	value, found, err := initializer.keyspaces[0].storage.Get(context.Background(), "key")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "value", value)
+}
+
+func TestInitializerRecoversSnapshot(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfg := config.Config{
+		WAL: &config.WALConfig{
+			FlushingBatchTimeout: time.Millisecond,
+			MaxSegmentSize:       "1B",
+			DataDirectory:        filepath.Join(dir, "wal"),
+		},
+		Snapshot: &config.SnapshotConfig{
+			Interval:      10 * time.Millisecond,
+			DataDirectory: filepath.Join(dir, "snapshots"),
+		},
+		Network: config.NetworkConfig{Address: "localhost:20012"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	for _, query := range []string{"SET key1 value1\n", "SET key2 value2\n", "DEL key1\n"} {
+		response, err := client.Send([]byte(query))
+		require.NoError(t, err)
+		require.Equal(t, "[ok]", string(response))
+	}
+	require.NoError(t, client.Close())
+
+	require.Eventually(t, func() bool {
+		return snapshotCoversWAL(cfg)
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	_, found, err := initializer.keyspaces[0].storage.Get(context.Background(), "key1")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	value, found, err := initializer.keyspaces[0].storage.Get(context.Background(), "key2")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "value2", value)
+}
+
+func TestInitializerRecoversLSM(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine:  config.EngineConfig{Type: "lsm", DataDirectory: t.TempDir()},
+		Network: config.NetworkConfig{Address: "localhost:20013"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	response, err := client.Send([]byte("SET key value\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[ok]", string(response))
+	response, err = client.Send([]byte("LPUSH list value\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[error] type isn't supported by the storage engine: lists", string(response))
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+
+	tables, err := filepath.Glob(filepath.Join(cfg.Engine.DataDirectory, "*.sst"))
+	require.NoError(t, err)
+	require.Len(t, tables, 1)
+
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+	defer initializer.closeEngines()
+
+	value, found, err := initializer.keyspaces[0].storage.Get(context.Background(), "key")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "value", value)
+}
+
+func TestInitializerExpiresKeys(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine:  config.EngineConfig{SweepInterval: 10 * time.Millisecond},
+		Network: config.NetworkConfig{Address: "localhost:20014"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	for _, exchange := range [][2]string{
+		{"SET key1 value EX 1\n", "[ok]"},
+		{"SET key2 value EX 10\n", "[ok]"},
+		{"TTL key1\n", "[ok] 1"},
+		{"PERSIST key2\n", "[ok]"},
+		{"TTL key2\n", "[ok] -1"},
+	} {
+		response, err := client.Send([]byte(exchange[0]))
+		require.NoError(t, err)
+		require.Equal(t, exchange[1], string(response))
+	}
+
+	require.Eventually(t, func() bool {
+		response, err := client.Send([]byte("GET key1\n"))
+		return err == nil && string(response) == "[nil]"
+	}, 2*time.Second, 50*time.Millisecond)
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestInitializerTransactions(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine: config.EngineConfig{Type: "in_memory_sharded"},
+		WAL: &config.WALConfig{
+			FlushingBatchTimeout: time.Millisecond,
+			DataDirectory:        t.TempDir(),
+		},
+		Network: config.NetworkConfig{Address: "localhost:20015"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	// Every transaction sets both keys to the same value, so they must be
+	// equal whatever the order of commits is.
+	clients := 4
+	var wg sync.WaitGroup
+	wg.Add(clients)
+	for i := 0; i < clients; i++ {
+		go func(clientID int) {
+			defer wg.Done()
+
+			client := connect(t, cfg.Network.Address)
+			defer client.Close()
+
+			for j := 0; j < 20; j++ {
+				value := fmt.Sprintf("value%d_%d", clientID, j)
+				for _, query := range []string{"BEGIN", "SET key1 " + value, "SET key2 " + value, "COMMIT"} {
+					response, err := client.Send([]byte(query + "\n"))
+					require.NoError(t, err)
+					require.Equal(t, "[ok]", string(response))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	client := connect(t, cfg.Network.Address)
+	for _, exchange := range [][2]string{
+		{"BEGIN\n", "[ok]"},
+		{"SET key1 rolled_back\n", "[ok]"},
+		{"GET key1\n", "[ok] rolled_back"},
+		{"ROLLBACK\n", "[ok]"},
+	} {
+		response, err := client.Send([]byte(exchange[0]))
+		require.NoError(t, err)
+		require.Equal(t, exchange[1], string(response))
+	}
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	value1, found, err := initializer.keyspaces[0].storage.Get(context.Background(), "key1")
+	require.NoError(t, err)
+	require.True(t, found)
+	value2, found, err := initializer.keyspaces[0].storage.Get(context.Background(), "key2")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, value1, value2)
+	require.NotEqual(t, "rolled_back", value1)
+}
+
+func TestInitializerRange(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine:  config.EngineConfig{Type: "in_memory_ordered"},
+		Network: config.NetworkConfig{Address: "localhost:20016"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	for _, exchange := range [][2]string{
+		{"SET key3 value3\n", "[ok]"},
+		{"SET key1 value1\n", "[ok]"},
+		{"SET end value2\n", "[ok]"},
+		{"SET key2 value2\n", "[ok]"},
+		{"RANGE key1 key3 LIMIT 2\n", "[ok] 2\n1) key1 value1\n2) key2 value2"},
+		{"RANGE a z\n", "[ok] 4\n1) end value2\n2) key1 value1\n3) key2 value2\n4) key3 value3"},
+		{"RANGE x z\n", "[ok] 0"},
+	} {
+		response, err := client.Send([]byte(exchange[0]))
+		require.NoError(t, err)
+		require.Equal(t, exchange[1], string(response))
+	}
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestInitializerScan(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine:  config.EngineConfig{Type: "in_memory_sharded", Shards: 4},
+		Network: config.NetworkConfig{Address: "localhost:20017"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	for i := 0; i < 30; i++ {
+		response, err := client.Send([]byte(fmt.Sprintf("SET user_%d value\n", i)))
+		require.NoError(t, err)
+		require.Equal(t, "[ok]", string(response))
+	}
+	response, err := client.Send([]byte("SET order_1 value\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[ok]", string(response))
+
+	// Writes of other clients don't break the iteration.
+	writer := connect(t, cfg.Network.Address)
+	var keys []string
+	cursor := "0"
+	for step := 0; ; step++ {
+		response, err := writer.Send([]byte(fmt.Sprintf("SET user_new%d value\n", step)))
+		require.NoError(t, err)
+		require.Equal(t, "[ok]", string(response))
+
+		response, err = client.Send([]byte("SCAN " + cursor + " MATCH user_? COUNT 4\n"))
+		require.NoError(t, err)
+		values := parseValues(t, string(response))
+		cursor, keys = values[0], append(keys, values[1:]...)
+		if cursor == "0" {
+			break
+		}
+	}
+	require.ElementsMatch(t, []string{
+		"user_0", "user_1", "user_2", "user_3", "user_4", "user_5", "user_6", "user_7", "user_8", "user_9",
+	}, keys)
+
+	response, err = client.Send([]byte("KEYS user_2?\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"user_20", "user_21", "user_22", "user_23", "user_24", "user_25", "user_26", "user_27", "user_28", "user_29",
+	}, parseValues(t, string(response)))
+
+	require.NoError(t, writer.Close())
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestInitializerConditionalWrites(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine:  config.EngineConfig{Type: "in_memory_sharded"},
+		Network: config.NetworkConfig{Address: "localhost:20018"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	// Only one client creates the lock, and increments with CAS aren't lost.
+	clients, increments := 4, 10
+	var created atomic.Int32
+	var wg sync.WaitGroup
+	wg.Add(clients)
+	for i := 0; i < clients; i++ {
+		go func(clientID int) {
+			defer wg.Done()
+
+			client := connect(t, cfg.Network.Address)
+			defer client.Close()
+
+			response, err := client.Send([]byte(fmt.Sprintf("SET lock client%d NX\n", clientID)))
+			require.NoError(t, err)
+			if string(response) == "[ok]" {
+				created.Add(1)
+			} else {
+				require.Equal(t, "[nil]", string(response))
+			}
+
+			for j := 0; j < increments; {
+				response, err := client.Send([]byte("GET counter\n"))
+				require.NoError(t, err)
+				current, _ := strconv.Atoi(strings.TrimPrefix(string(response), "[ok] "))
+
+				query := fmt.Sprintf("CAS counter %d %d\n", current, current+1)
+				if current == 0 {
+					query = "SET counter 1 NX\n"
+				}
+				response, err = client.Send([]byte(query))
+				require.NoError(t, err)
+				if string(response) == "[ok]" {
+					j++
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), created.Load())
+
+	client := connect(t, cfg.Network.Address)
+	for _, exchange := range [][2]string{
+		{"GET counter\n", fmt.Sprintf("[ok] %d", clients*increments)},
+		{"SET missing value XX\n", "[nil]"},
+		{"GET missing\n", "[nil]"},
+	} {
+		response, err := client.Send([]byte(exchange[0]))
+		require.NoError(t, err)
+		require.Equal(t, exchange[1], string(response))
+	}
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestInitializerCounters(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine: config.EngineConfig{Type: "in_memory_sharded"},
+		WAL: &config.WALConfig{
+			FlushingBatchTimeout: time.Millisecond,
+			DataDirectory:        t.TempDir(),
+		},
+		Network: config.NetworkConfig{Address: "localhost:20019"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	clients, increments := 4, 25
+	var wg sync.WaitGroup
+	wg.Add(clients)
+	for i := 0; i < clients; i++ {
+		go func() {
+			defer wg.Done()
+
+			client := connect(t, cfg.Network.Address)
+			defer client.Close()
+
+			for j := 0; j < increments; j++ {
+				response, err := client.Send([]byte("INCRBY counter 2\n"))
+				require.NoError(t, err)
+				require.True(t, strings.HasPrefix(string(response), "[ok] "))
+			}
+		}()
+	}
+	wg.Wait()
+
+	client := connect(t, cfg.Network.Address)
+	for _, exchange := range [][2]string{
+		{"DECR counter\n", fmt.Sprintf("[ok] %d", clients*increments*2-1)},
+		{"SET text value\n", "[ok]"},
+		{"INCR text\n", "[error] value is not an integer"},
+		{"SET big 9223372036854775807\n", "[ok]"},
+		{"INCR big\n", "[error] increment or decrement would overflow"},
+	} {
+		response, err := client.Send([]byte(exchange[0]))
+		require.NoError(t, err)
+		require.Equal(t, exchange[1], string(response))
+	}
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	value, found, err := initializer.keyspaces[0].storage.Get(context.Background(), "counter")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, strconv.Itoa(clients*increments*2-1), value)
+}
+
+func TestInitializerMultiKeyCommands(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine: config.EngineConfig{Type: "in_memory_sharded"},
+		WAL: &config.WALConfig{
+			FlushingBatchTimeout: time.Millisecond,
+			DataDirectory:        t.TempDir(),
+		},
+		Network: config.NetworkConfig{Address: "localhost:20020"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	for _, exchange := range [][2]string{
+		{"MSET key1 value1 key2 value2 key3 value3\n", "[ok]"},
+		{"MDEL key2 key4\n", "[ok]"},
+		{"MGET key1 key2 key3\n", "[ok] 3\n1) value1\n2) [nil]\n3) value3"},
+		{"MSET key1\n", "[error] invalid arguments"},
+	} {
+		response, err := client.Send([]byte(exchange[0]))
+		require.NoError(t, err)
+		require.Equal(t, exchange[1], string(response))
+	}
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	for key, expValue := range map[string]string{"key1": "value1", "key3": "value3"} {
+		value, found, err := initializer.keyspaces[0].storage.Get(context.Background(), key)
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, expValue, value)
+	}
+	_, found, err := initializer.keyspaces[0].storage.Get(context.Background(), "key2")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestInitializerLists(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine: config.EngineConfig{Type: "in_memory_sharded"},
+		WAL: &config.WALConfig{
+			FlushingBatchTimeout: time.Millisecond,
+			DataDirectory:        t.TempDir(),
+		},
+		Network: config.NetworkConfig{Address: "localhost:20021"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	for _, exchange := range [][2]string{
+		{"LPUSH list a b c\n", "[ok] 3"},
+		{"RPUSH list d\n", "[ok] 4"},
+		{"LRANGE list 0 -1\n", "[ok] 4\n1) c\n2) b\n3) a\n4) d"},
+		{"RPOP list\n", "[ok] d"},
+		{"LPOP list\n", "[ok] c"},
+		{"LLEN list\n", "[ok] 2"},
+		{"EXPIRE list 100\n", "[ok]"},
+		{"GET list\n", "[error] WRONGTYPE operation against a key holding the wrong kind of value"},
+		{"SET string value\n", "[ok]"},
+		{"LPUSH string value\n", "[error] WRONGTYPE operation against a key holding the wrong kind of value"},
+		{"LPOP missing\n", "[nil]"},
+	} {
+		response, err := client.Send([]byte(exchange[0]))
+		require.NoError(t, err)
+		require.Equal(t, exchange[1], string(response))
+	}
+
+	// The client timeout is longer than the timeouts of blocking pops.
+	waiter, err := network.NewTCPClient(cfg.Network.Address, 3*time.Second)
+	require.NoError(t, err)
+	response, err := waiter.Send([]byte("BLPOP missing 1\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[nil]", string(response))
+
+	// A blocking pop parks the connection until another one pushes a value.
+	popped := make(chan string)
+	go func() {
+		response, err := waiter.Send([]byte("BLPOP queue 0\n"))
+		require.NoError(t, err)
+		popped <- string(response)
+	}()
+
+	pusher := connect(t, cfg.Network.Address)
+	time.Sleep(100 * time.Millisecond)
+	response, err = pusher.Send([]byte("RPUSH queue job\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[ok] 1", string(response))
+	require.Equal(t, "[ok] job", <-popped)
+
+	response, err = pusher.Send([]byte("LLEN queue\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[ok] 0", string(response))
+	require.NoError(t, pusher.Close())
+	require.NoError(t, waiter.Close())
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	values, err := initializer.keyspaces[0].storage.ListRange(context.Background(), "list", 0, -1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "a"}, values)
+	ttl, found, err := initializer.keyspaces[0].storage.TTL(context.Background(), "list")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Greater(t, ttl, 90*time.Second)
+}
+
+func TestInitializerHashes(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine: config.EngineConfig{Type: "in_memory_sharded"},
+		WAL: &config.WALConfig{
+			FlushingBatchTimeout: time.Millisecond,
+			DataDirectory:        t.TempDir(),
+		},
+		Network: config.NetworkConfig{Address: "localhost:20022"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	for _, exchange := range [][2]string{
+		{"HSET user name alice email alice_mail\n", "[ok] 2"},
+		{"HSET user name bob age 30\n", "[ok] 1"},
+		{"HGET user name\n", "[ok] bob"},
+		{"HGET user phone\n", "[nil]"},
+		{"HGETALL user\n", "[ok] 3\n1) age 30\n2) email alice_mail\n3) name bob"},
+		{"HKEYS user\n", "[ok] 3\n1) age\n2) email\n3) name"},
+		{"HDEL user email phone\n", "[ok] 1"},
+		{"HLEN user\n", "[ok] 2"},
+		{"EXPIRE user 100\n", "[ok]"},
+		{"GET user\n", "[error] WRONGTYPE operation against a key holding the wrong kind of value"},
+		{"SET string value\n", "[ok]"},
+		{"HSET string field value\n", "[error] WRONGTYPE operation against a key holding the wrong kind of value"},
+		{"HGETALL missing\n", "[ok] 0"},
+	} {
+		response, err := client.Send([]byte(exchange[0]))
+		require.NoError(t, err)
+		require.Equal(t, exchange[1], string(response))
+	}
+
+	// Fields set by concurrent connections don't overwrite each other.
+	const clients, fields = 4, 25
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		writer := connect(t, cfg.Network.Address)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < fields; j++ {
+				response, err := writer.Send([]byte(fmt.Sprintf("HSET counters field_%d_%d %d\n", i, j, j)))
+				require.NoError(t, err)
+				require.Equal(t, "[ok] 1", string(response))
+			}
+			require.NoError(t, writer.Close())
+		}(i)
+	}
+	wg.Wait()
+
+	response, err := client.Send([]byte("HLEN counters\n"))
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("[ok] %d", clients*fields), string(response))
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	values, err := initializer.keyspaces[0].storage.HashGetAll(context.Background(), "user")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"name": "bob", "age": "30"}, values)
+	ttl, found, err := initializer.keyspaces[0].storage.TTL(context.Background(), "user")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Greater(t, ttl, 90*time.Second)
+	length, err := initializer.keyspaces[0].storage.HashLen(context.Background(), "counters")
+	require.NoError(t, err)
+	require.Equal(t, clients*fields, length)
+}
+
+func TestInitializerSets(t *testing.T) {
+	t.Parallel()
+
+	// Sets are recovered from a snapshot, because the WAL is compacted.
+	dir := t.TempDir()
+	cfg := config.Config{
+		WAL: &config.WALConfig{
+			FlushingBatchTimeout: time.Millisecond,
+			MaxSegmentSize:       "1B",
+			DataDirectory:        filepath.Join(dir, "wal"),
+		},
+		Snapshot: &config.SnapshotConfig{
+			Interval:      10 * time.Millisecond,
+			DataDirectory: filepath.Join(dir, "snapshots"),
+		},
+		Network: config.NetworkConfig{Address: "localhost:20023"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	for _, exchange := range [][2]string{
+		{"SADD tags go db kv\n", "[ok] 3"},
+		{"SADD other db sql\n", "[ok] 2"},
+		{"SREM tags kv\n", "[ok] 1"},
+		{"SISMEMBER tags go\n", "[ok] 1"},
+		{"SISMEMBER tags kv\n", "[ok] 0"},
+		{"SMEMBERS tags\n", "[ok] 2\n1) db\n2) go"},
+		{"SINTER tags other\n", "[ok] 1\n1) db"},
+		{"SUNION tags other\n", "[ok] 3\n1) db\n2) go\n3) sql"},
+		{"ZADD board 10 alice 2.5 bob 30 carol\n", "[ok] 3"},
+		{"ZADD board 40 bob -1 dave\n", "[ok] 1"},
+		{"ZREM board carol\n", "[ok] 1"},
+		{"ZRANGE board 0 -1 WITHSCORES\n", "[ok] 3\n1) dave -1\n2) alice 10\n3) bob 40"},
+		{"ZRANGEBYSCORE board 0 +inf\n", "[ok] 2\n1) alice\n2) bob"},
+		{"ZRANK board bob\n", "[ok] 2"},
+		{"ZRANK board carol\n", "[nil]"},
+		{"SADD board member\n", "[error] WRONGTYPE operation against a key holding the wrong kind of value"},
+		{"ZADD tags 1 member\n", "[error] WRONGTYPE operation against a key holding the wrong kind of value"},
+	} {
+		response, err := client.Send([]byte(exchange[0]))
+		require.NoError(t, err)
+		require.Equal(t, exchange[1], string(response))
+	}
+	require.NoError(t, client.Close())
+
+	require.Eventually(t, func() bool {
+		return snapshotCoversWAL(cfg)
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	members, err := initializer.keyspaces[0].storage.SetMembers(context.Background(), "tags")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"db", "go"}, members)
+	scored, err := initializer.keyspaces[0].storage.SortedSetRange(context.Background(), "board", 0, -1)
+	require.NoError(t, err)
+	require.Equal(t, []storage.ScoredMember{
+		{Member: "dave", Score: -1},
+		{Member: "alice", Score: 10},
+		{Member: "bob", Score: 40},
+	}, scored)
+}
+
+func TestInitializerVersions(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{Network: config.NetworkConfig{Address: "localhost:20024"}}
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	response, err := client.Send([]byte("GETV counter\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[nil]", string(response))
+	response, err = client.Send([]byte("SETV counter 0 0\n"))
+	require.NoError(t, err)
+	created := strings.TrimPrefix(string(response), "[ok] ")
+	response, err = client.Send([]byte("GETV counter\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[ok] 0 "+created, string(response))
+	response, err = client.Send([]byte("SETV counter 0 0\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[error] version of the key has changed", string(response))
+
+	// Concurrent clients increment the counter optimistically and retry on
+	// conflicts, so no increment is lost.
+	const clients, increments = 4, 25
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		writer := connect(t, cfg.Network.Address)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; {
+				response, err := writer.Send([]byte("GETV counter\n"))
+				require.NoError(t, err)
+				var value, version uint64
+				_, err = fmt.Sscanf(string(response), "[ok] %d %d", &value, &version)
+				require.NoError(t, err)
+
+				response, err = writer.Send([]byte(fmt.Sprintf("SETV counter %d %d\n", value+1, version)))
+				require.NoError(t, err)
+				if !strings.HasPrefix(string(response), "[error]") {
+					j++
+				}
+			}
+			require.NoError(t, writer.Close())
+		}()
+	}
+	wg.Wait()
+
+	response, err = client.Send([]byte("GET counter\n"))
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("[ok] %d", clients*increments), string(response))
+	require.NoError(t, client.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestInitializerDatabases(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfg := config.Config{
+		Engine: config.EngineConfig{Databases: 3},
+		WAL: &config.WALConfig{
+			FlushingBatchTimeout: time.Millisecond,
+			DataDirectory:        filepath.Join(dir, "wal"),
+		},
+		Network: config.NetworkConfig{Address: "localhost:20025"},
+	}
+
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	client := connect(t, cfg.Network.Address)
+	other := connect(t, cfg.Network.Address)
+	for _, exchange := range [][2]string{
+		{"SET key value0\n", "[ok]"},
+		{"SELECT 1\n", "[ok]"},
+		{"GET key\n", "[nil]"},
+		{"SET key value1\n", "[ok]"},
+		{"SET other value1\n", "[ok]"},
+		{"SELECT 2\n", "[ok]"},
+		{"SET key value2\n", "[ok]"},
+		{"SELECT 3\n", "[error] database index is out of range, there are 3 databases"},
+		{"SELECT 1\n", "[ok]"},
+		{"KEYS *\n", "[ok] 2\n1) key\n2) other"},
+		{"FLUSHDB\n", "[ok]"},
+		{"KEYS *\n", "[ok] 0"},
+	} {
+		response, err := client.Send([]byte(exchange[0]))
+		require.NoError(t, err)
+		require.Equal(t, exchange[1], string(response), exchange[0])
+	}
+
+	// Another connection starts in the keyspace 0.
+	response, err := other.Send([]byte("GET key\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[ok] value0", string(response))
+	require.NoError(t, client.Close())
+	require.NoError(t, other.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+
+	// Every keyspace is recovered from its own WAL.
+	require.DirExists(t, filepath.Join(dir, "wal", "db2"))
+	initializer, err = NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	for idx, expValue := range []string{"value0", "", "value2"} {
+		value, found, err := initializer.keyspaces[idx].storage.Get(context.Background(), "key")
+		require.NoError(t, err)
+		require.Equal(t, expValue != "", found)
+		require.Equal(t, expValue, value)
+	}
+}
+
+func TestInitializerReplication(t *testing.T) {
+	t.Parallel()
+
+	primaryCfg := config.Config{
+		Engine:      config.EngineConfig{Databases: 2},
+		Replication: &config.ReplicationConfig{BacklogSize: 100},
+		Network:     config.NetworkConfig{Address: "localhost:20026"},
+	}
+	replicaCfg := config.Config{
+		Engine:      config.EngineConfig{Databases: 2},
+		Replication: &config.ReplicationConfig{MasterAddress: primaryCfg.Network.Address},
+		Network:     config.NetworkConfig{Address: "localhost:20027"},
+	}
+
+	primaryInitializer, err := NewInitializer(primaryCfg, io.Discard)
+	require.NoError(t, err)
+	primaryCtx, stopPrimary := context.WithCancel(context.Background())
+	primaryDone := make(chan error)
+	go func() {
+		primaryDone <- primaryInitializer.Start(primaryCtx)
+	}()
+
+	// The data written before the replica connects comes with the snapshot.
+	primary := connect(t, primaryCfg.Network.Address)
+	send := func(client *network.TCPClient, request string) string {
+		response, err := client.Send([]byte(request + "\n"))
+		require.NoError(t, err)
+		return string(response)
+	}
+	require.Equal(t, "[ok]", send(primary, "SET key value"))
+	require.Equal(t, "[ok] 2", send(primary, "HSET hash a 1 b 2"))
+	require.Equal(t, "[ok]", send(primary, "SELECT 1"))
+	require.Equal(t, "[ok]", send(primary, "SET key other"))
+
+	replicaInitializer, err := NewInitializer(replicaCfg, io.Discard)
+	require.NoError(t, err)
+	replicaCtx, stopReplica := context.WithCancel(context.Background())
+	replicaDone := make(chan error)
+	go func() {
+		replicaDone <- replicaInitializer.Start(replicaCtx)
+	}()
+
+	replica := connect(t, replicaCfg.Network.Address)
+	require.Eventually(t, func() bool {
+		return send(replica, "GET key") == "[ok] value"
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "[ok] 2", send(replica, "HLEN hash"))
+	require.Equal(t, "[ok]", send(replica, "SELECT 1"))
+	require.Equal(t, "[ok] other", send(replica, "GET key"))
+
+	// The following mutations are streamed.
+	require.Equal(t, "[ok] 3", send(primary, "RPUSH list a b c"))
+	require.Equal(t, "[ok]", send(primary, "MSET key changed new value"))
+	require.Eventually(t, func() bool {
+		return send(replica, "GET new") == "[ok] value"
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "[ok] changed", send(replica, "GET key"))
+	require.Equal(t, []string{"a", "b", "c"}, parseValues(t, send(replica, "LRANGE list 0 -1")))
+
+	require.Equal(t, "[error] READONLY you can't write against a read-only replica", send(replica, "SET key value"))
+	require.Equal(t, "[error] READONLY you can't write against a read-only replica", send(replica, "FLUSHDB"))
+
+	require.Equal(t, "[ok] db0_offset:2 db1_offset:3 role:primary", send(primary, "REPLINFO"))
+	require.Eventually(t, func() bool {
+		return strings.HasPrefix(send(replica, "REPLINFO"), "[ok] lag:0 last_contact_ms:")
+	}, 5*time.Second, 10*time.Millisecond)
+	info := send(replica, "REPLINFO")
+	require.Contains(t, info, " master_address:localhost:20026 role:replica state:connected")
+
+	require.NoError(t, primary.Close())
+	stopPrimary()
+	require.NoError(t, <-primaryDone)
+
+	// The replica keeps serving reads while it reconnects.
+	require.Eventually(t, func() bool {
+		return strings.HasSuffix(send(replica, "REPLINFO"), "state:connecting")
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "[ok] changed", send(replica, "GET key"))
+
+	require.NoError(t, replica.Close())
+	stopReplica()
+	require.NoError(t, <-replicaDone)
+}
+
+// parseValues parses a multi-value response.
+func TestInitializerCluster(t *testing.T) {
+	t.Parallel()
+
+	nodes := []config.ClusterNodeConfig{
+		{ID: "node1", Address: "localhost:20042"},
+		{ID: "node2", Address: "localhost:20043"},
+		{ID: "node3", Address: "localhost:20044"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, len(nodes))
+	defer func() {
+		cancel()
+		for range nodes {
+			require.NoError(t, <-done)
+		}
+	}()
+
+	clients := make([]*network.TCPClient, 0, len(nodes))
+	addresses := make(map[*network.TCPClient]string, len(nodes))
+	for idx, node := range nodes {
+		cfg := config.Config{
+			Cluster: &config.ClusterConfig{
+				NodeID:            node.ID,
+				Nodes:             nodes,
+				ElectionTimeout:   150 * time.Millisecond,
+				HeartbeatInterval: 30 * time.Millisecond,
+				DataDirectory:     t.TempDir(),
+			},
+			Network: config.NetworkConfig{Address: fmt.Sprintf("localhost:%d", 20039+idx)},
+		}
+		initializer, err := NewInitializer(cfg, io.Discard)
+		require.NoError(t, err)
+
+		go func() {
+			done <- initializer.Start(ctx)
+		}()
+
+		client := connect(t, cfg.Network.Address)
+		defer client.Close()
+		clients = append(clients, client)
+		addresses[client] = cfg.Network.Address
+	}
+	send := func(client *network.TCPClient, request string) string {
+		response, err := client.Send([]byte(request + "\n"))
+		require.NoError(t, err)
+		return string(response)
+	}
+
+	// Writes are accepted by every node once the cluster has a leader.
+	var leader, follower *network.TCPClient
+	require.Eventually(t, func() bool {
+		for _, client := range clients {
+			if strings.Contains(send(client, "REPLINFO"), "role:leader") {
+				leader = client
+			} else {
+				follower = client
+			}
+		}
+		return leader != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, "[ok]", send(follower, "SET key value"))
+	require.Equal(t, "[ok]", send(leader, "SET other value"))
+	require.Equal(t, "[ok]", send(follower, "DEL other"))
+	// Other writes are replicated as well.
+	require.Equal(t, "[ok] 1", send(follower, "INCR counter"))
+	require.Equal(t, "[ok] 2", send(follower, "INCR counter"))
+	require.Equal(t, "[ok] 2", send(follower, "HSET hash a 1 b 2"))
+	require.Equal(t, "[ok] 3", send(leader, "RPUSH list a b c"))
+
+	for _, client := range clients {
+		require.Eventually(t, func() bool {
+			return send(client, "GET key") == "[ok] value" && send(client, "LLEN list") == "[ok] 3"
+		}, 5*time.Second, 10*time.Millisecond)
+		require.Equal(t, "[nil]", send(client, "GET other"))
+		require.Equal(t, "[ok] 2", send(client, "GET counter"))
+		require.Equal(t, "[ok] 1", send(client, "HGET hash a"))
+	}
+
+	// Blocking pops of every node wake up when a push is applied.
+	popped := make(chan string, 2)
+	for _, client := range []*network.TCPClient{leader, follower} {
+		waiter, err := network.NewTCPClient(addresses[client], 10*time.Second)
+		require.NoError(t, err)
+		defer waiter.Close()
+
+		go func() {
+			response, err := waiter.Send([]byte("BLPOP queue 5\n"))
+			if err != nil {
+				response = []byte(err.Error())
+			}
+			popped <- string(response)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	require.Equal(t, "[ok] 2", send(follower, "RPUSH queue a b"))
+	require.ElementsMatch(t, []string{"[ok] a", "[ok] b"}, []string{<-popped, <-popped})
+	require.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestInitializerClusterConcurrentIncrements(t *testing.T) {
+	t.Parallel()
+
+	nodes := []config.ClusterNodeConfig{
+		{ID: "node1", Address: "localhost:20064"},
+		{ID: "node2", Address: "localhost:20065"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, len(nodes))
+	defer func() {
+		cancel()
+		for range nodes {
+			require.NoError(t, <-done)
+		}
+	}()
+
+	addresses := make([]string, 0, len(nodes))
+	for idx, node := range nodes {
+		cfg := config.Config{
+			Cluster: &config.ClusterConfig{
+				NodeID:            node.ID,
+				Nodes:             nodes,
+				ElectionTimeout:   150 * time.Millisecond,
+				HeartbeatInterval: 30 * time.Millisecond,
+				DataDirectory:     t.TempDir(),
+			},
+			Network: config.NetworkConfig{Address: fmt.Sprintf("localhost:%d", 20066+idx)},
+		}
+		initializer, err := NewInitializer(cfg, io.Discard)
+		require.NoError(t, err)
+
+		go func() {
+			done <- initializer.Start(ctx)
+		}()
+		addresses = append(addresses, cfg.Network.Address)
+	}
+	send := func(client *network.TCPClient, request string) string {
+		response, err := client.Send([]byte(request + "\n"))
+		require.NoError(t, err)
+		return string(response)
+	}
+
+	client := connect(t, addresses[0])
+	defer client.Close()
+	require.Eventually(t, func() bool {
+		return send(client, "SET counter 0") == "[ok]"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The increments of both nodes are planned on states that the other node
+	// changes at the same time, and none of them is lost.
+	const clients, increments = 4, 25
+	responses := make(chan string, len(addresses)*clients*increments)
+	var wg sync.WaitGroup
+	for _, address := range addresses {
+		for idx := 0; idx < clients; idx++ {
+			// The increments of a key wait for each other.
+			client, err := network.NewTCPClient(address, 10*time.Second)
+			require.NoError(t, err)
+			defer client.Close()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for idx := 0; idx < increments; idx++ {
+					response, err := client.Send([]byte("INCR counter\n"))
+					if err != nil {
+						response = []byte(err.Error())
+					}
+					responses <- string(response)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(responses)
+	for response := range responses {
+		require.True(t, strings.HasPrefix(response, "[ok] "), response)
+	}
+
+	expected := fmt.Sprintf("[ok] %d", len(addresses)*clients*increments)
+	for _, address := range addresses {
+		client := connect(t, address)
+		defer client.Close()
+		require.Eventually(t, func() bool {
+			return send(client, "GET counter") == expected
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestInitializerSharding(t *testing.T) {
+	t.Parallel()
+
+	nodes := []config.ShardingNodeConfig{
+		{Address: "localhost:20047", Slots: "0-8191"},
+		{Address: "localhost:20048", Slots: "8192-16383"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, len(nodes))
+	defer func() {
+		cancel()
+		for range nodes {
+			require.NoError(t, <-done)
+		}
+	}()
+
+	for _, node := range nodes {
+		cfg := config.Config{
+			Sharding: &config.ShardingConfig{Nodes: nodes},
+			Network:  config.NetworkConfig{Address: node.Address},
+		}
+		initializer, err := NewInitializer(cfg, io.Discard)
+		require.NoError(t, err)
+
+		go func() {
+			done <- initializer.Start(ctx)
+		}()
+	}
+
+	first := connect(t, nodes[0].Address)
+	defer first.Close()
+	second := connect(t, nodes[1].Address)
+	defer second.Close()
+	send := func(client *network.TCPClient, request string) string {
+		response, err := client.Send([]byte(request + "\n"))
+		require.NoError(t, err)
+		return string(response)
+	}
+
+	// "a" is in the slot 15495 and "b" is in the slot 3300.
+	require.Equal(t, "[moved] 15495 localhost:20048", send(first, "SET a 1"))
+	require.Equal(t, "[ok]", send(second, "SET a 1"))
+	require.Equal(t, "[moved] 3300 localhost:20047", send(second, "GET b"))
+	require.Equal(t, "[error] keys of the query belong to different nodes", send(second, "MGET a b"))
+	require.Equal(t, []string{"0-8191 localhost:20047", "8192-16383 localhost:20048"},
+		parseValues(t, send(second, "SLOTS")))
+
+	// A routing client sends every key to its node.
+	client, err := network.NewTCPClient(nodes[0].Address, time.Second, network.WithSlotRouting(network.SlotRouting{
+		Slot:       database.QuerySlot,
+		SlotsQuery: database.SlotsCommand,
+		ParseSlots: database.ParseSlots,
+	}))
+	require.NoError(t, err)
+	defer client.Close()
+	for idx := 0; idx < 100; idx++ {
+		require.Equal(t, "[ok]", send(client, fmt.Sprintf("SET key%d value%d", idx, idx)))
+	}
+	for idx := 0; idx < 100; idx++ {
+		require.Equal(t, fmt.Sprintf("[ok] value%d", idx), send(client, fmt.Sprintf("GET key%d", idx)))
+	}
+	require.Equal(t, "[ok] 1", send(client, "GET a"))
+	_, err = client.Send([]byte("BEGIN\n"))
+	require.ErrorIs(t, err, database.ErrSessionRouting)
+	_, err = client.Send([]byte("SELECT 1\n"))
+	require.ErrorIs(t, err, database.ErrSessionRouting)
+
+	firstKeys, secondKeys := parseValues(t, send(first, "KEYS key*")), parseValues(t, send(second, "KEYS key*"))
+	require.Len(t, append(firstKeys, secondKeys...), 100)
+	require.NotEmpty(t, firstKeys)
+	require.NotEmpty(t, secondKeys)
+}
+
+func TestInitializerPubSub(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine:  config.EngineConfig{Databases: 2},
+		Network: config.NetworkConfig{Address: "localhost:20055"},
+	}
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	subscriber := connect(t, cfg.Network.Address)
+	publisher := connect(t, cfg.Network.Address)
+	send := func(client *network.TCPClient, request string) string {
+		response, err := client.Send([]byte(request + "\n"))
+		require.NoError(t, err)
+		return string(response)
+	}
+	receive := func() string {
+		message, err := subscriber.Receive()
+		require.NoError(t, err)
+		return string(message)
+	}
+
+	require.Equal(t, "[ok] 2", send(subscriber, "SUBSCRIBE news sport"))
+	require.Equal(t, "[ok] 3", send(subscriber, "PSUBSCRIBE user.*"))
+	require.Equal(t,
+		"[error] only subscription commands are allowed in push mode",
+		send(subscriber, "GET key"),
+	)
+
+	// Channels don't depend on the selected database.
+	require.Equal(t, "[ok]", send(publisher, "SELECT 1"))
+	require.Equal(t, "[ok] 1", send(publisher, "PUBLISH news hello"))
+	require.Equal(t, "[ok] 1", send(publisher, "PUBLISH user.42 login"))
+	require.Equal(t, "[ok] 0", send(publisher, "PUBLISH weather rain"))
+	require.Equal(t, "[message] news hello", receive())
+	require.Equal(t, "[pmessage] user.* user.42 login", receive())
+
+	// Messages that come with responses are kept for Receive.
+	require.Equal(t, "[ok] 1", send(publisher, "PUBLISH sport goal"))
+	require.Equal(t, "[ok] 2", send(subscriber, "UNSUBSCRIBE news"))
+	require.Equal(t, "[message] sport goal", receive())
+
+	require.Equal(t, "[ok] 1", send(subscriber, "UNSUBSCRIBE"))
+	require.Equal(t, "[ok] 0", send(subscriber, "PUNSUBSCRIBE user.*"))
+	require.Equal(t, "[ok] 0", send(publisher, "PUBLISH sport goal"))
+	require.Equal(t, "[nil]", send(subscriber, "GET key"))
+
+	require.NoError(t, subscriber.Close())
+	require.NoError(t, publisher.Close())
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestInitializerKeyspaceEvents(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Engine:  config.EngineConfig{Databases: 2, SweepInterval: 10 * time.Millisecond},
+		PubSub:  config.PubSubConfig{KeyspaceEvents: true},
+		Network: config.NetworkConfig{Address: "localhost:20056"},
+	}
+	initializer, err := NewInitializer(cfg, io.Discard)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- initializer.Start(ctx)
+	}()
+
+	watcher := connect(t, cfg.Network.Address)
+	writer := connect(t, cfg.Network.Address)
+	send := func(client *network.TCPClient, request string) string {
+		response, err := client.Send([]byte(request + "\n"))
+		require.NoError(t, err)
+		return string(response)
+	}
+	receive := func() string {
+		message, err := watcher.Receive()
+		require.NoError(t, err)
+		return string(message)
+	}
+
+	require.Equal(t, "[ok] 1", send(watcher, "WATCH user."))
+
+	// Only the changes of the watched prefix in the selected database come.
+	require.Equal(t, "[ok]", send(writer, "SET order.1 book"))
+	require.Equal(t, "[ok]", send(writer, "SET user.1 alice"))
+	require.Equal(t, "[ok]", send(writer, "DEL user.1"))
+	require.Equal(t, "[ok]", send(writer, "SELECT 1"))
+	require.Equal(t, "[ok]", send(writer, "SET user.2 bob"))
+	require.Equal(t, "[ok]", send(writer, "SELECT 0"))
+	require.Equal(t, "[ok]", send(writer, "SET user.3 carol EX 1"))
+	require.Equal(t, "[event] set user.1 alice", receive())
+	require.Equal(t, "[event] del user.1", receive())
+	require.Equal(t, "[event] set user.3 carol", receive())
+	require.Equal(t, "[event] expired user.3", receive())
+
+	require.Equal(t, "[ok]", send(writer, "FLUSHDB"))
+	require.Equal(t, "[event] flush", receive())
+
+	require.Equal(t, "[ok] 1", send(watcher, "UNSUBSCRIBE user."))
+	require.Equal(t, "[ok] 0", send(watcher, "UNWATCH user."))
+	require.Equal(t, "[nil]", send(watcher, "GET user.3"))
+
+	require.NoError(t, watcher.Close())
+	require.NoError(t, writer.Close())
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func parseValues(t *testing.T, response string) []string {
+	t.Helper()
+
+	lines := strings.Split(response, "\n")
+	require.Equal(t, fmt.Sprintf("[ok] %d", len(lines)-1), lines[0])
+
+	values := make([]string, 0, len(lines)-1)
+	for i, line := range lines[1:] {
+		prefix := fmt.Sprintf("%d) ", i+1)
+		require.True(t, strings.HasPrefix(line, prefix))
+		values = append(values, strings.TrimPrefix(line, prefix))
+	}
+	return values
+}
+
+// snapshotCoversWAL reports whether the newest snapshot contains the last
+// log of the WAL, which has a segment per log in the tests.
+func snapshotCoversWAL(cfg config.Config) bool {
+	snapshots, err := os.ReadDir(cfg.Snapshot.DataDirectory)
+	if err != nil || len(snapshots) == 0 {
+		return false
+	}
+
+	segments, err := os.ReadDir(cfg.WAL.DataDirectory)
+	if err != nil || len(segments) == 0 {
+		return false
+	}
+
+	lsn := func(name string) string {
+		return strings.TrimFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+	}
+	return lsn(snapshots[len(snapshots)-1].Name()) == lsn(segments[len(segments)-1].Name())
+}
+
+func connect(t *testing.T, address string) *network.TCPClient {
+	t.Helper()
+
+	var client *network.TCPClient
+	require.Eventually(t, func() bool {
+		var err error
+		client, err = network.NewTCPClient(address, time.Second)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	return client
 }
@@ -0,0 +1,32 @@
+package initialization
+
+import (
+	"kv_db/config"
+	"kv_db/internal/database/storage"
+	"kv_db/internal/pubsub"
+)
+
+func CreateBroker(cfg config.PubSubConfig) (*pubsub.Broker, error) {
+	var options []pubsub.BrokerOption
+	if cfg.BufferSize != 0 {
+		options = append(options, pubsub.WithBufferSize(cfg.BufferSize))
+	}
+
+	return pubsub.NewBroker(options...)
+}
+
+// keyspaceEvents publishes the changes of the keyspace with the index to the
+// sessions that watch them.
+type keyspaceEvents struct {
+	broker *pubsub.Broker
+	index  int
+}
+
+func (e keyspaceEvents) Notify(event storage.Event) {
+	e.broker.PublishEvent(e.index, string(event.Op), event.Key, event.Value)
+}
+
+// removed publishes the keys that an in-memory engine deletes by itself.
+func (e keyspaceEvents) removed(key string, evicted bool) {
+	e.Notify(storage.RemovalEvent(key, evicted))
+}
@@ -0,0 +1,61 @@
+package initialization
+
+import (
+	"errors"
+	"log/slog"
+
+	"kv_db/config"
+	"kv_db/internal/database/storage"
+	"kv_db/internal/replication"
+)
+
+const defaultReplicationBacklogSize = 10000
+
+// CreateReplicationOption makes a storage a read-only replica if the master
+// address is set and a primary with a backlog otherwise.
+func CreateReplicationOption(cfg config.ReplicationConfig) (storage.StorageOption, error) {
+	if cfg.MasterAddress != "" {
+		return storage.WithReadOnly(), nil
+	}
+
+	backlogSize := defaultReplicationBacklogSize
+	if cfg.BacklogSize != 0 {
+		backlogSize = cfg.BacklogSize
+	}
+	if backlogSize < 0 {
+		return nil, errors.New("replication backlog size is incorrect")
+	}
+
+	return storage.WithReplicationBacklog(backlogSize), nil
+}
+
+// createReplication creates the replica or the primary of the keyspaces.
+func (i *Initializer) createReplication(cfg config.ReplicationConfig) error {
+	if cfg.MasterAddress == "" {
+		storages := make([]replication.PrimaryStorage, 0, len(i.keyspaces))
+		for _, space := range i.keyspaces {
+			storages = append(storages, space.storage)
+		}
+
+		primary, err := replication.NewPrimary(storages)
+		if err != nil {
+			return err
+		}
+		i.replication = primary
+		return nil
+	}
+
+	storages := make([]replication.Storage, 0, len(i.keyspaces))
+	for _, space := range i.keyspaces {
+		storages = append(storages, space.storage)
+	}
+
+	replica, err := replication.NewReplica(
+		cfg.MasterAddress, storages, i.logger.With(slog.String("layer", "replication")),
+	)
+	if err != nil {
+		return err
+	}
+	i.replica, i.replication = replica, replica
+	return nil
+}
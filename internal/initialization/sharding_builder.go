@@ -0,0 +1,29 @@
+package initialization
+
+import (
+	"kv_db/config"
+	"kv_db/internal/sharding"
+)
+
+// CreateSharding creates the map of the slots of the nodes. The node is the
+// one with the sharding address, which is the network address by default.
+func CreateSharding(cfg config.ShardingConfig, networkCfg config.NetworkConfig) (*sharding.Map, error) {
+	address := cfg.Address
+	if address == "" {
+		address = networkCfg.Address
+	}
+	if address == "" {
+		address = defaultServerAddress
+	}
+
+	ranges := make([]sharding.Range, 0, len(cfg.Nodes))
+	for _, node := range cfg.Nodes {
+		slotRange, err := sharding.ParseRange(node.Slots, node.Address)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, slotRange)
+	}
+
+	return sharding.NewMap(address, ranges)
+}
@@ -0,0 +1,37 @@
+package initialization
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int
+}{
+	{suffix: "GB", multiplier: 1 << 30},
+	{suffix: "MB", multiplier: 1 << 20},
+	{suffix: "KB", multiplier: 1 << 10},
+	{suffix: "B", multiplier: 1},
+}
+
+func parseSize(text string) (int, error) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+
+	multiplier := 1
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSuffix(text, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.Atoi(text)
+	if err != nil || size <= 0 {
+		return 0, errors.New("size is incorrect")
+	}
+
+	return size * multiplier, nil
+}
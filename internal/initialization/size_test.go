@@ -0,0 +1,42 @@
+package initialization
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	t.Parallel()
+
+	testcases := map[string]struct {
+		text    string
+		expSize int
+		expErr  bool
+	}{
+		"bytes without unit": {text: "100", expSize: 100},
+		"bytes":              {text: "100B", expSize: 100},
+		"kilobytes":          {text: "2KB", expSize: 2 << 10},
+		"megabytes":          {text: "10MB", expSize: 10 << 20},
+		"gigabytes":          {text: "1GB", expSize: 1 << 30},
+		"lower case unit":    {text: "4mb", expSize: 4 << 20},
+		"empty":              {text: "", expErr: true},
+		"negative":           {text: "-1MB", expErr: true},
+		"unknown unit":       {text: "1TB", expErr: true},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			size, err := parseSize(tc.text)
+			if tc.expErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expSize, size)
+		})
+	}
+}
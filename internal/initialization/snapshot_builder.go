@@ -0,0 +1,34 @@
+package initialization
+
+import (
+	"log/slog"
+	"time"
+
+	"kv_db/config"
+	"kv_db/internal/database/storage/snapshot"
+)
+
+const (
+	defaultSnapshotInterval      = time.Minute * 5
+	defaultSnapshotDataDirectory = "data/snapshots"
+)
+
+func CreateSnapshotManager(cfg config.SnapshotConfig, logger *slog.Logger) (*snapshot.Manager, time.Duration, error) {
+	interval := defaultSnapshotInterval
+	dataDirectory := defaultSnapshotDataDirectory
+
+	if cfg.Interval != 0 {
+		interval = cfg.Interval
+	}
+
+	if cfg.DataDirectory != "" {
+		dataDirectory = cfg.DataDirectory
+	}
+
+	manager, err := snapshot.NewManager(dataDirectory, logger)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return manager, interval, nil
+}
@@ -0,0 +1,37 @@
+package initialization
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/config"
+	"kv_db/pkg/dlog"
+)
+
+func TestCreateSnapshotManagerWithEmptyConfigFields(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.SnapshotConfig{DataDirectory: filepath.Join(t.TempDir(), "snapshots")}
+
+	manager, interval, err := CreateSnapshotManager(cfg, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.NotNil(t, manager)
+	require.Equal(t, defaultSnapshotInterval, interval)
+}
+
+func TestCreateSnapshotManager(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.SnapshotConfig{
+		Interval:      time.Second,
+		DataDirectory: t.TempDir(),
+	}
+
+	manager, interval, err := CreateSnapshotManager(cfg, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.NotNil(t, manager)
+	require.Equal(t, time.Second, interval)
+}
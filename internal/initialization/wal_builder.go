@@ -0,0 +1,56 @@
+package initialization
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"kv_db/config"
+	"kv_db/internal/database/storage/wal"
+)
+
+const (
+	defaultFlushingBatchSize    = 100
+	defaultFlushingBatchTimeout = time.Millisecond * 10
+	defaultMaxSegmentSize       = 10 << 20
+	defaultWALDataDirectory     = "data/wal"
+)
+
+func CreateWAL(cfg config.WALConfig, logger *slog.Logger) (*wal.WAL, error) {
+	flushingBatchSize := defaultFlushingBatchSize
+	flushingBatchTimeout := defaultFlushingBatchTimeout
+	maxSegmentSize := defaultMaxSegmentSize
+	dataDirectory := defaultWALDataDirectory
+	fsync := true
+
+	if cfg.FlushingBatchSize != 0 {
+		flushingBatchSize = cfg.FlushingBatchSize
+	}
+
+	if cfg.FlushingBatchTimeout != 0 {
+		flushingBatchTimeout = cfg.FlushingBatchTimeout
+	}
+
+	if cfg.MaxSegmentSize != "" {
+		size, err := parseSize(cfg.MaxSegmentSize)
+		if err != nil {
+			return nil, fmt.Errorf("max segment size is incorrect: %w", err)
+		}
+		maxSegmentSize = size
+	}
+
+	if cfg.DataDirectory != "" {
+		dataDirectory = cfg.DataDirectory
+	}
+
+	if cfg.Fsync != nil {
+		fsync = *cfg.Fsync
+	}
+
+	manager, err := wal.NewLogsManager(dataDirectory, maxSegmentSize, fsync, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return wal.NewWAL(manager, flushingBatchSize, flushingBatchTimeout, logger)
+}
@@ -0,0 +1,52 @@
+package initialization
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/config"
+	"kv_db/pkg/dlog"
+)
+
+func TestCreateWALWithEmptyConfigFields(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.WALConfig{DataDirectory: filepath.Join(t.TempDir(), "wal")}
+
+	wal, err := CreateWAL(cfg, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.NotNil(t, wal)
+}
+
+func TestCreateWALWithIncorrectSegmentSize(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.WALConfig{
+		MaxSegmentSize: "incorrect",
+		DataDirectory:  t.TempDir(),
+	}
+
+	wal, err := CreateWAL(cfg, dlog.NewNonSlog())
+	require.Error(t, err)
+	require.Nil(t, wal)
+}
+
+func TestCreateWAL(t *testing.T) {
+	t.Parallel()
+
+	fsync := false
+	cfg := config.WALConfig{
+		FlushingBatchSize:    10,
+		FlushingBatchTimeout: time.Millisecond,
+		MaxSegmentSize:       "1KB",
+		DataDirectory:        t.TempDir(),
+		Fsync:                &fsync,
+	}
+
+	wal, err := CreateWAL(cfg, dlog.NewNonSlog())
+	require.NoError(t, err)
+	require.NotNil(t, wal)
+}
@@ -2,55 +2,270 @@ package network
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
+// ErrNotDelivered is returned by Send when the request isn't written, or the
+// server closes the connection without a byte of the response, which is what
+// a server does with an idle connection before it reads the request.
+var ErrNotDelivered = errors.New("request is not delivered")
+
+// maxRedirects is the number of MOVED responses a query follows, which is
+// more than one only while the slots move between nodes.
+const maxRedirects = 5
+
+type TCPClientOption func(*TCPClient)
+
+// SlotRouting tells a client the slots of queries and the owners of slots, so
+// the network layer doesn't depend on the commands of the database.
+type SlotRouting struct {
+	// Slot returns the slot of the first key of a query that is split into
+	// fields, and false for a query without keys. A query that can't be
+	// routed is rejected by an error.
+	Slot func(fields []string) (int, bool, error)
+	// SlotsQuery asks a node for the owners of slots, which ParseSlots
+	// returns by the response.
+	SlotsQuery string
+	ParseSlots func(response []byte) map[int]string
+}
+
+// WithSlotRouting makes the client send a query to the node that owns the
+// slot of its first key. The client learns the owners of slots from MOVED
+// responses and from the nodes that it is redirected to. Queries without
+// keys are sent to the node of the client address.
+func WithSlotRouting(routing SlotRouting) TCPClientOption {
+	return func(client *TCPClient) {
+		client.routing = &routing
+		client.owners = make(map[int]string)
+	}
+}
+
+// WithMaxResponseSize sets the longest line of a response.
+func WithMaxResponseSize(size int) TCPClientOption {
+	return func(client *TCPClient) {
+		client.maxResponseSize = size
+	}
+}
+
 type TCPClient struct {
-	connection  net.Conn
-	idleTimeout time.Duration
+	address         string
+	connection      net.Conn
+	idleTimeout     time.Duration
+	maxResponseSize int
+
+	// owners are the addresses of the nodes of known slots with slot
+	// routing, and connections are the connections to the nodes by their
+	// addresses.
+	routing     *SlotRouting
+	owners      map[int]string
+	connections map[string]net.Conn
+
+	// scanners read the frames of the connections, and pending are the
+	// messages of push mode that are read while waiting for responses.
+	scanners map[net.Conn]*bufio.Scanner
+	pending  [][]byte
 }
 
-func NewTCPClient(address string, idleTimeout time.Duration) (*TCPClient, error) {
+func NewTCPClient(address string, idleTimeout time.Duration, options ...TCPClientOption) (*TCPClient, error) {
 	connection, err := net.Dial("tcp", address)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial: %w", err)
 	}
 
-	return &TCPClient{
-		connection:  connection,
-		idleTimeout: idleTimeout,
-	}, nil
+	client := &TCPClient{
+		address:         address,
+		connection:      connection,
+		idleTimeout:     idleTimeout,
+		maxResponseSize: defaultMaxLineSize,
+		connections:     map[string]net.Conn{address: connection},
+		scanners:        make(map[net.Conn]*bufio.Scanner),
+	}
+	for _, option := range options {
+		option(client)
+	}
+	return client, nil
 }
 
+// Send returns the lines of the response before the end delimiter joined by
+// line breaks. Messages of push mode that come before the response are kept
+// for Receive.
 func (c *TCPClient) Send(request []byte) ([]byte, error) {
-	if err := c.connection.SetDeadline(time.Now().Add(c.idleTimeout)); err != nil {
+	if c.routing == nil {
+		return c.send(c.connection, request)
+	}
+
+	address, err := c.route(request)
+	if err != nil {
 		return nil, err
 	}
+	connection, err := c.connect(address)
+	if err != nil {
+		return nil, err
+	}
+
+	for redirects := 0; ; redirects++ {
+		response, err := c.send(connection, request)
+		if err != nil {
+			return nil, err
+		}
+
+		slot, address, moved := parseMoved(response)
+		if !moved || redirects == maxRedirects {
+			return response, nil
+		}
+
+		c.owners[slot] = address
+		if connection, err = c.connect(address); err != nil {
+			return nil, err
+		}
+		if err := c.loadSlots(connection); err != nil {
+			return nil, err
+		}
+	}
+}
 
-	if _, err := c.connection.Write(request); err != nil {
+func (c *TCPClient) send(connection net.Conn, request []byte) ([]byte, error) {
+	if err := connection.SetDeadline(time.Now().Add(c.idleTimeout)); err != nil {
 		return nil, err
 	}
 
-	scanner := bufio.NewScanner(c.connection)
-	res := make([]byte, 0)
+	if _, err := connection.Write(request); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotDelivered, err)
+	}
+
+	for frames := 0; ; frames++ {
+		response, err := c.read(connection)
+		if err != nil && frames == 0 && (errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)) {
+			return nil, fmt.Errorf("%w: %w", ErrNotDelivered, err)
+		}
+		if err != nil || !isMessage(response) {
+			return response, err
+		}
+		c.pending = append(c.pending, response)
+	}
+}
 
-	for scanner.Scan() {
+// Receive returns the next message of the connection in push mode, which is
+// "[message] channel message", "[pmessage] pattern channel message" or
+// "[event] op key value". It waits for a message without a timeout, so it is
+// stopped by Close.
+func (c *TCPClient) Receive() ([]byte, error) {
+	if len(c.pending) != 0 {
+		message := c.pending[0]
+		c.pending = c.pending[1:]
+		return message, nil
+	}
+
+	if err := c.connection.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return c.read(c.connection)
+}
+
+// read returns the lines of a frame before the end delimiter joined by line
+// breaks. It returns io.EOF if the connection is closed before the frame and
+// io.ErrUnexpectedEOF if it is closed in the middle of it.
+func (c *TCPClient) read(connection net.Conn) ([]byte, error) {
+	scanner, ok := c.scanners[connection]
+	if !ok {
+		scanner = bufio.NewScanner(connection)
+		scanner.Buffer(nil, c.maxResponseSize)
+		c.scanners[connection] = scanner
+	}
+
+	res := make([]byte, 0)
+	lines := 0
+	for ; scanner.Scan(); lines++ {
 		line := scanner.Bytes()
 		if strings.TrimSpace(string(line)) == EndDelim {
-			break
+			return res, nil
+		}
+		if lines > 0 {
+			res = append(res, '\n')
 		}
 		res = append(res, line...)
 	}
 	if scanner.Err() != nil {
 		return nil, scanner.Err()
 	}
+	if lines == 0 {
+		return nil, io.EOF
+	}
+	return nil, io.ErrUnexpectedEOF
+}
 
-	return res, nil
+func isMessage(frame []byte) bool {
+	return bytes.HasPrefix(frame, []byte("[message] ")) || bytes.HasPrefix(frame, []byte("[pmessage] ")) ||
+		bytes.HasPrefix(frame, []byte("[event] "))
+}
+
+// route returns the address of the node that owns the slot of the first key
+// of the request if the owner is known.
+func (c *TCPClient) route(request []byte) (string, error) {
+	slot, ok, err := c.routing.Slot(strings.Fields(string(request)))
+	if err != nil || !ok {
+		return c.address, err
+	}
+
+	if owner, ok := c.owners[slot]; ok {
+		return owner, nil
+	}
+	return c.address, nil
+}
+
+func (c *TCPClient) connect(address string) (net.Conn, error) {
+	if connection, ok := c.connections[address]; ok {
+		return connection, nil
+	}
+
+	connection, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+	c.connections[address] = connection
+	return connection, nil
+}
+
+// loadSlots learns the owners of slots from the node. The owners of other
+// slots stay as they are.
+func (c *TCPClient) loadSlots(connection net.Conn) error {
+	response, err := c.send(connection, []byte(c.routing.SlotsQuery+"\n"))
+	if err != nil {
+		return err
+	}
+
+	for slot, address := range c.routing.ParseSlots(response) {
+		c.owners[slot] = address
+	}
+	return nil
+}
+
+// parseMoved parses a "[moved] slot address" response.
+func parseMoved(response []byte) (int, string, bool) {
+	fields := strings.Fields(string(response))
+	if len(fields) != 3 || fields[0] != "[moved]" {
+		return 0, "", false
+	}
+
+	slot, err := strconv.Atoi(fields[1])
+	if err != nil || slot < 0 {
+		return 0, "", false
+	}
+	return slot, fields[2], true
 }
 
 func (c *TCPClient) Close() error {
-	return c.connection.Close()
+	var errs []error
+	for _, connection := range c.connections {
+		errs = append(errs, connection.Close())
+	}
+	return errors.Join(errs...)
 }
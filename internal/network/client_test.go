@@ -1,19 +1,26 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"kv_db/pkg/dlog"
 )
 
 func TestTCPClient(t *testing.T) {
 	t.Parallel()
 
 	request := "hello server"
-	response := "hello client"
+	// The last line is longer than the default limit.
+	response := "hello client\nsecond line\n" + strings.Repeat("x", 100_000)
 
 	listener, err := net.Listen("tcp", ":10001")
 	require.NoError(t, err)
@@ -42,7 +49,7 @@ func TestTCPClient(t *testing.T) {
 
 	time.Sleep(100 * time.Millisecond)
 
-	client, err := NewTCPClient("127.0.0.1:10001", time.Minute)
+	client, err := NewTCPClient("127.0.0.1:10001", time.Minute, WithMaxResponseSize(200_000))
 	require.NoError(t, err)
 
 	buffer, err := client.Send([]byte(request))
@@ -52,3 +59,175 @@ func TestTCPClient(t *testing.T) {
 	err = client.Close()
 	require.NoError(t, err)
 }
+
+func TestTCPClient_NotDelivered(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		address      string
+		response     string
+		notDelivered bool
+	}{
+		"closed before response": {
+			address:      "localhost:10002",
+			notDelivered: true,
+		},
+		"closed in the middle of response": {
+			address:  "localhost:10003",
+			response: "[ok] partial",
+		},
+		"response timeout": {
+			address: "localhost:10004",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			listener, err := net.Listen("tcp", test.address)
+			require.NoError(t, err)
+			defer func() { require.NoError(t, listener.Close()) }()
+
+			go func() {
+				connection, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer func() { _ = connection.Close() }()
+
+				buffer := make([]byte, 2048)
+				if _, err := connection.Read(buffer); err != nil {
+					return
+				}
+				if test.response == "" && !test.notDelivered {
+					time.Sleep(200 * time.Millisecond)
+				}
+				_, _ = connection.Write([]byte(test.response))
+			}()
+
+			client, err := NewTCPClient(test.address, 100*time.Millisecond)
+			require.NoError(t, err)
+			defer func() { require.NoError(t, client.Close()) }()
+
+			_, err = client.Send([]byte("GET key\n"))
+			require.Error(t, err)
+			require.Equal(t, test.notDelivered, errors.Is(err, ErrNotDelivered))
+		})
+	}
+}
+
+func TestTCPClient_SlotRouting(t *testing.T) {
+	t.Parallel()
+
+	// The slot of a key is its first byte. The first node redirects all keys
+	// to the second one, which owns all slots except the slot of "loop".
+	slot := func(key string) int {
+		return int(key[0])
+	}
+	routing := SlotRouting{
+		Slot: func(fields []string) (int, bool, error) {
+			switch {
+			case fields[0] == "BEGIN":
+				return 0, false, errors.New("transactions aren't supported")
+			case len(fields) < 2 || fields[0] == "INFO":
+				return 0, false, nil
+			}
+			return slot(fields[1]), true, nil
+		},
+		SlotsQuery: "SLOTS",
+		ParseSlots: func(response []byte) map[int]string {
+			address, ok := strings.CutPrefix(string(response), "[ok] ")
+			if !ok {
+				return nil
+			}
+			owners := make(map[int]string)
+			for slot := 0; slot < 256; slot++ {
+				owners[slot] = address
+			}
+			return owners
+		},
+	}
+	loopSlot := slot("loop")
+	var mutex sync.Mutex
+	var requests []string
+	handlers := map[string]TCPHandlerFunc{
+		"localhost:20045": func(_ context.Context, request []byte) []byte {
+			mutex.Lock()
+			defer mutex.Unlock()
+			requests = append(requests, "first "+string(request))
+
+			switch string(request) {
+			case "INFO":
+				return []byte("[ok] first")
+			case "SLOTS":
+				return []byte("[error] sharding is disabled")
+			}
+			return []byte(fmt.Sprintf("[moved] %d localhost:20046", slot(strings.Fields(string(request))[1])))
+		},
+		"localhost:20046": func(_ context.Context, request []byte) []byte {
+			mutex.Lock()
+			defer mutex.Unlock()
+			requests = append(requests, "second "+string(request))
+
+			switch string(request) {
+			case "SLOTS":
+				return []byte("[ok] localhost:20046")
+			case "GET loop":
+				return []byte(fmt.Sprintf("[moved] %d localhost:20045", loopSlot))
+			}
+			return []byte("[ok] second")
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	for address, handler := range handlers {
+		server, err := NewTCPServer(address, 10, time.Minute, dlog.NewNonSlog())
+		require.NoError(t, err)
+
+		handler := handler
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = server.HandleQueries(ctx, handler)
+		}()
+	}
+
+	var client *TCPClient
+	require.Eventually(t, func() bool {
+		var err error
+		client, err = NewTCPClient("localhost:20045", time.Second, WithSlotRouting(routing))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	defer client.Close()
+
+	send := func(request string) string {
+		response, err := client.Send([]byte(request + "\n"))
+		require.NoError(t, err)
+		return string(response)
+	}
+	require.Equal(t, "[ok] second", send("GET key"))
+	require.Equal(t, "[ok] second", send("MGET other key"))
+	require.Equal(t, "[ok] first", send("INFO"))
+	_, err := client.Send([]byte("BEGIN\n"))
+	require.Error(t, err)
+
+	mutex.Lock()
+	require.Equal(t, []string{
+		"first GET key", "second SLOTS", "second GET key", "second MGET other key", "first INFO",
+	}, requests)
+	requests = nil
+	mutex.Unlock()
+
+	// A query stops following redirects that go in circles.
+	require.Equal(t, fmt.Sprintf("[moved] %d localhost:20046", loopSlot), send("GET loop"))
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, requests, 2*maxRedirects+1)
+}
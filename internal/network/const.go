@@ -1,3 +1,10 @@
 package network
 
+import "bufio"
+
 const EndDelim = "end"
+
+// defaultMaxLineSize is the longest line of a query or a response, unless a
+// client or a server is created with a longer limit for lines that keep whole
+// collections or batches of logs.
+const defaultMaxLineSize = bufio.MaxScanTokenSize
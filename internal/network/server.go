@@ -2,6 +2,7 @@ package network
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -16,15 +17,53 @@ import (
 
 type TCPHandlerFunc = func(context.Context, []byte) []byte
 
+// TCPSession handles queries of a single connection, so it can keep the
+// state of the connection between them. Close is called after the connection
+// is closed.
+type TCPSession interface {
+	HandleQuery(context.Context, []byte) []byte
+	Close()
+}
+
+// TCPPushSession is a session that can switch its connection into push mode,
+// in which the connection gets messages without sending queries. Messages
+// returns nil while the session isn't in push mode. The connection is closed
+// if the channel of messages is closed.
+type TCPPushSession interface {
+	TCPSession
+	Messages() <-chan []byte
+}
+
+type TCPSessionFactory = func() TCPSession
+
+type handlerSession TCPHandlerFunc
+
+func (h handlerSession) HandleQuery(ctx context.Context, query []byte) []byte {
+	return h(ctx, query)
+}
+
+func (handlerSession) Close() {}
+
+type TCPServerOption func(*TCPServer)
+
+// WithMaxQuerySize sets the longest line of a query.
+func WithMaxQuerySize(size int) TCPServerOption {
+	return func(server *TCPServer) {
+		server.maxQuerySize = size
+	}
+}
+
 type TCPServer struct {
-	address     string
-	semaphore   dsem.Semaphore
-	idleTimeout time.Duration
-	logger      *slog.Logger
+	address      string
+	semaphore    dsem.Semaphore
+	idleTimeout  time.Duration
+	maxQuerySize int
+	logger       *slog.Logger
 }
 
 func NewTCPServer(
 	address string, maxConnectionsNumber int, idleTimeout time.Duration, logger *slog.Logger,
+	options ...TCPServerOption,
 ) (*TCPServer, error) {
 	if logger == nil {
 		return nil, errors.New("tcp server logger is invalid")
@@ -34,15 +73,29 @@ func NewTCPServer(
 		return nil, errors.New("invalid number of max connections for tcp server")
 	}
 
-	return &TCPServer{
-		address:     address,
-		semaphore:   dsem.NewSemaphoreChan(maxConnectionsNumber),
-		idleTimeout: idleTimeout,
-		logger:      logger,
-	}, nil
+	server := &TCPServer{
+		address:      address,
+		semaphore:    dsem.NewSemaphoreChan(maxConnectionsNumber),
+		idleTimeout:  idleTimeout,
+		maxQuerySize: defaultMaxLineSize,
+		logger:       logger,
+	}
+	for _, option := range options {
+		option(server)
+	}
+	return server, nil
 }
 
+// HandleQueries handles queries of all connections with the same stateless
+// handler.
 func (s *TCPServer) HandleQueries(ctx context.Context, handler TCPHandlerFunc) error {
+	return s.HandleSessions(ctx, func() TCPSession {
+		return handlerSession(handler)
+	})
+}
+
+// HandleSessions creates a new session for every accepted connection.
+func (s *TCPServer) HandleSessions(ctx context.Context, newSession TCPSessionFactory) error {
 	listener, err := net.Listen("tcp", s.address)
 	if err != nil {
 		return fmt.Errorf("failed to listen: %w", err)
@@ -73,7 +126,10 @@ func (s *TCPServer) HandleQueries(ctx context.Context, handler TCPHandlerFunc) e
 					wg.Done()
 				}()
 
-				s.handleConnection(ctx, connection, handler)
+				session := newSession()
+				defer session.Close()
+
+				s.handleConnection(ctx, connection, session)
 			}(connection)
 		}
 	}()
@@ -91,35 +147,102 @@ func (s *TCPServer) HandleQueries(ctx context.Context, handler TCPHandlerFunc) e
 	return nil
 }
 
-func (s *TCPServer) handleConnection(ctx context.Context, connection net.Conn, handler TCPHandlerFunc) {
+func (s *TCPServer) handleConnection(ctx context.Context, connection net.Conn, session TCPSession) {
 	defer func() {
 		if err := connection.Close(); err != nil {
 			s.logger.Warn("failed to close connection", dlog.ErrAttr(err))
 		}
 	}()
 
-	if err := connection.SetDeadline(time.Now().Add(s.idleTimeout)); err != nil {
-		s.logger.Warn("failed to set deadline", dlog.ErrAttr(err))
-		return
-	}
-
-	scanner := bufio.NewScanner(connection)
-	for scanner.Scan() {
-		query := scanner.Bytes()
-
-		response := handler(ctx, query)
-		response = append(response, fmt.Sprintf("\n%s\n", EndDelim)...)
-		if _, err := connection.Write(response); err != nil {
-			s.logger.Warn("failed to write", dlog.ErrAttr(err))
-			break
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queries := s.readQueries(ctx, cancel, connection)
+	for {
+		// A connection in push mode waits for messages, so the idle timeout
+		// doesn't apply to it.
+		messages := sessionMessages(session)
+		deadline := time.Time{}
+		if messages == nil {
+			deadline = time.Now().Add(s.idleTimeout)
 		}
-
-		if err := connection.SetDeadline(time.Now().Add(s.idleTimeout)); err != nil {
+		if err := connection.SetReadDeadline(deadline); err != nil {
 			s.logger.Warn("failed to set deadline", dlog.ErrAttr(err))
 			return
 		}
+
+		select {
+		case query, ok := <-queries:
+			if !ok {
+				return
+			}
+
+			// The idle timeout doesn't apply while a query is handled,
+			// because a query can wait, like a blocking pop.
+			if err := connection.SetReadDeadline(time.Time{}); err != nil {
+				s.logger.Warn("failed to set deadline", dlog.ErrAttr(err))
+				return
+			}
+			if !s.write(connection, session.HandleQuery(ctx, query)) {
+				return
+			}
+		case message, ok := <-messages:
+			if !ok {
+				s.logger.Warn("connection doesn't keep up with messages")
+				return
+			}
+			if !s.write(connection, message) {
+				return
+			}
+		}
+	}
+}
+
+// write writes a response or a message, which are framed the same way.
+func (s *TCPServer) write(connection net.Conn, response []byte) bool {
+	response = append(response, fmt.Sprintf("\n%s\n", EndDelim)...)
+
+	if err := connection.SetWriteDeadline(time.Now().Add(s.idleTimeout)); err != nil {
+		s.logger.Warn("failed to set deadline", dlog.ErrAttr(err))
+		return false
 	}
-	if err := scanner.Err(); err != nil {
-		s.logger.Warn("failed to scan", dlog.ErrAttr(err))
+	if _, err := connection.Write(response); err != nil {
+		s.logger.Warn("failed to write", dlog.ErrAttr(err))
+		return false
 	}
+	return true
+}
+
+func sessionMessages(session TCPSession) <-chan []byte {
+	if pushSession, ok := session.(TCPPushSession); ok {
+		return pushSession.Messages()
+	}
+	return nil
+}
+
+// readQueries reads queries in another goroutine, so a disconnect is noticed
+// while a query is handled. The context is canceled when the connection is
+// closed, which stops a waiting query.
+func (s *TCPServer) readQueries(
+	ctx context.Context, cancel context.CancelFunc, connection net.Conn,
+) <-chan []byte {
+	queries := make(chan []byte)
+	go func() {
+		defer close(queries)
+		defer cancel()
+
+		scanner := bufio.NewScanner(connection)
+		scanner.Buffer(nil, s.maxQuerySize)
+		for scanner.Scan() {
+			select {
+			case queries <- bytes.Clone(scanner.Bytes()):
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+			s.logger.Warn("failed to scan", dlog.ErrAttr(err))
+		}
+	}()
+	return queries
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -35,8 +37,11 @@ func TestTCPServer(t *testing.T) {
 		require.NoError(t, err)
 	}()
 
-	connection, err := net.Dial("tcp", "localhost:20001")
-	require.NoError(t, err)
+	var connection net.Conn
+	require.Eventually(t, func() bool {
+		connection, err = net.Dial("tcp", "localhost:20001")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
 
 	_, err = connection.Write(request)
 	require.NoError(t, err)
@@ -47,3 +52,255 @@ func TestTCPServer(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte(expected), buffer[:count])
 }
+
+type countingSession struct {
+	queries int
+	closed  chan struct{}
+}
+
+func (s *countingSession) HandleQuery(context.Context, []byte) []byte {
+	s.queries++
+	return []byte(strconv.Itoa(s.queries))
+}
+
+func (s *countingSession) Close() {
+	close(s.closed)
+}
+
+func TestTCPServerSessions(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, err := NewTCPServer(":20002", 2, time.Second, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	sessions := make(chan *countingSession, 2)
+	go func() {
+		err := server.HandleSessions(ctx, func() TCPSession {
+			session := &countingSession{closed: make(chan struct{})}
+			sessions <- session
+			return session
+		})
+		require.NoError(t, err)
+	}()
+
+	var first *TCPClient
+	require.Eventually(t, func() bool {
+		first, err = NewTCPClient("localhost:20002", time.Second)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	second, err := NewTCPClient("localhost:20002", time.Second)
+	require.NoError(t, err)
+
+	for _, exchange := range []struct {
+		client   *TCPClient
+		response string
+	}{
+		{client: first, response: "1"},
+		{client: first, response: "2"},
+		{client: second, response: "1"},
+		{client: first, response: "3"},
+	} {
+		response, err := exchange.client.Send([]byte("query\n"))
+		require.NoError(t, err)
+		require.Equal(t, exchange.response, string(response))
+	}
+
+	require.NoError(t, first.Close())
+	require.NoError(t, second.Close())
+	for i := 0; i < 2; i++ {
+		session := <-sessions
+		select {
+		case <-session.closed:
+		case <-time.After(time.Second):
+			require.Fail(t, "session is not closed")
+		}
+	}
+}
+
+func TestTCPServerMaxQuerySize(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, err := NewTCPServer(":20061", 2, time.Second, dlog.NewNonSlog(), WithMaxQuerySize(200_000))
+	require.NoError(t, err)
+	go func() {
+		err := server.HandleQueries(ctx, func(_ context.Context, query []byte) []byte {
+			return []byte(strconv.Itoa(len(query)))
+		})
+		require.NoError(t, err)
+	}()
+
+	var client *TCPClient
+	require.Eventually(t, func() bool {
+		client, err = NewTCPClient("localhost:20061", time.Second)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	defer client.Close()
+
+	response, err := client.Send([]byte(strings.Repeat("x", 100_000) + "\n"))
+	require.NoError(t, err)
+	require.Equal(t, "100000", string(response))
+
+	// The connection is closed after a query longer than the limit.
+	_, err = client.Send([]byte(strings.Repeat("x", 300_000) + "\n"))
+	require.Error(t, err)
+}
+
+func TestTCPServerWaitingQueries(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	idleTimeout := 100 * time.Millisecond
+	server, err := NewTCPServer(":20003", 2, idleTimeout, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	canceled := make(chan struct{})
+	go func() {
+		err := server.HandleQueries(ctx, func(ctx context.Context, query []byte) []byte {
+			if string(query) == "wait" {
+				<-ctx.Done()
+				close(canceled)
+				return nil
+			}
+
+			time.Sleep(3 * idleTimeout)
+			return query
+		})
+		require.NoError(t, err)
+	}()
+
+	var client *TCPClient
+	require.Eventually(t, func() bool {
+		client, err = NewTCPClient("localhost:20003", time.Second)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// The idle timeout doesn't apply while a query is handled.
+	response, err := client.Send([]byte("slow\n"))
+	require.NoError(t, err)
+	require.Equal(t, "slow", string(response))
+
+	connection, err := net.Dial("tcp", "localhost:20003")
+	require.NoError(t, err)
+	_, err = connection.Write([]byte("wait\n"))
+	require.NoError(t, err)
+	require.NoError(t, connection.Close())
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		require.Fail(t, "query is not canceled after disconnect")
+	}
+}
+
+type pushSession struct {
+	push     bool
+	messages chan []byte
+}
+
+func (s *pushSession) HandleQuery(_ context.Context, query []byte) []byte {
+	s.push = string(query) == "subscribe"
+	return []byte("[ok] " + string(query))
+}
+
+func (s *pushSession) Messages() <-chan []byte {
+	if !s.push {
+		return nil
+	}
+	return s.messages
+}
+
+func (s *pushSession) Close() {}
+
+func TestTCPServerPushMode(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	idleTimeout := 100 * time.Millisecond
+	server, err := NewTCPServer(":20053", 2, idleTimeout, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	messages := make(chan []byte)
+	go func() {
+		err := server.HandleSessions(ctx, func() TCPSession {
+			return &pushSession{messages: messages}
+		})
+		require.NoError(t, err)
+	}()
+
+	var client *TCPClient
+	require.Eventually(t, func() bool {
+		client, err = NewTCPClient("localhost:20053", time.Second)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	defer client.Close()
+
+	response, err := client.Send([]byte("subscribe\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[ok] subscribe", string(response))
+
+	// The idle timeout doesn't apply in push mode.
+	time.Sleep(3 * idleTimeout)
+	messages <- []byte("[message] news first")
+	message, err := client.Receive()
+	require.NoError(t, err)
+	require.Equal(t, "[message] news first", string(message))
+
+	// A message that comes before a response waits for Receive.
+	messages <- []byte("[message] news second")
+	response, err = client.Send([]byte("subscribe\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[ok] subscribe", string(response))
+	message, err = client.Receive()
+	require.NoError(t, err)
+	require.Equal(t, "[message] news second", string(message))
+
+	// The connection is closed when the session drops its messages.
+	close(messages)
+	_, err = client.Receive()
+	require.Error(t, err)
+}
+
+func TestTCPServerLeavesPushMode(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	idleTimeout := 100 * time.Millisecond
+	server, err := NewTCPServer(":20054", 2, idleTimeout, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	go func() {
+		err := server.HandleSessions(ctx, func() TCPSession {
+			return &pushSession{messages: make(chan []byte)}
+		})
+		require.NoError(t, err)
+	}()
+
+	var client *TCPClient
+	require.Eventually(t, func() bool {
+		client, err = NewTCPClient("localhost:20054", time.Second)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	defer client.Close()
+
+	for _, query := range []string{"subscribe", "unsubscribe"} {
+		response, err := client.Send([]byte(query + "\n"))
+		require.NoError(t, err)
+		require.Equal(t, "[ok] "+query, string(response))
+	}
+
+	// The idle timeout applies again after push mode.
+	_, err = client.Receive()
+	require.Error(t, err)
+}
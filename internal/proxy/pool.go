@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"kv_db/internal/network"
+)
+
+// pool keeps idle connections to a backend, so queries don't wait for a new
+// connection. A connection is reused only while it is idle for less than
+// maxIdleTime, after which the backend closes it.
+type pool struct {
+	address     string
+	idleTimeout time.Duration
+	maxIdleTime time.Duration
+	idle        chan idleClient
+}
+
+type idleClient struct {
+	client *network.TCPClient
+	since  time.Time
+}
+
+func newPool(address string, size int, idleTimeout, maxIdleTime time.Duration) *pool {
+	return &pool{
+		address:     address,
+		idleTimeout: idleTimeout,
+		maxIdleTime: maxIdleTime,
+		idle:        make(chan idleClient, size),
+	}
+}
+
+// send sends the request over an idle connection or a new one. The backend
+// can close an idle connection just before it is taken, without reading the
+// request, so a request that isn't delivered over an idle connection is sent
+// once more over a new one. Other failures aren't retried, because the
+// backend may have executed the request.
+func (p *pool) send(ctx context.Context, request []byte) ([]byte, error) {
+	client, reused, err := p.take()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := p.sendOver(ctx, client, request)
+	if errors.Is(err, network.ErrNotDelivered) && reused && ctx.Err() == nil {
+		if client, err = network.NewTCPClient(p.address, p.idleTimeout); err != nil {
+			return nil, err
+		}
+		response, err = p.sendOver(ctx, client, request)
+	}
+	return response, err
+}
+
+// sendOver sends the request over the connection. The connection is closed if
+// the request fails or the context is done, because a response that comes
+// later would be read by the next request.
+func (p *pool) sendOver(ctx context.Context, client *network.TCPClient, request []byte) ([]byte, error) {
+	stop := context.AfterFunc(ctx, func() {
+		_ = client.Close()
+	})
+	response, err := client.Send(request)
+	if !stop() || err != nil {
+		_ = client.Close()
+		if err == nil {
+			err = ctx.Err()
+		}
+		return nil, err
+	}
+
+	p.put(client)
+	return response, nil
+}
+
+// take returns an idle connection, which is reused, or a new one.
+func (p *pool) take() (*network.TCPClient, bool, error) {
+	for {
+		select {
+		case idle := <-p.idle:
+			if time.Since(idle.since) < p.maxIdleTime {
+				return idle.client, true, nil
+			}
+			_ = idle.client.Close()
+		default:
+			client, err := network.NewTCPClient(p.address, p.idleTimeout)
+			return client, false, err
+		}
+	}
+}
+
+func (p *pool) put(client *network.TCPClient) {
+	select {
+	case p.idle <- idleClient{client: client, since: time.Now()}:
+	default:
+		_ = client.Close()
+	}
+}
+
+// close closes the idle connections.
+func (p *pool) close() {
+	for {
+		select {
+		case idle := <-p.idle:
+			_ = idle.client.Close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kv_db/internal/database"
+	"kv_db/pkg/dlog"
+)
+
+const (
+	defaultPoolSize = 10
+	// defaultBackendIdleTimeout is the default idle timeout of kv_db.
+	defaultBackendIdleTimeout = 5 * time.Minute
+)
+
+type ProxyOption func(*Proxy)
+
+// WithPoolSize sets the number of idle connections kept to every backend.
+func WithPoolSize(size int) ProxyOption {
+	return func(proxy *Proxy) {
+		proxy.poolSize = size
+	}
+}
+
+// WithBackendIdleTimeout sets the time after which backends close idle
+// connections, so the proxy doesn't reuse them.
+func WithBackendIdleTimeout(timeout time.Duration) ProxyOption {
+	return func(proxy *Proxy) {
+		proxy.backendIdleTimeout = timeout
+	}
+}
+
+// WithVirtualNodes sets the number of points of every backend on the ring.
+func WithVirtualNodes(virtualNodes int) ProxyOption {
+	return func(proxy *Proxy) {
+		proxy.virtualNodes = virtualNodes
+	}
+}
+
+// Proxy sends queries to backends by their keys, which are spread over the
+// backends by a consistent-hash ring.
+//
+// A multi-key query is split into queries of the keys of every backend it
+// touches, and their results are merged. Such a query isn't atomic, so MSET
+// and MDEL can be applied by a part of the backends. KEYS, RANGE and FLUSHDB
+// are sent to all backends, and other queries without keys, like INFO, to the
+// first one. Commands that keep state on a connection, like BEGIN, SELECT and
+// SUBSCRIBE or WATCH, and SCAN, whose cursor is of a single backend, aren't supported.
+type Proxy struct {
+	ring               *Ring
+	pools              map[string]*pool
+	poolSize           int
+	backendIdleTimeout time.Duration
+	virtualNodes       int
+	logger             *slog.Logger
+}
+
+func NewProxy(
+	backends []string, idleTimeout time.Duration, logger *slog.Logger, options ...ProxyOption,
+) (*Proxy, error) {
+	if idleTimeout <= 0 {
+		return nil, errors.New("proxy idle timeout is invalid")
+	}
+
+	if logger == nil {
+		return nil, errors.New("proxy logger is invalid")
+	}
+
+	proxy := &Proxy{
+		pools:              make(map[string]*pool, len(backends)),
+		poolSize:           defaultPoolSize,
+		backendIdleTimeout: defaultBackendIdleTimeout,
+		virtualNodes:       defaultVirtualNodes,
+		logger:             logger,
+	}
+	for _, option := range options {
+		option(proxy)
+	}
+
+	if proxy.poolSize < 0 {
+		return nil, errors.New("proxy pool size is invalid")
+	}
+
+	if proxy.backendIdleTimeout <= 0 {
+		return nil, errors.New("proxy backend idle timeout is invalid")
+	}
+
+	var err error
+	if proxy.ring, err = NewRing(backends, proxy.virtualNodes); err != nil {
+		return nil, err
+	}
+	for _, backend := range backends {
+		proxy.pools[backend] = newPool(backend, proxy.poolSize, idleTimeout, proxy.backendIdleTimeout)
+	}
+
+	return proxy, nil
+}
+
+// Close closes the idle connections to the backends.
+func (p *Proxy) Close() {
+	for _, backendPool := range p.pools {
+		backendPool.close()
+	}
+}
+
+// HandleQuery handles a query of a client, which is a handler of
+// network.TCPServer.
+func (p *Proxy) HandleQuery(ctx context.Context, request []byte) []byte {
+	tokens := strings.Fields(string(request))
+	if len(tokens) == 0 {
+		return p.forward(ctx, p.ring.Backends()[0], request)
+	}
+
+	switch commandID := database.GetCommandIDByName(tokens[0]); {
+	case commandID == database.BeginCommandID, commandID == database.CommitCommandID,
+		commandID == database.RollbackCommandID, commandID == database.SelectCommandID,
+		commandID == database.ScanCommandID, commandID == database.ReplSyncCommandID,
+		commandID == database.SlotsCommandID, commandID == database.SubscribeCommandID,
+		commandID == database.PSubscribeCommandID, commandID == database.UnsubscribeCommandID,
+		commandID == database.PUnsubscribeCommandID, commandID == database.WatchCommandID,
+		commandID == database.UnwatchCommandID:
+		return []byte("[error] command is not supported by the proxy")
+	case commandID == database.MGetCommandID:
+		return p.handleMGetQuery(ctx, tokens)
+	case commandID == database.MSetCommandID, commandID == database.MDelCommandID:
+		return p.handleMultiWriteQuery(ctx, tokens)
+	case commandID == database.SInterCommandID, commandID == database.SUnionCommandID:
+		return p.handleSetReadQuery(ctx, tokens, commandID == database.SInterCommandID)
+	case commandID == database.KeysCommandID, commandID == database.RangeCommandID:
+		return p.handleBroadcastReadQuery(ctx, tokens, commandID == database.RangeCommandID)
+	case commandID == database.FlushDBCommandID:
+		return p.mergeWrites(p.broadcast(ctx, request))
+	}
+
+	backend := p.ring.Backends()[0]
+	if keys := database.QueryKeys(tokens); len(keys) != 0 {
+		backend = p.ring.Get(keys[0])
+	}
+	return p.forward(ctx, backend, request)
+}
+
+// handleMGetQuery returns the values in the order of the keys.
+func (p *Proxy) handleMGetQuery(ctx context.Context, tokens []string) []byte {
+	keys := tokens[1:]
+	groups := p.group(keys, 1)
+	if len(groups) <= 1 {
+		return p.forward(ctx, p.backendOf(keys), []byte(strings.Join(tokens, " ")))
+	}
+
+	requests := make(map[string][]byte, len(groups))
+	for backend, indexes := range groups {
+		requests[backend] = joinQuery(tokens[0], keys, indexes, 1)
+	}
+
+	values := make([]string, len(keys))
+	for backend, response := range p.send(ctx, requests) {
+		backendValues, ok := parseValues(response)
+		if !ok || len(backendValues) != len(groups[backend]) {
+			return response
+		}
+		for idx, keyIdx := range groups[backend] {
+			values[keyIdx] = backendValues[idx]
+		}
+	}
+	return formatValues(values)
+}
+
+// handleMultiWriteQuery handles MSET and MDEL, which are [ok] if all backends
+// have applied their keys.
+func (p *Proxy) handleMultiWriteQuery(ctx context.Context, tokens []string) []byte {
+	arguments, width := tokens[1:], 1
+	if database.GetCommandIDByName(tokens[0]) == database.MSetCommandID {
+		width = 2
+	}
+
+	// Pairs of MSET without a value are invalid, and any backend responds
+	// with the error.
+	groups := p.group(arguments, width)
+	if len(groups) <= 1 || len(arguments)%width != 0 {
+		return p.forward(ctx, p.backendOf(arguments), []byte(strings.Join(tokens, " ")))
+	}
+
+	requests := make(map[string][]byte, len(groups))
+	for backend, indexes := range groups {
+		requests[backend] = joinQuery(tokens[0], arguments, indexes, width)
+	}
+	return p.mergeWrites(p.send(ctx, requests))
+}
+
+// handleSetReadQuery handles SINTER and SUNION. The intersection of the
+// intersections of the sets of every backend is the intersection of all sets,
+// and the same is true for unions.
+func (p *Proxy) handleSetReadQuery(ctx context.Context, tokens []string, intersect bool) []byte {
+	keys := tokens[1:]
+	groups := p.group(keys, 1)
+	if len(groups) <= 1 {
+		return p.forward(ctx, p.backendOf(keys), []byte(strings.Join(tokens, " ")))
+	}
+
+	requests := make(map[string][]byte, len(groups))
+	for backend, indexes := range groups {
+		requests[backend] = joinQuery(tokens[0], keys, indexes, 1)
+	}
+
+	counts := make(map[string]int)
+	for _, response := range p.send(ctx, requests) {
+		members, ok := parseValues(response)
+		if !ok {
+			return response
+		}
+		for _, member := range members {
+			counts[member]++
+		}
+	}
+
+	members := make([]string, 0, len(counts))
+	for member, count := range counts {
+		if !intersect || count == len(groups) {
+			members = append(members, member)
+		}
+	}
+	sort.Strings(members)
+	return formatValues(members)
+}
+
+// handleBroadcastReadQuery handles KEYS and RANGE, which read the keys of all
+// backends. The keys of RANGE are merged in their order and limited again.
+func (p *Proxy) handleBroadcastReadQuery(ctx context.Context, tokens []string, ordered bool) []byte {
+	var values []string
+	for _, response := range p.broadcast(ctx, []byte(strings.Join(tokens, " "))) {
+		backendValues, ok := parseValues(response)
+		if !ok {
+			return response
+		}
+		values = append(values, backendValues...)
+	}
+	sort.Strings(values)
+
+	if ordered && len(tokens) == 5 {
+		if limit, err := strconv.Atoi(tokens[4]); err == nil && limit > 0 && limit < len(values) {
+			values = values[:limit]
+		}
+	}
+	return formatValues(values)
+}
+
+// group groups the indexes of the arguments by the backends of their keys.
+// Every key is followed by width-1 arguments of its own.
+func (p *Proxy) group(arguments []string, width int) map[string][]int {
+	groups := make(map[string][]int)
+	for idx := 0; idx < len(arguments); idx += width {
+		backend := p.ring.Get(arguments[idx])
+		groups[backend] = append(groups[backend], idx/width)
+	}
+	return groups
+}
+
+// backendOf returns the backend of the first key. A query without keys is
+// invalid, and any backend responds with the error.
+func (p *Proxy) backendOf(keys []string) string {
+	if len(keys) == 0 {
+		return p.ring.Backends()[0]
+	}
+	return p.ring.Get(keys[0])
+}
+
+func (p *Proxy) broadcast(ctx context.Context, request []byte) map[string][]byte {
+	requests := make(map[string][]byte, len(p.pools))
+	for backend := range p.pools {
+		requests[backend] = request
+	}
+	return p.send(ctx, requests)
+}
+
+// send sends the requests to their backends concurrently.
+func (p *Proxy) send(ctx context.Context, requests map[string][]byte) map[string][]byte {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	responses := make(map[string][]byte, len(requests))
+	for backend, request := range requests {
+		backend, request := backend, request
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response := p.forward(ctx, backend, request)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			responses[backend] = response
+		}()
+	}
+	wg.Wait()
+	return responses
+}
+
+func (p *Proxy) forward(ctx context.Context, backend string, request []byte) []byte {
+	// The request of a broadcast is shared by several goroutines, so the
+	// line break is appended to a copy of it.
+	line := make([]byte, 0, len(request)+1)
+	response, err := p.pools[backend].send(ctx, append(append(line, request...), '\n'))
+	if err != nil {
+		p.logger.Warn("failed to send query", slog.String("backend", backend), dlog.ErrAttr(err))
+		return []byte(fmt.Sprintf("[error] backend %s is unavailable", backend))
+	}
+	return response
+}
+
+// mergeWrites returns [ok] if all responses are [ok] and the first error
+// otherwise.
+func (p *Proxy) mergeWrites(responses map[string][]byte) []byte {
+	for _, backend := range p.ring.Backends() {
+		if response, ok := responses[backend]; ok && string(response) != "[ok]" {
+			return response
+		}
+	}
+	return []byte("[ok]")
+}
+
+// joinQuery joins the command with the arguments of the keys with the
+// indexes.
+func joinQuery(command string, arguments []string, indexes []int, width int) []byte {
+	query := []string{command}
+	for _, idx := range indexes {
+		query = append(query, arguments[idx*width:idx*width+width]...)
+	}
+	return []byte(strings.Join(query, " "))
+}
+
+// parseValues parses a multi-value response of a backend.
+func parseValues(response []byte) ([]string, bool) {
+	lines := strings.Split(string(response), "\n")
+	count, ok := strings.CutPrefix(lines[0], "[ok] ")
+	if !ok || count != strconv.Itoa(len(lines)-1) {
+		return nil, false
+	}
+
+	values := make([]string, 0, len(lines)-1)
+	for idx, line := range lines[1:] {
+		value, ok := strings.CutPrefix(line, strconv.Itoa(idx+1)+") ")
+		if !ok {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
+func formatValues(values []string) []byte {
+	var builder strings.Builder
+	builder.WriteString("[ok] " + strconv.Itoa(len(values)))
+	for idx, value := range values {
+		builder.WriteString(fmt.Sprintf("\n%d) %s", idx+1, value))
+	}
+	return []byte(builder.String())
+}
@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/config"
+	"kv_db/internal/initialization"
+	"kv_db/internal/network"
+	"kv_db/pkg/dlog"
+)
+
+func TestNewProxy(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		backends    []string
+		idleTimeout time.Duration
+		options     []ProxyOption
+		expErr      bool
+	}{
+		"no backends":          {idleTimeout: time.Second, expErr: true},
+		"invalid idle timeout": {backends: []string{"localhost:3223"}, expErr: true},
+		"invalid pool size": {
+			backends:    []string{"localhost:3223"},
+			idleTimeout: time.Second,
+			options:     []ProxyOption{WithPoolSize(-1)},
+			expErr:      true,
+		},
+		"invalid backend idle timeout": {
+			backends:    []string{"localhost:3223"},
+			idleTimeout: time.Second,
+			options:     []ProxyOption{WithBackendIdleTimeout(0)},
+			expErr:      true,
+		},
+		"invalid virtual nodes": {
+			backends:    []string{"localhost:3223"},
+			idleTimeout: time.Second,
+			options:     []ProxyOption{WithVirtualNodes(0)},
+			expErr:      true,
+		},
+		"success": {backends: []string{"localhost:3223", "localhost:3224"}, idleTimeout: time.Second},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			proxy, err := NewProxy(test.backends, test.idleTimeout, dlog.NewNonSlog(), test.options...)
+			if test.expErr {
+				require.Error(t, err)
+				require.Nil(t, proxy)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, proxy.pools, len(test.backends))
+		})
+	}
+
+	proxy, err := NewProxy([]string{"localhost:3223"}, time.Second, nil)
+	require.Error(t, err)
+	require.Nil(t, proxy)
+}
+
+func TestProxy(t *testing.T) {
+	t.Parallel()
+
+	backends := []string{"localhost:20049", "localhost:20050", "localhost:20051"}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, len(backends))
+	defer func() {
+		cancel()
+		for range backends {
+			require.NoError(t, <-done)
+		}
+	}()
+
+	clients := make(map[string]*network.TCPClient, len(backends))
+	for _, backend := range backends {
+		// RANGE needs an ordered engine.
+		initializer, err := initialization.NewInitializer(config.Config{
+			Engine:  config.EngineConfig{Type: "in_memory_ordered"},
+			Network: config.NetworkConfig{Address: backend},
+		}, io.Discard)
+		require.NoError(t, err)
+		go func() {
+			done <- initializer.Start(ctx)
+		}()
+
+		require.Eventually(t, func() bool {
+			clients[backend], err = network.NewTCPClient(backend, time.Second)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+		defer clients[backend].Close()
+	}
+
+	proxy, err := NewProxy(backends, time.Second, dlog.NewNonSlog(), WithPoolSize(2))
+	require.NoError(t, err)
+	defer proxy.Close()
+	send := func(request string) string {
+		return string(proxy.HandleQuery(ctx, []byte(request)))
+	}
+	sendBackend := func(backend, request string) string {
+		response, err := clients[backend].Send([]byte(request + "\n"))
+		require.NoError(t, err)
+		return string(response)
+	}
+
+	// Keys are spread over all backends.
+	pairs := make([]string, 0, 40)
+	for idx := 0; idx < 20; idx++ {
+		require.Equal(t, "[ok]", send(fmt.Sprintf("SET key%02d value%02d", idx, idx)))
+		pairs = append(pairs, fmt.Sprintf("other%02d", idx), fmt.Sprintf("value%02d", idx))
+	}
+	for _, backend := range backends {
+		require.NotEqual(t, "[ok] 0", sendBackend(backend, "KEYS key*"))
+	}
+	require.Equal(t, "[ok] value07", send("GET key07"))
+	require.Equal(t, "[ok] 20", strings.Split(send("KEYS key*"), "\n")[0])
+	require.Equal(t,
+		"[ok] 3\n1) key05 value05\n2) key06 value06\n3) key07 value07", send("RANGE key05 key15 LIMIT 3"),
+	)
+
+	// Multi-key commands are split by backends and merged in the order of
+	// their keys.
+	require.Equal(t, "[ok]", send("MSET "+strings.Join(pairs, " ")))
+	require.Equal(t,
+		"[ok] 4\n1) value03\n2) [nil]\n3) value01\n4) value12", send("MGET other03 missing key01 other12"),
+	)
+	require.Equal(t, "[ok]", send("MDEL other03 other12 key01"))
+	require.Equal(t, "[ok] 3\n1) [nil]\n2) [nil]\n3) value04", send("MGET other03 key01 other04"))
+	require.Equal(t, "[error] invalid arguments", send("MSET a 1 b"))
+
+	require.Equal(t, "[ok] 3", send("SADD set1 a b c"))
+	require.Equal(t, "[ok] 3", send("SADD set2 b c d"))
+	require.Equal(t, "[ok] 3", send("SADD set3 c d e"))
+	require.Equal(t, "[ok] 1\n1) c", send("SINTER set1 set2 set3"))
+	require.Equal(t, "[ok] 5\n1) a\n2) b\n3) c\n4) d\n5) e", send("SUNION set1 set2 set3"))
+
+	require.Equal(t, "[error] command is not supported by the proxy", send("BEGIN"))
+	require.Equal(t, "[error] command is not supported by the proxy", send("SCAN 0"))
+	require.Equal(t, "[error] command is not supported by the proxy", send("SUBSCRIBE news"))
+	require.Equal(t, "[error] command is not supported by the proxy", send("WATCH user."))
+	require.True(t, strings.HasPrefix(send("INFO"), "[ok] "))
+
+	require.Equal(t, "[ok]", send("FLUSHDB"))
+	require.Equal(t, "[ok] 0", send("KEYS *"))
+}
+
+func TestProxy_UnavailableBackend(t *testing.T) {
+	t.Parallel()
+
+	proxy, err := NewProxy([]string{"localhost:20052"}, time.Second, dlog.NewNonSlog())
+	require.NoError(t, err)
+	defer proxy.Close()
+
+	response := proxy.HandleQuery(context.Background(), []byte("GET key"))
+	require.Equal(t, "[error] backend localhost:20052 is unavailable", string(response))
+}
+
+func TestProxy_IdleBackendConnections(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The backend closes connections that are idle for longer than 100ms.
+	for _, backend := range []string{"localhost:20062", "localhost:20063"} {
+		server, err := network.NewTCPServer(backend, 10, 100*time.Millisecond, dlog.NewNonSlog())
+		require.NoError(t, err)
+		go func() {
+			_ = server.HandleQueries(ctx, func(context.Context, []byte) []byte {
+				return []byte("[ok] value")
+			})
+		}()
+	}
+
+	for name, options := range map[string][]ProxyOption{
+		// A pooled connection that is closed by the backend is replaced
+		// after the request fails.
+		"stale connection": nil,
+		// A pooled connection isn't reused after the backend idle timeout.
+		"expired connection": {WithBackendIdleTimeout(50 * time.Millisecond)},
+	} {
+		backend := "localhost:20062"
+		if options != nil {
+			backend = "localhost:20063"
+		}
+		proxy, err := NewProxy([]string{backend}, time.Second, dlog.NewNonSlog(), options...)
+		require.NoError(t, err)
+		defer proxy.Close()
+
+		require.Eventually(t, func() bool {
+			return string(proxy.HandleQuery(ctx, []byte("GET key"))) == "[ok] value"
+		}, time.Second, 10*time.Millisecond, name)
+		time.Sleep(300 * time.Millisecond)
+		require.Equal(t, "[ok] value", string(proxy.HandleQuery(ctx, []byte("GET key"))), name)
+	}
+}
+
+func TestProxy_StalledBackend(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The backend executes the second request and answers it after the
+	// proxy stops waiting.
+	var executed atomic.Int32
+	server, err := network.NewTCPServer("localhost:20068", 10, time.Minute, dlog.NewNonSlog())
+	require.NoError(t, err)
+	go func() {
+		_ = server.HandleQueries(ctx, func(context.Context, []byte) []byte {
+			if executed.Add(1) == 2 {
+				time.Sleep(500 * time.Millisecond)
+			}
+			return []byte("[ok]")
+		})
+	}()
+
+	proxy, err := NewProxy([]string{"localhost:20068"}, 100*time.Millisecond, dlog.NewNonSlog())
+	require.NoError(t, err)
+	defer proxy.Close()
+
+	require.Eventually(t, func() bool {
+		return string(proxy.HandleQuery(ctx, []byte("INCR key"))) == "[ok]"
+	}, time.Second, 10*time.Millisecond)
+
+	// The request isn't sent once more over a new connection, because the
+	// backend has executed it.
+	require.Equal(t, "[error] backend localhost:20068 is unavailable", string(proxy.HandleQuery(ctx, []byte("INCR key"))))
+	time.Sleep(600 * time.Millisecond)
+	require.Equal(t, int32(2), executed.Load())
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+const defaultVirtualNodes = 100
+
+type point struct {
+	hash    uint32
+	backend string
+}
+
+// Ring is a consistent-hash ring of backends. Every backend has several
+// virtual nodes on the ring, and a key belongs to the first virtual node
+// after its hash, so adding a backend moves only the keys of the new one.
+type Ring struct {
+	backends []string
+	points   []point
+}
+
+func NewRing(backends []string, virtualNodes int) (*Ring, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("ring backends are invalid")
+	}
+
+	if virtualNodes <= 0 {
+		return nil, errors.New("ring virtual nodes number is invalid")
+	}
+
+	ring := &Ring{
+		backends: backends,
+		points:   make([]point, 0, len(backends)*virtualNodes),
+	}
+	seen := make(map[string]bool, len(backends))
+	for _, backend := range backends {
+		if backend == "" || seen[backend] {
+			return nil, fmt.Errorf("ring backend %q is invalid", backend)
+		}
+		seen[backend] = true
+
+		for idx := 0; idx < virtualNodes; idx++ {
+			hash := crc32.ChecksumIEEE([]byte(backend + "#" + strconv.Itoa(idx)))
+			ring.points = append(ring.points, point{hash: hash, backend: backend})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i].hash < ring.points[j].hash
+	})
+
+	return ring, nil
+}
+
+// Get returns the backend of the key.
+func (r *Ring) Get(key string) string {
+	hash := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
+	})
+	if idx == len(r.points) {
+		idx = 0
+	}
+	return r.points[idx].backend
+}
+
+// Backends returns the backends in the order they were added.
+func (r *Ring) Backends() []string {
+	return r.backends
+}
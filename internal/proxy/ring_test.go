@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRing(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		backends     []string
+		virtualNodes int
+		expErr       bool
+	}{
+		"no backends":           {virtualNodes: 1, expErr: true},
+		"empty backend":         {backends: []string{""}, virtualNodes: 1, expErr: true},
+		"duplicated backend":    {backends: []string{"a", "a"}, virtualNodes: 1, expErr: true},
+		"invalid virtual nodes": {backends: []string{"a"}, expErr: true},
+		"success":               {backends: []string{"a", "b"}, virtualNodes: 10},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ring, err := NewRing(test.backends, test.virtualNodes)
+			if test.expErr {
+				require.Error(t, err)
+				require.Nil(t, ring)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.backends, ring.Backends())
+			require.Len(t, ring.points, len(test.backends)*test.virtualNodes)
+		})
+	}
+}
+
+func TestRing_Get(t *testing.T) {
+	t.Parallel()
+
+	backends := []string{"localhost:3223", "localhost:3224", "localhost:3225"}
+	ring, err := NewRing(backends, defaultVirtualNodes)
+	require.NoError(t, err)
+	grownRing, err := NewRing(append(backends, "localhost:3226"), defaultVirtualNodes)
+	require.NoError(t, err)
+
+	const keysCount = 3000
+	counts := make(map[string]int)
+	for idx := 0; idx < keysCount; idx++ {
+		key := fmt.Sprintf("key%d", idx)
+		backend := ring.Get(key)
+		require.Equal(t, backend, ring.Get(key))
+		counts[backend]++
+
+		// A new backend takes keys only for itself.
+		if grownBackend := grownRing.Get(key); grownBackend != backend {
+			require.Equal(t, "localhost:3226", grownBackend)
+		}
+	}
+
+	require.Len(t, counts, len(backends))
+	for _, count := range counts {
+		require.Greater(t, count, keysCount/len(backends)/2)
+	}
+}
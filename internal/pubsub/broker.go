@@ -0,0 +1,298 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+const defaultBufferSize = 1000
+
+type subscribers map[*Subscriber]struct{}
+
+// watch is a subscription to the events of the keys with the prefix in the
+// keyspace with the index.
+type watch struct {
+	keyspace int
+	prefix   string
+}
+
+type BrokerOption func(*Broker)
+
+// WithBufferSize sets the number of messages that a subscriber can lag
+// behind before it is dropped.
+func WithBufferSize(size int) BrokerOption {
+	return func(broker *Broker) {
+		broker.bufferSize = size
+	}
+}
+
+// Broker delivers messages published to channels to their subscribers and to
+// the subscribers of patterns that match the channels. It also delivers the
+// events of keys to the subscribers that watch their prefixes.
+//
+// Publishers never wait for subscribers. A subscriber that doesn't keep up
+// and fills its buffer is dropped: its messages channel is closed, and it
+// gets no messages anymore.
+type Broker struct {
+	bufferSize int
+
+	mutex    sync.Mutex
+	channels map[string]subscribers
+	patterns map[string]subscribers
+	watches  map[watch]subscribers
+}
+
+func NewBroker(options ...BrokerOption) (*Broker, error) {
+	broker := &Broker{
+		bufferSize: defaultBufferSize,
+		channels:   make(map[string]subscribers),
+		patterns:   make(map[string]subscribers),
+		watches:    make(map[watch]subscribers),
+	}
+	for _, option := range options {
+		option(broker)
+	}
+
+	if broker.bufferSize <= 0 {
+		return nil, errors.New("broker buffer size is invalid")
+	}
+
+	return broker, nil
+}
+
+// Publish sends the message to the subscribers of the channel and returns
+// the number of subscribers that got it.
+func (b *Broker) Publish(channel, message string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	receivers := 0
+	for subscriber := range b.channels[channel] {
+		if subscriber.deliver(fmt.Sprintf("[message] %s %s", channel, message)) {
+			receivers++
+		}
+	}
+	for pattern, subscribers := range b.patterns {
+		if ok, _ := path.Match(pattern, channel); !ok {
+			continue
+		}
+		for subscriber := range subscribers {
+			if subscriber.deliver(fmt.Sprintf("[pmessage] %s %s %s", pattern, channel, message)) {
+				receivers++
+			}
+		}
+	}
+	return receivers
+}
+
+// PublishEvent sends the event of the key in the keyspace to the subscribers
+// that watch its prefixes as "[event] op key value" and returns the number of
+// subscribers that got it. An event without a key concerns all keys, and the
+// empty key and value are left out. Every subscriber gets the event once,
+// even if it watches several prefixes of the key.
+func (b *Broker) PublishEvent(keyspace int, op, key, value string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.watches) == 0 {
+		return 0
+	}
+
+	receivers := make(subscribers)
+	for watched, subscribers := range b.watches {
+		if watched.keyspace != keyspace || (key != "" && !strings.HasPrefix(key, watched.prefix)) {
+			continue
+		}
+		for subscriber := range subscribers {
+			receivers[subscriber] = struct{}{}
+		}
+	}
+
+	message := "[event] " + op
+	for _, field := range []string{key, value} {
+		if field != "" {
+			message += " " + field
+		}
+	}
+
+	delivered := 0
+	for subscriber := range receivers {
+		if subscriber.deliver(message) {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// NewSubscriber creates a subscriber without subscriptions.
+func (b *Broker) NewSubscriber() *Subscriber {
+	return &Subscriber{
+		broker:   b,
+		messages: make(chan []byte, b.bufferSize),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		watches:  make(map[watch]struct{}),
+	}
+}
+
+// Subscriber receives the messages of its channels and patterns and the events
+// of its watched prefixes. Its methods must be called sequentially.
+type Subscriber struct {
+	broker   *Broker
+	messages chan []byte
+	// dropped is set when the messages channel is closed. It is guarded by
+	// the mutex of the broker.
+	dropped  bool
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	watches  map[watch]struct{}
+}
+
+// Messages returns the channel of messages formatted as
+// "[message] channel message", "[pmessage] pattern channel message" or
+// "[event] op key value".
+func (s *Subscriber) Messages() <-chan []byte {
+	return s.messages
+}
+
+// Subscribe subscribes to the channels and returns the number of
+// subscriptions.
+func (s *Subscriber) Subscribe(channels ...string) int {
+	s.broker.mutex.Lock()
+	defer s.broker.mutex.Unlock()
+
+	for _, channel := range channels {
+		add(s, s.broker.channels, s.channels, channel)
+	}
+	return s.subscriptions()
+}
+
+// PSubscribe subscribes to the channels that match the glob patterns and
+// returns the number of subscriptions.
+func (s *Subscriber) PSubscribe(patterns ...string) int {
+	s.broker.mutex.Lock()
+	defer s.broker.mutex.Unlock()
+
+	for _, pattern := range patterns {
+		add(s, s.broker.patterns, s.patterns, pattern)
+	}
+	return s.subscriptions()
+}
+
+// Watch subscribes to the events of the keys with the prefixes in the
+// keyspace with the index and returns the number of subscriptions.
+func (s *Subscriber) Watch(keyspace int, prefixes ...string) int {
+	s.broker.mutex.Lock()
+	defer s.broker.mutex.Unlock()
+
+	for _, prefix := range prefixes {
+		add(s, s.broker.watches, s.watches, watch{keyspace: keyspace, prefix: prefix})
+	}
+	return s.subscriptions()
+}
+
+// Unsubscribe removes the subscriptions to the channels, or to all channels
+// without names, and returns the number of the remaining subscriptions.
+func (s *Subscriber) Unsubscribe(channels ...string) int {
+	s.broker.mutex.Lock()
+	defer s.broker.mutex.Unlock()
+
+	unsubscribe(s, s.broker.channels, s.channels, channels)
+	return s.subscriptions()
+}
+
+// PUnsubscribe removes the subscriptions to the patterns, or to all patterns
+// without names, and returns the number of the remaining subscriptions.
+func (s *Subscriber) PUnsubscribe(patterns ...string) int {
+	s.broker.mutex.Lock()
+	defer s.broker.mutex.Unlock()
+
+	unsubscribe(s, s.broker.patterns, s.patterns, patterns)
+	return s.subscriptions()
+}
+
+// Unwatch removes the subscriptions to the events of the keys with the
+// prefixes in the keyspace with the index, or all watched prefixes without
+// prefixes, and returns the number of the remaining subscriptions.
+func (s *Subscriber) Unwatch(keyspace int, prefixes ...string) int {
+	s.broker.mutex.Lock()
+	defer s.broker.mutex.Unlock()
+
+	var watches []watch
+	for _, prefix := range prefixes {
+		watches = append(watches, watch{keyspace: keyspace, prefix: prefix})
+	}
+	unsubscribe(s, s.broker.watches, s.watches, watches)
+	return s.subscriptions()
+}
+
+// Close removes all subscriptions and closes the messages channel.
+func (s *Subscriber) Close() {
+	s.broker.mutex.Lock()
+	defer s.broker.mutex.Unlock()
+
+	unsubscribe(s, s.broker.channels, s.channels, nil)
+	unsubscribe(s, s.broker.patterns, s.patterns, nil)
+	unsubscribe(s, s.broker.watches, s.watches, nil)
+	if !s.dropped {
+		s.dropped = true
+		close(s.messages)
+	}
+}
+
+func (s *Subscriber) subscriptions() int {
+	return len(s.channels) + len(s.patterns) + len(s.watches)
+}
+
+func add[K comparable](s *Subscriber, index map[K]subscribers, own map[K]struct{}, name K) {
+	own[name] = struct{}{}
+	if index[name] == nil {
+		index[name] = make(subscribers)
+	}
+	index[name][s] = struct{}{}
+}
+
+// unsubscribe removes the subscriptions with the names, or all of them
+// without names.
+func unsubscribe[K comparable](s *Subscriber, index map[K]subscribers, own map[K]struct{}, names []K) {
+	if len(names) == 0 {
+		for name := range own {
+			remove(s, index, own, name)
+		}
+		return
+	}
+
+	for _, name := range names {
+		if _, ok := own[name]; ok {
+			remove(s, index, own, name)
+		}
+	}
+}
+
+func remove[K comparable](s *Subscriber, index map[K]subscribers, own map[K]struct{}, name K) {
+	delete(own, name)
+	delete(index[name], s)
+	if len(index[name]) == 0 {
+		delete(index, name)
+	}
+}
+
+// deliver sends the message without waiting and drops the subscriber if its
+// buffer is full. It is called with the mutex of the broker locked.
+func (s *Subscriber) deliver(message string) bool {
+	if s.dropped {
+		return false
+	}
+
+	select {
+	case s.messages <- []byte(message):
+		return true
+	default:
+		s.dropped = true
+		close(s.messages)
+		return false
+	}
+}
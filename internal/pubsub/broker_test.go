@@ -0,0 +1,147 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBroker(t *testing.T) {
+	t.Parallel()
+
+	broker, err := NewBroker(WithBufferSize(0))
+	require.Error(t, err)
+	require.Nil(t, broker)
+
+	broker, err = NewBroker()
+	require.NoError(t, err)
+	require.Equal(t, defaultBufferSize, broker.bufferSize)
+}
+
+func TestBroker_Publish(t *testing.T) {
+	t.Parallel()
+
+	broker, err := NewBroker()
+	require.NoError(t, err)
+
+	first := broker.NewSubscriber()
+	defer first.Close()
+	second := broker.NewSubscriber()
+	defer second.Close()
+
+	require.Equal(t, 0, broker.Publish("news", "hello"))
+
+	require.Equal(t, 2, first.Subscribe("news", "sport"))
+	require.Equal(t, 2, first.Subscribe("news"))
+	require.Equal(t, 1, second.PSubscribe("new*"))
+
+	require.Equal(t, 2, broker.Publish("news", "hello"))
+	require.Equal(t, "[message] news hello", string(<-first.Messages()))
+	require.Equal(t, "[pmessage] new* news hello", string(<-second.Messages()))
+
+	require.Equal(t, 1, broker.Publish("newspaper", "paper"))
+	require.Equal(t, "[pmessage] new* newspaper paper", string(<-second.Messages()))
+
+	require.Equal(t, 1, first.Unsubscribe("news", "unknown"))
+	// A pattern is removed only by PUnsubscribe.
+	require.Equal(t, 1, second.Unsubscribe("new*"))
+	require.Equal(t, 1, second.Unsubscribe())
+	require.Equal(t, 0, second.PUnsubscribe("new*"))
+	require.Equal(t, 0, broker.Publish("news", "hello"))
+	require.Equal(t, 1, broker.Publish("sport", "goal"))
+	require.Equal(t, "[message] sport goal", string(<-first.Messages()))
+
+	require.Equal(t, 2, second.Subscribe("news", "sport"))
+	require.Equal(t, 3, second.PSubscribe("new*"))
+	require.Equal(t, 1, second.Unsubscribe())
+	require.Equal(t, 0, second.PUnsubscribe())
+	require.Empty(t, broker.channels["news"])
+	require.Len(t, broker.channels["sport"], 1)
+	require.Empty(t, broker.patterns)
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	broker, err := NewBroker(WithBufferSize(2))
+	require.NoError(t, err)
+
+	slow := broker.NewSubscriber()
+	defer slow.Close()
+	fast := broker.NewSubscriber()
+	defer fast.Close()
+	slow.Subscribe("news")
+	fast.Subscribe("news")
+
+	for idx := 0; idx < 2; idx++ {
+		require.Equal(t, 2, broker.Publish("news", "hello"))
+		require.Equal(t, "[message] news hello", string(<-fast.Messages()))
+	}
+
+	// The buffer of the slow subscriber is full, so it is dropped after the
+	// messages that it has got.
+	require.Equal(t, 1, broker.Publish("news", "hello"))
+	require.Equal(t, 1, broker.Publish("news", "hello"))
+	for idx := 0; idx < 2; idx++ {
+		message, ok := <-slow.Messages()
+		require.True(t, ok)
+		require.Equal(t, "[message] news hello", string(message))
+	}
+	_, ok := <-slow.Messages()
+	require.False(t, ok)
+}
+
+func TestSubscriber_Close(t *testing.T) {
+	t.Parallel()
+
+	broker, err := NewBroker()
+	require.NoError(t, err)
+
+	subscriber := broker.NewSubscriber()
+	subscriber.Subscribe("news")
+	subscriber.PSubscribe("*")
+	subscriber.Close()
+	subscriber.Close()
+
+	_, ok := <-subscriber.Messages()
+	require.False(t, ok)
+	require.Equal(t, 0, broker.Publish("news", "hello"))
+	require.Empty(t, broker.channels)
+	require.Empty(t, broker.patterns)
+}
+
+func TestBroker_PublishEvent(t *testing.T) {
+	t.Parallel()
+
+	broker, err := NewBroker()
+	require.NoError(t, err)
+
+	first := broker.NewSubscriber()
+	defer first.Close()
+	second := broker.NewSubscriber()
+	defer second.Close()
+
+	require.Equal(t, 0, broker.PublishEvent(0, "set", "user.1", "alice"))
+
+	require.Equal(t, 2, first.Watch(0, "user.", "user.1"))
+	require.Equal(t, 3, first.Subscribe("news"))
+	require.Equal(t, 1, second.Watch(1, ""))
+
+	require.Equal(t, 1, broker.PublishEvent(0, "set", "user.1", "alice"))
+	require.Equal(t, "[event] set user.1 alice", string(<-first.Messages()))
+	require.Equal(t, 0, broker.PublishEvent(0, "del", "order.1", ""))
+	require.Equal(t, 1, broker.PublishEvent(1, "del", "order.1", ""))
+	require.Equal(t, "[event] del order.1", string(<-second.Messages()))
+	require.Equal(t, 1, broker.PublishEvent(0, "flush", "", ""))
+	require.Equal(t, "[event] flush", string(<-first.Messages()))
+
+	// A watched prefix is removed only by Unwatch in its keyspace.
+	require.Equal(t, 3, first.Unsubscribe("user."))
+	require.Equal(t, 3, first.Unwatch(1, "user."))
+	require.Equal(t, 2, first.Unwatch(0, "user."))
+	require.Equal(t, 0, broker.PublishEvent(0, "set", "user.2", "bob"))
+	require.Equal(t, 1, first.Unwatch(0))
+	require.Equal(t, 0, first.Unsubscribe())
+	require.Equal(t, 0, second.Unwatch(1, ""))
+	require.Empty(t, broker.watches)
+}
@@ -0,0 +1,44 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// PrimaryStorage is a keyspace of a primary, which keeps its last mutations
+// for replicas.
+type PrimaryStorage interface {
+	ReplicationOffset() (string, uint64)
+}
+
+// Primary reports the replication state of a server that replicas connect
+// to. Replicas read the changes of its keyspaces by REPLSYNC.
+type Primary struct {
+	storages []PrimaryStorage
+}
+
+func NewPrimary(storages []PrimaryStorage) (*Primary, error) {
+	if len(storages) == 0 {
+		return nil, errors.New("primary storages are invalid")
+	}
+
+	for _, keyspace := range storages {
+		if keyspace == nil {
+			return nil, errors.New("primary storages are invalid")
+		}
+	}
+
+	return &Primary{storages: storages}, nil
+}
+
+// Info reports the offset of the last mutation of every keyspace.
+func (p *Primary) Info(context.Context) map[string]string {
+	info := map[string]string{"role": "primary"}
+	for idx, keyspace := range p.storages {
+		_, offset := keyspace.ReplicationOffset()
+		info[fmt.Sprintf("db%d_offset", idx)] = strconv.FormatUint(offset, 10)
+	}
+	return info
+}
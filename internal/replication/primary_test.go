@@ -0,0 +1,34 @@
+package replication
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type offsetStorage uint64
+
+func (s offsetStorage) ReplicationOffset() (string, uint64) {
+	return "id", uint64(s)
+}
+
+func TestNewPrimary(t *testing.T) {
+	t.Parallel()
+
+	primary, err := NewPrimary(nil)
+	require.Error(t, err)
+	require.Nil(t, primary)
+
+	primary, err = NewPrimary([]PrimaryStorage{offsetStorage(1), nil})
+	require.Error(t, err)
+	require.Nil(t, primary)
+
+	primary, err = NewPrimary([]PrimaryStorage{offsetStorage(1), offsetStorage(5)})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"role":       "primary",
+		"db0_offset": "1",
+		"db1_offset": "5",
+	}, primary.Info(context.Background()))
+}
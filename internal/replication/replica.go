@@ -0,0 +1,300 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kv_db/internal/database"
+	"kv_db/internal/database/storage"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/internal/network"
+	"kv_db/pkg/dlog"
+)
+
+const (
+	defaultRetryInterval = time.Second
+
+	// idleTimeout is much longer than the time the primary waits for changes,
+	// so a REPLSYNC without changes doesn't time out.
+	idleTimeout = 10 * time.Second
+
+	// unknownID asks the primary for a snapshot, because it never equals the
+	// ID of a primary start.
+	unknownID = "?"
+
+	// maxSyncLineSize is the longest line of a REPLSYNC response, which keeps
+	// a log of a whole collection.
+	maxSyncLineSize = 64 << 20
+)
+
+// Storage is a keyspace of a replica, which applies the changes of the
+// keyspace of the primary with the same index.
+type Storage interface {
+	ApplyChanges(context.Context, storage.Changes) error
+}
+
+type linkState int
+
+// States of a link are ordered from the worst to the best one.
+const (
+	connectingState linkState = iota
+	syncingState
+	connectedState
+)
+
+func (s linkState) String() string {
+	return [...]string{"connecting", "syncing", "connected"}[s]
+}
+
+// link replicates a single keyspace over its own connection, because a
+// REPLSYNC of a keyspace holds the connection until there are changes.
+type link struct {
+	index   int
+	storage Storage
+
+	mutex       sync.Mutex
+	state       linkState
+	id          string
+	offset      uint64
+	head        uint64
+	lastContact time.Time
+}
+
+type ReplicaOption func(*Replica)
+
+// WithRetryInterval sets the pause before a reconnection to the primary.
+func WithRetryInterval(interval time.Duration) ReplicaOption {
+	return func(replica *Replica) {
+		replica.retryInterval = interval
+	}
+}
+
+// Replica keeps its keyspaces in sync with the keyspaces of a primary. It
+// gets a snapshot of a keyspace first and then the mutations that follow it.
+// After a reconnection it continues from the last applied mutation if the
+// primary still has it in the backlog.
+type Replica struct {
+	masterAddress string
+	links         []*link
+	retryInterval time.Duration
+	logger        *slog.Logger
+}
+
+func NewReplica(
+	masterAddress string, storages []Storage, logger *slog.Logger, options ...ReplicaOption,
+) (*Replica, error) {
+	if masterAddress == "" {
+		return nil, errors.New("replica master address is invalid")
+	}
+
+	if len(storages) == 0 {
+		return nil, errors.New("replica storages are invalid")
+	}
+
+	if logger == nil {
+		return nil, errors.New("replica logger is invalid")
+	}
+
+	replica := &Replica{
+		masterAddress: masterAddress,
+		links:         make([]*link, 0, len(storages)),
+		retryInterval: defaultRetryInterval,
+		logger:        logger,
+	}
+	for idx, keyspace := range storages {
+		if keyspace == nil {
+			return nil, errors.New("replica storages are invalid")
+		}
+		replica.links = append(replica.links, &link{index: idx, storage: keyspace, id: unknownID})
+	}
+	for _, option := range options {
+		option(replica)
+	}
+
+	if replica.retryInterval <= 0 {
+		return nil, errors.New("replica retry interval is invalid")
+	}
+
+	return replica, nil
+}
+
+// Start replicates all keyspaces until the context is done.
+func (r *Replica) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for _, keyspace := range r.links {
+		keyspace := keyspace
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.replicate(ctx, keyspace)
+		}()
+	}
+}
+
+// replicate reconnects to the primary until the context is done.
+func (r *Replica) replicate(ctx context.Context, keyspace *link) {
+	logger := r.logger.With(slog.Int("db", keyspace.index))
+	for {
+		err := r.sync(ctx, keyspace)
+		keyspace.setState(connectingState)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("replication link is broken", dlog.ErrAttr(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.retryInterval):
+		}
+	}
+}
+
+// sync applies the changes of the keyspace until the connection fails.
+func (r *Replica) sync(ctx context.Context, keyspace *link) error {
+	client, err := network.NewTCPClient(r.masterAddress, idleTimeout, network.WithMaxResponseSize(maxSyncLineSize))
+	if err != nil {
+		return err
+	}
+	// The connection is closed on the shutdown, so a waiting REPLSYNC
+	// returns at once.
+	stop := context.AfterFunc(ctx, func() {
+		_ = client.Close()
+	})
+	defer func() {
+		if stop() {
+			_ = client.Close()
+		}
+	}()
+
+	response, err := client.Send([]byte(fmt.Sprintf("%s %d\n", database.SelectCommand, keyspace.index)))
+	if err != nil {
+		return err
+	}
+	if string(response) != "[ok]" {
+		return fmt.Errorf("failed to select database: %s", response)
+	}
+	keyspace.setState(syncingState)
+
+	for {
+		id, offset := keyspace.position()
+		response, err := client.Send([]byte(fmt.Sprintf("%s %s %d\n", database.ReplSyncCommand, id, offset)))
+		if err != nil {
+			return err
+		}
+
+		changes, err := parseChanges(string(response))
+		if err != nil {
+			return err
+		}
+		if err := keyspace.storage.ApplyChanges(ctx, changes); err != nil {
+			// A partially applied change can be fixed only by a snapshot.
+			keyspace.reset()
+			return fmt.Errorf("failed to apply changes: %w", err)
+		}
+		keyspace.update(changes)
+	}
+}
+
+// parseChanges parses a REPLSYNC response, which is "[ok] kind id offset head"
+// followed by a line per log.
+func parseChanges(response string) (storage.Changes, error) {
+	lines := strings.Split(response, "\n")
+	fields := strings.Fields(lines[0])
+	if len(fields) != 5 || fields[0] != "[ok]" {
+		return storage.Changes{}, fmt.Errorf("unexpected response: %s", lines[0])
+	}
+
+	changes := storage.Changes{ID: fields[2], Snapshot: fields[1] == database.ReplSyncSnapshot}
+	if !changes.Snapshot && fields[1] != database.ReplSyncLogs {
+		return storage.Changes{}, fmt.Errorf("unexpected response: %s", lines[0])
+	}
+
+	var err error
+	if changes.Offset, err = strconv.ParseUint(fields[3], 10, 64); err != nil {
+		return storage.Changes{}, fmt.Errorf("invalid offset: %w", err)
+	}
+	if changes.Head, err = strconv.ParseUint(fields[4], 10, 64); err != nil {
+		return storage.Changes{}, fmt.Errorf("invalid head: %w", err)
+	}
+
+	changes.Logs = make([]wal.Log, len(lines)-1)
+	for idx, line := range lines[1:] {
+		if err := changes.Logs[idx].UnmarshalText([]byte(line)); err != nil {
+			return storage.Changes{}, err
+		}
+	}
+	return changes, nil
+}
+
+// Info reports the worst state of the keyspaces, the number of mutations the
+// replica lags behind and the milliseconds since the oldest last contact with
+// the primary, which is -1 if a keyspace has never been synced.
+func (r *Replica) Info(context.Context) map[string]string {
+	state := connectedState
+	lag := uint64(0)
+	var lastContact time.Time
+	synced := true
+	for _, keyspace := range r.links {
+		keyspace.mutex.Lock()
+		state = min(state, keyspace.state)
+		lag += keyspace.head - keyspace.offset
+		if keyspace.lastContact.IsZero() {
+			synced = false
+		} else if lastContact.IsZero() || keyspace.lastContact.Before(lastContact) {
+			lastContact = keyspace.lastContact
+		}
+		keyspace.mutex.Unlock()
+	}
+
+	lastContactMS := int64(-1)
+	if synced {
+		lastContactMS = time.Since(lastContact).Milliseconds()
+	}
+
+	return map[string]string{
+		"role":            "replica",
+		"master_address":  r.masterAddress,
+		"state":           state.String(),
+		"lag":             strconv.FormatUint(lag, 10),
+		"last_contact_ms": strconv.FormatInt(lastContactMS, 10),
+	}
+}
+
+func (l *link) setState(state linkState) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.state = state
+}
+
+func (l *link) position() (string, uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.id, l.offset
+}
+
+func (l *link) update(changes storage.Changes) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.state = connectedState
+	l.id, l.offset, l.head = changes.ID, changes.Offset, changes.Head
+	l.lastContact = time.Now()
+}
+
+func (l *link) reset() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.id, l.offset, l.head = unknownID, 0, 0
+}
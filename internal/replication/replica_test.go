@@ -0,0 +1,156 @@
+package replication
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"kv_db/internal/database/storage"
+	"kv_db/internal/database/storage/wal"
+	"kv_db/internal/network"
+	"kv_db/pkg/dlog"
+)
+
+type storageFunc func(context.Context, storage.Changes) error
+
+func (f storageFunc) ApplyChanges(ctx context.Context, changes storage.Changes) error {
+	return f(ctx, changes)
+}
+
+func TestNewReplica(t *testing.T) {
+	t.Parallel()
+
+	keyspace := storageFunc(func(context.Context, storage.Changes) error { return nil })
+	tests := map[string]struct {
+		address  string
+		storages []Storage
+		options  []ReplicaOption
+		expErr   bool
+	}{
+		"empty address": {storages: []Storage{keyspace}, expErr: true},
+		"no storages":   {address: "localhost:3223", expErr: true},
+		"nil storage":   {address: "localhost:3223", storages: []Storage{keyspace, nil}, expErr: true},
+		"invalid retry interval": {
+			address:  "localhost:3223",
+			storages: []Storage{keyspace},
+			options:  []ReplicaOption{WithRetryInterval(0)},
+			expErr:   true,
+		},
+		"success": {address: "localhost:3223", storages: []Storage{keyspace, keyspace}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			replica, err := NewReplica(test.address, test.storages, dlog.NewNonSlog(), test.options...)
+			if test.expErr {
+				require.Error(t, err)
+				require.Nil(t, replica)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, replica.links, len(test.storages))
+		})
+	}
+
+	replica, err := NewReplica("localhost:3223", []Storage{keyspace}, nil)
+	require.Error(t, err)
+	require.Nil(t, replica)
+}
+
+func TestParseChanges(t *testing.T) {
+	t.Parallel()
+
+	log := wal.NewLog(0, wal.SetOp, "key", "value")
+	text, err := log.MarshalText()
+	require.NoError(t, err)
+
+	changes, err := parseChanges("[ok] logs id 6 7\n" + string(text))
+	require.NoError(t, err)
+	require.Equal(t, storage.Changes{ID: "id", Offset: 6, Head: 7, Logs: []wal.Log{log}}, changes)
+
+	changes, err = parseChanges("[ok] snapshot id 7 7")
+	require.NoError(t, err)
+	require.Equal(t, storage.Changes{ID: "id", Offset: 7, Head: 7, Snapshot: true, Logs: []wal.Log{}}, changes)
+
+	for _, response := range []string{
+		"[error] replication backlog is disabled",
+		"[ok] other id 7 7",
+		"[ok] logs id x 7",
+		"[ok] logs id 7 x",
+		"[ok] logs id 6 7\nnot a log",
+	} {
+		_, err = parseChanges(response)
+		require.Error(t, err, response)
+	}
+}
+
+func TestReplica(t *testing.T) {
+	t.Parallel()
+
+	// The primary sends a snapshot first and then waits for a REPLSYNC that
+	// continues from it.
+	server, err := network.NewTCPServer("localhost:20028", 10, time.Minute, dlog.NewNonSlog())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests := make(chan string, 10)
+	go func() {
+		_ = server.HandleQueries(ctx, func(ctx context.Context, request []byte) []byte {
+			requests <- string(request)
+			switch {
+			case strings.HasPrefix(string(request), "SELECT"):
+				return []byte("[ok]")
+			case string(request) == "REPLSYNC ? 0":
+				return []byte("[ok] snapshot id 3 5")
+			}
+			<-ctx.Done()
+			return []byte("[error] closed")
+		})
+	}()
+
+	applied := make(chan storage.Changes, 1)
+	keyspace := storageFunc(func(_ context.Context, changes storage.Changes) error {
+		applied <- changes
+		return nil
+	})
+	replica, err := NewReplica(
+		"localhost:20028", []Storage{keyspace}, dlog.NewNonSlog(), WithRetryInterval(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"role":            "replica",
+		"master_address":  "localhost:20028",
+		"state":           "connecting",
+		"lag":             "0",
+		"last_contact_ms": "-1",
+	}, replica.Info(ctx))
+
+	replicaCtx, stopReplica := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		replica.Start(replicaCtx)
+	}()
+
+	require.Equal(t, "SELECT 0", <-requests)
+	require.Equal(t, "REPLSYNC ? 0", <-requests)
+	require.Equal(t, storage.Changes{ID: "id", Offset: 3, Head: 5, Snapshot: true, Logs: []wal.Log{}}, <-applied)
+	require.Equal(t, "REPLSYNC id 3", <-requests)
+
+	info := replica.Info(ctx)
+	require.Equal(t, "connected", info["state"])
+	require.Equal(t, "2", info["lag"])
+	require.NotEqual(t, "-1", info["last_contact_ms"])
+
+	// The shutdown doesn't wait for the response of the primary.
+	stopReplica()
+	<-done
+	require.Equal(t, "connecting", replica.Info(ctx)["state"])
+}
@@ -0,0 +1,115 @@
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SlotsCount is the number of hash slots that keys are mapped to.
+const SlotsCount = 16384
+
+// Slot returns the hash slot of the key, which is CRC16 of the key modulo
+// the number of slots.
+func Slot(key string) int {
+	crc := uint16(0)
+	for idx := 0; idx < len(key); idx++ {
+		crc ^= uint16(key[idx]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return int(crc) % SlotsCount
+}
+
+// Range is a range of slots from Start to End inclusive that a node with the
+// address owns.
+type Range struct {
+	Start   int
+	End     int
+	Address string
+}
+
+// ParseRange parses a range of slots like "0-8191" or a single slot.
+func ParseRange(text, address string) (Range, error) {
+	startText, endText, ok := strings.Cut(text, "-")
+	if !ok {
+		endText = startText
+	}
+
+	start, err := strconv.Atoi(startText)
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid slots %q: %w", text, err)
+	}
+	end, err := strconv.Atoi(endText)
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid slots %q: %w", text, err)
+	}
+	return Range{Start: start, End: end, Address: address}, nil
+}
+
+func (r Range) String() string {
+	return fmt.Sprintf("%d-%d %s", r.Start, r.End, r.Address)
+}
+
+// Map is the owners of all slots, one of which is this node.
+type Map struct {
+	address string
+	ranges  []Range
+	owners  []string
+}
+
+// NewMap creates the map of the ranges, which must cover every slot exactly
+// once. The address is the address of this node in the ranges.
+func NewMap(address string, ranges []Range) (*Map, error) {
+	if address == "" {
+		return nil, errors.New("sharding address is invalid")
+	}
+
+	slots := &Map{
+		address: address,
+		ranges:  ranges,
+		owners:  make([]string, SlotsCount),
+	}
+	for _, slotRange := range ranges {
+		if slotRange.Start < 0 || slotRange.End >= SlotsCount || slotRange.Start > slotRange.End {
+			return nil, fmt.Errorf("sharding slots %d-%d are invalid", slotRange.Start, slotRange.End)
+		}
+		if slotRange.Address == "" {
+			return nil, fmt.Errorf("sharding address of slots %d-%d is invalid", slotRange.Start, slotRange.End)
+		}
+
+		for slot := slotRange.Start; slot <= slotRange.End; slot++ {
+			if slots.owners[slot] != "" {
+				return nil, fmt.Errorf("sharding slot %d has several owners", slot)
+			}
+			slots.owners[slot] = slotRange.Address
+		}
+	}
+
+	for slot, owner := range slots.owners {
+		if owner == "" {
+			return nil, fmt.Errorf("sharding slot %d has no owner", slot)
+		}
+	}
+	return slots, nil
+}
+
+// Owner returns the slot of the key and the address of the node that owns
+// it, which is empty if this node owns it.
+func (m *Map) Owner(key string) (int, string) {
+	slot := Slot(key)
+	if owner := m.owners[slot]; owner != m.address {
+		return slot, owner
+	}
+	return slot, ""
+}
+
+func (m *Map) Ranges() []Range {
+	return m.ranges
+}
@@ -0,0 +1,118 @@
+package sharding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlot(t *testing.T) {
+	t.Parallel()
+
+	// 0x31C3 is the check value of CRC16/XMODEM.
+	require.Equal(t, 0x31C3, Slot("123456789"))
+	require.Equal(t, 0, Slot(""))
+	require.Less(t, Slot("key"), SlotsCount)
+}
+
+func TestParseRange(t *testing.T) {
+	t.Parallel()
+
+	slotRange, err := ParseRange("0-8191", "localhost:3223")
+	require.NoError(t, err)
+	require.Equal(t, Range{Start: 0, End: 8191, Address: "localhost:3223"}, slotRange)
+	require.Equal(t, "0-8191 localhost:3223", slotRange.String())
+
+	slotRange, err = ParseRange("42", "localhost:3223")
+	require.NoError(t, err)
+	require.Equal(t, Range{Start: 42, End: 42, Address: "localhost:3223"}, slotRange)
+
+	for _, text := range []string{"", "a-1", "1-b", "1-2-3"} {
+		_, err = ParseRange(text, "localhost:3223")
+		require.Error(t, err, text)
+	}
+}
+
+func TestNewMap(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		address string
+		ranges  []Range
+		expErr  bool
+	}{
+		"empty address": {
+			ranges: []Range{{Start: 0, End: SlotsCount - 1, Address: "localhost:3223"}},
+			expErr: true,
+		},
+		"uncovered slots": {
+			address: "localhost:3223",
+			ranges:  []Range{{Start: 0, End: 100, Address: "localhost:3223"}},
+			expErr:  true,
+		},
+		"overlapped slots": {
+			address: "localhost:3223",
+			ranges: []Range{
+				{Start: 0, End: 100, Address: "localhost:3223"},
+				{Start: 100, End: SlotsCount - 1, Address: "localhost:3224"},
+			},
+			expErr: true,
+		},
+		"slots out of range": {
+			address: "localhost:3223",
+			ranges:  []Range{{Start: 0, End: SlotsCount, Address: "localhost:3223"}},
+			expErr:  true,
+		},
+		"reversed slots": {
+			address: "localhost:3223",
+			ranges:  []Range{{Start: 1, End: 0, Address: "localhost:3223"}},
+			expErr:  true,
+		},
+		"range without address": {
+			address: "localhost:3223",
+			ranges:  []Range{{Start: 0, End: SlotsCount - 1}},
+			expErr:  true,
+		},
+		"success": {
+			address: "localhost:3223",
+			ranges: []Range{
+				{Start: 0, End: 100, Address: "localhost:3223"},
+				{Start: 101, End: SlotsCount - 1, Address: "localhost:3224"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			slots, err := NewMap(test.address, test.ranges)
+			if test.expErr {
+				require.Error(t, err)
+				require.Nil(t, slots)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.ranges, slots.Ranges())
+		})
+	}
+}
+
+func TestMap_Owner(t *testing.T) {
+	t.Parallel()
+
+	slots, err := NewMap("localhost:3223", []Range{
+		{Start: 0, End: 12738, Address: "localhost:3223"},
+		{Start: 12739, End: SlotsCount - 1, Address: "localhost:3224"},
+	})
+	require.NoError(t, err)
+
+	slot, owner := slots.Owner("")
+	require.Equal(t, 0, slot)
+	require.Empty(t, owner)
+
+	slot, owner = slots.Owner("123456789")
+	require.Equal(t, 12739, slot)
+	require.Equal(t, "localhost:3224", owner)
+}
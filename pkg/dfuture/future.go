@@ -0,0 +1,37 @@
+package dfuture
+
+import "sync"
+
+type Future[T any] struct {
+	done  chan struct{}
+	once  sync.Once
+	value T
+}
+
+func NewFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+func NewResolvedFuture[T any](value T) *Future[T] {
+	future := NewFuture[T]()
+	future.Resolve(value)
+	return future
+}
+
+// Resolve sets the value and wakes up all waiters. Only the first call has
+// an effect.
+func (f *Future[T]) Resolve(value T) {
+	f.once.Do(func() {
+		f.value = value
+		close(f.done)
+	})
+}
+
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *Future[T]) Get() T {
+	<-f.done
+	return f.value
+}
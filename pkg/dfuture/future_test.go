@@ -0,0 +1,51 @@
+package dfuture
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuture(t *testing.T) {
+	t.Parallel()
+
+	future := NewFuture[int]()
+
+	select {
+	case <-future.Done():
+		require.Fail(t, "future is resolved before resolve")
+	default:
+	}
+
+	waiters := 10
+	results := make(chan int, waiters)
+	var wg sync.WaitGroup
+	wg.Add(waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			defer wg.Done()
+			results <- future.Get()
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	future.Resolve(42)
+	future.Resolve(24)
+	wg.Wait()
+	close(results)
+
+	for result := range results {
+		require.Equal(t, 42, result)
+	}
+}
+
+func TestResolvedFuture(t *testing.T) {
+	t.Parallel()
+
+	future := NewResolvedFuture("value")
+
+	<-future.Done()
+	require.Equal(t, "value", future.Get())
+}
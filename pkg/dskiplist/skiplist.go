@@ -0,0 +1,185 @@
+package dskiplist
+
+import "cmp"
+
+const (
+	maxLevel = 32
+	// levelBits gives each node a 1/4 chance to be promoted to the next level.
+	levelBits = 2
+)
+
+type node[K, V any] struct {
+	key   K
+	value V
+	next  []*node[K, V]
+	// span is the number of nodes that a link of next skips, including the
+	// node it points to, so ranks are counted while the list is searched.
+	span []int
+}
+
+// path is the last node before a key on every level and its rank, where the
+// rank of the head is zero.
+type path[K, V any] struct {
+	nodes [maxLevel]*node[K, V]
+	ranks [maxLevel]int
+}
+
+// SkipList keeps keys ordered by the less function. It isn't safe for
+// concurrent use.
+type SkipList[K, V any] struct {
+	head   *node[K, V]
+	level  int
+	length int
+	less   func(a, b K) bool
+	seed   uint64
+}
+
+func New[K, V any](less func(a, b K) bool) *SkipList[K, V] {
+	return &SkipList[K, V]{
+		head:  &node[K, V]{next: make([]*node[K, V], maxLevel), span: make([]int, maxLevel)},
+		level: 1,
+		less:  less,
+		seed:  1,
+	}
+}
+
+func NewOrdered[K cmp.Ordered, V any]() *SkipList[K, V] {
+	return New[K, V](cmp.Less[K])
+}
+
+func (s *SkipList[K, V]) Len() int {
+	return s.length
+}
+
+func (s *SkipList[K, V]) Get(key K) (V, bool) {
+	if n := s.seek(key, nil); n != nil && !s.less(key, n.key) {
+		return n.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set inserts the key or replaces its value.
+func (s *SkipList[K, V]) Set(key K, value V) {
+	var update path[K, V]
+	if n := s.seek(key, &update); n != nil && !s.less(key, n.key) {
+		n.value = value
+		return
+	}
+
+	level := s.randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update.nodes[i] = s.head
+			update.ranks[i] = 0
+			s.head.span[i] = s.length
+		}
+		s.level = level
+	}
+
+	n := &node[K, V]{key: key, value: value, next: make([]*node[K, V], level), span: make([]int, level)}
+	for i := 0; i < level; i++ {
+		prev := update.nodes[i]
+		skipped := update.ranks[0] - update.ranks[i]
+		n.next[i], prev.next[i] = prev.next[i], n
+		n.span[i], prev.span[i] = prev.span[i]-skipped, skipped+1
+	}
+	for i := level; i < s.level; i++ {
+		update.nodes[i].span[i]++
+	}
+	s.length++
+}
+
+// Delete returns false if there is no such key.
+func (s *SkipList[K, V]) Delete(key K) bool {
+	var update path[K, V]
+	n := s.seek(key, &update)
+	if n == nil || s.less(key, n.key) {
+		return false
+	}
+
+	for i := 0; i < s.level; i++ {
+		prev := update.nodes[i]
+		if prev.next[i] == n {
+			prev.next[i] = n.next[i]
+			prev.span[i] += n.span[i] - 1
+		} else {
+			prev.span[i]--
+		}
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.length--
+	return true
+}
+
+// Rank returns the zero-based position of the key in the list.
+func (s *SkipList[K, V]) Rank(key K) (int, bool) {
+	var update path[K, V]
+	if n := s.seek(key, &update); n != nil && !s.less(key, n.key) {
+		return update.ranks[0], true
+	}
+	return 0, false
+}
+
+// Ascend calls yield for keys that are greater than or equal to from in
+// ascending order until yield returns false.
+func (s *SkipList[K, V]) Ascend(from K, yield func(key K, value V) bool) {
+	for n := s.seek(from, nil); n != nil; n = n.next[0] {
+		if !yield(n.key, n.value) {
+			return
+		}
+	}
+}
+
+// AscendAt calls yield for keys starting from the one at the zero-based
+// position in ascending order until yield returns false.
+func (s *SkipList[K, V]) AscendAt(index int, yield func(key K, value V) bool) {
+	if index < 0 || index >= s.length {
+		return
+	}
+
+	current, rank := s.head, 0
+	for i := s.level - 1; i >= 0; i-- {
+		for current.next[i] != nil && rank+current.span[i] <= index+1 {
+			rank += current.span[i]
+			current = current.next[i]
+		}
+	}
+	for n := current; n != nil; n = n.next[0] {
+		if !yield(n.key, n.value) {
+			return
+		}
+	}
+}
+
+// seek returns the first node with a key that is greater than or equal to
+// the given one. If update isn't nil, it receives the path to the key.
+func (s *SkipList[K, V]) seek(key K, update *path[K, V]) *node[K, V] {
+	current, rank := s.head, 0
+	for i := s.level - 1; i >= 0; i-- {
+		for current.next[i] != nil && s.less(current.next[i].key, key) {
+			rank += current.span[i]
+			current = current.next[i]
+		}
+		if update != nil {
+			update.nodes[i], update.ranks[i] = current, rank
+		}
+	}
+	return current.next[0]
+}
+
+// randomLevel uses a xorshift generator, because levels don't need good
+// randomness and a global source would be shared by all lists.
+func (s *SkipList[K, V]) randomLevel() int {
+	s.seed ^= s.seed << 13
+	s.seed ^= s.seed >> 7
+	s.seed ^= s.seed << 17
+
+	level := 1
+	for bits := s.seed; level < maxLevel && bits&(1<<levelBits-1) == 0; bits >>= levelBits {
+		level++
+	}
+	return level
+}
@@ -0,0 +1,132 @@
+package dskiplist
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipList(t *testing.T) {
+	t.Parallel()
+
+	list := NewOrdered[string, int]()
+	_, ok := list.Get("key")
+	require.False(t, ok)
+	require.False(t, list.Delete("key"))
+
+	list.Set("b", 2)
+	list.Set("a", 1)
+	list.Set("c", 3)
+	list.Set("b", 20)
+	require.Equal(t, 3, list.Len())
+
+	value, ok := list.Get("b")
+	require.True(t, ok)
+	require.Equal(t, 20, value)
+
+	require.True(t, list.Delete("a"))
+	require.False(t, list.Delete("a"))
+	require.Equal(t, 2, list.Len())
+
+	var keys []string
+	list.Ascend("", func(key string, _ int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	require.Equal(t, []string{"b", "c"}, keys)
+}
+
+func TestSkipListAscend(t *testing.T) {
+	t.Parallel()
+
+	list := New[int, struct{}](func(a, b int) bool { return a > b })
+	for _, key := range rand.Perm(1000) {
+		list.Set(key, struct{}{})
+	}
+
+	var keys []int
+	list.Ascend(500, func(key int, _ struct{}) bool {
+		keys = append(keys, key)
+		return len(keys) < 3
+	})
+	require.Equal(t, []int{500, 499, 498}, keys)
+}
+
+func TestSkipListRandomOperations(t *testing.T) {
+	t.Parallel()
+
+	list := NewOrdered[string, string]()
+	expected := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(rand.Intn(500))
+		if rand.Intn(3) == 0 {
+			_, ok := expected[key]
+			require.Equal(t, ok, list.Delete(key))
+			delete(expected, key)
+		} else {
+			list.Set(key, strconv.Itoa(i))
+			expected[key] = strconv.Itoa(i)
+		}
+	}
+
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var actual []string
+	list.Ascend("", func(key, value string) bool {
+		require.Equal(t, expected[key], value)
+		actual = append(actual, key)
+		return true
+	})
+	require.Equal(t, keys, actual)
+	require.Equal(t, len(expected), list.Len())
+}
+
+func TestSkipListRank(t *testing.T) {
+	t.Parallel()
+
+	list := NewOrdered[int, struct{}]()
+	expected := make(map[int]struct{})
+	for i := 0; i < 5000; i++ {
+		key := rand.Intn(300)
+		if rand.Intn(3) == 0 {
+			list.Delete(key)
+			delete(expected, key)
+		} else {
+			list.Set(key, struct{}{})
+			expected[key] = struct{}{}
+		}
+	}
+
+	keys := make([]int, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	for index, key := range keys {
+		rank, ok := list.Rank(key)
+		require.True(t, ok)
+		require.Equal(t, index, rank)
+
+		var actual []int
+		list.AscendAt(index, func(key int, _ struct{}) bool {
+			actual = append(actual, key)
+			return len(actual) < 2
+		})
+		require.Equal(t, keys[index:min(index+2, len(keys))], actual)
+	}
+
+	_, ok := list.Rank(-1)
+	require.False(t, ok)
+	list.AscendAt(len(keys), func(int, struct{}) bool {
+		require.Fail(t, "index is out of range")
+		return false
+	})
+}